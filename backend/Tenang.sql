@@ -24,6 +24,7 @@ CREATE TABLE users (
     is_active BOOLEAN DEFAULT true,
     email_verified_at TIMESTAMP,
     last_active_at TIMESTAMP,
+    avatar_key VARCHAR(255), -- Prefiks file avatar di storage; NULL berarti identicon bawaan
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP,
@@ -48,7 +49,7 @@ CREATE TABLE user_preferences (
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     notification_chat BOOLEAN DEFAULT true,
     notification_community BOOLEAN DEFAULT true,
-    notification_schedule JSONB DEFAULT '[]',
+    notification_schedule JSONB DEFAULT '{}',
     community_anonymous_default BOOLEAN DEFAULT false,
     social_media_monitoring BOOLEAN DEFAULT false,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -187,6 +188,7 @@ CREATE TABLE community_categories (
     display_order INTEGER DEFAULT 0,
     is_active BOOLEAN DEFAULT true,
     moderator_required BOOLEAN DEFAULT false,
+    adults_only BOOLEAN DEFAULT false, -- Tidak tampil untuk pengguna di bawah umur
     post_guidelines TEXT,
     icon_name VARCHAR(50),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -287,7 +289,7 @@ CREATE TABLE social_media_posts_monitored (
 CREATE TABLE notifications (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    notification_type VARCHAR(30) NOT NULL CHECK (notification_type IN ('chat_checkin', 'community_reply', 'community_reaction', 'social_media_alert', 'wellness_reminder')),
+    notification_type VARCHAR(30) NOT NULL CHECK (notification_type IN ('chat_checkin', 'community_reply', 'community_reaction', 'social_media_alert', 'wellness_reminder', 'account_update', 'crisis_alert')),
     title VARCHAR(200) NOT NULL,
     message TEXT NOT NULL,
     action_url VARCHAR(500),
@@ -307,7 +309,7 @@ CREATE TABLE notifications (
 CREATE TABLE user_progress_metrics (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    metric_type VARCHAR(30) NOT NULL CHECK (metric_type IN ('wellbeing_trend_vocal', 'chat_engagement', 'community_participation', 'overall_wellness')),
+    metric_type VARCHAR(30) NOT NULL CHECK (metric_type IN ('wellbeing_trend_vocal', 'chat_engagement', 'chat_mood', 'community_participation', 'overall_wellness')),
     metric_value DECIMAL(10,2) NOT NULL,
     metric_date DATE NOT NULL,
     calculation_data JSONB DEFAULT '{}',
@@ -315,9 +317,10 @@ CREATE TABLE user_progress_metrics (
     UNIQUE(user_id, metric_type, metric_date)
 );
 
--- Tabel system_analytics - Analytics penggunaan anonim
+-- Tabel system_analytics - Analytics penggunaan, anonim kecuali tingkat privasi pengguna 'full'
 CREATE TABLE system_analytics (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID,
     event_type VARCHAR(50) NOT NULL,
     event_data JSONB NOT NULL DEFAULT '{}',
     user_segment VARCHAR(30),
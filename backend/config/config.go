@@ -17,6 +17,8 @@ type Config struct {
 	Database    DatabaseConfig
 	JWT         JWTConfig
 	Azure       AzureConfig
+	LLM         LLMConfig
+	Sentiment   SentimentConfig
 	HuggingFace HuggingFaceConfig
 	OAuth       OAuthConfig
 	Google      GoogleOAuthConfig
@@ -30,14 +32,21 @@ type ServerConfig struct {
 	Host        string
 	Environment string
 	CORSOrigins []string
+	FrontendURL string // Basis URL untuk tautan di email (reset password, verifikasi, dll.)
+	PublicURL   string // Basis URL publik API ini, untuk tautan unduhan yang ditandatangani
 }
 
 type JWTConfig struct {
-	AccessSecret  string
+	AccessSecret  string // Hanya untuk memverifikasi token HS256 lama selama masa transisi
 	RefreshSecret string
 	AccessExpiry  time.Duration
 	RefreshExpiry time.Duration
 	EncryptionKey []byte
+
+	// Penandatanganan asimetris dengan rotasi kunci
+	SigningAlgorithm    string        // ES256 atau RS256
+	KeyRotationInterval time.Duration // Seberapa sering kunci penandatangan baru dibuat
+	AcceptLegacyHS256   bool          // Terima token HS256 lama sampai kedaluwarsa
 }
 
 type AzureConfig struct {
@@ -57,6 +66,24 @@ type AzureConfig struct {
 	OpenAIModelVersion   string // Ditambahkan
 }
 
+// LLMConfig memilih penyedia model bahasa: "azure" (kredensial dari AzureConfig),
+// "openai" untuk endpoint yang kompatibel dengan OpenAI (OpenAI, llama.cpp, Ollama),
+// atau "fake" untuk pengembangan offline tanpa memanggil model sungguhan.
+type LLMConfig struct {
+	Provider      string
+	BaseURL       string // Hanya untuk provider "openai"
+	APIKey        string // Hanya untuk provider "openai"; server lokal biasanya tidak memerlukannya
+	DefaultModel  string // Nama deployment untuk Azure
+	FeatureModels map[string]string // Model per fitur dari LLM_MODEL_<FITUR>; kosong berarti DefaultModel
+}
+
+// SentimentConfig memilih penganalisis sentimen & emosi pesan chat: "lexicon" (lokal,
+// bawaan), "llm" (memakai LLM_MODEL_SENTIMENT), atau "azure" (Azure Text Analytics).
+type SentimentConfig struct {
+	Analyzer string
+	Workers  int // Jumlah worker latar belakang yang menganalisis pesan
+}
+
 type HuggingFaceConfig struct {
 	APIKey    string
 	ModelName string
@@ -67,6 +94,7 @@ type GoogleOAuthConfig struct {
 	ClientID     string
 	ClientSecret string
 	RedirectURI  string
+	Issuer       string // Issuer OpenID Connect; bisa diarahkan ke server OIDC lokal untuk pengujian
 }
 
 type OAuthConfig struct {
@@ -97,13 +125,57 @@ type StorageConfig struct {
 	AudioUploadPath   string
 	MaxFileSize       int64 // in bytes
 	AllowedExtensions []string
+	ExportPath        string // Arsip ekspor data pribadi; jangan letakkan di bawah /uploads yang disajikan publik
+	MaxAvatarSize     int64  // in bytes
 }
 
 type SecurityConfig struct {
-	EncryptionKey    []byte
-	RateLimitPerMin  int
-	MaxLoginAttempts int
-	LockoutDuration  time.Duration
+	EncryptionKey       []byte
+	PreviousEncryptionKeys [][]byte // Kunci master lama, hanya untuk membuka data selama rotasi (perintah rotate-data-keys)
+	RateLimitPerMin     int
+	MaxLoginAttempts    int
+	LockoutDuration     time.Duration // Durasi lockout pertama, berlipat ganda tiap lockout berikutnya
+	MaxLockoutDuration  time.Duration
+	PasswordResetExpiry time.Duration
+
+	// Verifikasi email
+	EmailVerificationExpiry    time.Duration
+	VerificationResendCooldown time.Duration
+	VerificationResendDailyMax int
+	RequireVerifiedEmail       bool // Batasi fitur komunitas & sosial sampai email terverifikasi
+
+	// Autentikasi dua faktor (TOTP)
+	MFAChallengeExpiry time.Duration
+
+	// Login tanpa password (magic link)
+	MagicLinkExpiry   time.Duration
+	MagicLinkCooldown time.Duration // Jeda minimum antar email magic link untuk satu akun
+
+	// Sesi dukungan (admin bertindak sebagai pengguna)
+	ImpersonationExpiry time.Duration
+
+	// Ekspor data pribadi (UU PDP)
+	DataExportRetention  time.Duration // Berapa lama arsip disimpan sebelum dihapus
+	DataExportLinkExpiry time.Duration // Masa berlaku tautan unduhan yang ditandatangani
+
+	// Penghapusan akun: data dihapus permanen setelah masa tenggang ini
+	AccountDeletionGracePeriod time.Duration
+
+	// Tingkat privasi "minimal": percakapan chat dihapus otomatis setelah jangka ini
+	MinimalChatRetention time.Duration
+
+	// Batas usia: pendaftaran ditolak di bawah MinimumAge; di bawah MinorSafeAge berlaku mode aman anak
+	MinimumAge   int
+	MinorSafeAge int
+	// Masa berlaku tautan persetujuan orang tua/wali
+	GuardianConsentLinkExpiry time.Duration
+
+	// Kontak tepercaya & eskalasi krisis
+	TrustedContactLinkExpiry time.Duration
+	CrisisEscalationCooldown time.Duration // Jeda minimum antar eskalasi ke kontak untuk satu pengguna
+
+	// Deteksi krisis pada pesan chat: leksikon selalu aktif, tahap model bahasa opsional
+	CrisisModelStage bool
 }
 
 var AppConfig *Config
@@ -117,13 +189,38 @@ func LoadConfig() *Config {
 	// --- Membaca dan Mem-validasi Kunci Enkripsi dengan Benar ---
 	jwtKey := decodeKey("JWT_ENCRYPTION_KEY")
 	securityKey := decodeKey("ENCRYPTION_KEY")
+	previousSecurityKeys := decodeKeyList("ENCRYPTION_KEY_PREVIOUS")
 
 	// --- Mem-parsing nilai-nilai lain ---
 	accessExpiry, _ := time.ParseDuration(getEnv("JWT_ACCESS_EXPIRY", "15m"))
 	refreshExpiry, _ := time.ParseDuration(getEnv("JWT_REFRESH_EXPIRY", "168h"))
+	keyRotationInterval, _ := time.ParseDuration(getEnv("JWT_KEY_ROTATION_INTERVAL", "720h"))
+	acceptLegacyHS256, _ := strconv.ParseBool(getEnv("JWT_ACCEPT_LEGACY_HS256", "true"))
 	lockoutDuration, _ := time.ParseDuration(getEnv("LOCKOUT_DURATION", "15m"))
+	mfaChallengeExpiry, _ := time.ParseDuration(getEnv("MFA_CHALLENGE_EXPIRY", "5m"))
+	magicLinkExpiry, _ := time.ParseDuration(getEnv("MAGIC_LINK_EXPIRY", "15m"))
+	magicLinkCooldown, _ := time.ParseDuration(getEnv("MAGIC_LINK_COOLDOWN", "60s"))
+	impersonationExpiry, _ := time.ParseDuration(getEnv("IMPERSONATION_TOKEN_EXPIRY", "15m"))
+	dataExportRetention, _ := time.ParseDuration(getEnv("DATA_EXPORT_RETENTION", "168h"))
+	dataExportLinkExpiry, _ := time.ParseDuration(getEnv("DATA_EXPORT_LINK_EXPIRY", "24h"))
+	accountDeletionGracePeriod, _ := time.ParseDuration(getEnv("ACCOUNT_DELETION_GRACE_PERIOD", "720h"))
+	minimalChatRetention, _ := time.ParseDuration(getEnv("PRIVACY_MINIMAL_CHAT_RETENTION", "720h"))
+	minimumAge, _ := strconv.Atoi(getEnv("MINIMUM_AGE", "13"))
+	minorSafeAge, _ := strconv.Atoi(getEnv("MINOR_SAFE_MODE_AGE", "18"))
+	guardianConsentLinkExpiry, _ := time.ParseDuration(getEnv("GUARDIAN_CONSENT_LINK_EXPIRY", "168h"))
+	trustedContactLinkExpiry, _ := time.ParseDuration(getEnv("TRUSTED_CONTACT_LINK_EXPIRY", "168h"))
+	crisisEscalationCooldown, _ := time.ParseDuration(getEnv("CRISIS_ESCALATION_COOLDOWN", "30m"))
+	crisisModelStage, _ := strconv.ParseBool(getEnv("CRISIS_MODEL_STAGE", "false"))
+	sentimentWorkers, _ := strconv.Atoi(getEnv("SENTIMENT_WORKERS", "2"))
+	maxLockoutDuration, _ := time.ParseDuration(getEnv("LOCKOUT_MAX_DURATION", "24h"))
+	passwordResetExpiry, _ := time.ParseDuration(getEnv("PASSWORD_RESET_EXPIRY", "1h"))
+	emailVerificationExpiry, _ := time.ParseDuration(getEnv("EMAIL_VERIFICATION_EXPIRY", "24h"))
+	verificationResendCooldown, _ := time.ParseDuration(getEnv("EMAIL_VERIFICATION_RESEND_COOLDOWN", "60s"))
+	verificationResendDailyMax, _ := strconv.Atoi(getEnv("EMAIL_VERIFICATION_RESEND_DAILY_MAX", "5"))
+	requireVerifiedEmail, _ := strconv.ParseBool(getEnv("REQUIRE_VERIFIED_EMAIL", "false"))
 	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
 	maxFileSize, _ := strconv.ParseInt(getEnv("MAX_FILE_SIZE", "10485760"), 10, 64)
+	maxAvatarSize, _ := strconv.ParseInt(getEnv("MAX_AVATAR_SIZE", "5242880"), 10, 64)
 	rateLimitPerMin, _ := strconv.Atoi(getEnv("RATE_LIMIT_PER_MIN", "60"))
 	maxLoginAttempts, _ := strconv.Atoi(getEnv("MAX_LOGIN_ATTEMPTS", "5"))
 
@@ -133,6 +230,8 @@ func LoadConfig() *Config {
 			Host:        getEnv("HOST", "localhost"),
 			Environment: getEnv("GIN_MODE", "debug"),
 			CORSOrigins: strings.Split(getEnv("CORS_ORIGINS", "http://localhost:3000,http://localhost:8081"), ","),
+			FrontendURL: strings.TrimSuffix(getEnv("FRONTEND_URL", "http://localhost:3000"), "/"),
+			PublicURL:   strings.TrimSuffix(getEnv("PUBLIC_API_URL", "http://localhost:8080"), "/"),
 		},
 
 		Database: *LoadDatabaseConfig(), // Memanggil fungsi dari database.go
@@ -143,6 +242,10 @@ func LoadConfig() *Config {
 			AccessExpiry:  accessExpiry,
 			RefreshExpiry: refreshExpiry,
 			EncryptionKey: jwtKey, // Menyimpan hasil decode
+
+			SigningAlgorithm:    getEnv("JWT_SIGNING_ALGORITHM", "ES256"),
+			KeyRotationInterval: keyRotationInterval,
+			AcceptLegacyHS256:   acceptLegacyHS256,
 		},
 
 		Azure: AzureConfig{
@@ -162,6 +265,19 @@ func LoadConfig() *Config {
 			BlobContainerAudio:  getEnv("AZURE_BLOB_CONTAINER_AUDIO", "audio-files"),
 		},
 
+		LLM: LLMConfig{
+			Provider:      getEnv("LLM_PROVIDER", "azure"),
+			BaseURL:       getEnv("LLM_BASE_URL", "http://localhost:11434/v1"),
+			APIKey:        getEnv("LLM_API_KEY", ""),
+			DefaultModel:  getEnv("LLM_MODEL", getEnv("AZURE_OPENAI_DEPLOYMENT_NAME", "")),
+			FeatureModels: featureModels("chat", "vocal_analysis", "crisis_classifier", "sentiment"),
+		},
+
+		Sentiment: SentimentConfig{
+			Analyzer: getEnv("SENTIMENT_ANALYZER", "lexicon"),
+			Workers:  sentimentWorkers,
+		},
+
 		HuggingFace: HuggingFaceConfig{
 			APIKey:    getEnv("HUGGINGFACE_API_KEY", ""),
 			ModelName: getEnv("HUGGINGFACE_MODEL", "facebook/wav2vec2-base-960h"),
@@ -172,6 +288,7 @@ func LoadConfig() *Config {
 			ClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 			ClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
 			RedirectURI:  getEnv("GOOGLE_REDIRECT_URI", ""),
+			Issuer:       getEnv("GOOGLE_OIDC_ISSUER", "https://accounts.google.com"),
 		},
 
 		OAuth: OAuthConfig{
@@ -202,13 +319,46 @@ func LoadConfig() *Config {
 			AudioUploadPath:   getEnv("AUDIO_UPLOAD_PATH", "./uploads/audio"),
 			MaxFileSize:       maxFileSize,
 			AllowedExtensions: []string{".wav", ".mp3", ".m4a"},
+			ExportPath:        getEnv("EXPORT_PATH", "./exports"),
+			MaxAvatarSize:     maxAvatarSize,
 		},
 
 		Security: SecurityConfig{
-			EncryptionKey:    securityKey, // Menyimpan hasil decode
-			RateLimitPerMin:  rateLimitPerMin,
-			MaxLoginAttempts: maxLoginAttempts,
-			LockoutDuration:  lockoutDuration,
+			EncryptionKey:       securityKey, // Menyimpan hasil decode
+			PreviousEncryptionKeys: previousSecurityKeys,
+			RateLimitPerMin:     rateLimitPerMin,
+			MaxLoginAttempts:    maxLoginAttempts,
+			LockoutDuration:     lockoutDuration,
+			MaxLockoutDuration:  maxLockoutDuration,
+			PasswordResetExpiry: passwordResetExpiry,
+
+			EmailVerificationExpiry:    emailVerificationExpiry,
+			VerificationResendCooldown: verificationResendCooldown,
+			VerificationResendDailyMax: verificationResendDailyMax,
+			RequireVerifiedEmail:       requireVerifiedEmail,
+
+			MFAChallengeExpiry: mfaChallengeExpiry,
+
+			MagicLinkExpiry:   magicLinkExpiry,
+			MagicLinkCooldown: magicLinkCooldown,
+
+			ImpersonationExpiry: impersonationExpiry,
+
+			DataExportRetention:  dataExportRetention,
+			DataExportLinkExpiry: dataExportLinkExpiry,
+
+			AccountDeletionGracePeriod: accountDeletionGracePeriod,
+
+			MinimalChatRetention: minimalChatRetention,
+
+			MinimumAge:                minimumAge,
+			MinorSafeAge:              minorSafeAge,
+			GuardianConsentLinkExpiry: guardianConsentLinkExpiry,
+
+			TrustedContactLinkExpiry: trustedContactLinkExpiry,
+			CrisisEscalationCooldown: crisisEscalationCooldown,
+
+			CrisisModelStage: crisisModelStage,
 		},
 	}
 
@@ -235,6 +385,17 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// featureModels membaca LLM_MODEL_<FITUR> untuk setiap fitur yang diberikan.
+func featureModels(features ...string) map[string]string {
+	models := map[string]string{}
+	for _, feature := range features {
+		if model := os.Getenv("LLM_MODEL_" + strings.ToUpper(feature)); model != "" {
+			models[feature] = model
+		}
+	}
+	return models
+}
+
 // decodeKey adalah helper untuk men-decode dan memvalidasi kunci Base64.
 func decodeKey(envKey string) []byte {
 	keyStr := getEnvRequired(envKey)
@@ -252,6 +413,23 @@ func decodeKey(envKey string) []byte {
 	return decodedKey
 }
 
+// decodeKeyList membaca daftar kunci Base64 opsional yang dipisahkan koma.
+func decodeKeyList(envKey string) [][]byte {
+	var keys [][]byte
+	for _, keyStr := range strings.Split(os.Getenv(envKey), ",") {
+		keyStr = strings.TrimSpace(keyStr)
+		if keyStr == "" {
+			continue
+		}
+		decodedKey, err := base64.StdEncoding.DecodeString(keyStr)
+		if err != nil || len(decodedKey) != 32 {
+			log.Fatalf("FATAL: Every key in '%s' must be a base64 encoded 32-byte key", envKey)
+		}
+		keys = append(keys, decodedKey)
+	}
+	return keys
+}
+
 // validateConfig memvalidasi nilai-nilai konfigurasi penting lainnya.
 func validateConfig(config *Config) {
 	if len(config.JWT.AccessSecret) < 32 {
@@ -261,6 +439,36 @@ func validateConfig(config *Config) {
 		log.Println("WARNING: JWT_REFRESH_SECRET should be at least 32 characters for security.")
 	}
 
+	if alg := config.JWT.SigningAlgorithm; alg != "ES256" && alg != "RS256" {
+		log.Fatalf("FATAL: JWT_SIGNING_ALGORITHM must be ES256 or RS256, got '%s'", alg)
+	}
+
+	switch config.LLM.Provider {
+	case "azure", "openai", "fake":
+	default:
+		log.Fatalf("FATAL: LLM_PROVIDER must be azure, openai or fake, got '%s'", config.LLM.Provider)
+	}
+	if config.LLM.Provider == "fake" && config.Server.Environment == "release" {
+		log.Println("WARNING: LLM_PROVIDER=fake in release mode; AI replies are not real.")
+	}
+
+	switch config.Sentiment.Analyzer {
+	case "lexicon", "llm":
+	case "azure":
+		if config.Azure.TextAnalyticsKey == "" || config.Azure.TextAnalyticsEndpoint == "" {
+			log.Fatal("FATAL: SENTIMENT_ANALYZER=azure requires AZURE_TEXT_ANALYTICS_KEY and AZURE_TEXT_ANALYTICS_ENDPOINT")
+		}
+	default:
+		log.Fatalf("FATAL: SENTIMENT_ANALYZER must be lexicon, llm or azure, got '%s'", config.Sentiment.Analyzer)
+	}
+	if config.Sentiment.Workers < 1 {
+		config.Sentiment.Workers = 1
+	}
+
+	if config.Security.MinorSafeAge < config.Security.MinimumAge {
+		log.Fatalf("FATAL: MINOR_SAFE_MODE_AGE (%d) must not be lower than MINIMUM_AGE (%d)", config.Security.MinorSafeAge, config.Security.MinimumAge)
+	}
+
 	// Validasi untuk kunci enkripsi sudah dilakukan di dalam decodeKey,
 	// sehingga tidak perlu diulang di sini.
 
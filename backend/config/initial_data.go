@@ -29,6 +29,7 @@ func CreateInitialData(db *gorm.DB) {
 
 	log.Println("🌱 Seeding essential data...")
 	createCommunityCategories(tx)
+	createRolesAndPermissions(tx)
 	createAdminUser(tx)
 
 	// Hanya buat data sampel jika kita tidak di lingkungan produksi
@@ -69,6 +70,79 @@ func createCommunityCategories(tx *gorm.DB) {
 	log.Println("✅ Community categories checked/seeded.")
 }
 
+// defaultRolePermissions memetakan role bawaan ke permission yang dimilikinya.
+var defaultRolePermissions = map[string][]string{
+	models.RoleUser:      {},
+	models.RoleModerator: {models.PermUsersRead, models.PermCommunityModerate},
+	models.RoleCounselor: {models.PermUsersRead, models.PermCrisisRespond},
+	models.RoleAdmin: {
+		models.PermUsersRead, models.PermUsersManage, models.PermUsersImpersonate, models.PermCommunityModerate,
+		models.PermNotificationsBroadcast, models.PermAnalyticsView, models.PermCrisisRespond,
+	},
+	models.RoleSuperAdmin: {
+		models.PermUsersRead, models.PermUsersManage, models.PermUsersImpersonate, models.PermRolesManage, models.PermCommunityModerate,
+		models.PermNotificationsBroadcast, models.PermAnalyticsView, models.PermCrisisRespond,
+		models.PermSecurityManage,
+	},
+}
+
+// createRolesAndPermissions memastikan role dan permission bawaan tersedia.
+// Permission yang ditambahkan di rilis baru akan ikut terpasang ke role bawaan.
+func createRolesAndPermissions(tx *gorm.DB) {
+	permissions := map[string]string{
+		models.PermUsersRead:              "Melihat daftar dan profil pengguna",
+		models.PermUsersManage:            "Mengaktifkan, menonaktifkan, dan membuka kunci akun",
+		models.PermUsersImpersonate:       "Bertindak sebagai pengguna untuk kasus dukungan (diaudit)",
+		models.PermRolesManage:            "Memberi dan mencabut role pengguna",
+		models.PermCommunityModerate:      "Memoderasi postingan komunitas",
+		models.PermNotificationsBroadcast: "Mengirim notifikasi massal",
+		models.PermAnalyticsView:          "Melihat analitik sistem",
+		models.PermCrisisRespond:          "Menangani peringatan krisis pengguna",
+		models.PermSecurityManage:         "Mengelola kunci penandatangan token",
+	}
+	roles := []models.Role{
+		{RoleName: models.RoleUser, DisplayName: "Pengguna"},
+		{RoleName: models.RoleModerator, DisplayName: "Moderator"},
+		{RoleName: models.RoleCounselor, DisplayName: "Konselor"},
+		{RoleName: models.RoleAdmin, DisplayName: "Admin"},
+		{RoleName: models.RoleSuperAdmin, DisplayName: "Super Admin"},
+	}
+
+	permissionsByKey := make(map[string]models.Permission, len(permissions))
+	for key, description := range permissions {
+		var permission models.Permission
+		if err := tx.Where(models.Permission{PermissionKey: key}).
+			Attrs(models.Permission{Description: stringPtr(description)}).
+			FirstOrCreate(&permission).Error; err != nil {
+			log.Printf("ERROR: Failed to seed permission '%s': %v", key, err)
+			return
+		}
+		permissionsByKey[key] = permission
+	}
+
+	for _, roleData := range roles {
+		var role models.Role
+		if err := tx.Where(models.Role{RoleName: roleData.RoleName}).
+			Attrs(models.Role{DisplayName: roleData.DisplayName}).
+			FirstOrCreate(&role).Error; err != nil {
+			log.Printf("ERROR: Failed to seed role '%s': %v", roleData.RoleName, err)
+			return
+		}
+
+		var rolePermissions []models.Permission
+		for _, key := range defaultRolePermissions[role.RoleName] {
+			rolePermissions = append(rolePermissions, permissionsByKey[key])
+		}
+		if len(rolePermissions) > 0 {
+			if err := tx.Model(&role).Association("Permissions").Append(rolePermissions); err != nil {
+				log.Printf("ERROR: Failed to seed permissions for role '%s': %v", role.RoleName, err)
+				return
+			}
+		}
+	}
+	log.Println("✅ Roles and permissions checked/seeded.")
+}
+
 // createAdminUser menggunakan FirstOrCreate untuk memastikan hanya ada satu admin.
 func createAdminUser(tx *gorm.DB) {
 	adminEmail := "admin@tenang.in"
@@ -87,6 +161,11 @@ func createAdminUser(tx *gorm.DB) {
 		return
 	}
 
+	var superAdminRole models.Role
+	if err := tx.Where("role_name = ?", models.RoleSuperAdmin).First(&superAdminRole).Error; err == nil {
+		tx.FirstOrCreate(&models.UserRole{}, models.UserRole{UserID: adminUser.ID, RoleID: superAdminRole.ID})
+	}
+
 	if result.RowsAffected > 0 {
 		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("superadmin123!"), bcrypt.DefaultCost)
 		tx.Create(&models.UserCredentials{UserID: adminUser.ID, PasswordHash: string(hashedPassword)})
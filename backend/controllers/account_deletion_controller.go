@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AccountDeletionController handles account deletion requests (UU PDP right to erasure).
+type AccountDeletionController struct {
+	DB      *gorm.DB
+	Cfg     *config.Config
+	Deleter *services.AccountDeleter
+}
+
+// NewAccountDeletionController creates a new instance of AccountDeletionController.
+func NewAccountDeletionController(db *gorm.DB, cfg *config.Config, deleter *services.AccountDeleter) *AccountDeletionController {
+	return &AccountDeletionController{DB: db, Cfg: cfg, Deleter: deleter}
+}
+
+// --- DTOs ---
+
+type CancelAccountDeletionRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// --- Handlers ---
+
+// RequestDeletion deactivates the account now and schedules its permanent deletion
+// after the grace period. The user receives an email link to restore it until then.
+// ROUTE: DELETE /api/v1/users/:userId/deactivate
+func (dc *AccountDeletionController) RequestDeletion(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "code": "invalid_user_id"})
+		return
+	}
+	actorID, _, _, _, err := middleware.GetUserFromTenangContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	var user models.User
+	if err := dc.DB.Where("id = ? AND email <> ?", userID, models.DeletedUserEmail).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found"})
+		return
+	}
+
+	var pending models.AccountDeletionRequest
+	if err := dc.DB.Where("user_id = ? AND status = ?", user.ID, models.AccountDeletionPending).First(&pending).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Account deletion is already scheduled", "code": "deletion_already_scheduled", "scheduled_for": pending.ScheduledFor})
+		return
+	}
+
+	now := time.Now()
+	clientIP := c.ClientIP()
+	request := models.AccountDeletionRequest{
+		UserID:       user.ID,
+		RequestedBy:  actorID,
+		Status:       models.AccountDeletionPending,
+		RequestedIP:  &clientIP,
+		ScheduledFor: now.Add(dc.Cfg.Security.AccountDeletionGracePeriod),
+	}
+
+	err = dc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&request).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Updates(map[string]interface{}{"is_active": false, "deleted_at": now}).Error; err != nil {
+			return err
+		}
+		_, err := middleware.RevokeUserSessions(tx, user.ID, "account_deletion", nil)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate account", "code": "db_transaction_failed"})
+		return
+	}
+
+	services.RecordAudit(dc.DB, services.AuditEntry{
+		UserID: &actorID, Action: "account_deletion_requested", TableName: "account_deletion_requests", RecordID: &request.ID,
+		NewValues: gin.H{"user_id": user.ID, "scheduled_for": request.ScheduledFor},
+		IPAddress: clientIP, UserAgent: c.Request.UserAgent(),
+	})
+	go dc.Deleter.NotifyScheduled(request, user)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Akun sudah dinonaktifkan dan akan dihapus permanen setelah masa tenggang. Kami mengirim tautan untuk memulihkannya ke email kamu.",
+		"code":          "user_deactivated",
+		"request_id":    request.ID,
+		"scheduled_for": request.ScheduledFor,
+	})
+}
+
+// CancelDeletion restores an account during its grace period using the emailed link.
+// The signed token is the credential because the deactivated user cannot log in.
+// ROUTE: POST /api/v1/account/restore
+func (dc *AccountDeletionController) CancelDeletion(c *gin.Context) {
+	var req CancelAccountDeletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Restore token is required", "code": "validation_failed"})
+		return
+	}
+
+	claims, err := services.ParsePurposeToken(dc.Cfg.JWT.EncryptionKey, req.Token, services.AccountDeletionCancelPurpose)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Restore link is invalid or has expired", "code": "invalid_restore_link"})
+		return
+	}
+	requestID, err := uuid.Parse(claims.Reference)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Restore link is invalid or has expired", "code": "invalid_restore_link"})
+		return
+	}
+
+	// Pembatalan bersyarat: hanya berhasil bila purge belum mengambil permintaan ini.
+	now := time.Now()
+	err = dc.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.AccountDeletionRequest{}).
+			Where("id = ? AND user_id = ? AND status = ? AND scheduled_for > ?", requestID, claims.UserID, models.AccountDeletionPending, now).
+			Updates(map[string]interface{}{"status": models.AccountDeletionCancelled, "cancelled_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.User{}).Where("id = ? AND email = ?", claims.UserID, claims.Email).
+			Updates(map[string]interface{}{"is_active": true, "deleted_at": nil}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusGone, gin.H{"error": "This account can no longer be restored", "code": "deletion_not_pending"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account", "code": "db_transaction_failed"})
+		return
+	}
+
+	services.RecordAudit(dc.DB, services.AuditEntry{
+		UserID: &claims.UserID, Action: "account_deletion_cancelled", TableName: "account_deletion_requests", RecordID: &requestID,
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Akun kamu sudah dipulihkan. Silakan masuk kembali.", "code": "account_restored"})
+}
@@ -9,6 +9,7 @@ import (
 	"backend/config"
 	"backend/middleware"
 	"backend/models"
+	"backend/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -90,6 +91,10 @@ func (a *AnalyticsController) RecordEvent(c *gin.Context) {
 		DeviceType:  &req.DeviceType,
 		AppVersion:  &req.AppVersion,
 	}
+	// Event hanya dikaitkan ke pengguna bila tingkat privasinya mengizinkan
+	if user, err := middleware.GetFullUserFromContext(c); err == nil && services.PolicyForUser(*user, a.Cfg).LinkAnalytics {
+		event.UserID = &user.ID
+	}
 	if err := a.DB.Create(&event).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record event", "code": "db_error"})
 		return
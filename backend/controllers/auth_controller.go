@@ -2,30 +2,51 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"backend/config"
 	"backend/middleware"
 	"backend/models"
+	"backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/api/idtoken"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // AuthController handles all authentication-related API requests.
 type AuthController struct {
-	DB  *gorm.DB
-	Cfg *config.Config
+	DB      *gorm.DB
+	Cfg     *config.Config
+	Email   *services.EmailService
+	Lockout *services.LoginLockout
+	Google  services.IdentityProvider
+
+	Guardians *services.GuardianConsents
 }
 
 // NewAuthController creates a new instance of AuthController with dependencies.
 func NewAuthController(db *gorm.DB, cfg *config.Config) *AuthController {
-	return &AuthController{DB: db, Cfg: cfg}
+	return &AuthController{
+		DB:      db,
+		Cfg:     cfg,
+		Email:   services.NewEmailService(cfg.Email),
+		Lockout: services.NewLoginLockout(db, cfg.Security),
+		Google:  services.NewOIDCProvider("google", cfg.Google.Issuer, cfg.Google.ClientID, cfg.Google.ClientSecret, cfg.Google.RedirectURI),
+
+		Guardians: services.NewGuardianConsents(db, cfg),
+	}
 }
 
 // --- DTOs and Request Structs ---
@@ -35,7 +56,11 @@ type RegisterRequest struct {
 	Password    string `json:"password" binding:"required,min=8"`
 	FullName    string `json:"full_name" binding:"required,min=2"`
 	Username    string `json:"username" binding:"omitempty,min=3"`
-	DateOfBirth string `json:"date_of_birth" binding:"omitempty,datetime=2006-01-02"`
+	DateOfBirth string `json:"date_of_birth" binding:"required,datetime=2006-01-02"`
+	Timezone    string `json:"timezone" binding:"omitempty,max=50"` // Nama zona IANA; default Asia/Jakarta
+
+	// Wajib bila usia di bawah MINOR_SAFE_MODE_AGE
+	Guardian *GuardianConsentRequest `json:"guardian"`
 }
 
 type LoginRequest struct {
@@ -56,6 +81,19 @@ type ChangePasswordRequest struct {
 	NewPassword     string `json:"new_password" binding:"required,min=8"`
 }
 
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+var errResetTokenAlreadyUsed = errors.New("password reset token already used")
+
+const emailVerificationPurpose = "email_verification"
+
 type AuthResponse struct {
 	Message string `json:"message"`
 	User    struct {
@@ -65,13 +103,24 @@ type AuthResponse struct {
 		Username *string   `json:"username"`
 	} `json:"user"`
 	Tokens struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
-		TokenType    string `json:"token_type"`
-		ExpiresIn    int64  `json:"expires_in"`
+		AccessToken  string    `json:"access_token"`
+		RefreshToken string    `json:"refresh_token"`
+		TokenType    string    `json:"token_type"`
+		ExpiresIn    int64     `json:"expires_in"`
+		SessionID    uuid.UUID `json:"session_id"`
 	} `json:"tokens"`
 }
 
+type SessionResponse struct {
+	ID             uuid.UUID              `json:"id"`
+	Device         map[string]interface{} `json:"device"`
+	IPAddress      string                 `json:"ip_address"`
+	LastActivityAt time.Time              `json:"last_activity_at"`
+	CreatedAt      time.Time              `json:"created_at"`
+	ExpiresAt      time.Time              `json:"expires_at"`
+	IsCurrent      bool                   `json:"is_current"`
+}
+
 // --- Controller Handlers ---
 
 // Register handles new user registration.
@@ -82,8 +131,9 @@ func (a *AuthController) Register(c *gin.Context) {
 		return
 	}
 
+	req.Email = services.NormalizeEmail(req.Email)
 	var existingUser models.User
-	if err := a.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+	if err := a.DB.Scopes(services.EmailEquals(req.Email)).First(&existingUser).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
 		return
 	}
@@ -97,12 +147,46 @@ func (a *AuthController) Register(c *gin.Context) {
 		IsActive: true,
 	}
 	if req.Username != "" { user.Username = &req.Username }
-	if dob, err := time.Parse("2006-01-02", req.DateOfBirth); err == nil { user.DateOfBirth = &dob }
+	user.Timezone = services.DefaultTimezone
+	if req.Timezone != "" {
+		if err := services.ValidateTimezone(req.Timezone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_timezone"})
+			return
+		}
+		user.Timezone = req.Timezone
+	}
+	dob, _ := time.Parse("2006-01-02", req.DateOfBirth)
+	user.DateOfBirth = &dob
+
+	// Usia dihitung menurut tanggal di zona waktu pengguna
+	age := services.AgeOn(dob, time.Now(), services.UserLocation(user.Timezone))
+	if age < a.Cfg.Security.MinimumAge {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("You must be at least %d years old to use Tenang.in", a.Cfg.Security.MinimumAge),
+			"code":  "age_requirement_not_met", "minimum_age": a.Cfg.Security.MinimumAge,
+		})
+		return
+	}
+	isMinor := age < a.Cfg.Security.MinorSafeAge
+	if isMinor && (req.Guardian == nil || strings.EqualFold(req.Guardian.GuardianEmail, req.Email)) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "A parent or guardian with their own email address is required for users under " + strconv.Itoa(a.Cfg.Security.MinorSafeAge),
+			"code":  "guardian_required",
+		})
+		return
+	}
 
+	var consent *models.GuardianConsent
 	err := a.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(&user).Error; err != nil { return err }
 		if err := tx.Create(&models.UserCredentials{UserID: user.ID, PasswordHash: string(hashedPassword)}).Error; err != nil { return err }
 		if err := tx.Create(&models.UserPreferences{UserID: user.ID}).Error; err != nil { return err }
+		if err := recordVerificationSent(tx, user, c.ClientIP(), c.Request.UserAgent()); err != nil { return err }
+		if isMinor {
+			var err error
+			consent, err = a.Guardians.Create(tx, user.ID, req.Guardian.GuardianName, req.Guardian.GuardianEmail, req.Guardian.Relationship)
+			return err
+		}
 		return nil
 	})
 
@@ -111,6 +195,10 @@ func (a *AuthController) Register(c *gin.Context) {
 		return
 	}
 
+	go a.sendVerificationEmail(user)
+	if consent != nil {
+		go a.Guardians.Notify(*consent, user)
+	}
 	a.generateTokensAndRespond(c, user, http.StatusCreated, "Registrasi berhasil! Selamat datang di Tenang.in 🌸")
 }
 
@@ -123,18 +211,44 @@ func (a *AuthController) Login(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := a.DB.Where("email = ? AND is_active = ?", req.Email, true).First(&user).Error; err != nil {
+	if err := a.DB.Scopes(services.EmailEquals(req.Email)).Where("is_active = ?", true).First(&user).Error; err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	var credentials models.UserCredentials
-	a.DB.Where("user_id = ?", user.ID).First(&credentials)
+	if err := a.DB.Where("user_id = ?", user.ID).First(&credentials).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if lockedUntil := a.Lockout.LockedUntil(credentials); lockedUntil != nil {
+		respondAccountLocked(c, *lockedUntil)
+		return
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(credentials.PasswordHash), []byte(req.Password)); err != nil {
+		a.recordLogin(c, user.ID, "password", false)
+		lockedUntil, lockErr := a.Lockout.RegisterFailure(credentials, c.ClientIP(), c.Request.UserAgent())
+		if lockErr != nil {
+			log.Printf("ERROR: Failed to record failed login for user %s: %v", user.ID, lockErr)
+		}
+		if lockedUntil != nil {
+			respondAccountLocked(c, *lockedUntil)
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
+	// Dengan 2FA, penghitung gagal baru direset setelah faktor kedua lolos (VerifyMFA);
+	// kalau tidak, login ulang dengan password bisa dipakai untuk menebak kode tanpa batas.
+	if a.mfaEnabled(user.ID) {
+		a.respondWithMFAChallenge(c, user)
+		return
+	}
+
+	a.Lockout.RegisterSuccess(credentials)
+	a.recordLogin(c, user.ID, "password", true)
 	a.DB.Model(&user).Update("last_active_at", time.Now())
 	a.generateTokensAndRespond(c, user, http.StatusOK, "Login berhasil! Selamat datang kembali 🌸")
 }
@@ -147,22 +261,27 @@ func (a *AuthController) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	claims, err := middleware.ValidateTenangJWT(req.RefreshToken, "refresh")
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+	tokens, err := middleware.RefreshTenangTokens(req.RefreshToken, a.DB, middleware.ClientInfoFromRequest(c))
+	switch {
+	case errors.Is(err, middleware.ErrRefreshTokenReused):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used, please log in again", "code": "refresh_token_reused"})
 		return
-	}
-
-	var user models.User
-	if err := a.DB.First(&user, claims.UserID).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found for this token"})
+	case errors.Is(err, middleware.ErrUserNotFoundOrInactive):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User account not found or inactive", "code": "user_not_found"})
+		return
+	case errors.Is(err, middleware.ErrSessionRevoked):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session is no longer valid, please log in again", "code": "session_revoked"})
+		return
+	case err != nil:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token", "code": "invalid_refresh_token"})
 		return
 	}
 
-	a.generateTokensAndRespond(c, user, http.StatusOK, "Tokens refreshed successfully")
+	a.respondWithTokens(c, tokens, http.StatusOK, "Tokens refreshed successfully")
 }
 
-// GoogleAuth handles authentication via Google ID token.
+// GoogleAuth handles authentication via a Google ID token obtained by a native client.
+// Web clients should use the authorization-code flow (GoogleLogin/GoogleCallback).
 func (a *AuthController) GoogleAuth(c *gin.Context) {
 	var req GoogleAuthRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -173,46 +292,160 @@ func (a *AuthController) GoogleAuth(c *gin.Context) {
 	// Verifikasi token ID dengan Google secara aman di backend
 	idTokenPayload, err := idtoken.Validate(context.Background(), req.IDToken, a.Cfg.Google.ClientID)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google ID token", "details": err.Error()})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google ID token", "code": "invalid_id_token"})
 		return
 	}
 
-	email := idTokenPayload.Claims["email"].(string)
-	name := idTokenPayload.Claims["name"].(string)
+	email, _ := idTokenPayload.Claims["email"].(string)
+	name, _ := idTokenPayload.Claims["name"].(string)
+	emailVerified, _ := idTokenPayload.Claims["email_verified"].(bool)
 
-	var user models.User
-	err = a.DB.Where(models.User{Email: email}).First(&user).Error
-
-	if errors.Is(err, gorm.ErrRecordNotFound) { // User baru
-		newUser := models.User{
-			ID:              uuid.New(),
-			Email:           email,
-			FullName:        &name,
-			IsActive:        true,
-			EmailVerifiedAt: func() *time.Time { t := time.Now(); return &t }(),
-		}
-		err = a.DB.Transaction(func(tx *gorm.DB) error {
-			if err := tx.Create(&newUser).Error; err != nil { return err }
-			if err := tx.Create(&models.UserCredentials{UserID: newUser.ID, PasswordHash: "google_sso"}).Error; err != nil { return err }
-			if err := tx.Create(&models.UserPreferences{UserID: newUser.ID}).Error; err != nil { return err }
-			return nil
-		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user from Google account"})
-			return
+	a.signInWithIdentity(c, &services.ExternalIdentity{
+		Provider:      a.Google.Name(),
+		Subject:       idTokenPayload.Subject,
+		Email:         services.NormalizeEmail(email),
+		EmailVerified: emailVerified,
+		Name:          name,
+	})
+}
+
+// Logout revokes the session the current access token belongs to.
+func (a *AuthController) Logout(c *gin.Context) {
+	userID, sessionID, ok := currentSession(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	if _, err := middleware.RevokeSession(a.DB, userID, sessionID, "logout"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session", "code": "db_update_failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
+}
+
+// LogoutAll revokes every session of the user ("keluar dari semua perangkat").
+// Pass ?keep_current=true to stay signed in on the calling device.
+// ROUTE: POST /api/v1/auth/logout-all
+func (a *AuthController) LogoutAll(c *gin.Context) {
+	userID, sessionID, ok := currentSession(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	var except *uuid.UUID
+	if c.Query("keep_current") == "true" {
+		except = &sessionID
+	}
+
+	revoked, err := middleware.RevokeUserSessions(a.DB, userID, "logout_all", except)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end sessions", "code": "db_update_failed"})
+		return
+	}
+
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &userID, Action: "sessions_revoked_all", TableName: "user_sessions",
+		NewValues: gin.H{"revoked": revoked, "kept_current": except != nil},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Signed out from all devices", "revoked_sessions": revoked})
+}
+
+// UnlockAccount lets an admin lift a login lockout.
+// ROUTE: POST /api/v1/admin/users/:userId/unlock
+func (a *AuthController) UnlockAccount(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "code": "invalid_user_id"})
+		return
+	}
+	adminID, _, _, _, err := middleware.GetUserFromTenangContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	err = a.Lockout.Unlock(userID, adminID, c.ClientIP(), c.Request.UserAgent())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User credentials not found", "code": "user_not_found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account", "code": "db_update_failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked successfully", "user_id": userID})
+}
+
+// GetSessions lists the user's active sessions (devices).
+// ROUTE: GET /api/v1/auth/sessions
+func (a *AuthController) GetSessions(c *gin.Context) {
+	userID, sessionID, ok := currentSession(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	var sessions []models.UserSession
+	if err := a.DB.Where("user_id = ? AND is_active = ? AND expires_at > ? AND impersonator_id IS NULL", userID, true, time.Now()).
+		Order("last_activity_at DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions", "code": "db_query_failed"})
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		item := SessionResponse{
+			ID:             s.ID,
+			IPAddress:      s.IPAddress,
+			LastActivityAt: s.LastActivityAt,
+			CreatedAt:      s.CreatedAt,
+			ExpiresAt:      s.ExpiresAt,
+			IsCurrent:      s.ID == sessionID,
 		}
-		a.generateTokensAndRespond(c, newUser, http.StatusCreated, "Akun berhasil dibuat dengan Google! Selamat datang 🌸")
-	} else if err == nil { // User sudah ada
-		a.DB.Model(&user).Update("last_active_at", time.Now())
-		a.generateTokensAndRespond(c, user, http.StatusOK, "Login dengan Google berhasil! Selamat datang kembali 🌸")
-	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during Google auth"})
+		json.Unmarshal([]byte(s.DeviceInfo), &item.Device)
+		response = append(response, item)
 	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
 }
 
-// Logout is a placeholder for client-side token deletion.
-func (a *AuthController) Logout(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Logout successful. Please clear tokens on the client."})
+// RevokeSession signs a single device out.
+// ROUTE: DELETE /api/v1/auth/sessions/:sessionId
+func (a *AuthController) RevokeSession(c *gin.Context) {
+	userID, _, ok := currentSession(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	targetID, err := uuid.Parse(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID format", "code": "invalid_session_id"})
+		return
+	}
+
+	revoked, err := middleware.RevokeSession(a.DB, userID, targetID, "revoked_by_user")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session", "code": "db_update_failed"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found", "code": "session_not_found"})
+		return
+	}
+
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &userID, Action: "session_revoked", TableName: "user_sessions", RecordID: &targetID,
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
 }
 
 // ChangePassword allows an authenticated user to change their password.
@@ -233,38 +466,341 @@ func (a *AuthController) ChangePassword(c *gin.Context) {
 	credentials.PasswordHash = string(newHashedPassword)
 	credentials.PasswordChangedAt = time.Now()
 	a.DB.Save(&credentials)
+	middleware.RevokeUserSessions(a.DB, authedUser.ID, "password_changed", nil)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+	// Changing the password invalidates every token issued before it, so hand
+	// the current device a fresh pair instead of logging it out.
+	a.issueSessionAndRespond(c, *authedUser, c.GetBool("mfa_verified"), http.StatusOK, "Password changed successfully")
 }
 
-// (Placeholders for features requiring email service)
-func (a *AuthController) ForgotPassword(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"message": "If your email is registered, a password reset link has been sent."}) }
-func (a *AuthController) ResetPassword(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"message": "Password has been reset successfully."}) }
-func (a *AuthController) VerifyEmail(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully."}) }
+// ForgotPassword issues a single-use reset token and emails it to the user.
+// The response is identical whether or not the email is registered.
+func (a *AuthController) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "code": "validation_failed"})
+		return
+	}
+
+	var user models.User
+	if err := a.DB.Scopes(services.EmailEquals(req.Email)).Where("is_active = ?", true).First(&user).Error; err == nil {
+		// Token creation and SMTP delivery run in the background so response
+		// timing does not reveal whether the account exists.
+		go a.issuePasswordReset(user, c.ClientIP(), c.Request.UserAgent())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If your email is registered, a password reset link has been sent."})
+}
+
+// ResetPassword consumes a reset token, stores the new password hash and
+// invalidates every existing session of the user.
+func (a *AuthController) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "code": "validation_failed"})
+		return
+	}
+
+	var resetToken models.PasswordResetToken
+	err := a.DB.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", services.HashToken(req.Token), time.Now()).
+		First(&resetToken).Error
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token", "code": "invalid_reset_token"})
+		return
+	}
+
+	newHashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to secure new password", "code": "hash_failed"})
+		return
+	}
+
+	now := time.Now()
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		// Conditional update keeps the token single-use even under concurrent requests.
+		result := tx.Model(&models.PasswordResetToken{}).Where("id = ? AND used_at IS NULL", resetToken.ID).Update("used_at", now)
+		if result.Error != nil { return result.Error }
+		if result.RowsAffected == 0 { return errResetTokenAlreadyUsed }
+
+		if err := tx.Model(&models.UserCredentials{}).Where("user_id = ?", resetToken.UserID).Updates(map[string]interface{}{
+			"password_hash":         string(newHashedPassword),
+			"password_changed_at":   now,
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		}).Error; err != nil { return err }
+
+		_, err := middleware.RevokeUserSessions(tx, resetToken.UserID, "password_reset", nil)
+		return err
+	})
+
+	if errors.Is(err, errResetTokenAlreadyUsed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token", "code": "invalid_reset_token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password", "code": "db_transaction_failed"})
+		return
+	}
+
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &resetToken.UserID, Action: "password_reset_completed", TableName: "user_credentials",
+		RecordID: &resetToken.ID, IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset successfully. Please log in with your new password."})
+}
+
+// VerifyEmail consumes a signed verification token and stamps EmailVerifiedAt.
+// ROUTE: GET /api/v1/auth/verify-email?token=...
+func (a *AuthController) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification token is required", "code": "missing_token"})
+		return
+	}
+
+	claims, err := services.ParsePurposeToken(a.Cfg.JWT.EncryptionKey, token, emailVerificationPurpose)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link", "code": "invalid_verification_token"})
+		return
+	}
+
+	var user models.User
+	if err := a.DB.Where("id = ? AND email = ?", claims.UserID, claims.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link", "code": "invalid_verification_token"})
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Email already verified.", "email_verified_at": user.EmailVerifiedAt})
+		return
+	}
+
+	// Only the first redemption stamps the timestamp, which makes the link single-use.
+	now := time.Now()
+	result := a.DB.Model(&models.User{}).Where("id = ? AND email_verified_at IS NULL", user.ID).Update("email_verified_at", now)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email", "code": "db_update_failed"})
+		return
+	}
+
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &user.ID, Action: "email_verified", TableName: "users", RecordID: &user.ID,
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully.", "email_verified_at": now})
+}
+
+// ResendVerification emails a fresh verification link, throttled per user.
+// ROUTE: POST /api/v1/auth/resend-verification
+func (a *AuthController) ResendVerification(c *gin.Context) {
+	authedUser, _ := middleware.GetFullUserFromContext(c)
+	if authedUser.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified", "code": "email_already_verified"})
+		return
+	}
+
+	// Previous sends are recorded in the audit log, which doubles as the throttle store.
+	// Cek batas dan pencatatan terjadi dalam satu transaksi yang mengunci baris pengguna,
+	// jadi permintaan paralel tidak bisa lolos bersamaan sebelum kiriman tercatat.
+	var throttled gin.H
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, "id = ?", authedUser.ID).Error; err != nil {
+			return err
+		}
+
+		var lastSent models.AuditLog
+		err := tx.Where("user_id = ? AND action = ?", authedUser.ID, "email_verification_sent").Order("created_at DESC").First(&lastSent).Error
+		if err == nil {
+			if retryAt := lastSent.CreatedAt.Add(a.Cfg.Security.VerificationResendCooldown); time.Now().Before(retryAt) {
+				throttled = gin.H{
+					"error": "Please wait before requesting another verification email", "code": "verification_resend_throttled",
+					"retry_after": int(time.Until(retryAt).Seconds()) + 1,
+				}
+				return nil
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		var sentToday int64
+		if err := tx.Model(&models.AuditLog{}).
+			Where("user_id = ? AND action = ? AND created_at > ?", authedUser.ID, "email_verification_sent", time.Now().Add(-24*time.Hour)).
+			Count(&sentToday).Error; err != nil {
+			return err
+		}
+		if int(sentToday) >= a.Cfg.Security.VerificationResendDailyMax {
+			throttled = gin.H{"error": "Daily verification email limit reached", "code": "verification_resend_limit"}
+			return nil
+		}
+
+		return recordVerificationSent(tx, *authedUser, c.ClientIP(), c.Request.UserAgent())
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email", "code": "db_transaction_failed"})
+		return
+	}
+	if throttled != nil {
+		c.JSON(http.StatusTooManyRequests, throttled)
+		return
+	}
+
+	go a.sendVerificationEmail(*authedUser)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "A new verification email is on its way."})
+}
 
 // --- Helper Functions ---
 
+// issuePasswordReset replaces any outstanding reset token for the user and emails a new one.
+func (a *AuthController) issuePasswordReset(user models.User, clientIP, userAgent string) {
+	token, tokenHash, err := services.GenerateSecureToken()
+	if err != nil {
+		log.Printf("ERROR: Failed to generate password reset token for user %s: %v", user.ID, err)
+		return
+	}
+
+	now := time.Now()
+	resetToken := models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: now.Add(a.Cfg.Security.PasswordResetExpiry),
+	}
+	if clientIP != "" { resetToken.RequestedIP = &clientIP }
+
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordResetToken{}).Where("user_id = ? AND used_at IS NULL", user.ID).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&resetToken).Error
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to store password reset token for user %s: %v", user.ID, err)
+		return
+	}
+
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &user.ID, Action: "password_reset_requested", TableName: "password_reset_tokens",
+		RecordID: &resetToken.ID, IPAddress: clientIP, UserAgent: userAgent,
+	})
+
+	resetLink := fmt.Sprintf("%s/reset-password?token=%s", a.Cfg.Server.FrontendURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Halo,\n\n"+
+		"Kami menerima permintaan untuk mengatur ulang password akun Tenang.in kamu. "+
+		"Buka tautan berikut untuk membuat password baru:\n\n%s\n\n"+
+		"Tautan ini hanya dapat digunakan sekali dan berlaku selama %s. "+
+		"Jika kamu tidak merasa meminta reset password, abaikan email ini; password kamu tidak akan berubah.\n\n"+
+		"Salam hangat,\nTim Tenang.in 🌸", resetLink, formatDurationID(a.Cfg.Security.PasswordResetExpiry))
+
+	if err := a.Email.Send(services.EmailMessage{To: user.Email, Subject: "Reset password Tenang.in", TextBody: body}); err != nil {
+		log.Printf("ERROR: Failed to send password reset email to user %s: %v", user.ID, err)
+	}
+}
+
 func (a *AuthController) generateTokensAndRespond(c *gin.Context, user models.User, statusCode int, message string) {
-	sessionID := uuid.New().String()
-	accessToken, errAccess := middleware.GenerateTenangJWT(user, "access", sessionID)
-	refreshToken, errRefresh := middleware.GenerateTenangJWT(user, "refresh", sessionID)
+	a.issueSessionAndRespond(c, user, false, statusCode, message)
+}
 
-	if errAccess != nil || errRefresh != nil {
+func (a *AuthController) issueSessionAndRespond(c *gin.Context, user models.User, mfaVerified bool, statusCode int, message string) {
+	tokens, err := middleware.IssueTenangSession(a.DB, user, middleware.ClientInfoFromRequest(c), mfaVerified)
+	if err != nil {
+		log.Printf("ERROR: Failed to issue session for user %s: %v", user.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
 		return
 	}
+	a.respondWithTokens(c, tokens, statusCode, message)
+}
 
+func (a *AuthController) respondWithTokens(c *gin.Context, tokens *middleware.TenangTokenPair, statusCode int, message string) {
 	accessExpiry := a.Cfg.JWT.AccessExpiry
 
 	response := AuthResponse{ Message: message }
-	response.User.ID = user.ID
-	response.User.Email = user.Email
-	response.User.FullName = user.FullName
-	response.User.Username = user.Username
-	response.Tokens.AccessToken = accessToken
-	response.Tokens.RefreshToken = refreshToken
+	response.User.ID = tokens.User.ID
+	response.User.Email = tokens.User.Email
+	response.User.FullName = tokens.User.FullName
+	response.User.Username = tokens.User.Username
+	response.Tokens.AccessToken = tokens.AccessToken
+	response.Tokens.RefreshToken = tokens.RefreshToken
 	response.Tokens.TokenType = "Bearer"
 	response.Tokens.ExpiresIn = int64(accessExpiry.Seconds())
+	response.Tokens.SessionID = tokens.Session.ID
 
 	c.JSON(statusCode, response)
-}
\ No newline at end of file
+}
+
+// respondAccountLocked answers a sign-in attempt on a locked account.
+func respondAccountLocked(c *gin.Context, lockedUntil time.Time) {
+	retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusLocked, gin.H{
+		"error":        "Account temporarily locked due to too many failed login attempts",
+		"code":         "account_locked",
+		"retry_after":  retryAfter,
+		"locked_until": lockedUntil,
+	})
+}
+
+// recordLogin writes the audit entry shared by all first-factor login methods.
+func (a *AuthController) recordLogin(c *gin.Context, userID uuid.UUID, method string, success bool) {
+	action := "login_success"
+	if !success {
+		action = "login_failed"
+	}
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &userID, Action: action, TableName: "users", RecordID: &userID,
+		NewValues: gin.H{"method": method}, IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+}
+
+// currentSession reads the user and session IDs set by TenangAuthMiddleware.
+func currentSession(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, _, _, _, err := middleware.GetUserFromTenangContext(c)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+	sessionID, err := uuid.Parse(c.GetString("session_id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, sessionID, true
+}
+
+// recordVerificationSent writes the email_verification_sent audit row that
+// ResendVerification throttles on. It is written before sendVerificationEmail starts,
+// so the throttle sees the send even while the email is still in flight.
+func recordVerificationSent(tx *gorm.DB, user models.User, clientIP, userAgent string) error {
+	return services.WriteAudit(tx, services.AuditEntry{
+		UserID: &user.ID, Action: "email_verification_sent", TableName: "users", RecordID: &user.ID,
+		IPAddress: clientIP, UserAgent: userAgent,
+	})
+}
+
+// sendVerificationEmail signs a verification token for the user and emails the link.
+// The send must already be recorded with recordVerificationSent.
+func (a *AuthController) sendVerificationEmail(user models.User) {
+	expiry := a.Cfg.Security.EmailVerificationExpiry
+	token, err := services.SignPurposeToken(a.Cfg.JWT.EncryptionKey, emailVerificationPurpose, user.ID, user.Email, expiry)
+	if err != nil {
+		log.Printf("ERROR: Failed to sign verification token for user %s: %v", user.ID, err)
+		return
+	}
+
+	verifyLink := fmt.Sprintf("%s/verify-email?token=%s", a.Cfg.Server.FrontendURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Halo,\n\n"+
+		"Terima kasih sudah bergabung dengan Tenang.in. Konfirmasi alamat email kamu dengan membuka tautan berikut:\n\n%s\n\n"+
+		"Tautan ini berlaku selama %s. Jika kamu tidak mendaftar di Tenang.in, abaikan email ini.\n\n"+
+		"Salam hangat,\nTim Tenang.in 🌸", verifyLink, formatDurationID(expiry))
+
+	if err := a.Email.Send(services.EmailMessage{To: user.Email, Subject: "Verifikasi email Tenang.in", TextBody: body}); err != nil {
+		log.Printf("ERROR: Failed to send verification email to user %s: %v", user.ID, err)
+	}
+}
+
+// formatDurationID renders a duration in Indonesian for user-facing emails.
+func formatDurationID(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d jam", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d menit", int(d.Minutes()))
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/models"
+	"backend/testutil"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestEmailLookupsIgnoreCase(t *testing.T) {
+	db := testutil.OpenDB(t)
+	auth := NewAuthController(db, newTestConfig())
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("db", db); c.Next() })
+	router.POST("/api/v1/auth/register", auth.Register)
+	router.POST("/api/v1/auth/login", auth.Login)
+
+	// Akun lama yang tersimpan persis seperti diketik saat mendaftar
+	user := createTestUser(t, db, "Alice@Example.com")
+	hash, _ := bcrypt.GenerateFromPassword([]byte("rahasia-123"), bcrypt.MinCost)
+	db.Model(&models.UserCredentials{}).Where("user_id = ?", user.ID).Update("password_hash", string(hash))
+
+	for _, email := range []string{"alice@example.com", "ALICE@EXAMPLE.COM", "Alice@Example.com"} {
+		recorder, body := performJSON(router, http.MethodPost, "/api/v1/auth/login", gin.H{"email": email, "password": "rahasia-123"}, nil)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("login as %q = %d %v, want 200", email, recorder.Code, body)
+		}
+	}
+
+	recorder, _ := performJSON(router, http.MethodPost, "/api/v1/auth/register", gin.H{
+		"email": "alice@EXAMPLE.com", "password": "rahasia-456", "full_name": "Alice Dua", "date_of_birth": "1995-05-05",
+	}, nil)
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("register with a case variant of an existing email = %d, want 409", recorder.Code)
+	}
+
+	recorder, body := performJSON(router, http.MethodPost, "/api/v1/auth/register", gin.H{
+		"email": "Budi@Example.com", "password": "rahasia-789", "full_name": "Budi", "date_of_birth": "1995-05-05",
+	}, nil)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("register = %d %v", recorder.Code, body)
+	}
+	var stored models.User
+	if err := db.Where("email = ?", "budi@example.com").First(&stored).Error; err != nil {
+		t.Errorf("registered email was not stored normalized: %v", err)
+	}
+}
+
+func TestResendVerificationThrottlesParallelRequests(t *testing.T) {
+	db := testutil.OpenDB(t)
+	cfg := newTestConfig()
+	cfg.Security.VerificationResendCooldown = time.Minute
+	cfg.Security.VerificationResendDailyMax = 5
+	auth := NewAuthController(db, cfg)
+
+	user := createTestUser(t, db, "rani@example.com")
+	db.Model(&user).Update("email_verified_at", nil)
+	user.EmailVerifiedAt = nil
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user", user); c.Next() })
+	router.POST("/api/v1/auth/resend-verification", auth.ResendVerification)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder, _ := performJSON(router, http.MethodPost, "/api/v1/auth/resend-verification", nil, nil)
+			codes <- recorder.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	accepted := 0
+	for code := range codes {
+		switch code {
+		case http.StatusAccepted:
+			accepted++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("%d parallel resends accepted, want 1", accepted)
+	}
+
+	var sent int64
+	db.Model(&models.AuditLog{}).Where("user_id = ? AND action = ?", user.ID, "email_verification_sent").Count(&sent)
+	if sent != 1 {
+		t.Errorf("%d email_verification_sent rows, want 1", sent)
+	}
+}
@@ -2,19 +2,24 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"backend/config"
 	"backend/middleware"
 	"backend/models"
+	"backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
 )
 
@@ -22,11 +27,17 @@ import (
 type ChatController struct {
 	DB  *gorm.DB
 	Cfg *config.Config
+	Hub *services.ChatHub // Kanal real-time ke perangkat yang tersambung lewat WebSocket
+	LLM *services.LLMService
+	// Crisis screens every user message before the AI answers
+	Crisis *services.CrisisDetector
+	// Sentiment tags user messages with a sentiment score and emotion in the background
+	Sentiment *services.SentimentTagger
 }
 
 // NewChatController creates a new instance of ChatController.
-func NewChatController(db *gorm.DB, cfg *config.Config) *ChatController {
-	return &ChatController{DB: db, Cfg: cfg}
+func NewChatController(db *gorm.DB, cfg *config.Config, hub *services.ChatHub, llm *services.LLMService, sentiment *services.SentimentTagger) *ChatController {
+	return &ChatController{DB: db, Cfg: cfg, Hub: hub, LLM: llm, Crisis: services.NewCrisisDetector(db, cfg, llm), Sentiment: sentiment}
 }
 
 // --- DTOs and Request Structs for Chat Controller ---
@@ -41,16 +52,34 @@ type ChatSessionResponse struct {
 	SessionDurationSeconds *int       `json:"session_duration_seconds,omitempty"`
 	StartedAt              time.Time  `json:"started_at"`
 	EndedAt                *time.Time `json:"ended_at,omitempty"`
+	AverageSentiment       *float64   `json:"average_sentiment,omitempty"`
 }
 
 type ChatMessageResponse struct {
-	ID             uuid.UUID `json:"id"`
-	ChatSessionID  uuid.UUID `json:"chat_session_id"`
-	SenderType     string    `json:"sender_type"`
-	MessageContent string    `json:"message_content"`
+	ID              uuid.UUID `json:"id"`
+	ChatSessionID   uuid.UUID `json:"chat_session_id"`
+	SenderType      string    `json:"sender_type"`
+	MessageContent  string    `json:"message_content"`
+	SentimentScore  *float64  `json:"sentiment_score,omitempty"` // Hanya pesan pengguna, diisi setelah dianalisis
+	EmotionDetected *string   `json:"emotion_detected,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// MoodPoint is one analysed user message on a session's mood curve.
+type MoodPoint struct {
+	MessageID      uuid.UUID `json:"message_id"`
+	SentimentScore float64   `json:"sentiment_score"`
+	Emotion        string    `json:"emotion"`
 	CreatedAt      time.Time `json:"created_at"`
 }
 
+type SessionMoodResponse struct {
+	Curve            []MoodPoint `json:"curve"`
+	AverageSentiment *float64    `json:"average_sentiment,omitempty"`
+	DominantEmotion  *string     `json:"dominant_emotion,omitempty"`
+	PendingMessages  int         `json:"pending_messages"` // Pesan pengguna yang belum selesai dianalisis
+}
+
 type ScheduledCheckinResponse struct {
 	ID               uuid.UUID  `json:"id"`
 	ScheduleName     *string    `json:"schedule_name,omitempty"`
@@ -78,14 +107,14 @@ type EndSessionRequest struct {
 type CreateCheckinRequest struct {
 	ScheduleName     *string `json:"schedule_name"`
 	TimeOfDay        string  `json:"time_of_day" binding:"required"` // Format: "15:04"
-	DaysOfWeek       []int64 `json:"days_of_week" binding:"required,min=1"`
+	DaysOfWeek       []int64 `json:"days_of_week" binding:"required,min=1,max=7,dive,min=0,max=6"` // 0 = Minggu
 	GreetingTemplate *string `json:"greeting_template"`
 }
 
 type UpdateCheckinRequest struct {
 	ScheduleName     *string  `json:"schedule_name"`
 	TimeOfDay        *string  `json:"time_of_day"`
-	DaysOfWeek       *[]int64 `json:"days_of_week"`
+	DaysOfWeek       *[]int64 `json:"days_of_week" binding:"omitempty,min=1,max=7,dive,min=0,max=6"`
 	GreetingTemplate *string  `json:"greeting_template"`
 	IsActive         *bool    `json:"is_active"`
 }
@@ -95,8 +124,7 @@ type UpdateCheckinRequest struct {
 // CreateSession creates a new chat session for the authenticated user.
 func (ch *ChatController) CreateSession(c *gin.Context) {
 	authedUser, _ := middleware.GetFullUserFromContext(c)
-	loc, _ := time.LoadLocation("Asia/Jakarta")
-	sessionTitle := fmt.Sprintf("Percakapan pada %s", time.Now().In(loc).Format("2 Jan 15:04"))
+	sessionTitle := fmt.Sprintf("Percakapan pada %s", time.Now().In(services.UserLocation(authedUser.Timezone)).Format("2 Jan 15:04"))
 
 	// 1. Buat sesi baru dalam satu transaksi database
 	tx := ch.DB.Begin()
@@ -169,8 +197,32 @@ func (ch *ChatController) GetSessions(c *gin.Context) {
 
 	query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&sessions)
 
+	// Rata-rata sentimen pesan pengguna per sesi, untuk ringkasan suasana hati di daftar
+	sessionIDs := make([]uuid.UUID, 0, len(sessions))
+	for _, s := range sessions {
+		sessionIDs = append(sessionIDs, s.ID)
+	}
+	var averages []struct {
+		ChatSessionID uuid.UUID
+		Average       float64
+	}
+	if len(sessionIDs) > 0 {
+		ch.DB.Model(&models.ChatMessage{}).
+			Select("chat_session_id, ROUND(AVG(sentiment_score), 2) AS average").
+			Where("chat_session_id IN ? AND sender_type = ? AND sentiment_score IS NOT NULL", sessionIDs, "user").
+			Group("chat_session_id").Scan(&averages)
+	}
+	averageBySession := make(map[uuid.UUID]float64, len(averages))
+	for _, a := range averages {
+		averageBySession[a.ChatSessionID] = a.Average
+	}
+
 	var response []ChatSessionResponse
 	for _, s := range sessions {
+		var averageSentiment *float64
+		if average, ok := averageBySession[s.ID]; ok {
+			averageSentiment = &average
+		}
 		response = append(response, ChatSessionResponse{
 			ID:                     s.ID,
 			UserID:                 s.UserID,
@@ -181,13 +233,15 @@ func (ch *ChatController) GetSessions(c *gin.Context) {
 			SessionDurationSeconds: s.SessionDurationSeconds,
 			StartedAt:              s.StartedAt,
 			EndedAt:                s.EndedAt,
+			AverageSentiment:       averageSentiment,
 		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": response})
 }
 
-// GetSession mengambil pesan untuk sesi spesifik (sudah dilengkapi).
+// GetSession mengambil pesan untuk sesi spesifik beserta kurva suasana hati sesi itu.
+// ROUTE: GET /api/v1/chat/sessions/:sessionId
 func (ch *ChatController) GetSession(c *gin.Context) {
 	sessionID, err := uuid.Parse(c.Param("sessionId"))
 	if err != nil {
@@ -207,13 +261,10 @@ func (ch *ChatController) GetSession(c *gin.Context) {
 
 	var response []ChatMessageResponse
 	for _, m := range messages {
-		response = append(response, ChatMessageResponse{
-			ID: m.ID, ChatSessionID: m.ChatSessionID, SenderType: m.SenderType,
-			MessageContent: m.MessageContent, CreatedAt: m.CreatedAt,
-		})
+		response = append(response, mapChatMessageToResponse(m))
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": response}) // PERBAIKAN: Dibungkus dengan "data"
+	c.JSON(http.StatusOK, gin.H{"data": response, "mood": sessionMood(messages)}) // PERBAIKAN: Dibungkus dengan "data"
 }
 
 // SendMessage sends a user message and triggers an AI response.
@@ -240,13 +291,32 @@ func (ch *ChatController) SendMessage(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user message"})
 		return
 	}
+	ch.publishMessage(userMessage)
+	ch.Sentiment.Enqueue(userMessage, *authedUser)
+
+	// Pada risiko tinggi jawaban AI tidak diminta sama sekali; pengguna langsung
+	// menerima pesan keselamatan yang sudah ditinjau.
+	assessment := ch.Crisis.Assess(c.Request.Context(), req.MessageContent)
+	if assessment.Risk == models.CrisisRiskHigh {
+		safetyMessage, err := ch.respondToCrisis(userMessage, *authedUser, assessment)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save AI response", "code": "db_error", "resources": services.CrisisResources})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"data": mapChatMessageToResponse(*safetyMessage), "crisis": crisisResponse(assessment)})
+		return
+	}
+	ch.raiseCrisisAlert(userMessage, *authedUser, assessment)
+	ch.publishTyping(session.ID, true)
 
 	// PERBAIKAN: Tidak lagi menggunakan goroutine, panggil langsung dan tunggu hasilnya.
 	aiMessage, err := ch.generateAIResponse(session.ID, *authedUser)
 	if err != nil {
+		ch.publishTyping(session.ID, false)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get AI response", "details": err.Error()})
 		return
 	}
+	ch.publishMessage(*aiMessage)
 
 	// Kembalikan pesan dari AI
 	aiResponse := ChatMessageResponse{
@@ -259,6 +329,157 @@ func (ch *ChatController) SendMessage(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"data": aiResponse})
 }
 
+// StreamMessage sends a user message and streams the AI reply as Server-Sent Events:
+// "start" (the saved user message), "delta" ({"content": ...}) for each token chunk,
+// then "done" with the saved AI message, or "error". If the client disconnects or the
+// stream fails midway, the partial reply is still saved and flagged as interrupted.
+// ROUTE: POST /api/v1/chat/messages/stream
+func (ch *ChatController) StreamMessage(c *gin.Context) {
+	var req SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	authedUser, _ := middleware.GetFullUserFromContext(c)
+
+	var session models.ChatSession
+	if err := ch.DB.Where("id = ? AND user_id = ? AND session_status = 'active'", req.SessionID, authedUser.ID).First(&session).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Active session not found or access denied"})
+		return
+	}
+
+	if !ch.LLM.Configured(services.LLMFeatureChat) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI service is not configured", "code": "ai_unavailable"})
+		return
+	}
+
+	userMessage := models.ChatMessage{
+		ChatSessionID:  req.SessionID,
+		SenderType:     "user",
+		MessageContent: req.MessageContent,
+	}
+	if err := ch.DB.Create(&userMessage).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user message"})
+		return
+	}
+	ch.publishMessage(userMessage)
+	ch.Sentiment.Enqueue(userMessage, *authedUser)
+
+	assessment := ch.Crisis.Assess(c.Request.Context(), req.MessageContent)
+	if assessment.Risk == models.CrisisRiskHigh {
+		safetyMessage, err := ch.respondToCrisis(userMessage, *authedUser, assessment)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save AI response", "code": "db_error", "resources": services.CrisisResources})
+			return
+		}
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Status(http.StatusOK)
+		writeSSE(c, "start", mapChatMessageToResponse(userMessage))
+		writeSSE(c, "delta", gin.H{"content": safetyMessage.MessageContent})
+		writeSSE(c, "done", gin.H{"data": mapChatMessageToResponse(*safetyMessage), "crisis": crisisResponse(assessment)})
+		return
+	}
+	ch.raiseCrisisAlert(userMessage, *authedUser, assessment)
+	ch.publishTyping(session.ID, true)
+	defer ch.publishTyping(session.ID, false)
+
+	// Konteks request ikut dibatalkan saat klien memutus koneksi, sehingga
+	// pembuatan jawaban di penyedia model juga berhenti.
+	ctx := c.Request.Context()
+	start := time.Now()
+	stream, err := ch.LLM.Stream(ctx, ch.buildChatRequest(session.ID, *authedUser))
+	if err != nil {
+		log.Printf("❌ [AI] %s stream error: %v", ch.LLM.ProviderName(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to get AI response", "code": "ai_request_failed"})
+		return
+	}
+	defer stream.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Matikan buffering di reverse proxy (nginx)
+	c.Status(http.StatusOK)
+	writeSSE(c, "start", mapChatMessageToResponse(userMessage))
+
+	var content strings.Builder
+	var firstToken time.Duration
+	finishReason, interruption := "", ""
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				interruption = "client_disconnected"
+			} else {
+				interruption = "upstream_error"
+				log.Printf("❌ [AI] Stream for session %s failed: %v", session.ID, err)
+			}
+			break
+		}
+		if chunk.FinishReason != "" {
+			finishReason = chunk.FinishReason
+		}
+		delta := chunk.Content
+		if delta == "" {
+			continue
+		}
+		if firstToken == 0 {
+			firstToken = time.Since(start)
+		}
+		content.WriteString(delta)
+		if !writeSSE(c, "delta", gin.H{"content": delta}) {
+			interruption = "client_disconnected"
+			break
+		}
+	}
+
+	if content.Len() == 0 {
+		if interruption != "client_disconnected" {
+			writeSSE(c, "error", gin.H{"error": "Failed to get AI response", "code": "ai_request_failed"})
+		}
+		return
+	}
+
+	responseTimeMs := int(time.Since(start).Milliseconds())
+	metadata, _ := json.Marshal(gin.H{
+		"streamed":               true,
+		"time_to_first_token_ms": firstToken.Milliseconds(),
+		"finish_reason":          finishReason,
+		"interrupted":            interruption != "",
+		"interruption_reason":    interruption,
+	})
+	aiMessage := models.ChatMessage{
+		ChatSessionID:   session.ID,
+		SenderType:      "ai_bot",
+		MessageContent:  content.String(),
+		MessageMetadata: string(metadata),
+		ResponseTimeMs:  &responseTimeMs,
+	}
+	// Disimpan dengan DB tanpa konteks request, agar tetap tersimpan setelah klien pergi.
+	if err := ch.DB.Create(&aiMessage).Error; err != nil {
+		log.Printf("❌ [AI] Failed to save streamed AI message for session %s: %v", session.ID, err)
+		writeSSE(c, "error", gin.H{"error": "Failed to save AI response", "code": "db_error"})
+		return
+	}
+	ch.publishMessage(aiMessage)
+
+	if interruption == "upstream_error" {
+		writeSSE(c, "error", gin.H{"error": "AI response was interrupted", "code": "ai_stream_interrupted", "message_id": aiMessage.ID})
+		return
+	}
+	if interruption == "" {
+		writeSSE(c, "done", gin.H{
+			"data":                   mapChatMessageToResponse(aiMessage),
+			"response_time_ms":       responseTimeMs,
+			"time_to_first_token_ms": firstToken.Milliseconds(),
+		})
+	}
+}
+
 // EndSession ends a chat session.
 func (ch *ChatController) EndSession(c *gin.Context) {
 	sessionID, _ := uuid.Parse(c.Param("sessionId"))
@@ -287,6 +508,8 @@ func (ch *ChatController) EndSession(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session", "code": "db_error"})
 		return
 	}
+	event, err := services.NewChatEvent(services.ChatEventSessionEnded, session.ID, gin.H{"status": session.SessionStatus, "ended_at": session.EndedAt})
+	publishChatEvent(ch.Hub, event, err)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Session ended successfully"})
 }
@@ -326,8 +549,6 @@ func (ch *ChatController) CreateScheduledCheckin(c *gin.Context) {
 		return
 	}
 
-	nextTrigger := calculateNextTriggerTime(timeOfDay, req.DaysOfWeek)
-
 	checkin := models.ScheduledCheckin{
 		UserID:           authedUser.ID,
 		ScheduleName:     req.ScheduleName,
@@ -335,7 +556,7 @@ func (ch *ChatController) CreateScheduledCheckin(c *gin.Context) {
 		DaysOfWeek:       req.DaysOfWeek,
 		GreetingTemplate: req.GreetingTemplate,
 		IsActive:         true,
-		NextTriggerAt:    &nextTrigger,
+		NextTriggerAt:    nextTriggerAt(authedUser, timeOfDay, req.DaysOfWeek),
 	}
 
 	if err := ch.DB.Create(&checkin).Error; err != nil {
@@ -367,10 +588,13 @@ func (ch *ChatController) UpdateScheduledCheckin(c *gin.Context) {
 		checkin.ScheduleName = req.ScheduleName
 	}
 	if req.TimeOfDay != nil {
-		if t, err := time.Parse("15:04", *req.TimeOfDay); err == nil {
-			checkin.TimeOfDay = t
-			scheduleChanged = true
+		t, err := time.Parse("15:04", *req.TimeOfDay)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time format. Use HH:MM", "code": "invalid_time_format"})
+			return
 		}
+		checkin.TimeOfDay = t
+		scheduleChanged = true
 	}
 	if req.DaysOfWeek != nil {
 		checkin.DaysOfWeek = *req.DaysOfWeek
@@ -383,9 +607,8 @@ func (ch *ChatController) UpdateScheduledCheckin(c *gin.Context) {
 		checkin.IsActive = *req.IsActive
 	}
 
-	if scheduleChanged || (req.IsActive != nil && *req.IsActive) {
-		nextTrigger := calculateNextTriggerTime(checkin.TimeOfDay, checkin.DaysOfWeek)
-		checkin.NextTriggerAt = &nextTrigger
+	if checkin.IsActive && (scheduleChanged || req.IsActive != nil) {
+		checkin.NextTriggerAt = nextTriggerAt(authedUser, checkin.TimeOfDay, checkin.DaysOfWeek)
 	} else if req.IsActive != nil && !*req.IsActive {
 		checkin.NextTriggerAt = nil
 	}
@@ -411,110 +634,44 @@ func (ch *ChatController) DeleteScheduledCheckin(c *gin.Context) {
 }
 
 // --- AI Integration ---
+
+// minorSafePrompt ditambahkan ke system prompt untuk pengguna dalam mode aman anak.
+const minorSafePrompt = "The user is a minor. Use simple, age-appropriate language. Never discuss or describe self-harm methods, substances, sexual content, dieting or weight loss, or romantic relationships beyond general emotional support. Do not role-play. Encourage them to talk with a parent, guardian, teacher or school counsellor they trust. If they mention self-harm, abuse, or being in danger, tell them clearly to contact a trusted adult right away and to call 119 (ext. 8) or 112 for emergencies."
 func (ch *ChatController) generateAIResponse(sessionID uuid.UUID, user models.User) (*models.ChatMessage, error) {
 	log.Printf("🤖 [AI] Starting AI response generation for session: %s", sessionID)
 
-	// Ambil konfigurasi
-	apiKey := ch.Cfg.Azure.OpenAIAPIKey
-	endpoint := ch.Cfg.Azure.OpenAIEndpoint
-	deploymentName := ch.Cfg.Azure.OpenAIDeploymentName
-	apiVersion := ch.Cfg.Azure.OpenAIAPIVersion
-
-	// Enhanced logging untuk configuration
-	log.Printf("🔧 [AI] Configuration check:")
-	log.Printf("   Endpoint: %s", endpoint)
-	log.Printf("   Deployment: %s", deploymentName)
-	log.Printf("   API Version: %s", apiVersion)
-	log.Printf("   API Key length: %d", len(apiKey))
-
-	if apiKey == "" || endpoint == "" || deploymentName == "" {
-		msg := fmt.Sprintf("Konfigurasi Azure OpenAI tidak lengkap - KEY:%t, ENDPOINT:%t, DEPLOYMENT:%t",
-			apiKey != "", endpoint != "", deploymentName != "")
-		log.Printf("❌ [AI] %s", msg)
-		return nil, fmt.Errorf(msg)
-	}
-
-	// Setup Azure OpenAI client
-	log.Printf("🔗 [AI] Creating Azure OpenAI client...")
-	config := openai.DefaultAzureConfig(apiKey, endpoint)
-	config.APIVersion = apiVersion
-	client := openai.NewClientWithConfig(config)
-
-	// Ambil history chat
-	log.Printf("📚 [AI] Fetching chat history...")
-	var history []models.ChatMessage
-	ch.DB.Where("chat_session_id = ?", sessionID).Order("created_at DESC").Limit(10).Find(&history)
+	req := ch.buildChatRequest(sessionID, user)
 
-	// Reverse history to have correct chronological order
-	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
-		history[i], history[j] = history[j], history[i]
-	}
-
-	log.Printf("📖 [AI] Found %d messages in history", len(history))
-
-	// Prepare messages for Azure OpenAI
-	systemPrompt := "You are Tenang Assistant, an empathetic and supportive AI friend from Indonesia. Your primary goal is to validate the user's feelings first before asking gentle, open-ended questions. Do not give direct advice unless it's about simple, general wellness like breathing exercises. Never diagnose. Keep responses concise and use a warm, supportive tone in Bahasa Indonesia or English, depending on the user's language used in the session. Always end with a question to encourage further sharing."
-
-	messages := []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
-	}
-
-	for _, msg := range history {
-		role := openai.ChatMessageRoleUser
-		if msg.SenderType == "ai_bot" {
-			role = openai.ChatMessageRoleAssistant
-		}
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    role,
-			Content: msg.MessageContent,
-		})
-		log.Printf("📝 [AI] Added %s message: %.50s...", msg.SenderType, msg.MessageContent)
-	}
-
-	// Prepare request
-	req := openai.ChatCompletionRequest{
-		Model:       deploymentName,
-		Messages:    messages,
-		MaxTokens:   150,
-		Temperature: 0.7,
-	}
-
-	log.Printf("🚀 [AI] Sending request to Azure OpenAI...")
-	log.Printf("   Model: %s", req.Model)
+	log.Printf("🚀 [AI] Sending request to %s...", ch.LLM.ProviderName())
+	log.Printf("   Model: %s", ch.LLM.ModelFor(req.Feature))
 	log.Printf("   Messages count: %d", len(req.Messages))
 	log.Printf("   Max tokens: %d", req.MaxTokens)
 
 	// Make the API call with timing
 	start := time.Now()
-	resp, err := client.CreateChatCompletion(context.Background(), req)
+	resp, err := ch.LLM.Complete(context.Background(), req)
 	duration := time.Since(start)
 
 	if err != nil {
-		log.Printf("❌ [AI] Azure OpenAI API error (took %s): %v", duration, err)
-		log.Printf("❌ [AI] Error type: %T", err)
-		log.Printf("❌ [AI] Full error: %+v", err)
-		return nil, fmt.Errorf("Azure OpenAI API error: %v", err)
+		log.Printf("❌ [AI] LLM error (took %s): %v", duration, err)
+		return nil, fmt.Errorf("LLM error: %w", err)
 	}
 
-	log.Printf("✅ [AI] Azure OpenAI API call successful (took %s)", duration)
+	log.Printf("✅ [AI] LLM call successful (took %s)", duration)
 	log.Printf("📊 [AI] Token usage - Prompt: %d, Completion: %d, Total: %d",
 		resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
 
-	if len(resp.Choices) == 0 {
-		msg := "Azure OpenAI returned no response choices"
-		log.Printf("❌ [AI] %s", msg)
-		return nil, fmt.Errorf(msg)
-	}
-
-	aiResponseContent := resp.Choices[0].Message.Content
-	log.Printf("🎯 [AI] Generated response: %.100s...", aiResponseContent)
+	aiResponseContent := resp.Content
+	log.Printf("🎯 [AI] Generated response for session %s (%d chars)", sessionID, len(aiResponseContent))
 
 	// Save to database
 	log.Printf("💾 [AI] Saving AI message to database...")
+	responseTimeMs := int(duration.Milliseconds())
 	aiMessage := &models.ChatMessage{
 		ChatSessionID:  sessionID,
 		SenderType:     "ai_bot",
 		MessageContent: aiResponseContent,
+		ResponseTimeMs: &responseTimeMs,
 	}
 
 	if err := ch.DB.Create(aiMessage).Error; err != nil {
@@ -528,25 +685,160 @@ func (ch *ChatController) generateAIResponse(sessionID uuid.UUID, user models.Us
 	return aiMessage, nil
 }
 
+// buildChatRequest prepares the completion request: system prompt plus the last 10
+// messages of the session in chronological order.
+func (ch *ChatController) buildChatRequest(sessionID uuid.UUID, user models.User) services.LLMRequest {
+	var history []models.ChatMessage
+	ch.DB.Where("chat_session_id = ?", sessionID).Order("created_at DESC").Limit(10).Find(&history)
+
+	// Reverse history to have correct chronological order
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	systemPrompt := "You are Tenang Assistant, an empathetic and supportive AI friend from Indonesia. Your primary goal is to validate the user's feelings first before asking gentle, open-ended questions. Do not give direct advice unless it's about simple, general wellness like breathing exercises. Never diagnose. Keep responses concise and use a warm, supportive tone in Bahasa Indonesia or English, depending on the user's language used in the session. Always end with a question to encourage further sharing."
+	if services.IsMinor(user, ch.Cfg) {
+		systemPrompt += " " + minorSafePrompt
+	}
+
+	messages := []services.LLMMessage{
+		{Role: services.LLMRoleSystem, Content: systemPrompt},
+	}
+	for _, msg := range history {
+		role := services.LLMRoleUser
+		if msg.SenderType == "ai_bot" {
+			role = services.LLMRoleAssistant
+		}
+		messages = append(messages, services.LLMMessage{Role: role, Content: msg.MessageContent})
+	}
+
+	return services.LLMRequest{
+		Feature:     services.LLMFeatureChat,
+		Messages:    messages,
+		MaxTokens:   150,
+		Temperature: 0.7,
+	}
+}
+
+// --- Crisis Detection ---
+
+// respondToCrisis saves the vetted safety message in place of an AI answer, flags the
+// session and raises the crisis to counselors.
+func (ch *ChatController) respondToCrisis(userMessage models.ChatMessage, user models.User, assessment services.CrisisAssessment) (*models.ChatMessage, error) {
+	alert, err := ch.Crisis.Raise(user, userMessage, assessment, true)
+	if err != nil {
+		// Pesan keselamatan tetap dikirim walaupun peringatan gagal dicatat.
+		log.Printf("ERROR: Failed to raise crisis alert for session %s: %v", userMessage.ChatSessionID, err)
+	}
+
+	metadata := gin.H{"safety_override": true, "risk_level": assessment.Risk, "signals": assessment.Signals}
+	if alert != nil {
+		metadata["crisis_alert_id"] = alert.ID
+	}
+	rawMetadata, _ := json.Marshal(metadata)
+	safetyMessage := models.ChatMessage{
+		ChatSessionID:   userMessage.ChatSessionID,
+		SenderType:      "ai_bot",
+		MessageContent:  services.CrisisSafetyMessage(assessment.Language, services.IsMinor(user, ch.Cfg)),
+		MessageMetadata: string(rawMetadata),
+	}
+	if err := ch.DB.Create(&safetyMessage).Error; err != nil {
+		log.Printf("ERROR: Failed to save crisis safety message for session %s: %v", userMessage.ChatSessionID, err)
+		return nil, err
+	}
+	ch.publishMessage(safetyMessage)
+	return &safetyMessage, nil
+}
+
+// raiseCrisisAlert sends medium-risk messages to the counselor queue; the AI still answers.
+func (ch *ChatController) raiseCrisisAlert(userMessage models.ChatMessage, user models.User, assessment services.CrisisAssessment) {
+	if !assessment.ShouldAlert() {
+		return
+	}
+	if _, err := ch.Crisis.Raise(user, userMessage, assessment, false); err != nil {
+		log.Printf("ERROR: Failed to raise crisis alert for session %s: %v", userMessage.ChatSessionID, err)
+	}
+}
+
+func crisisResponse(assessment services.CrisisAssessment) gin.H {
+	return gin.H{"risk_level": assessment.Risk, "session_flagged": true, "resources": services.CrisisResources}
+}
+
 // --- Helper Function ---
 
-func calculateNextTriggerTime(timeOfDay time.Time, daysOfWeek []int64) time.Time {
-	// (Logika ini diambil dari file Anda karena sudah sangat baik)
-	now := time.Now()
-	today := time.Date(now.Year(), now.Month(), now.Day(), timeOfDay.Hour(), timeOfDay.Minute(), 0, 0, now.Location())
+// writeSSE sends one Server-Sent Event and flushes it. It returns false once the
+// client has gone away.
+func writeSSE(c *gin.Context, event string, data interface{}) bool {
+	if c.Request.Context().Err() != nil {
+		return false
+	}
+	c.SSEvent(event, data)
+	c.Writer.Flush()
+	return c.Request.Context().Err() == nil
+}
 
-	for i := 0; i < 7; i++ {
-		nextDate := today.AddDate(0, 0, i)
-		currentWeekday := int64(nextDate.Weekday()) // Days are 0 (Sun) to 6 (Sat)
+// publishMessage pushes a saved message to every device connected to its session.
+func (ch *ChatController) publishMessage(message models.ChatMessage) {
+	event, err := chatMessageEvent(message)
+	publishChatEvent(ch.Hub, event, err)
+}
 
-		for _, scheduledDay := range daysOfWeek {
-			if scheduledDay == currentWeekday {
-				if nextDate.After(now) {
-					return nextDate
-				}
-			}
+// publishTyping shows or hides the assistant's typing indicator.
+func (ch *ChatController) publishTyping(sessionID uuid.UUID, isTyping bool) {
+	event, err := services.NewChatEvent(services.ChatEventTyping, sessionID, gin.H{"sender_type": "ai_bot", "is_typing": isTyping})
+	publishChatEvent(ch.Hub, event, err)
+}
+
+func mapChatMessageToResponse(m models.ChatMessage) ChatMessageResponse {
+	return ChatMessageResponse{
+		ID: m.ID, ChatSessionID: m.ChatSessionID, SenderType: m.SenderType,
+		MessageContent: m.MessageContent, SentimentScore: m.SentimentScore,
+		EmotionDetected: m.EmotionDetected, CreatedAt: m.CreatedAt,
+	}
+}
+
+// sessionMood builds the mood curve from a session's messages in chronological order.
+func sessionMood(messages []models.ChatMessage) SessionMoodResponse {
+	mood := SessionMoodResponse{Curve: []MoodPoint{}}
+	sum := 0.0
+	emotionCounts := map[string]int{}
+	for _, m := range messages {
+		if m.SenderType != "user" {
+			continue
 		}
+		if m.SentimentScore == nil {
+			mood.PendingMessages++
+			continue
+		}
+		point := MoodPoint{MessageID: m.ID, SentimentScore: *m.SentimentScore, Emotion: models.EmotionNeutral, CreatedAt: m.CreatedAt}
+		if m.EmotionDetected != nil {
+			point.Emotion = *m.EmotionDetected
+		}
+		mood.Curve = append(mood.Curve, point)
+		sum += point.SentimentScore
+		emotionCounts[point.Emotion]++
+	}
+	if len(mood.Curve) == 0 {
+		return mood
+	}
+
+	average := math.Round(sum/float64(len(mood.Curve))*100) / 100
+	mood.AverageSentiment = &average
+	dominant, best := "", 0
+	for _, emotion := range models.Emotions { // Urutan tetap agar hasil seri selalu sama
+		if emotionCounts[emotion] > best {
+			dominant, best = emotion, emotionCounts[emotion]
+		}
+	}
+	mood.DominantEmotion = &dominant
+	return mood
+}
+
+// nextTriggerAt computes the next check-in in the user's own time zone, stored in UTC.
+func nextTriggerAt(user *models.User, timeOfDay time.Time, daysOfWeek []int64) *time.Time {
+	next, ok := services.NextCheckinTrigger(timeOfDay, daysOfWeek, services.UserLocation(user.Timezone), time.Now())
+	if !ok {
+		return nil
 	}
-	// If no suitable day found this week, find for next week
-	return today.AddDate(0, 0, 7)
+	return &next
 }
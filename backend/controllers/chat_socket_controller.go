@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+	"gorm.io/gorm"
+)
+
+// chatSocketProtocol is the subprotocol echoed to browser clients, which must offer
+// it alongside their "bearer.<token>" subprotocol.
+const chatSocketProtocol = "tenang.chat.v1"
+
+const chatSocketHeartbeat = 30 * time.Second
+
+// ChatSocketController serves the real-time WebSocket channel of a chat session.
+type ChatSocketController struct {
+	DB  *gorm.DB
+	Cfg *config.Config
+	Hub *services.ChatHub
+}
+
+// NewChatSocketController creates a new instance of ChatSocketController.
+func NewChatSocketController(db *gorm.DB, cfg *config.Config, hub *services.ChatHub) *ChatSocketController {
+	return &ChatSocketController{DB: db, Cfg: cfg, Hub: hub}
+}
+
+// chatSocketInbound is a frame sent by the client. Messages are still sent through
+// the REST endpoints; the socket only carries typing indicators and pings.
+type chatSocketInbound struct {
+	Type     string `json:"type"` // typing | ping
+	IsTyping bool   `json:"is_typing"`
+}
+
+// Connect upgrades to a WebSocket that pushes the session's messages, typing
+// indicators and the session_ended event. Several devices may be connected at once.
+// After a reconnect, pass ?last_message_id= to receive every message saved since.
+// The login session is re-checked on every heartbeat; once it is revoked or the
+// access token expires the server sends auth_expired and closes the socket.
+// ROUTE: GET /api/v1/chat/sessions/:sessionId/ws
+func (cs *ChatSocketController) Connect(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID", "code": "invalid_session_id"})
+		return
+	}
+	authedUser, _ := middleware.GetFullUserFromContext(c)
+	claims, err := middleware.GetTokenClaimsFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	var session models.ChatSession
+	if err := cs.DB.Where("id = ? AND user_id = ?", sessionID, authedUser.ID).First(&session).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+	if session.SessionStatus != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Chat session has ended", "code": "session_not_active"})
+		return
+	}
+
+	var lastSeen *models.ChatMessage
+	if raw := c.Query("last_message_id"); raw != "" {
+		var message models.ChatMessage
+		lastID, err := uuid.Parse(raw)
+		if err == nil {
+			err = cs.DB.Select("id", "chat_session_id", "created_at").Where("id = ? AND chat_session_id = ?", lastID, sessionID).First(&message).Error
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown last_message_id for this session", "code": "invalid_last_message_id"})
+			return
+		}
+		lastSeen = &message
+	}
+
+	server := websocket.Server{
+		Handshake: cs.handshake,
+		Handler:   func(ws *websocket.Conn) { cs.serve(ws, session.ID, claims, lastSeen) },
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// handshake only accepts browser origins allowed by CORS, and never echoes the
+// token-bearing subprotocol back.
+func (cs *ChatSocketController) handshake(config *websocket.Config, r *http.Request) error {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		allowed := false
+		for _, o := range cs.Cfg.Server.CORSOrigins {
+			if o == origin {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.New("origin not allowed")
+		}
+	}
+
+	offered := config.Protocol
+	config.Protocol = nil
+	for _, protocol := range offered {
+		if protocol == chatSocketProtocol {
+			config.Protocol = []string{chatSocketProtocol}
+		}
+	}
+	return nil
+}
+
+func (cs *ChatSocketController) serve(ws *websocket.Conn, sessionID uuid.UUID, claims *middleware.TenangJWTClaims, lastSeen *models.ChatMessage) {
+	defer ws.Close()
+
+	// Bergabung ke hub sebelum membaca riwayat, agar pesan yang tersimpan di antaranya
+	// tidak terlewat; duplikatnya disaring lewat ID pesan.
+	client, err := cs.Hub.Join(sessionID)
+	if err != nil {
+		log.Printf("ERROR: Failed to join chat hub for session %s: %v", sessionID, err)
+		return
+	}
+	defer cs.Hub.Leave(client)
+
+	replayed := map[uuid.UUID]bool{}
+	if lastSeen != nil {
+		var missed []models.ChatMessage
+		cs.DB.Where("chat_session_id = ? AND (created_at > ? OR (created_at = ? AND id > ?))",
+			sessionID, lastSeen.CreatedAt, lastSeen.CreatedAt, lastSeen.ID).
+			Order("created_at ASC, id ASC").Find(&missed)
+		for _, message := range missed {
+			event, err := chatMessageEvent(message)
+			if err != nil || websocket.JSON.Send(ws, event) != nil {
+				return
+			}
+			replayed[message.ID] = true
+		}
+	}
+
+	closed := make(chan struct{})
+	go cs.readLoop(ws, client, closed)
+
+	heartbeat := time.NewTicker(chatSocketHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-client.Lagged():
+			// Klien menyambung ulang dengan last_message_id untuk mengambil yang terlewat.
+			websocket.JSON.Send(ws, gin.H{"type": "resync_required"})
+			return
+		case event, ok := <-client.Events():
+			if !ok {
+				return
+			}
+			if event.MessageID != nil && replayed[*event.MessageID] {
+				continue
+			}
+			event.Source = ""
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				return
+			}
+			if event.Type == services.ChatEventSessionEnded {
+				return
+			}
+		case <-heartbeat.C:
+			// Token hanya diperiksa saat handshake; logout, pencabutan sesi, ganti password
+			// atau token kedaluwarsa harus ikut memutus koneksi yang sudah terbuka.
+			if err := middleware.CheckSessionStillValid(cs.DB, claims); err != nil {
+				websocket.JSON.Send(ws, gin.H{"type": "auth_expired", "code": chatSocketAuthCode(err)})
+				return
+			}
+			if err := websocket.JSON.Send(ws, gin.H{"type": "heartbeat"}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readLoop handles client frames until the connection closes.
+func (cs *ChatSocketController) readLoop(ws *websocket.Conn, client *services.ChatClient, closed chan<- struct{}) {
+	defer close(closed)
+	for {
+		var frame chatSocketInbound
+		if err := websocket.JSON.Receive(ws, &frame); err != nil {
+			return
+		}
+		switch frame.Type {
+		case "typing":
+			event, err := services.NewChatEvent(services.ChatEventTyping, client.SessionID, gin.H{"sender_type": "user", "is_typing": frame.IsTyping})
+			if err != nil {
+				continue
+			}
+			event.Source = client.ID
+			if err := cs.Hub.Publish(event); err != nil {
+				log.Printf("WARNING: Failed to publish typing event for session %s: %v", client.SessionID, err)
+			}
+		case "ping":
+			websocket.JSON.Send(ws, gin.H{"type": "pong"})
+		}
+	}
+}
+
+// chatSocketAuthCode maps a failed session re-check to the code sent with auth_expired.
+// Clients refresh their tokens and reconnect on token_expired; anything else means
+// the user has to log in again.
+func chatSocketAuthCode(err error) string {
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return "token_expired"
+	}
+	return "session_revoked"
+}
+
+// chatMessageEvent wraps a saved message as a "message" event.
+func chatMessageEvent(message models.ChatMessage) (services.ChatEvent, error) {
+	event, err := services.NewChatEvent(services.ChatEventMessage, message.ChatSessionID, mapChatMessageToResponse(message))
+	if err != nil {
+		return services.ChatEvent{}, err
+	}
+	event.MessageID = &message.ID
+	return event, nil
+}
+
+// publishChatEvent is used by the REST handlers; real-time delivery is best effort
+// because clients can always catch up with last_message_id.
+func publishChatEvent(hub *services.ChatHub, event services.ChatEvent, err error) {
+	if err == nil {
+		err = hub.Publish(event)
+	}
+	if err != nil {
+		log.Printf("WARNING: Failed to publish %s event for session %s: %v", event.Type, event.SessionID, err)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"net/http"
 	"time"
 
+	"backend/config"
 	"backend/middleware"
 	"backend/models"
+	"backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -13,33 +15,37 @@ import (
 )
 
 type CommunityController struct {
-	DB *gorm.DB
+	DB      *gorm.DB
+	Cfg     *config.Config
+	Avatars *services.AvatarService
 }
 
-func NewCommunityController(db *gorm.DB) *CommunityController {
-	return &CommunityController{DB: db}
+func NewCommunityController(db *gorm.DB, cfg *config.Config, avatars *services.AvatarService) *CommunityController {
+	return &CommunityController{DB: db, Cfg: cfg, Avatars: avatars}
 }
 
 // --- DTOs (Data Transfer Objects) ---
 
 type CommunityPostSummaryResponse struct {
-	ID             uuid.UUID `json:"id"`
-	Title          string    `json:"title"`
-	ContentSnippet string    `json:"content_snippet"`
-	AuthorName     string    `json:"author_name"`
-	ReplyCount     int       `json:"reply_count"`
-	ReactionCount  int       `json:"reaction_count"`
-	LastActivityAt time.Time `json:"last_activity_at"`
+	ID             uuid.UUID            `json:"id"`
+	Title          string               `json:"title"`
+	ContentSnippet string               `json:"content_snippet"`
+	AuthorName     string               `json:"author_name"`
+	AuthorAvatar   *services.AvatarURLs `json:"author_avatar,omitempty"`
+	ReplyCount     int                  `json:"reply_count"`
+	ReactionCount  int                  `json:"reaction_count"`
+	LastActivityAt time.Time            `json:"last_activity_at"`
 }
 
 type CommunityPostReplyResponse struct {
-	ID            uuid.UUID `json:"ID"`
-	AuthorName    string    `json:"author_name"`
-	AuthorID      uuid.UUID `json:"author_id"`
-	Content       string    `json:"content"`
-	IsAnonymous   bool      `json:"is_anonymous"`
-	ReactionCount int       `json:"reaction_count"`
-	CreatedAt     time.Time `json:"CreatedAt"`
+	ID            uuid.UUID            `json:"ID"`
+	AuthorName    string               `json:"author_name"`
+	AuthorID      *uuid.UUID           `json:"author_id,omitempty"`
+	AuthorAvatar  *services.AvatarURLs `json:"author_avatar,omitempty"`
+	Content       string               `json:"content"`
+	IsAnonymous   bool                 `json:"is_anonymous"`
+	ReactionCount int                  `json:"reaction_count"`
+	CreatedAt     time.Time            `json:"CreatedAt"`
 }
 
 type CommunityPostDetailResponse struct {
@@ -47,7 +53,8 @@ type CommunityPostDetailResponse struct {
 	Title         string                       `json:"title"`
 	Content       string                       `json:"content"`
 	AuthorName    string                       `json:"author_name"`
-	AuthorID      uuid.UUID                    `json:"author_id"`
+	AuthorID      *uuid.UUID                   `json:"author_id,omitempty"`
+	AuthorAvatar  *services.AvatarURLs         `json:"author_avatar,omitempty"`
 	IsAnonymous   bool                         `json:"is_anonymous"`
 	ReplyCount    int                          `json:"reply_count"`
 	ReactionCount int                          `json:"reaction_count"`
@@ -71,25 +78,89 @@ type CreateReplyRequest struct {
 
 // --- Implementasi Fungsi Controller ---
 
+// communityAuthor is the author identity that may be shown on a post or reply.
+type communityAuthor struct {
+	Name   string
+	ID     *uuid.UUID
+	Avatar *services.AvatarURLs
+}
+
+// authorOf menentukan identitas penulis yang boleh dikirim ke klien. Untuk konten anonim
+// nama dan avatar tidak pernah disertakan, dan ID penulis hanya dikembalikan kepada
+// penulisnya sendiri (agar tetap bisa mengedit/menghapus).
+func (cc *CommunityController) authorOf(c *gin.Context, userID uuid.UUID, user *models.User, isAnonymous bool, name func(*models.User) *string) communityAuthor {
+	if isAnonymous || user == nil {
+		author := communityAuthor{Name: "Pengguna Anonim"}
+		if viewerID, _, _, _, err := middleware.GetUserFromTenangContext(c); err == nil && viewerID == userID {
+			author.ID = &userID
+		}
+		return author
+	}
+	author := communityAuthor{Name: "Pengguna Anonim", ID: &userID}
+	if n := name(user); n != nil {
+		author.Name = *n
+	}
+	avatar := cc.Avatars.URLs(*user)
+	author.Avatar = &avatar
+	return author
+}
+
+// viewer returns the signed-in user, if any. Public community routes only carry the
+// token claims, so the user is loaded on demand.
+func (cc *CommunityController) viewer(c *gin.Context) *models.User {
+	if user, err := middleware.GetFullUserFromContext(c); err == nil {
+		return user
+	}
+	userID, _, _, _, err := middleware.GetUserFromTenangContext(c)
+	if err != nil {
+		return nil
+	}
+	var user models.User
+	if err := cc.DB.First(&user, "id = ?", userID).Error; err != nil {
+		return nil
+	}
+	return &user
+}
+
+// adultsOnlyHidden reports whether adults-only categories must be hidden: for users in
+// minor-safe mode, and for visitors whose age is unknown.
+func (cc *CommunityController) adultsOnlyHidden(c *gin.Context) bool {
+	user := cc.viewer(c)
+	return user == nil || services.IsMinor(*user, cc.Cfg)
+}
+
+// adultsOnlyCategories selects the IDs of categories hidden in minor-safe mode.
+func (cc *CommunityController) adultsOnlyCategories() *gorm.DB {
+	return cc.DB.Model(&models.CommunityCategory{}).Select("id").Where("adults_only = ?", true)
+}
+
+func respondCategoryRestricted(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"error": "This category is not available in minor-safe mode", "code": "category_restricted"})
+}
+
+func authorUsername(user *models.User) *string { return user.Username }
+func authorFullName(user *models.User) *string { return user.FullName }
+
 func (cc *CommunityController) GetPublicPosts(c *gin.Context) {
 	var posts []models.CommunityPost
-	err := cc.DB.Preload("User").Order("last_activity_at DESC").Limit(20).Find(&posts, "post_status = ?", "published").Error
+	query := cc.DB.Preload("User").Order("last_activity_at DESC").Limit(20)
+	if cc.adultsOnlyHidden(c) {
+		query = query.Where("category_id NOT IN (?)", cc.adultsOnlyCategories())
+	}
+	err := query.Find(&posts, "post_status = ?", "published").Error
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data postingan"})
 		return
 	}
 	var response []CommunityPostSummaryResponse
 	for _, post := range posts {
-		authorName := "Pengguna Anonim"
-		if !post.IsAnonymous && post.User != nil && post.User.Username != nil {
-			authorName = *post.User.Username
-		}
+		author := cc.authorOf(c, post.UserID, post.User, post.IsAnonymous, authorUsername)
 		snippet := post.PostContent
 		if len(snippet) > 100 {
 			snippet = snippet[:100] + "..."
 		}
 		response = append(response, CommunityPostSummaryResponse{
-			ID: post.ID, Title: post.PostTitle, ContentSnippet: snippet, AuthorName: authorName,
+			ID: post.ID, Title: post.PostTitle, ContentSnippet: snippet, AuthorName: author.Name, AuthorAvatar: author.Avatar,
 			ReplyCount: post.ReplyCount, ReactionCount: post.ReactionCount, LastActivityAt: post.LastActivityAt,
 		})
 	}
@@ -104,9 +175,13 @@ func (cc *CommunityController) GetPost(c *gin.Context) {
 	}
 
 	var post models.CommunityPost
-	err = cc.DB.Preload("User").Preload("Replies", func(db *gorm.DB) *gorm.DB {
+	query := cc.DB.Preload("User").Preload("Replies", func(db *gorm.DB) *gorm.DB {
 		return db.Order("community_post_replies.created_at ASC")
-	}).Preload("Replies.User").First(&post, "id = ?", postID).Error
+	}).Preload("Replies.User")
+	if cc.adultsOnlyHidden(c) {
+		query = query.Where("category_id NOT IN (?)", cc.adultsOnlyCategories())
+	}
+	err = query.First(&post, "id = ?", postID).Error
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
@@ -115,25 +190,19 @@ func (cc *CommunityController) GetPost(c *gin.Context) {
 
 	var replyResponses []CommunityPostReplyResponse
 	for _, reply := range post.Replies {
-		replyAuthorName := "Pengguna Anonim"
-		if !reply.IsAnonymous && reply.User != nil {
-			replyAuthorName = *reply.User.FullName
-		}
+		replyAuthor := cc.authorOf(c, reply.UserID, reply.User, reply.IsAnonymous, authorFullName)
 		replyResponses = append(replyResponses, CommunityPostReplyResponse{
-			ID: reply.ID, AuthorName: replyAuthorName, AuthorID: reply.UserID,
+			ID: reply.ID, AuthorName: replyAuthor.Name, AuthorID: replyAuthor.ID, AuthorAvatar: replyAuthor.Avatar,
 			Content: reply.ReplyContent, IsAnonymous: reply.IsAnonymous,
 			ReactionCount: reply.ReactionCount, CreatedAt: reply.CreatedAt,
 		})
 	}
 
-	authorName := "Pengguna Anonim"
-	if !post.IsAnonymous && post.User != nil {
-		authorName = *post.User.FullName
-	}
+	author := cc.authorOf(c, post.UserID, post.User, post.IsAnonymous, authorFullName)
 
 	response := CommunityPostDetailResponse{
-		ID: post.ID, Title: post.PostTitle, Content: post.PostContent, AuthorName: authorName,
-		AuthorID: post.UserID, IsAnonymous: post.IsAnonymous, ReplyCount: post.ReplyCount,
+		ID: post.ID, Title: post.PostTitle, Content: post.PostContent, AuthorName: author.Name,
+		AuthorID: author.ID, AuthorAvatar: author.Avatar, IsAnonymous: post.IsAnonymous, ReplyCount: post.ReplyCount,
 		ReactionCount: post.ReactionCount, CreatedAt: post.CreatedAt, Replies: replyResponses,
 	}
 	c.JSON(http.StatusOK, gin.H{"data": response})
@@ -148,6 +217,16 @@ func (cc *CommunityController) CreatePost(c *gin.Context) {
 	authedUser, _ := middleware.GetFullUserFromContext(c)
 	categoryID, _ := uuid.Parse(req.CategoryID)
 
+	var category models.CommunityCategory
+	if err := cc.DB.First(&category, "id = ? AND is_active = ?", categoryID, true).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category", "code": "invalid_category"})
+		return
+	}
+	if category.AdultsOnly && services.IsMinor(*authedUser, cc.Cfg) {
+		respondCategoryRestricted(c)
+		return
+	}
+
 	post := models.CommunityPost{
 		UserID:      authedUser.ID,
 		CategoryID:  categoryID,
@@ -171,6 +250,15 @@ func (cc *CommunityController) CreateReply(c *gin.Context) {
 	authedUser, _ := middleware.GetFullUserFromContext(c)
 	postID, _ := uuid.Parse(req.PostID)
 
+	if services.IsMinor(*authedUser, cc.Cfg) {
+		var restricted int64
+		cc.DB.Model(&models.CommunityPost{}).Where("id = ? AND category_id IN (?)", postID, cc.adultsOnlyCategories()).Count(&restricted)
+		if restricted > 0 {
+			respondCategoryRestricted(c)
+			return
+		}
+	}
+
 	reply := models.CommunityPostReply{
 		PostID: postID, UserID: authedUser.ID, ReplyContent: req.Content, IsAnonymous: req.IsAnonymous,
 	}
@@ -180,21 +268,30 @@ func (cc *CommunityController) CreateReply(c *gin.Context) {
 	}
 
 	cc.DB.Model(&reply).Preload("User").First(&reply)
-	authorName := "Pengguna Anonim"
-	if !reply.IsAnonymous && reply.User != nil {
-		authorName = *reply.User.FullName
-	}
+	author := cc.authorOf(c, reply.UserID, reply.User, reply.IsAnonymous, authorFullName)
 
 	response := CommunityPostReplyResponse{
-		ID: reply.ID, AuthorName: authorName, AuthorID: authedUser.ID,
-		Content: reply.ReplyContent, CreatedAt: reply.CreatedAt,
+		ID: reply.ID, AuthorName: author.Name, AuthorID: author.ID, AuthorAvatar: author.Avatar,
+		Content: reply.ReplyContent, IsAnonymous: reply.IsAnonymous, CreatedAt: reply.CreatedAt,
 	}
 	c.JSON(http.StatusCreated, gin.H{"data": response})
 }
 
 // --- Placeholder untuk fungsi lainnya ---
+// GetCategories lists active categories. Adults-only categories are left out for
+// users in minor-safe mode and for visitors who are not signed in.
+// ROUTE: GET /api/v1/community/categories
 func (cc *CommunityController) GetCategories(c *gin.Context) {
-	c.JSON(200, gin.H{"message": "not implemented"})
+	var categories []models.CommunityCategory
+	query := cc.DB.Where("is_active = ?", true).Order("display_order ASC, category_name ASC")
+	if cc.adultsOnlyHidden(c) {
+		query = query.Where("adults_only = ?", false)
+	}
+	if err := query.Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil kategori"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": categories})
 }
 func (cc *CommunityController) GetUserPosts(c *gin.Context) {
 	c.JSON(200, gin.H{"message": "not implemented"})
@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CrisisController handles the panic button, staff-confirmed crisis escalations and
+// the counselor review queue of crises detected in chat.
+type CrisisController struct {
+	DB        *gorm.DB
+	Cfg       *config.Config
+	Escalator *services.CrisisEscalator
+}
+
+// NewCrisisController creates a new instance of CrisisController.
+func NewCrisisController(db *gorm.DB, cfg *config.Config) *CrisisController {
+	return &CrisisController{DB: db, Cfg: cfg, Escalator: services.NewCrisisEscalator(db, cfg)}
+}
+
+// --- DTOs ---
+
+type PanicRequest struct {
+	Note      string   `json:"note" binding:"max=500"`
+	Latitude  *float64 `json:"latitude" binding:"omitempty,min=-90,max=90"`
+	Longitude *float64 `json:"longitude" binding:"omitempty,min=-180,max=180"`
+}
+
+type ConfirmCrisisRequest struct {
+	Note string `json:"note" binding:"required,min=5,max=500"`
+}
+
+type ReviewCrisisAlertRequest struct {
+	Action string `json:"action" binding:"required,oneof=acknowledge dismiss escalate"`
+	Note   string `json:"note" binding:"required,min=5,max=500"`
+}
+
+// --- Handlers ---
+
+// TriggerPanic alerts the user's trusted contacts who agreed to panic alerts. Crisis
+// resources are always returned, even when no contact can be reached.
+// ROUTE: POST /api/v1/crisis/panic
+func (cc *CrisisController) TriggerPanic(c *gin.Context) {
+	userID, _, _, _, err := middleware.GetUserFromTenangContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required", "resources": services.CrisisResources})
+		return
+	}
+
+	// Body boleh kosong: dalam keadaan darurat, satu ketukan saja sudah cukup.
+	var req PanicRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error(), "code": "validation_failed", "resources": services.CrisisResources})
+		return
+	}
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		req.Latitude, req.Longitude = nil, nil
+	}
+
+	cc.escalate(c, services.EscalationRequest{
+		UserID: userID, Trigger: models.EscalationTriggerPanic, TriggeredBy: &userID, Note: req.Note,
+		Latitude: req.Latitude, Longitude: req.Longitude, IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+}
+
+// ConfirmCrisis lets a counselor or admin confirm a crisis, alerting the user's
+// contacts who agreed to crisis alerts.
+// ROUTE: POST /api/v1/admin/users/:userId/crisis-escalations
+func (cc *CrisisController) ConfirmCrisis(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "code": "invalid_user_id"})
+		return
+	}
+	staffID, _, _, _, err := middleware.GetUserFromTenangContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+	var req ConfirmCrisisRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error(), "code": "validation_failed"})
+		return
+	}
+
+	cc.escalate(c, services.EscalationRequest{
+		UserID: userID, Trigger: models.EscalationTriggerCrisisConfirmed, TriggeredBy: &staffID, Note: req.Note,
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+}
+
+// ListEscalations returns the user's escalation history, including suppressed attempts.
+// ROUTE: GET /api/v1/users/:userId/crisis-escalations
+// ROUTE: GET /api/v1/admin/users/:userId/crisis-escalations
+func (cc *CrisisController) ListEscalations(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "code": "invalid_user_id"})
+		return
+	}
+
+	var escalations []models.CrisisEscalation
+	if err := cc.DB.Preload("Deliveries").Where("user_id = ?", userID).
+		Order("created_at DESC").Limit(100).Find(&escalations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch crisis escalations", "code": "db_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": escalations})
+}
+
+// ListAlerts returns crises detected in chat messages, open ones by default.
+// ROUTE: GET /api/v1/admin/crisis-alerts
+func (cc *CrisisController) ListAlerts(c *gin.Context) {
+	status := c.DefaultQuery("status", models.CrisisAlertOpen)
+	query := cc.DB.Order("created_at DESC").Limit(100)
+	if status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	if risk := c.Query("risk_level"); risk != "" {
+		query = query.Where("risk_level = ?", risk)
+	}
+
+	var alerts []models.CrisisAlert
+	if err := query.Find(&alerts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch crisis alerts", "code": "db_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": alerts})
+}
+
+// ReviewAlert records a counselor's decision on a detected crisis. "escalate" confirms
+// the crisis and alerts the user's contacts who agreed to crisis alerts.
+// ROUTE: POST /api/v1/admin/crisis-alerts/:alertId/review
+func (cc *CrisisController) ReviewAlert(c *gin.Context) {
+	alertID, err := uuid.Parse(c.Param("alertId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID format", "code": "invalid_alert_id"})
+		return
+	}
+	staffID, _, _, _, err := middleware.GetUserFromTenangContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+	var req ReviewCrisisAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error(), "code": "validation_failed"})
+		return
+	}
+
+	var alert models.CrisisAlert
+	if err := cc.DB.First(&alert, "id = ?", alertID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Crisis alert not found", "code": "not_found"})
+		return
+	}
+	// Peringatan yang sudah ditangani masih boleh diteruskan atau ditutup; yang sudah
+	// diteruskan atau ditutup bersifat final.
+	if alert.Status == models.CrisisAlertEscalated || alert.Status == models.CrisisAlertDismissed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Crisis alert has already been resolved", "code": "alert_already_resolved", "status": alert.Status})
+		return
+	}
+
+	var escalation *models.CrisisEscalation
+	status := map[string]string{"acknowledge": models.CrisisAlertAcknowledged, "dismiss": models.CrisisAlertDismissed, "escalate": models.CrisisAlertEscalated}[req.Action]
+	if req.Action == "escalate" {
+		escalation, _, err = cc.Escalator.Escalate(services.EscalationRequest{
+			UserID: alert.UserID, Trigger: models.EscalationTriggerCrisisConfirmed, TriggeredBy: &staffID, Note: req.Note,
+			IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+		})
+		// Dalam masa cooldown kontak sudah dihubungi baru-baru ini; peringatan tetap
+		// dianggap diteruskan dan tercatat pada eskalasi yang ditahan.
+		if err != nil && !errors.Is(err, services.ErrEscalationCooldown) {
+			log.Printf("ERROR: Crisis escalation for alert %s failed: %v", alert.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to alert trusted contacts", "code": "escalation_failed"})
+			return
+		}
+		alert.EscalationID = &escalation.ID
+	}
+
+	now := time.Now()
+	oldStatus := alert.Status
+	alert.Status, alert.ReviewedBy, alert.ReviewedAt, alert.ReviewNote = status, &staffID, &now, &req.Note
+	if err := cc.DB.Save(&alert).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update crisis alert", "code": "db_error"})
+		return
+	}
+	services.RecordAudit(cc.DB, services.AuditEntry{
+		UserID: &staffID, Action: "crisis_alert_" + alert.Status, TableName: "crisis_alerts", RecordID: &alert.ID,
+		OldValues: map[string]interface{}{"status": oldStatus},
+		NewValues: map[string]interface{}{"status": alert.Status, "user_id": alert.UserID, "escalation_id": alert.EscalationID},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"data": alert, "escalation": escalation})
+}
+
+// --- Helpers ---
+
+func (cc *CrisisController) escalate(c *gin.Context, req services.EscalationRequest) {
+	escalation, contacts, err := cc.Escalator.Escalate(req)
+	if errors.Is(err, services.ErrEscalationCooldown) {
+		retryAfter := time.Until(cc.lastSentAt(req.UserID).Add(cc.Cfg.Security.CrisisEscalationCooldown))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":               "Trusted contacts were already alerted recently",
+			"code":                "escalation_cooldown",
+			"escalation":          escalation,
+			"retry_after_seconds": int(retryAfter.Seconds()),
+			"resources":           services.CrisisResources,
+		})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found", "resources": services.CrisisResources})
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Crisis escalation for user %s failed: %v", req.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to alert trusted contacts", "code": "escalation_failed", "resources": services.CrisisResources})
+		return
+	}
+
+	message := "Kontak tepercaya kamu sedang dihubungi. Kamu tidak sendirian."
+	if len(contacts) == 0 {
+		message = "Belum ada kontak tepercaya yang bisa dihubungi. Silakan hubungi layanan di bawah ini."
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":           message,
+		"escalation":        escalation,
+		"contacts_notified": len(contacts),
+		"resources":         services.CrisisResources,
+	})
+}
+
+func (cc *CrisisController) lastSentAt(userID uuid.UUID) time.Time {
+	var last models.CrisisEscalation
+	cc.DB.Where("user_id = ? AND status = ?", userID, models.EscalationSent).Order("created_at DESC").First(&last)
+	return last.CreatedAt
+}
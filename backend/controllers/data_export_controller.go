@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Satu ekspor per hari sudah cukup; membuat arsip penuh termasuk audio cukup mahal.
+const dataExportCooldown = 24 * time.Hour
+
+// DataExportController handles personal data export requests (UU PDP right of access).
+type DataExportController struct {
+	DB       *gorm.DB
+	Cfg      *config.Config
+	Exporter *services.DataExporter
+}
+
+// NewDataExportController creates a new instance of DataExportController.
+func NewDataExportController(db *gorm.DB, cfg *config.Config, exporter *services.DataExporter) *DataExportController {
+	return &DataExportController{DB: db, Cfg: cfg, Exporter: exporter}
+}
+
+// --- DTOs ---
+
+type DataExportResponse struct {
+	models.DataExport
+	DownloadURL       *string    `json:"downloadUrl,omitempty"`
+	DownloadExpiresAt *time.Time `json:"downloadExpiresAt,omitempty"`
+}
+
+// --- Handlers ---
+
+// RequestExport queues a new export of everything the platform holds on the user.
+// ROUTE: POST /api/v1/users/:userId/export
+func (dc *DataExportController) RequestExport(c *gin.Context) {
+	user, ok := dc.exportOwner(c)
+	if !ok {
+		return
+	}
+
+	var latest models.DataExport
+	err := dc.DB.Where("user_id = ?", user.ID).Order("created_at DESC").First(&latest).Error
+	if err == nil {
+		switch {
+		case latest.Status == models.DataExportPending || latest.Status == models.DataExportProcessing:
+			c.JSON(http.StatusConflict, gin.H{"error": "An export is already being prepared", "code": "export_in_progress", "export": latest})
+			return
+		case latest.Status != models.DataExportFailed && time.Since(latest.CreatedAt) < dataExportCooldown:
+			retryAt := latest.CreatedAt.Add(dataExportCooldown)
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "You can request one export per day", "code": "export_throttled",
+				"retry_after": int(time.Until(retryAt).Seconds()) + 1,
+			})
+			return
+		}
+	}
+
+	clientIP := c.ClientIP()
+	export := models.DataExport{UserID: user.ID, Status: models.DataExportPending, RequestedIP: &clientIP}
+	if err := dc.DB.Create(&export).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export request", "code": "db_create_failed"})
+		return
+	}
+
+	services.RecordAudit(dc.DB, services.AuditEntry{
+		UserID: &user.ID, Action: "data_export_requested", TableName: "data_exports", RecordID: &export.ID,
+		IPAddress: clientIP, UserAgent: c.Request.UserAgent(),
+	})
+	dc.Exporter.Enqueue(export.ID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Kami sedang menyiapkan salinan data kamu. Kami akan mengabari lewat notifikasi dan email saat sudah siap.",
+		"export":  export,
+	})
+}
+
+// ListExports returns the user's exports; ready ones carry a fresh signed download link.
+// ROUTE: GET /api/v1/users/:userId/export
+func (dc *DataExportController) ListExports(c *gin.Context) {
+	user, ok := dc.exportOwner(c)
+	if !ok {
+		return
+	}
+
+	var exports []models.DataExport
+	if err := dc.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Limit(10).Find(&exports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve exports", "code": "db_query_failed"})
+		return
+	}
+
+	response := make([]DataExportResponse, 0, len(exports))
+	for _, export := range exports {
+		item := DataExportResponse{DataExport: export}
+		if export.Status == models.DataExportReady {
+			if link, expiresAt, err := dc.Exporter.DownloadURL(export, *user); err == nil {
+				item.DownloadURL = &link
+				item.DownloadExpiresAt = &expiresAt
+			}
+		}
+		response = append(response, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"exports": response})
+}
+
+// DownloadExport serves the archive behind a signed, expiring link. The link is the
+// credential, so it works from a browser or email client without a bearer token.
+// ROUTE: GET /api/v1/exports/:exportId/download?token=...
+func (dc *DataExportController) DownloadExport(c *gin.Context) {
+	exportID, err := uuid.Parse(c.Param("exportId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID format", "code": "invalid_export_id"})
+		return
+	}
+
+	claims, err := services.ParsePurposeToken(dc.Cfg.JWT.EncryptionKey, c.Query("token"), services.DataExportPurpose)
+	if err != nil || claims.Reference != exportID.String() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Download link is invalid or has expired", "code": "invalid_download_link"})
+		return
+	}
+
+	var user models.User
+	if err := dc.DB.Where("id = ? AND email = ? AND is_active = ?", claims.UserID, claims.Email, true).First(&user).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Download link is invalid or has expired", "code": "invalid_download_link"})
+		return
+	}
+
+	var export models.DataExport
+	err = dc.DB.Where("id = ? AND user_id = ? AND status = ?", exportID, user.ID, models.DataExportReady).First(&export).Error
+	if err != nil || export.FilePath == nil || (export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt)) {
+		c.JSON(http.StatusGone, gin.H{"error": "This export is no longer available, please request a new one", "code": "export_expired"})
+		return
+	}
+	if _, err := os.Stat(*export.FilePath); err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "This export is no longer available, please request a new one", "code": "export_expired"})
+		return
+	}
+
+	services.RecordAudit(dc.DB, services.AuditEntry{
+		UserID: &user.ID, Action: "data_export_downloaded", TableName: "data_exports", RecordID: &export.ID,
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	completedAt := export.CreatedAt
+	if export.CompletedAt != nil {
+		completedAt = *export.CompletedAt
+	}
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(*export.FilePath, fmt.Sprintf("tenang-data-%s.zip", completedAt.Format("20060102")))
+}
+
+// exportOwner returns the authenticated user if they own the :userId in the path.
+// Unlike other user routes, admins cannot export someone else's data.
+func (dc *DataExportController) exportOwner(c *gin.Context) (*models.User, bool) {
+	user, err := middleware.GetFullUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return nil, false
+	}
+	if c.Param("userId") != user.ID.String() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only export your own data", "code": "access_denied"})
+		return nil, false
+	}
+	return user, true
+}
@@ -10,17 +10,18 @@ import (
 	"time"
 
 	"backend/config"
+	"backend/services"
 
 	"github.com/gin-gonic/gin"
-	"github.com/sashabaranov/go-openai"
 )
 
 type DebugController struct {
 	Cfg *config.Config
+	LLM *services.LLMService
 }
 
-func NewDebugController(cfg *config.Config) *DebugController {
-	return &DebugController{Cfg: cfg}
+func NewDebugController(cfg *config.Config, llm *services.LLMService) *DebugController {
+	return &DebugController{Cfg: cfg, LLM: llm}
 }
 
 // DebugEnvironment shows current environment variables (masked for security)
@@ -33,16 +34,23 @@ func (d *DebugController) DebugEnvironment(c *gin.Context) {
 
 	debug := map[string]interface{}{
 		"azure_config": map[string]string{
-			"api_key_masked":     masked,
-			"endpoint":           d.Cfg.Azure.OpenAIEndpoint,
-			"deployment_name":    d.Cfg.Azure.OpenAIDeploymentName,
-			"api_version":        d.Cfg.Azure.OpenAIAPIVersion,
+			"api_key_masked":  masked,
+			"endpoint":        d.Cfg.Azure.OpenAIEndpoint,
+			"deployment_name": d.Cfg.Azure.OpenAIDeploymentName,
+			"api_version":     d.Cfg.Azure.OpenAIAPIVersion,
+		},
+		"llm_config": map[string]interface{}{
+			"provider":       d.LLM.ProviderName(),
+			"base_url":       d.Cfg.LLM.BaseURL,
+			"default_model":  d.LLM.DefaultModel,
+			"feature_models": d.LLM.FeatureModels,
 		},
 		"config_status": map[string]bool{
-			"api_key_set":      len(d.Cfg.Azure.OpenAIAPIKey) > 0,
-			"endpoint_set":     len(d.Cfg.Azure.OpenAIEndpoint) > 0,
-			"deployment_set":   len(d.Cfg.Azure.OpenAIDeploymentName) > 0,
-			"version_set":      len(d.Cfg.Azure.OpenAIAPIVersion) > 0,
+			"api_key_set":    len(d.Cfg.Azure.OpenAIAPIKey) > 0,
+			"endpoint_set":   len(d.Cfg.Azure.OpenAIEndpoint) > 0,
+			"deployment_set": len(d.Cfg.Azure.OpenAIDeploymentName) > 0,
+			"version_set":    len(d.Cfg.Azure.OpenAIAPIVersion) > 0,
+			"llm_ready":      d.LLM.Configured(services.LLMFeatureChat),
 		},
 		"timestamp": time.Now(),
 	}
@@ -50,95 +58,66 @@ func (d *DebugController) DebugEnvironment(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"debug": debug})
 }
 
-// TestAzureOpenAI tests direct connection to Azure OpenAI
-func (d *DebugController) TestAzureOpenAI(c *gin.Context) {
-	apiKey := d.Cfg.Azure.OpenAIAPIKey
-	endpoint := d.Cfg.Azure.OpenAIEndpoint
-	deploymentName := d.Cfg.Azure.OpenAIDeploymentName
-	apiVersion := d.Cfg.Azure.OpenAIAPIVersion
+// TestLLM sends a short test prompt through the configured language model provider
+func (d *DebugController) TestLLM(c *gin.Context) {
+	provider := d.LLM.ProviderName()
+	model := d.LLM.ModelFor(services.LLMFeatureChat)
 
-	fmt.Printf("🔍 Testing Azure OpenAI Connection...\n")
-	fmt.Printf("   Endpoint: %s\n", endpoint)
-	fmt.Printf("   Deployment: %s\n", deploymentName)
-	fmt.Printf("   API Version: %s\n", apiVersion)
-	fmt.Printf("   API Key Length: %d\n", len(apiKey))
+	fmt.Printf("🔍 Testing LLM Connection...\n")
+	fmt.Printf("   Provider: %s\n", provider)
+	fmt.Printf("   Model: %s\n", model)
 
-	if apiKey == "" || endpoint == "" || deploymentName == "" {
+	if !d.LLM.Configured(services.LLMFeatureChat) {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Missing Azure OpenAI configuration",
+			"error":    "Missing LLM configuration",
+			"provider": provider,
 			"missing": map[string]bool{
-				"api_key":    apiKey == "",
-				"endpoint":   endpoint == "",
-				"deployment": deploymentName == "",
+				"provider": d.LLM.Provider == nil,
+				"model":    model == "",
 			},
 		})
 		return
 	}
 
-	// Test connection
-	config := openai.DefaultAzureConfig(apiKey, endpoint)
-	config.APIVersion = apiVersion
-	client := openai.NewClientWithConfig(config)
+	fmt.Printf("🔗 Sending test request to %s...\n", provider)
 
-	fmt.Printf("🔗 Sending test request to Azure OpenAI...\n")
-
-	req := openai.ChatCompletionRequest{
-		Model: deploymentName,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: "You are a helpful assistant.",
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: "Say 'Hello from Azure OpenAI test' in Indonesian.",
-			},
+	req := services.LLMRequest{
+		Feature: services.LLMFeatureChat,
+		Messages: []services.LLMMessage{
+			{Role: services.LLMRoleSystem, Content: "You are a helpful assistant."},
+			{Role: services.LLMRoleUser, Content: "Say 'Hello from the LLM test' in Indonesian."},
 		},
 		MaxTokens:   50,
 		Temperature: 0.7,
 	}
 
 	start := time.Now()
-	resp, err := client.CreateChatCompletion(context.Background(), req)
+	resp, err := d.LLM.Complete(context.Background(), req)
 	duration := time.Since(start)
 
 	if err != nil {
-		fmt.Printf("❌ Azure OpenAI Error: %v\n", err)
+		fmt.Printf("❌ LLM Error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":    "Azure OpenAI connection failed",
+			"error":    "LLM connection failed",
 			"details":  err.Error(),
 			"duration": duration.String(),
 			"config": map[string]string{
-				"endpoint":    endpoint,
-				"deployment":  deploymentName,
-				"api_version": apiVersion,
+				"provider": provider,
+				"model":    model,
 			},
 		})
 		return
 	}
 
-	if len(resp.Choices) == 0 {
-		fmt.Printf("❌ Azure OpenAI returned no choices\n")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":    "No response choices from Azure OpenAI",
-			"duration": duration.String(),
-		})
-		return
-	}
-
-	response := resp.Choices[0].Message.Content
-	fmt.Printf("✅ Azure OpenAI Response: %s\n", response)
+	fmt.Printf("✅ LLM Response: %s\n", resp.Content)
 	fmt.Printf("✅ Request completed in: %s\n", duration)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":  true,
-		"response": response,
+		"provider": provider,
+		"response": resp.Content,
 		"duration": duration.String(),
-		"usage": map[string]interface{}{
-			"prompt_tokens":     resp.Usage.PromptTokens,
-			"completion_tokens": resp.Usage.CompletionTokens,
-			"total_tokens":      resp.Usage.TotalTokens,
-		},
-		"model": resp.Model,
+		"usage":    resp.Usage,
+		"model":    resp.Model,
 	})
-}
\ No newline at end of file
+}
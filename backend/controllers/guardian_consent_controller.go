@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Jeda minimum sebelum email persetujuan boleh dikirim ulang ke orang tua/wali.
+const guardianConsentResendCooldown = time.Minute
+
+// GuardianConsentController handles parent/guardian consent for users in minor-safe mode.
+type GuardianConsentController struct {
+	DB       *gorm.DB
+	Cfg      *config.Config
+	Consents *services.GuardianConsents
+}
+
+// NewGuardianConsentController creates a new instance of GuardianConsentController.
+func NewGuardianConsentController(db *gorm.DB, cfg *config.Config) *GuardianConsentController {
+	return &GuardianConsentController{DB: db, Cfg: cfg, Consents: services.NewGuardianConsents(db, cfg)}
+}
+
+// --- DTOs ---
+
+type GuardianConsentRequest struct {
+	GuardianName  string `json:"guardian_name" binding:"required,min=2,max=100"`
+	GuardianEmail string `json:"guardian_email" binding:"required,email"`
+	Relationship  string `json:"relationship" binding:"required,min=2,max=50"`
+}
+
+type GuardianConsentResponseRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Decision string `json:"decision" binding:"required,oneof=grant decline"`
+}
+
+type GuardianConsentStatusResponse struct {
+	MinorSafe           bool                    `json:"minor_safe"`
+	DateOfBirthRequired bool                    `json:"date_of_birth_required"` // Usia belum diketahui; isi tanggal lahir dulu
+	ConsentRequired     bool                    `json:"consent_required"`
+	Consent             *models.GuardianConsent `json:"consent,omitempty"`
+}
+
+// --- Handlers ---
+
+// GetConsentStatus reports whether the user is in minor-safe mode and the state of
+// their latest guardian consent request.
+// ROUTE: GET /api/v1/users/:userId/guardian-consent
+func (gc *GuardianConsentController) GetConsentStatus(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "code": "invalid_user_id"})
+		return
+	}
+	var user models.User
+	if err := gc.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, GuardianConsentStatusResponse{
+		MinorSafe:           services.IsMinor(user, gc.Cfg),
+		DateOfBirthRequired: services.AgeUnknown(user),
+		ConsentRequired:     gc.Consents.Required(user),
+		Consent:             gc.Consents.Latest(user.ID),
+	})
+}
+
+// RequestConsent sends (or re-sends) a consent request to a parent or guardian, e.g.
+// after the previous one was declined or the guardian's email address was wrong.
+// ROUTE: POST /api/v1/users/:userId/guardian-consent
+func (gc *GuardianConsentController) RequestConsent(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "code": "invalid_user_id"})
+		return
+	}
+	var req GuardianConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error(), "code": "validation_failed"})
+		return
+	}
+
+	var user models.User
+	if err := gc.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found"})
+		return
+	}
+	if services.AgeUnknown(user) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Add your date of birth before requesting guardian consent", "code": "date_of_birth_required"})
+		return
+	}
+	if !services.IsMinor(user, gc.Cfg) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Guardian consent is only needed for users in minor-safe mode", "code": "consent_not_required"})
+		return
+	}
+	if strings.EqualFold(req.GuardianEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The guardian must use their own email address", "code": "guardian_email_invalid"})
+		return
+	}
+	if !gc.Consents.Required(user) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Guardian consent has already been granted", "code": "consent_already_granted"})
+		return
+	}
+	if latest := gc.Consents.Latest(user.ID); latest != nil && latest.Status == models.GuardianConsentPending &&
+		time.Since(latest.CreatedAt) < guardianConsentResendCooldown {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before sending another consent request", "code": "consent_resend_cooldown"})
+		return
+	}
+
+	var consent *models.GuardianConsent
+	err = gc.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		consent, err = gc.Consents.Create(tx, user.ID, req.GuardianName, req.GuardianEmail, req.Relationship)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create consent request", "code": "db_insert_failed"})
+		return
+	}
+
+	actorID, _, _, _, _ := middleware.GetUserFromTenangContext(c)
+	services.RecordAudit(gc.DB, services.AuditEntry{
+		UserID: &actorID, Action: "guardian_consent_requested", TableName: "guardian_consents", RecordID: &consent.ID,
+		NewValues: gin.H{"user_id": user.ID, "guardian_email": consent.GuardianEmail},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+	go gc.Consents.Notify(*consent, user)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Permintaan persetujuan telah dikirim ke email orang tua/wali.", "consent": consent})
+}
+
+// RespondToConsent records a guardian's decision from the emailed link. The signed
+// token is the credential because guardians do not have an account.
+// ROUTE: POST /api/v1/guardian-consent/respond
+func (gc *GuardianConsentController) RespondToConsent(c *gin.Context) {
+	var req GuardianConsentResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error(), "code": "validation_failed"})
+		return
+	}
+
+	consent, err := gc.Consents.Respond(req.Token, req.Decision == "grant", c.ClientIP(), c.Request.UserAgent())
+	switch {
+	case errors.Is(err, services.ErrInvalidSignedToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Consent link is invalid or has expired", "code": "invalid_consent_link"})
+		return
+	case errors.Is(err, services.ErrConsentNotPending):
+		c.JSON(http.StatusGone, gin.H{"error": "This consent request has already been answered or replaced", "code": "consent_not_pending"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record consent", "code": "db_update_failed"})
+		return
+	}
+
+	message := "Terima kasih. Persetujuan Anda telah dicatat."
+	if consent.Status == models.GuardianConsentDeclined {
+		message = "Terima kasih. Penolakan Anda telah dicatat dan fitur akun tetap dibatasi."
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "status": consent.Status})
+}
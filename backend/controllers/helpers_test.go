@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestConfig returns the settings the controllers need; tokens are signed with HS256.
+func newTestConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Server.PublicURL = "http://localhost:8080"
+	cfg.Server.FrontendURL = "http://localhost:3000"
+	cfg.JWT.AccessSecret = "test-access-secret-test-access-secret"
+	cfg.JWT.RefreshSecret = "test-refresh-secret-test-refresh-secret"
+	cfg.JWT.AccessExpiry = 15 * time.Minute
+	cfg.JWT.RefreshExpiry = time.Hour
+	cfg.JWT.EncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+	cfg.Security.MaxLoginAttempts = 5
+	cfg.Security.LockoutDuration = 15 * time.Minute
+	cfg.Security.MaxLockoutDuration = time.Hour
+	cfg.Security.MFAChallengeExpiry = 5 * time.Minute
+	cfg.Security.MinimumAge = 13
+	cfg.Security.MinorSafeAge = 18
+	config.AppConfig = cfg
+	return cfg
+}
+
+// createTestUser stores an active, verified adult with credentials and preferences.
+func createTestUser(t *testing.T, db *gorm.DB, email string) models.User {
+	t.Helper()
+	now := time.Now()
+	dob := now.AddDate(-25, 0, 0)
+	user := models.User{ID: uuid.New(), Email: email, IsActive: true, EmailVerifiedAt: &now, DateOfBirth: &dob}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	db.Create(&models.UserCredentials{UserID: user.ID})
+	db.Create(&models.UserPreferences{UserID: user.ID})
+	return user
+}
+
+// accessTokenFor issues a real session for user and returns its bearer token.
+func accessTokenFor(t *testing.T, db *gorm.DB, user models.User) string {
+	t.Helper()
+	tokens, err := middleware.IssueTenangSession(db, user, middleware.ClientInfo{IPAddress: "127.0.0.1"}, false)
+	if err != nil {
+		t.Fatalf("issue session: %v", err)
+	}
+	return tokens.AccessToken
+}
+
+// performJSON sends body as JSON and decodes the JSON response.
+func performJSON(router http.Handler, method, path string, body interface{}, headers map[string]string, cookies ...*http.Cookie) (*httptest.ResponseRecorder, map[string]interface{}) {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	var decoded map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &decoded)
+	return recorder, decoded
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImpersonationController lets support staff act as a user to reproduce problems
+// without asking for the user's password. Every step is audited.
+type ImpersonationController struct {
+	DB  *gorm.DB
+	Cfg *config.Config
+}
+
+// NewImpersonationController creates a new instance of ImpersonationController.
+func NewImpersonationController(db *gorm.DB, cfg *config.Config) *ImpersonationController {
+	return &ImpersonationController{DB: db, Cfg: cfg}
+}
+
+// --- DTOs ---
+
+type StartImpersonationRequest struct {
+	Reason          string `json:"reason" binding:"required,min=10,max=500"` // Nomor tiket atau alasan dukungan
+	ReadWrite       bool   `json:"read_write"`
+	DurationMinutes int    `json:"duration_minutes" binding:"omitempty,min=1"`
+}
+
+// --- Handlers ---
+
+// StartImpersonation mints a short-lived access token that acts as the target user.
+// Sessions are read-only unless a super admin explicitly asks for write access.
+// ROUTE: POST /api/v1/admin/users/:userId/impersonate
+func (ic *ImpersonationController) StartImpersonation(c *gin.Context) {
+	targetID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "code": "invalid_user_id"})
+		return
+	}
+
+	var req StartImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A support reason is required", "code": "validation_failed"})
+		return
+	}
+
+	impersonator, err := middleware.GetFullUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+	if impersonator.ID == targetID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot impersonate yourself", "code": "invalid_target"})
+		return
+	}
+	if req.ReadWrite && !hasRole(c, models.RoleSuperAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only super admins can start a read-write support session", "code": "permission_denied"})
+		return
+	}
+
+	var target models.User
+	if err := ic.DB.Where("id = ? AND is_active = ?", targetID, true).First(&target).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found or inactive", "code": "user_not_found"})
+		return
+	}
+
+	// Akun staf tidak boleh diimpersonasi agar tidak ada jalan memutar ke hak akses admin.
+	targetRoles, err := middleware.LoadUserRoles(ic.DB, target.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user roles", "code": "db_query_failed"})
+		return
+	}
+	if len(targetRoles) > 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Staff accounts cannot be impersonated", "code": "target_is_staff"})
+		return
+	}
+
+	expiry := ic.Cfg.Security.ImpersonationExpiry
+	if requested := time.Duration(req.DurationMinutes) * time.Minute; requested > 0 && requested < expiry {
+		expiry = requested
+	}
+
+	token, session, err := middleware.IssueImpersonationSession(ic.DB, target, *impersonator, middleware.ClientInfoFromRequest(c), !req.ReadWrite, expiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start support session", "code": "session_create_failed"})
+		return
+	}
+
+	services.RecordAudit(ic.DB, services.AuditEntry{
+		UserID: &impersonator.ID, Action: "impersonation_started", TableName: "user_sessions", RecordID: &session.ID,
+		NewValues: gin.H{
+			"target_user_id": target.ID, "reason": req.Reason,
+			"read_only": !req.ReadWrite, "expires_at": session.ExpiresAt,
+		},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Support session started. All requests are recorded.",
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int64(expiry.Seconds()),
+		"expires_at":   session.ExpiresAt,
+		"session_id":   session.ID,
+		"read_only":    !req.ReadWrite,
+		"target_user":  gin.H{"id": target.ID, "email": target.Email},
+	})
+}
+
+// ListImpersonations returns support sessions, newest first. ?active=true limits to live ones.
+// ROUTE: GET /api/v1/admin/impersonations
+func (ic *ImpersonationController) ListImpersonations(c *gin.Context) {
+	query := ic.DB.Where("impersonator_id IS NOT NULL")
+	if c.Query("active") == "true" {
+		query = query.Where("is_active = ? AND expires_at > ?", true, time.Now())
+	}
+
+	var sessions []models.UserSession
+	if err := query.Order("created_at DESC").Limit(100).Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve support sessions", "code": "db_query_failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// EndImpersonation revokes a support session before it expires.
+// ROUTE: DELETE /api/v1/admin/impersonations/:sessionId
+func (ic *ImpersonationController) EndImpersonation(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID format", "code": "invalid_session_id"})
+		return
+	}
+
+	var session models.UserSession
+	if err := ic.DB.Where("id = ? AND impersonator_id IS NOT NULL", sessionID).First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Support session not found", "code": "session_not_found"})
+		return
+	}
+	if _, err := middleware.RevokeSession(ic.DB, session.UserID, session.ID, "impersonation_ended"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end support session", "code": "session_revoke_failed"})
+		return
+	}
+
+	adminID, _, _, _, _ := middleware.GetUserFromTenangContext(c)
+	services.RecordAudit(ic.DB, services.AuditEntry{
+		UserID: &adminID, Action: "impersonation_ended", TableName: "user_sessions", RecordID: &session.ID,
+		NewValues: gin.H{"target_user_id": session.UserID, "impersonator_id": session.ImpersonatorID},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Support session ended"})
+}
+
+// hasRole reports whether the authenticated user holds a role (roles are set by TenangAuthMiddleware).
+func hasRole(c *gin.Context, role string) bool {
+	roles, _ := c.Get("roles")
+	names, _ := roles.([]string)
+	for _, name := range names {
+		if name == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Passwordless (magic link) login handlers of AuthController.
+
+type MagicLinkRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	DeviceID string `json:"device_id" binding:"required,min=16,max=128"` // ID acak yang disimpan aplikasi di perangkat
+}
+
+type MagicLinkVerifyRequest struct {
+	Token    string `json:"token" binding:"required"`
+	DeviceID string `json:"device_id" binding:"required,min=16,max=128"`
+}
+
+// RequestMagicLink emails a one-time login link bound to the requesting device.
+// The response is identical whether or not the account exists.
+// ROUTE: POST /api/v1/auth/magic-link
+func (a *AuthController) RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "code": "validation_failed"})
+		return
+	}
+
+	var user models.User
+	if err := a.DB.Scopes(services.EmailEquals(req.Email)).Where("is_active = ?", true).First(&user).Error; err == nil {
+		// Jeda dicadangkan sebelum membalas; hanya pengiriman email yang berjalan di latar.
+		token, err := a.reserveMagicLink(user, req.DeviceID, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			log.Printf("ERROR: Failed to issue magic link for user %s: %v", user.ID, err)
+		} else if token != "" {
+			go a.sendMagicLinkEmail(user, token)
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "If your email is registered, a login link has been sent. Open it on this device.",
+		"expires_in": int64(a.Cfg.Security.MagicLinkExpiry.Seconds()),
+	})
+}
+
+// VerifyMagicLink redeems a magic link and signs the user in.
+// ROUTE: POST /api/v1/auth/magic-link/verify
+func (a *AuthController) VerifyMagicLink(c *gin.Context) {
+	var req MagicLinkVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "code": "validation_failed"})
+		return
+	}
+
+	var link models.MagicLinkToken
+	err := a.DB.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", services.HashToken(req.Token), time.Now()).First(&link).Error
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login link is invalid or has expired", "code": "invalid_magic_link"})
+		return
+	}
+
+	var user models.User
+	if err := a.DB.Where("id = ? AND is_active = ?", link.UserID, true).First(&user).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login link is invalid or has expired", "code": "invalid_magic_link"})
+		return
+	}
+	var credentials models.UserCredentials
+	if err := a.DB.Where("user_id = ?", user.ID).First(&credentials).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if lockedUntil := a.Lockout.LockedUntil(credentials); lockedUntil != nil {
+		respondAccountLocked(c, *lockedUntil)
+		return
+	}
+
+	if services.HashToken(req.DeviceID) != link.DeviceHash {
+		// The link stays valid for the device that asked for it; a forwarded or
+		// intercepted link counts as a failed login attempt.
+		a.recordLogin(c, user.ID, "magic_link", false)
+		lockedUntil, lockErr := a.Lockout.RegisterFailure(credentials, c.ClientIP(), c.Request.UserAgent())
+		if lockErr != nil {
+			log.Printf("ERROR: Failed to record failed magic link login for user %s: %v", user.ID, lockErr)
+		}
+		if lockedUntil != nil {
+			respondAccountLocked(c, *lockedUntil)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "This login link was requested from another device",
+			"code":    "magic_link_device_mismatch",
+			"message": "Open the link on the device where you requested it, or request a new one here.",
+		})
+		return
+	}
+
+	// Tandai terpakai secara atomik agar dua permintaan bersamaan tidak sama-sama berhasil.
+	now := time.Now()
+	result := a.DB.Model(&models.MagicLinkToken{}).
+		Where("id = ? AND used_at IS NULL", link.ID).
+		Update("used_at", now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login link is invalid or has expired", "code": "invalid_magic_link"})
+		return
+	}
+
+	// Membuka link dari inbox membuktikan kepemilikan email.
+	if user.EmailVerifiedAt == nil {
+		a.DB.Model(&user).Update("email_verified_at", now)
+		user.EmailVerifiedAt = &now
+	}
+
+	// Sama seperti Login: penghitung gagal baru direset setelah faktor kedua lolos.
+	if a.mfaEnabled(user.ID) {
+		a.respondWithMFAChallenge(c, user)
+		return
+	}
+
+	a.Lockout.RegisterSuccess(credentials)
+	a.recordLogin(c, user.ID, "magic_link", true)
+	a.DB.Model(&user).Update("last_active_at", now)
+	a.generateTokensAndRespond(c, user, http.StatusOK, "Login berhasil! Selamat datang kembali 🌸")
+}
+
+// --- Helpers ---
+
+// reserveMagicLink stores a device-bound token and records the send, or returns ""
+// when the account is locked or still in its cooldown. The user row is locked so
+// parallel requests cannot both pass the cooldown before the audit row exists.
+func (a *AuthController) reserveMagicLink(user models.User, deviceID, clientIP, userAgent string) (string, error) {
+	var token string
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, "id = ?", user.ID).Error; err != nil {
+			return err
+		}
+
+		var credentials models.UserCredentials
+		if err := tx.Where("user_id = ?", user.ID).First(&credentials).Error; err == nil {
+			if a.Lockout.LockedUntil(credentials) != nil {
+				return nil
+			}
+		}
+
+		// Jeda antar email dicatat lewat audit log, sama seperti kirim ulang verifikasi.
+		var lastSent models.AuditLog
+		err := tx.Where("user_id = ? AND action = ?", user.ID, "magic_link_sent").Order("created_at DESC").First(&lastSent).Error
+		if err == nil && time.Since(lastSent.CreatedAt) < a.Cfg.Security.MagicLinkCooldown {
+			return nil
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		plain, tokenHash, err := services.GenerateSecureToken()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		link := models.MagicLinkToken{
+			UserID:     user.ID,
+			TokenHash:  tokenHash,
+			DeviceHash: services.HashToken(deviceID),
+			ExpiresAt:  now.Add(a.Cfg.Security.MagicLinkExpiry),
+		}
+		if clientIP != "" {
+			link.RequestedIP = &clientIP
+		}
+		if err := tx.Model(&models.MagicLinkToken{}).Where("user_id = ? AND used_at IS NULL", user.ID).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&link).Error; err != nil {
+			return err
+		}
+		if err := services.WriteAudit(tx, services.AuditEntry{
+			UserID: &user.ID, Action: "magic_link_sent", TableName: "magic_link_tokens",
+			RecordID: &link.ID, IPAddress: clientIP, UserAgent: userAgent,
+		}); err != nil {
+			return err
+		}
+		token = plain
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// sendMagicLinkEmail emails a link reserved with reserveMagicLink.
+func (a *AuthController) sendMagicLinkEmail(user models.User, token string) {
+	loginLink := fmt.Sprintf("%s/magic-link?token=%s", a.Cfg.Server.FrontendURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Halo,\n\n"+
+		"Berikut tautan untuk masuk ke akun Tenang.in kamu tanpa password:\n\n%s\n\n"+
+		"Buka tautan ini di perangkat yang sama dengan tempat kamu memintanya. "+
+		"Tautan hanya dapat digunakan sekali dan berlaku selama %s. "+
+		"Jika kamu tidak merasa meminta tautan ini, abaikan email ini; akun kamu tetap aman.\n\n"+
+		"Salam hangat,\nTim Tenang.in 🌸", loginLink, formatDurationID(a.Cfg.Security.MagicLinkExpiry))
+
+	if err := a.Email.Send(services.EmailMessage{To: user.Email, Subject: "Tautan masuk Tenang.in", TextBody: body}); err != nil {
+		log.Printf("ERROR: Failed to send magic link email to user %s: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/models"
+	"backend/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestMagicLinkCooldownHoldsForParallelRequests(t *testing.T) {
+	db := testutil.OpenDB(t)
+	cfg := newTestConfig()
+	cfg.Security.MagicLinkExpiry = 15 * time.Minute
+	cfg.Security.MagicLinkCooldown = time.Minute
+	auth := NewAuthController(db, cfg)
+	router := gin.New()
+	router.POST("/api/v1/auth/magic-link", auth.RequestMagicLink)
+
+	user := createTestUser(t, db, "rani@example.com")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder, _ := performJSON(router, http.MethodPost, "/api/v1/auth/magic-link",
+				gin.H{"email": "rani@example.com", "device_id": "device-0123456789abcdef"}, nil)
+			if recorder.Code != http.StatusAccepted {
+				t.Errorf("magic link request = %d, want 202", recorder.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Cooldown sudah tercatat saat balasan 202 dikirim, bukan menunggu goroutine email.
+	var sent, links int64
+	db.Model(&models.AuditLog{}).Where("user_id = ? AND action = ?", user.ID, "magic_link_sent").Count(&sent)
+	db.Model(&models.MagicLinkToken{}).Where("user_id = ?", user.ID).Count(&links)
+	if sent != 1 || links != 1 {
+		t.Errorf("%d magic_link_sent rows and %d tokens after parallel requests, want 1 each", sent, links)
+	}
+}
@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Two-factor (TOTP) handlers of AuthController.
+
+const (
+	mfaChallengePurpose = "mfa_challenge"
+	mfaIssuer           = "Tenang.in"
+	recoveryCodeCount   = 10
+)
+
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFADisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+var errMFANotEnabled = errors.New("two-factor authentication is not enabled")
+
+// VerifyMFA completes a two-step login with a TOTP or recovery code.
+// ROUTE: POST /api/v1/auth/mfa/verify
+func (a *AuthController) VerifyMFA(c *gin.Context) {
+	var req MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "code": "validation_failed"})
+		return
+	}
+
+	claims, err := services.ParsePurposeToken(a.Cfg.JWT.EncryptionKey, req.MFAToken, mfaChallengePurpose)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA challenge, please log in again", "code": "invalid_mfa_token"})
+		return
+	}
+
+	var user models.User
+	if err := a.DB.Where("id = ? AND email = ? AND is_active = ?", claims.UserID, claims.Email, true).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA challenge, please log in again", "code": "invalid_mfa_token"})
+		return
+	}
+	if !a.consumeMFAChallenge(claims) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "This MFA challenge has already been used, please log in again", "code": "mfa_token_used"})
+		return
+	}
+
+	var credentials models.UserCredentials
+	if err := a.DB.Where("user_id = ?", user.ID).First(&credentials).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if lockedUntil := a.Lockout.LockedUntil(credentials); lockedUntil != nil {
+		respondAccountLocked(c, *lockedUntil)
+		return
+	}
+
+	method := "totp"
+	if req.RecoveryCode != "" {
+		method = "recovery_code"
+		err = a.consumeRecoveryCode(user, req.RecoveryCode)
+	} else {
+		err = a.checkTOTP(user, req.Code)
+	}
+	if err != nil {
+		// Wrong second factors count toward the same lockout as wrong passwords.
+		lockedUntil, lockErr := a.Lockout.RegisterFailure(credentials, c.ClientIP(), c.Request.UserAgent())
+		if lockErr != nil {
+			log.Printf("ERROR: Failed to record failed MFA attempt for user %s: %v", user.ID, lockErr)
+		}
+		if lockedUntil != nil {
+			respondAccountLocked(c, *lockedUntil)
+			return
+		}
+		// Token lama sudah terpakai; beri token baru agar pengguna bisa mencoba lagi
+		// tanpa memasukkan password. Percobaan tetap dibatasi oleh lockout di atas.
+		response := gin.H{"error": "Invalid verification code", "code": "invalid_mfa_code"}
+		if token, err := a.signMFAChallenge(user); err == nil {
+			response["mfa_token"] = token
+			response["expires_in"] = int64(a.Cfg.Security.MFAChallengeExpiry.Seconds())
+		}
+		c.JSON(http.StatusUnauthorized, response)
+		return
+	}
+
+	a.Lockout.RegisterSuccess(credentials)
+	a.DB.Model(&user).Update("last_active_at", time.Now())
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &user.ID, Action: "mfa_login", TableName: "user_mfa",
+		NewValues: gin.H{"method": method}, IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	a.issueSessionAndRespond(c, user, true, http.StatusOK, "Login berhasil! Selamat datang kembali 🌸")
+}
+
+// GetMFAStatus reports whether 2FA is enabled and required for the user.
+// ROUTE: GET /api/v1/auth/mfa
+func (a *AuthController) GetMFAStatus(c *gin.Context) {
+	user, err := middleware.GetFullUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	var mfa models.UserMFA
+	enabled := a.DB.Where("user_id = ? AND is_enabled = ?", user.ID, true).First(&mfa).Error == nil
+	required, _ := middleware.UserRequiresMFA(a.DB, user.ID)
+
+	var remainingCodes int64
+	if enabled {
+		a.DB.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remainingCodes)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  enabled,
+		"enabled_at":               mfa.EnabledAt,
+		"required":                 required,
+		"session_verified":         c.GetBool("mfa_verified"),
+		"recovery_codes_remaining": remainingCodes,
+	})
+}
+
+// SetupMFA generates a new TOTP secret and returns the provisioning URI for the QR code.
+// 2FA stays disabled until EnableMFA confirms a first code.
+// ROUTE: POST /api/v1/auth/mfa/setup
+func (a *AuthController) SetupMFA(c *gin.Context) {
+	user, err := middleware.GetFullUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	var existing models.UserMFA
+	if err := a.DB.Where("user_id = ?", user.ID).First(&existing).Error; err == nil && existing.IsEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled", "code": "mfa_already_enabled"})
+		return
+	}
+
+	secret, err := services.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret", "code": "mfa_setup_failed"})
+		return
+	}
+	encrypted, err := services.EncryptString(a.Cfg.Security.EncryptionKey, secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to secure secret", "code": "mfa_setup_failed"})
+		return
+	}
+
+	existing.UserID = user.ID
+	existing.SecretEncrypted = encrypted
+	existing.IsEnabled = false
+	existing.LastUsedStep = 0
+	if err := a.DB.Save(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret", "code": "db_update_failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Scan the QR code with your authenticator app, then confirm with a code.",
+		"secret":           secret,
+		"provisioning_uri": services.TOTPProvisioningURI(secret, user.Email, mfaIssuer),
+	})
+}
+
+// EnableMFA confirms the pending secret with a first code and returns the recovery codes.
+// ROUTE: POST /api/v1/auth/mfa/enable
+func (a *AuthController) EnableMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "code": "validation_failed"})
+		return
+	}
+	user, err := middleware.GetFullUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	var mfa models.UserMFA
+	if err := a.DB.Where("user_id = ?", user.ID).First(&mfa).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first", "code": "mfa_setup_required"})
+		return
+	}
+	if mfa.IsEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled", "code": "mfa_already_enabled"})
+		return
+	}
+	step, ok := a.validateMFACode(mfa, req.Code)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code", "code": "invalid_mfa_code"})
+		return
+	}
+
+	codes, hashes, err := services.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes", "code": "mfa_setup_failed"})
+		return
+	}
+
+	now := time.Now()
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&mfa).Updates(map[string]interface{}{"is_enabled": true, "enabled_at": now, "last_used_step": step}).Error; err != nil {
+			return err
+		}
+		if err := replaceRecoveryCodes(tx, user.ID, hashes); err != nil {
+			return err
+		}
+		// The device that just proved possession of the authenticator counts as verified.
+		return tx.Model(&models.UserSession{}).Where("id = ?", c.GetString("session_id")).Update("mfa_verified", true).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication", "code": "db_transaction_failed"})
+		return
+	}
+
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &user.ID, Action: "mfa_enabled", TableName: "user_mfa", RecordID: &mfa.ID,
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled. Store these recovery codes somewhere safe; they are shown only once.",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFA turns 2FA off after re-checking the password and a current code.
+// Users whose role requires 2FA cannot disable it.
+// ROUTE: POST /api/v1/auth/mfa/disable
+func (a *AuthController) DisableMFA(c *gin.Context) {
+	var req MFADisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "code": "validation_failed"})
+		return
+	}
+	user, err := middleware.GetFullUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	if required, _ := middleware.UserRequiresMFA(a.DB, user.ID); required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your role requires two-factor authentication", "code": "mfa_mandatory"})
+		return
+	}
+
+	var credentials models.UserCredentials
+	if err := a.DB.Where("user_id = ?", user.ID).First(&credentials).Error; err != nil ||
+		bcrypt.CompareHashAndPassword([]byte(credentials.PasswordHash), []byte(req.Password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid current password", "code": "invalid_password"})
+		return
+	}
+	if err := a.checkTOTP(*user, req.Code); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code", "code": "invalid_mfa_code"})
+		return
+	}
+
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.UserMFA{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication", "code": "db_transaction_failed"})
+		return
+	}
+
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &user.ID, Action: "mfa_disabled", TableName: "user_mfa",
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current TOTP code.
+// ROUTE: POST /api/v1/auth/mfa/recovery-codes
+func (a *AuthController) RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "code": "validation_failed"})
+		return
+	}
+	user, err := middleware.GetFullUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	if err := a.checkTOTP(*user, req.Code); err != nil {
+		if errors.Is(err, errMFANotEnabled) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled", "code": "mfa_not_enabled"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code", "code": "invalid_mfa_code"})
+		return
+	}
+
+	codes, hashes, err := services.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes", "code": "mfa_setup_failed"})
+		return
+	}
+	if err := a.DB.Transaction(func(tx *gorm.DB) error { return replaceRecoveryCodes(tx, user.ID, hashes) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recovery codes", "code": "db_transaction_failed"})
+		return
+	}
+
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &user.ID, Action: "mfa_recovery_codes_regenerated", TableName: "mfa_recovery_codes",
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// --- Helpers ---
+
+// mfaEnabled reports whether the user has confirmed a TOTP authenticator.
+func (a *AuthController) mfaEnabled(userID uuid.UUID) bool {
+	var count int64
+	a.DB.Model(&models.UserMFA{}).Where("user_id = ? AND is_enabled = ?", userID, true).Count(&count)
+	return count > 0
+}
+
+// respondWithMFAChallenge is the first step of a 2FA login: instead of tokens the
+// client gets a short-lived challenge to exchange at /auth/mfa/verify.
+func (a *AuthController) respondWithMFAChallenge(c *gin.Context, user models.User) {
+	expiry := a.Cfg.Security.MFAChallengeExpiry
+	token, err := a.signMFAChallenge(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor login", "code": "mfa_challenge_failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Two-factor authentication required",
+		"code":         "mfa_required",
+		"mfa_required": true,
+		"mfa_token":    token,
+		"expires_in":   int64(expiry.Seconds()),
+	})
+}
+
+func (a *AuthController) signMFAChallenge(user models.User) (string, error) {
+	return services.SignPurposeToken(a.Cfg.JWT.EncryptionKey, mfaChallengePurpose, user.ID, user.Email, a.Cfg.Security.MFAChallengeExpiry)
+}
+
+// consumeMFAChallenge records the token's jti and reports false if it was already
+// used, so each challenge token allows exactly one verification attempt.
+func (a *AuthController) consumeMFAChallenge(claims *services.PurposeClaims) bool {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return false
+	}
+	a.DB.Where("expires_at < ?", time.Now()).Delete(&models.UsedMFAChallenge{})
+	used := models.UsedMFAChallenge{TokenID: claims.ID, UserID: claims.UserID, ExpiresAt: claims.ExpiresAt.Time}
+	return a.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&used).RowsAffected == 1
+}
+
+// checkTOTP validates a code for an enabled authenticator and records the used step.
+func (a *AuthController) checkTOTP(user models.User, code string) error {
+	var mfa models.UserMFA
+	if err := a.DB.Where("user_id = ? AND is_enabled = ?", user.ID, true).First(&mfa).Error; err != nil {
+		return errMFANotEnabled
+	}
+
+	step, ok := a.validateMFACode(mfa, code)
+	if !ok {
+		return errors.New("invalid totp code")
+	}
+
+	// Conditional update so the same code cannot be used twice, even concurrently.
+	result := a.DB.Model(&models.UserMFA{}).Where("id = ? AND last_used_step < ?", mfa.ID, step).Update("last_used_step", step)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return errors.New("totp code already used")
+	}
+	return nil
+}
+
+func (a *AuthController) validateMFACode(mfa models.UserMFA, code string) (int64, bool) {
+	secret, err := services.DecryptWithMasterKeys(a.Cfg.Security, mfa.SecretEncrypted)
+	if err != nil {
+		log.Printf("ERROR: Failed to decrypt TOTP secret for user %s: %v", mfa.UserID, err)
+		return 0, false
+	}
+	step, ok := services.ValidateTOTP(secret, code, time.Now())
+	if !ok || step <= mfa.LastUsedStep {
+		return 0, false
+	}
+	return step, true
+}
+
+// consumeRecoveryCode marks a matching unused recovery code as used.
+func (a *AuthController) consumeRecoveryCode(user models.User, code string) error {
+	if !a.mfaEnabled(user.ID) {
+		return errMFANotEnabled
+	}
+	result := a.DB.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, services.HashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil || result.RowsAffected == 0 {
+		return errors.New("invalid recovery code")
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID, hashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return err
+	}
+	records := make([]models.MFARecoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		records = append(records, models.MFARecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	return tx.Create(&records).Error
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"backend/config"
 	"backend/middleware"
 	"backend/models"
+	"backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -16,12 +18,13 @@ import (
 )
 
 type NotificationController struct {
-	DB *gorm.DB
-	Cfg *config.Config
+	DB       *gorm.DB
+	Cfg      *config.Config
+	Notifier *services.Notifier
 }
 
-func NewNotificationController(db *gorm.DB, cfg *config.Config) *NotificationController {
-	return &NotificationController{DB: db, Cfg: cfg}
+func NewNotificationController(db *gorm.DB, cfg *config.Config, notifier *services.Notifier) *NotificationController {
+	return &NotificationController{DB: db, Cfg: cfg, Notifier: notifier}
 }
 
 // --- DTOs and Request Structs ---
@@ -35,13 +38,15 @@ type NotificationResponse struct {
 	ActionURL        *string    `json:"action_url,omitempty"`
 	ActionData       string     `json:"action_data,omitempty"`
 	Priority         string     `json:"priority"`
+	DeliveryMethod   string     `json:"delivery_method"`
+	ScheduledFor     *time.Time `json:"scheduled_for,omitempty"`
 	IsRead           bool       `json:"is_read"`
 	ReadAt           *time.Time `json:"read_at,omitempty"`
 	CreatedAt        time.Time  `json:"created_at"`
 }
 
 type BroadcastRequest struct {
-	NotificationType string `json:"notification_type" binding:"required"`
+	NotificationType string `json:"notification_type" binding:"required,oneof=chat_checkin community_reply community_reaction social_media_alert wellness_reminder account_update"`
 	Title            string `json:"title" binding:"required"`
 	Message          string `json:"message" binding:"required"`
 	ActionURL        string `json:"action_url"`
@@ -97,6 +102,7 @@ func (n *NotificationController) GetUnreadCount(c *gin.Context) {
     var unreadCount int64
     n.DB.Model(&models.Notification{}).
         Where("user_id = ? AND is_read = ? AND (expires_at IS NULL OR expires_at > ?)", authedUser.ID, false, time.Now()).
+        Where("scheduled_for IS NULL OR scheduled_for <= ?", time.Now()).
         Count(&unreadCount)
 
     c.JSON(http.StatusOK, gin.H{"unread_count": unreadCount})
@@ -171,7 +177,11 @@ func (n *NotificationController) SendTestNotification(c *gin.Context) {
         DeliveryMethod:   "push",
     }
 
-    if err := n.DB.Create(&testNotif).Error; err != nil {
+    if err := n.Notifier.Create(&testNotif); err != nil {
+        if errors.Is(err, services.ErrNotificationSuppressed) {
+            c.JSON(http.StatusConflict, gin.H{"error": "Wellness reminders are turned off in your notification settings", "code": "notification_type_disabled"})
+            return
+        }
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create test notification", "code": "db_error"})
         return
     }
@@ -198,46 +208,45 @@ func (n *NotificationController) BroadcastNotification(c *gin.Context) {
         return
     }
 
-    var newNotifications []models.Notification
+    // Setiap notifikasi melewati preferensi penerimanya: jenis yang dimatikan dilewati,
+    // dan yang jatuh pada jam tenang ditunda.
+    created, suppressed := 0, 0
     for _, userID := range userIDs {
-        newNotifications = append(newNotifications, models.Notification{
+        notification := models.Notification{
             UserID:           userID,
             NotificationType: req.NotificationType,
             Title:            req.Title,
             Message:          req.Message,
-            ActionURL:        &req.ActionURL,
             Priority:         "high",
             DeliveryMethod:   "push",
-        })
+        }
+        if req.ActionURL != "" {
+            notification.ActionURL = &req.ActionURL
+        }
+        if err := n.Notifier.Create(&notification); err != nil {
+            if !errors.Is(err, services.ErrNotificationSuppressed) {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create broadcast notifications", "code": "db_batch_error", "users_notified": created})
+                return
+            }
+            suppressed++
+            continue
+        }
+        created++
     }
 
-    if err := n.DB.Create(&newNotifications).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create broadcast notifications", "code": "db_batch_error"})
-        return
-    }
-
-    c.JSON(http.StatusCreated, gin.H{"message": "Broadcast notification created for all active users.", "users_targeted": len(userIDs)})
+    c.JSON(http.StatusCreated, gin.H{"message": "Broadcast notification created for all active users.", "users_targeted": len(userIDs), "users_notified": created, "users_opted_out": suppressed})
 }
 
-// ProcessScheduledNotifications handles sending of scheduled notifications.
+// ProcessScheduledNotifications delivers notifications whose scheduled time has passed.
+// The delivery worker does this every minute; the endpoint lets a cron job or an admin trigger it.
 // ROUTE: POST /api/v1/admin/notifications/process-scheduled
 func (n *NotificationController) ProcessScheduledNotifications(c *gin.Context) {
-	// This function is kept from your original code, it's a good pattern.
-	// In a real production environment, this endpoint would be protected and called by a trusted cron job service.
-	now := time.Now()
-
-	var scheduledNotifications []models.Notification
-	if err := n.DB.Where("scheduled_for <= ? AND is_sent = ?", now, false).Find(&scheduledNotifications).Error; err != nil {
+	processedCount, err := n.Notifier.DeliverDue(time.Now())
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduled notifications"})
 		return
 	}
 
-	processedCount := 0
-	for _, notification := range scheduledNotifications {
-		go sendNotification(n.DB, notification.ID)
-		processedCount++
-	}
-
 	c.JSON(http.StatusOK, gin.H{"message": "Scheduled notifications processed", "processedCount": processedCount})
 }
 
@@ -256,8 +265,9 @@ func applyNotificationFilters(c *gin.Context, query *gorm.DB) *gorm.DB {
 	if priority := c.Query("priority"); priority != "" {
 		query = query.Where("priority = ?", priority)
 	}
-	// Always exclude expired notifications
+	// Always exclude expired notifications, and deferred ones until they are due
 	query = query.Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	query = query.Where("scheduled_for IS NULL OR scheduled_for <= ?", time.Now())
 	return query
 }
 
@@ -272,31 +282,10 @@ func mapNotificationToResponse(notif models.Notification) NotificationResponse {
         ActionURL:        notif.ActionURL,
         ActionData:       notif.ActionData,
         Priority:         notif.Priority,
+        DeliveryMethod:   notif.DeliveryMethod,
+        ScheduledFor:     notif.ScheduledFor,
         IsRead:           notif.IsRead,
         ReadAt:           notif.ReadAt,
         CreatedAt:        notif.CreatedAt,
     }
 }
-
-// sendNotification simulates the sending of a notification.
-func sendNotification(db *gorm.DB, notificationID uuid.UUID) {
-	var notification models.Notification
-	if err := db.First(&notification, notificationID).Error; err != nil {
-		return // Notification not found
-	}
-	if notification.IsSent {
-		return // Already sent
-	}
-
-	// TODO: Implement actual sending logic based on DeliveryMethod
-	// switch notification.DeliveryMethod {
-	// case "push": // pushService.Send(notification)
-	// case "email": // emailService.Send(notification)
-	// }
-
-	// Mark as sent
-	now := time.Now()
-	notification.IsSent = true
-	notification.SentAt = &now
-	db.Save(&notification)
-}
\ No newline at end of file
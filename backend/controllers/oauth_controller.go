@@ -0,0 +1,414 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// External identity (Google OIDC) handlers of AuthController.
+
+const (
+	oauthStateExpiry = 10 * time.Minute
+	// oauthBindingCookie mengikat alur ke browser yang memulainya, sehingga state milik
+	// orang lain tidak bisa diselesaikan di browser korban (login/link CSRF).
+	oauthBindingCookie = "tenang_oauth_binding"
+	oauthBindingPath   = "/api/v1/auth"
+	// legacyGoogleSSOHash was written as the password hash of accounts created by the old ID-token flow.
+	legacyGoogleSSOHash = "google_sso"
+)
+
+type OAuthCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+var (
+	errOAuthStateInvalid   = errors.New("oauth state is invalid or expired")
+	errOAuthLinkNotOwner   = errors.New("oauth link flow was started by another account")
+	errAccountLinkRequired = errors.New("an account with this email already exists")
+)
+
+// GoogleLogin starts the authorization-code flow and returns the Google consent URL.
+// ROUTE: GET /api/v1/auth/google/login
+func (a *AuthController) GoogleLogin(c *gin.Context) {
+	authURL, err := a.startOAuthFlow(c, a.Google, nil)
+	if err != nil {
+		log.Printf("ERROR: Failed to start Google sign-in: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Google sign-in is currently unavailable", "code": "identity_provider_unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL, "expires_in": int64(oauthStateExpiry.Seconds())})
+}
+
+// GoogleCallback finishes the flow: it validates state and the browser binding cookie,
+// exchanges the code with the PKCE verifier and then either signs the user in or links
+// Google to the account that started the flow. Link flows must also be completed by
+// that same signed-in account.
+// ROUTE: POST /api/v1/auth/google/callback
+func (a *AuthController) GoogleCallback(c *gin.Context) {
+	var req OAuthCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "code": "validation_failed"})
+		return
+	}
+
+	binding, _ := c.Cookie(oauthBindingCookie)
+	state, err := a.consumeOAuthState(c, req.State, binding, a.Google.Name())
+	switch {
+	case errors.Is(err, errOAuthLinkNotOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sign in to the account that started linking, then try again", "code": "oauth_link_not_owner"})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in link expired or already used, please try again", "code": "invalid_oauth_state"})
+		return
+	}
+	a.clearOAuthBinding(c)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+	identity, err := a.Google.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("WARNING: Google code exchange failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not verify Google account", "code": "identity_verification_failed"})
+		return
+	}
+
+	if state.LinkUserID != nil {
+		a.linkIdentity(c, *state.LinkUserID, identity)
+		return
+	}
+	a.signInWithIdentity(c, identity)
+}
+
+// StartGoogleLink begins linking Google to the signed-in account.
+// ROUTE: POST /api/v1/auth/identities/google
+func (a *AuthController) StartGoogleLink(c *gin.Context) {
+	userID, _, _, _, err := middleware.GetUserFromTenangContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	var existing int64
+	a.DB.Model(&models.UserIdentity{}).Where("user_id = ? AND provider = ?", userID, a.Google.Name()).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Google is already linked to this account", "code": "identity_already_linked"})
+		return
+	}
+
+	authURL, err := a.startOAuthFlow(c, a.Google, &userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to start Google link: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Google sign-in is currently unavailable", "code": "identity_provider_unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL, "expires_in": int64(oauthStateExpiry.Seconds())})
+}
+
+// ListIdentities returns the external identities linked to the account.
+// ROUTE: GET /api/v1/auth/identities
+func (a *AuthController) ListIdentities(c *gin.Context) {
+	userID, _, _, _, err := middleware.GetUserFromTenangContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+
+	var identities []models.UserIdentity
+	if err := a.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve linked accounts", "code": "db_query_failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"identities": identities, "has_password": a.hasUsablePassword(userID)})
+}
+
+// UnlinkIdentity removes a linked provider, unless it is the account's only way to sign in.
+// ROUTE: DELETE /api/v1/auth/identities/:provider
+func (a *AuthController) UnlinkIdentity(c *gin.Context) {
+	userID, _, _, _, err := middleware.GetUserFromTenangContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "code": "auth_required"})
+		return
+	}
+	provider := c.Param("provider")
+
+	var identity models.UserIdentity
+	if err := a.DB.Where("user_id = ? AND provider = ?", userID, provider).First(&identity).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Linked account not found", "code": "identity_not_found"})
+		return
+	}
+
+	var otherIdentities int64
+	a.DB.Model(&models.UserIdentity{}).Where("user_id = ? AND id <> ?", userID, identity.ID).Count(&otherIdentities)
+	if otherIdentities == 0 && !a.hasUsablePassword(userID) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Set a password before unlinking your only sign-in method",
+			"code":    "last_login_method",
+			"message": "Use 'forgot password' to create a password first, then unlink this account.",
+		})
+		return
+	}
+
+	if err := a.DB.Delete(&identity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink account", "code": "db_delete_failed"})
+		return
+	}
+
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &userID, Action: "identity_unlinked", TableName: "user_identities", RecordID: &identity.ID,
+		OldValues: gin.H{"provider": identity.Provider, "email": identity.Email},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlinked successfully", "provider": provider})
+}
+
+// --- Helpers ---
+
+// startOAuthFlow stores a single-use state with its nonce and PKCE verifier, binds it
+// to this browser with a cookie and returns the provider's consent URL.
+func (a *AuthController) startOAuthFlow(c *gin.Context, provider services.IdentityProvider, linkUserID *uuid.UUID) (string, error) {
+	state, stateHash, err := services.GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	binding, bindingHash, err := services.GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, _, err := services.GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, _, err := services.GenerateSecureToken() // 43 karakter base64url, sesuai RFC 7636
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+
+	a.DB.Where("expires_at < ?", time.Now()).Delete(&models.OAuthState{})
+	record := models.OAuthState{
+		StateHash:    stateHash,
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		BindingHash:  bindingHash,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oauthStateExpiry),
+	}
+	if err := a.DB.Create(&record).Error; err != nil {
+		return "", err
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthBindingCookie, binding, int(oauthStateExpiry.Seconds()), oauthBindingPath, "", a.secureCookies(c), true)
+	return authURL, nil
+}
+
+// consumeOAuthState deletes and returns the state; a second callback with the same state
+// fails. The state is only accepted from the browser holding its binding cookie, and a
+// link state only from the account that started it.
+func (a *AuthController) consumeOAuthState(c *gin.Context, state, binding, provider string) (*models.OAuthState, error) {
+	if binding == "" {
+		return nil, errOAuthStateInvalid
+	}
+
+	var record models.OAuthState
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Returning{}).
+			Where("state_hash = ? AND binding_hash = ? AND provider = ? AND expires_at > ?", services.HashToken(state), services.HashToken(binding), provider, time.Now()).
+			Delete(&record)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return errOAuthStateInvalid
+		}
+		if record.LinkUserID != nil {
+			userID, _, _, _, err := middleware.GetUserFromTenangContext(c)
+			_, impersonating := c.Get("impersonator_id")
+			if err != nil || userID != *record.LinkUserID || impersonating {
+				return errOAuthLinkNotOwner // State tetap terhapus; pemilik harus memulai ulang
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errOAuthLinkNotOwner) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errOAuthStateInvalid
+	}
+	return &record, nil
+}
+
+func (a *AuthController) clearOAuthBinding(c *gin.Context) {
+	c.SetCookie(oauthBindingCookie, "", -1, oauthBindingPath, "", a.secureCookies(c), true)
+}
+
+// secureCookies reports whether cookies must be HTTPS-only: always unless the API runs on plain HTTP.
+func (a *AuthController) secureCookies(c *gin.Context) bool {
+	return c.Request.TLS != nil || strings.HasPrefix(a.Cfg.Server.PublicURL, "https://")
+}
+
+// signInWithIdentity logs in (or registers) the user behind a verified external identity.
+func (a *AuthController) signInWithIdentity(c *gin.Context, identity *services.ExternalIdentity) {
+	if identity.Email == "" || !identity.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your Google email address is not verified", "code": "email_not_verified"})
+		return
+	}
+
+	user, created, err := a.findOrCreateIdentityUser(identity)
+	switch {
+	case errors.Is(err, errAccountLinkRequired):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "An account with this email already exists",
+			"code":    "account_exists_link_required",
+			"message": "Log in with your password, then link Google from your account settings.",
+		})
+		return
+	case errors.Is(err, middleware.ErrUserNotFoundOrInactive):
+		c.JSON(http.StatusForbidden, gin.H{"error": "User account not found or inactive", "code": "user_inactive"})
+		return
+	case err != nil:
+		log.Printf("ERROR: Failed to sign in with %s identity: %v", identity.Provider, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in with Google", "code": "db_transaction_failed"})
+		return
+	}
+
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &user.ID, Action: "oauth_login", TableName: "user_identities",
+		NewValues: gin.H{"provider": identity.Provider, "new_account": created},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	if created {
+		// Google tidak memberi tanggal lahir; chat dan komunitas terkunci sampai pengguna mengisinya.
+		a.generateTokensAndRespond(c, *user, http.StatusCreated, "Akun berhasil dibuat dengan Google! Lengkapi tanggal lahir di profil kamu untuk mulai 🌸")
+		return
+	}
+	if a.mfaEnabled(user.ID) {
+		a.respondWithMFAChallenge(c, *user)
+		return
+	}
+	a.DB.Model(user).Update("last_active_at", time.Now())
+	a.generateTokensAndRespond(c, *user, http.StatusOK, "Login dengan Google berhasil! Selamat datang kembali 🌸")
+}
+
+// findOrCreateIdentityUser resolves the account for an identity. Existing password
+// accounts are never linked implicitly; the owner must link them while signed in.
+func (a *AuthController) findOrCreateIdentityUser(identity *services.ExternalIdentity) (*models.User, bool, error) {
+	now := time.Now()
+
+	var link models.UserIdentity
+	err := a.DB.Where("provider = ? AND provider_subject = ?", identity.Provider, identity.Subject).First(&link).Error
+	if err == nil {
+		var user models.User
+		if err := a.DB.Where("id = ? AND is_active = ?", link.UserID, true).First(&user).Error; err != nil {
+			return nil, false, middleware.ErrUserNotFoundOrInactive
+		}
+		a.DB.Model(&link).Update("last_login_at", now)
+		return &user, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	var user models.User
+	err = a.DB.Scopes(services.EmailEquals(identity.Email)).First(&user).Error
+	if err == nil {
+		if !user.IsActive {
+			return nil, false, middleware.ErrUserNotFoundOrInactive
+		}
+		var credentials models.UserCredentials
+		a.DB.Where("user_id = ?", user.ID).First(&credentials)
+		if credentials.PasswordHash != legacyGoogleSSOHash {
+			return nil, false, errAccountLinkRequired
+		}
+
+		// Account created by the old ID-token flow: attach the identity and drop the placeholder hash.
+		err = a.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&models.UserIdentity{UserID: user.ID, Provider: identity.Provider, ProviderSubject: identity.Subject, Email: identity.Email, LastLoginAt: &now}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&credentials).Update("password_hash", "").Error
+		})
+		return &user, false, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	user = models.User{ID: uuid.New(), Email: identity.Email, IsActive: true, EmailVerifiedAt: &now}
+	if identity.Name != "" {
+		user.FullName = &identity.Name
+	}
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		// Tanpa password: hash kosong tidak akan pernah cocok dengan bcrypt.
+		if err := tx.Create(&models.UserCredentials{UserID: user.ID, PasswordHash: ""}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.UserPreferences{UserID: user.ID}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserIdentity{UserID: user.ID, Provider: identity.Provider, ProviderSubject: identity.Subject, Email: identity.Email, LastLoginAt: &now}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &user, true, nil
+}
+
+// linkIdentity attaches a verified identity to the account that started the link flow.
+func (a *AuthController) linkIdentity(c *gin.Context, userID uuid.UUID, identity *services.ExternalIdentity) {
+	if !identity.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your Google email address is not verified", "code": "email_not_verified"})
+		return
+	}
+
+	var owner models.UserIdentity
+	if err := a.DB.Where("provider = ? AND provider_subject = ?", identity.Provider, identity.Subject).First(&owner).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "This Google account is already linked to another account", "code": "identity_in_use"})
+		return
+	}
+
+	link := models.UserIdentity{UserID: userID, Provider: identity.Provider, ProviderSubject: identity.Subject, Email: identity.Email}
+	if err := a.DB.Create(&link).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Google is already linked to this account", "code": "identity_already_linked"})
+		return
+	}
+
+	services.RecordAudit(a.DB, services.AuditEntry{
+		UserID: &userID, Action: "identity_linked", TableName: "user_identities", RecordID: &link.ID,
+		NewValues: gin.H{"provider": identity.Provider, "email": identity.Email},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Google account linked successfully", "identity": link})
+}
+
+// hasUsablePassword reports whether the account can sign in with a password.
+func (a *AuthController) hasUsablePassword(userID uuid.UUID) bool {
+	var credentials models.UserCredentials
+	if err := a.DB.Select("password_hash").Where("user_id = ?", userID).First(&credentials).Error; err != nil {
+		return false
+	}
+	return credentials.PasswordHash != "" && credentials.PasswordHash != legacyGoogleSSOHash
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+	"backend/testutil"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type oauthTestEnv struct {
+	db     *gorm.DB
+	router *gin.Engine
+	issuer *services.FakeOIDCIssuer
+}
+
+func newOAuthTestEnv(t *testing.T) *oauthTestEnv {
+	t.Helper()
+	db := testutil.OpenDB(t)
+	cfg := newTestConfig()
+
+	issuer, err := services.NewFakeOIDCIssuer(services.FakeOIDCIdentity{Subject: "google-rani", Email: "rani@example.com", EmailVerified: true, Name: "Rani"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(issuer)
+	t.Cleanup(server.Close)
+	cfg.Google.Issuer, cfg.Google.ClientID, cfg.Google.RedirectURI = server.URL, "tenang-client", "http://localhost:3000/auth/google/callback"
+
+	auth := NewAuthController(db, cfg)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("db", db); c.Next() })
+	router.GET("/api/v1/auth/google/login", auth.GoogleLogin)
+	router.POST("/api/v1/auth/google/callback", middleware.OptionalAuth(), auth.GoogleCallback)
+	router.POST("/api/v1/auth/identities/google", middleware.TenangAuthMiddleware(), auth.StartGoogleLink)
+	return &oauthTestEnv{db: db, router: router, issuer: issuer}
+}
+
+// start runs one flow start and returns the consent URL and the binding cookie.
+func (e *oauthTestEnv) start(t *testing.T, method, path, accessToken string) (string, *http.Cookie) {
+	t.Helper()
+	headers := map[string]string{}
+	if accessToken != "" {
+		headers["Authorization"] = "Bearer " + accessToken
+	}
+	recorder, body := performJSON(e.router, method, path, nil, headers)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("%s %s = %d %v", method, path, recorder.Code, body)
+	}
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == oauthBindingCookie && cookie.HttpOnly {
+			return body["authorization_url"].(string), cookie
+		}
+	}
+	t.Fatalf("%s %s did not set an HttpOnly %s cookie", method, path, oauthBindingCookie)
+	return "", nil
+}
+
+func (e *oauthTestEnv) callback(t *testing.T, authURL string, identity services.FakeOIDCIdentity, accessToken string, cookies ...*http.Cookie) (int, map[string]interface{}) {
+	t.Helper()
+	code, state, err := e.issuer.Authorize(authURL, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{}
+	if accessToken != "" {
+		headers["Authorization"] = "Bearer " + accessToken
+	}
+	recorder, body := performJSON(e.router, http.MethodPost, "/api/v1/auth/google/callback", gin.H{"code": code, "state": state}, headers, cookies...)
+	return recorder.Code, body
+}
+
+func TestGoogleCallbackRequiresBindingCookie(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	authURL, cookie := env.start(t, http.MethodGet, "/api/v1/auth/google/login", "")
+
+	// State yang dikirim ke browser lain (tanpa cookie) ditolak dan tidak terpakai.
+	if status, body := env.callback(t, authURL, env.issuer.Identity, ""); status != http.StatusBadRequest || body["code"] != "invalid_oauth_state" {
+		t.Fatalf("callback without cookie = %d %v, want 400 invalid_oauth_state", status, body)
+	}
+	other := *cookie
+	other.Value = "someone-elses-binding"
+	if status, body := env.callback(t, authURL, env.issuer.Identity, "", &other); status != http.StatusBadRequest {
+		t.Fatalf("callback with another browser's cookie = %d %v, want 400", status, body)
+	}
+
+	status, body := env.callback(t, authURL, env.issuer.Identity, "", cookie)
+	if status != http.StatusCreated {
+		t.Fatalf("callback with cookie = %d %v, want 201", status, body)
+	}
+
+	// State sekali pakai: callback kedua dengan state yang sama gagal.
+	if status, _ := env.callback(t, authURL, env.issuer.Identity, "", cookie); status != http.StatusBadRequest {
+		t.Fatalf("replayed state = %d, want 400", status)
+	}
+}
+
+func TestGoogleLinkMustBeCompletedByInitiator(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	owner := createTestUser(t, env.db, "owner@example.com")
+	victim := createTestUser(t, env.db, "victim@example.com")
+	ownerToken := accessTokenFor(t, env.db, owner)
+	victimToken := accessTokenFor(t, env.db, victim)
+	victimGoogle := services.FakeOIDCIdentity{Subject: "google-victim", Email: "victim@gmail.com", EmailVerified: true}
+
+	// Link-CSRF: pemilik memulai alur, korban yang menyelesaikannya dengan akun Google-nya.
+	authURL, cookie := env.start(t, http.MethodPost, "/api/v1/auth/identities/google", ownerToken)
+	for name, token := range map[string]string{"anonymous": "", "another account": victimToken} {
+		authURL, cookie := env.start(t, http.MethodPost, "/api/v1/auth/identities/google", ownerToken)
+		if status, body := env.callback(t, authURL, victimGoogle, token, cookie); status != http.StatusForbidden || body["code"] != "oauth_link_not_owner" {
+			t.Fatalf("%s completing owner's link = %d %v, want 403 oauth_link_not_owner", name, status, body)
+		}
+	}
+	var linked int64
+	env.db.Model(&models.UserIdentity{}).Where("user_id = ?", owner.ID).Count(&linked)
+	if linked != 0 {
+		t.Fatalf("owner has %d linked identities after rejected callbacks, want 0", linked)
+	}
+
+	status, body := env.callback(t, authURL, services.FakeOIDCIdentity{Subject: "google-owner", Email: "owner@gmail.com", EmailVerified: true}, ownerToken, cookie)
+	if status != http.StatusOK {
+		t.Fatalf("owner completing link = %d %v, want 200", status, body)
+	}
+	env.db.Model(&models.UserIdentity{}).Where("user_id = ? AND provider_subject = ?", owner.ID, "google-owner").Count(&linked)
+	if linked != 1 {
+		t.Fatalf("owner has %d google-owner identities, want 1", linked)
+	}
+}
+
+func TestGoogleSignInMatchesExistingEmailIgnoringCase(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	existing := createTestUser(t, env.db, "Alice@Example.com")
+	env.db.Model(&models.UserCredentials{}).Where("user_id = ?", existing.ID).Update("password_hash", "$2a$10$placeholderplaceholderplaceholderplaceholderpla")
+
+	authURL, cookie := env.start(t, http.MethodGet, "/api/v1/auth/google/login", "")
+	alice := services.FakeOIDCIdentity{Subject: "google-alice", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if status, body := env.callback(t, authURL, alice, "", cookie); status != http.StatusConflict || body["code"] != "account_exists_link_required" {
+		t.Fatalf("Google sign-in for a mixed-case password account = %d %v, want 409 account_exists_link_required", status, body)
+	}
+
+	var accounts int64
+	env.db.Model(&models.User{}).Where("LOWER(email) = ?", "alice@example.com").Count(&accounts)
+	if accounts != 1 {
+		t.Fatalf("found %d accounts for alice@example.com, want the existing one only", accounts)
+	}
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RoleController handles role and permission management for admins.
+type RoleController struct {
+	DB *gorm.DB
+}
+
+// NewRoleController creates a new instance of RoleController.
+func NewRoleController(db *gorm.DB) *RoleController {
+	return &RoleController{DB: db}
+}
+
+// --- DTOs ---
+
+type GrantRoleRequest struct {
+	RoleName string `json:"role_name" binding:"required"`
+}
+
+type RoleMFARequest struct {
+	RequireMFA *bool `json:"require_mfa" binding:"required"`
+}
+
+var errLastSuperAdmin = errors.New("cannot remove the last super admin")
+
+// --- Handlers ---
+
+// ListRoles returns all roles together with their permissions.
+// ROUTE: GET /api/v1/admin/roles
+func (rc *RoleController) ListRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := rc.DB.Preload("Permissions").Order("role_name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve roles", "code": "db_query_failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// GetUserRoles returns the roles and effective permissions of a user.
+// ROUTE: GET /api/v1/admin/users/:userId/roles
+func (rc *RoleController) GetUserRoles(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "code": "invalid_user_id"})
+		return
+	}
+	if err := rc.DB.Select("id").Where("id = ?", userID).First(&models.User{}).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found"})
+		return
+	}
+
+	roles, err := middleware.LoadUserRoles(rc.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user roles", "code": "db_query_failed"})
+		return
+	}
+	permissions, err := middleware.LoadUserPermissions(rc.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user permissions", "code": "db_query_failed"})
+		return
+	}
+
+	permissionKeys := make([]string, 0, len(permissions))
+	for key := range permissions {
+		permissionKeys = append(permissionKeys, key)
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "roles": roles, "permissions": permissionKeys})
+}
+
+// GrantRole assigns a role to a user.
+// ROUTE: POST /api/v1/admin/users/:userId/roles
+func (rc *RoleController) GrantRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "code": "invalid_user_id"})
+		return
+	}
+	var req GrantRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "code": "validation_failed"})
+		return
+	}
+	if req.RoleName == models.RoleUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Every user already has the 'user' role", "code": "implicit_role"})
+		return
+	}
+
+	adminID, _, _, _, _ := middleware.GetUserFromTenangContext(c)
+
+	var role models.Role
+	if err := rc.DB.Where("role_name = ?", req.RoleName).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found", "code": "role_not_found"})
+		return
+	}
+	if err := rc.DB.Select("id").Where("id = ? AND is_active = ?", userID, true).First(&models.User{}).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found"})
+		return
+	}
+
+	userRole := models.UserRole{UserID: userID, RoleID: role.ID, GrantedBy: &adminID}
+	result := rc.DB.Where(models.UserRole{UserID: userID, RoleID: role.ID}).Attrs(userRole).FirstOrCreate(&userRole)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant role", "code": "db_create_failed"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "User already has this role", "code": "role_already_granted"})
+		return
+	}
+
+	services.RecordAudit(rc.DB, services.AuditEntry{
+		UserID: &adminID, Action: "role_granted", TableName: "user_roles", RecordID: &userRole.ID,
+		NewValues: gin.H{"user_id": userID, "role": role.RoleName},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Role granted successfully", "user_id": userID, "role": role.RoleName})
+}
+
+// RevokeRole removes a role from a user. The last super-admin cannot be removed.
+// ROUTE: DELETE /api/v1/admin/users/:userId/roles/:roleName
+func (rc *RoleController) RevokeRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "code": "invalid_user_id"})
+		return
+	}
+
+	adminID, _, _, _, _ := middleware.GetUserFromTenangContext(c)
+
+	var role models.Role
+	if err := rc.DB.Where("role_name = ?", c.Param("roleName")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found", "code": "role_not_found"})
+		return
+	}
+
+	var userRole models.UserRole
+	err = rc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND role_id = ?", userID, role.ID).First(&userRole).Error; err != nil {
+			return err
+		}
+		if role.RoleName == models.RoleSuperAdmin {
+			var remaining int64
+			tx.Model(&models.UserRole{}).Where("role_id = ? AND user_id <> ?", role.ID, userID).Count(&remaining)
+			if remaining == 0 {
+				return errLastSuperAdmin
+			}
+		}
+		return tx.Delete(&userRole).Error
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User does not have this role", "code": "role_not_granted"})
+		return
+	case errors.Is(err, errLastSuperAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot remove the last super admin", "code": "last_super_admin"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke role", "code": "db_delete_failed"})
+		return
+	}
+
+	services.RecordAudit(rc.DB, services.AuditEntry{
+		UserID: &adminID, Action: "role_revoked", TableName: "user_roles", RecordID: &userRole.ID,
+		OldValues: gin.H{"user_id": userID, "role": role.RoleName, "granted_by": userRole.GrantedBy},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role revoked successfully", "user_id": userID, "role": role.RoleName})
+}
+
+// SetRoleMFARequirement makes two-factor authentication mandatory (or optional) for a role.
+// ROUTE: PUT /api/v1/admin/roles/:roleName/mfa
+func (rc *RoleController) SetRoleMFARequirement(c *gin.Context) {
+	var req RoleMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "code": "validation_failed"})
+		return
+	}
+
+	var role models.Role
+	if err := rc.DB.Where("role_name = ?", c.Param("roleName")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found", "code": "role_not_found"})
+		return
+	}
+
+	previous := role.RequireMFA
+	if err := rc.DB.Model(&role).Update("require_mfa", *req.RequireMFA).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role", "code": "db_update_failed"})
+		return
+	}
+
+	adminID, _, _, _, _ := middleware.GetUserFromTenangContext(c)
+	services.RecordAudit(rc.DB, services.AuditEntry{
+		UserID: &adminID, Action: "role_mfa_requirement_changed", TableName: "roles", RecordID: &role.ID,
+		OldValues: gin.H{"require_mfa": previous}, NewValues: gin.H{"require_mfa": *req.RequireMFA},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role MFA requirement updated", "role": role.RoleName, "require_mfa": *req.RequireMFA})
+}
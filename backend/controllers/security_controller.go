@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"net/http"
+
+	"backend/middleware"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SecurityController exposes the JWT verification keys and key management for admins.
+type SecurityController struct {
+	DB   *gorm.DB
+	Keys *services.SigningKeyManager
+}
+
+// NewSecurityController creates a new instance of SecurityController.
+func NewSecurityController(db *gorm.DB, keys *services.SigningKeyManager) *SecurityController {
+	return &SecurityController{DB: db, Keys: keys}
+}
+
+// JWKS publishes the public keys that verify access and refresh tokens.
+// ROUTE: GET /.well-known/jwks.json
+func (sc *SecurityController) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, sc.Keys.JWKS())
+}
+
+// ListSigningKeys returns metadata (never private keys) of all stored signing keys.
+// ROUTE: GET /api/v1/admin/security/signing-keys
+func (sc *SecurityController) ListSigningKeys(c *gin.Context) {
+	keys, err := sc.Keys.ListKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve signing keys", "code": "db_query_failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// RotateSigningKey activates a new signing key immediately, e.g. after a suspected leak.
+// Tokens signed with the previous key keep verifying until they expire.
+// ROUTE: POST /api/v1/admin/security/signing-keys/rotate
+func (sc *SecurityController) RotateSigningKey(c *gin.Context) {
+	key, err := sc.Keys.Rotate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate signing key", "code": "key_rotation_failed"})
+		return
+	}
+
+	adminID, _, _, _, _ := middleware.GetUserFromTenangContext(c)
+	services.RecordAudit(sc.DB, services.AuditEntry{
+		UserID: &adminID, Action: "signing_key_rotated", TableName: "signing_keys", RecordID: &key.ID,
+		NewValues: gin.H{"kid": key.KeyID, "algorithm": key.Algorithm},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Signing key rotated", "kid": key.KeyID, "algorithm": key.Algorithm})
+}
@@ -15,6 +15,7 @@ import (
 	"backend/config"
 	"backend/middleware"
 	"backend/models"
+	"backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -94,7 +95,7 @@ func (s *SocialController) ConnectAccount(c *gin.Context) {
 		PlatformUserID:       platformUserID,
 		PlatformUsername:     &platformUsername,
 		AccessTokenEncrypted: &encryptedToken,
-		MonitoringEnabled:    true, // Default to enabled
+		MonitoringEnabled:    s.monitoringAllowed(authedUser), // Enabled by default when the privacy level allows it
 	}
 
 	if err := s.DB.Create(&account).Error; err != nil {
@@ -142,6 +143,11 @@ func (s *SocialController) UpdateAccountSettings(c *gin.Context) {
 		return
 	}
 
+	if *req.MonitoringEnabled && !s.monitoringAllowed(authedUser) {
+		respondMonitoringRestricted(c, services.PolicyForUser(*authedUser, s.Cfg))
+		return
+	}
+
 	account.MonitoringEnabled = *req.MonitoringEnabled
 	if err := s.DB.Save(&account).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account settings", "code": "db_error"})
@@ -195,6 +201,11 @@ func (s *SocialController) SyncAccount(c *gin.Context) {
 	accountID, _ := uuid.Parse(c.Param("accountId"))
 	authedUser, _ := middleware.GetFullUserFromContext(c)
 
+	if !s.monitoringAllowed(authedUser) {
+		respondMonitoringRestricted(c, services.PolicyForUser(*authedUser, s.Cfg))
+		return
+	}
+
 	var account models.SocialMediaAccount
 	if err := s.DB.Where("id = ? AND user_id = ? AND monitoring_enabled = ?", accountID, authedUser.ID, true).First(&account).Error; err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Account not found or monitoring is disabled", "code": "forbidden_or_not_found"})
@@ -249,6 +260,19 @@ func (s *SocialController) HandleWebhook(c *gin.Context) {
 
 // --- Helper and Background Functions ---
 
+// monitoringAllowed reports whether the user's privacy level (and age) permits social media monitoring.
+func (s *SocialController) monitoringAllowed(user *models.User) bool {
+	return services.PolicyForUser(*user, s.Cfg).AllowSocialMonitoring
+}
+
+func respondMonitoringRestricted(c *gin.Context, policy services.PrivacyPolicy) {
+	if policy.MinorSafe {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Social media monitoring is turned off in minor-safe mode", "code": "minor_safe_mode"})
+		return
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Social media monitoring is not available on your privacy level", "code": "privacy_level_restricted"})
+}
+
 func (s *SocialController) syncAccountPosts(account models.SocialMediaAccount) {
 	log.Printf("Syncing posts for account %s on platform %s", account.ID, account.Platform)
 	// Placeholder for background job
@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+const (
+	maxTrustedContacts           = 5
+	trustedContactResendCooldown = time.Minute
+)
+
+// TrustedContactController manages the people a user trusts to be alerted in a crisis.
+type TrustedContactController struct {
+	DB       *gorm.DB
+	Cfg      *config.Config
+	Contacts *services.TrustedContacts
+}
+
+// NewTrustedContactController creates a new instance of TrustedContactController.
+func NewTrustedContactController(db *gorm.DB, cfg *config.Config) *TrustedContactController {
+	return &TrustedContactController{DB: db, Cfg: cfg, Contacts: services.NewTrustedContacts(db, cfg)}
+}
+
+// --- DTOs ---
+
+type TrustedContactRequest struct {
+	Name         string   `json:"name" binding:"required,min=2,max=100"`
+	Email        string   `json:"email" binding:"required,email"`
+	Phone        *string  `json:"phone" binding:"omitempty,min=8,max=20"`
+	Relationship string   `json:"relationship" binding:"required,min=2,max=50"`
+	Scopes       []string `json:"scopes" binding:"required,min=1,dive,oneof=crisis_alerts panic_alerts share_location"`
+}
+
+type TrustedContactUpdateRequest struct {
+	Name         *string  `json:"name" binding:"omitempty,min=2,max=100"`
+	Phone        *string  `json:"phone" binding:"omitempty,min=8,max=20"`
+	Relationship *string  `json:"relationship" binding:"omitempty,min=2,max=50"`
+	Scopes       []string `json:"scopes" binding:"omitempty,min=1,dive,oneof=crisis_alerts panic_alerts share_location"`
+}
+
+type TrustedContactDecisionRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Decision string `json:"decision" binding:"required,oneof=accept decline"`
+}
+
+// --- Handlers ---
+
+// ListContacts lists the user's trusted contacts and what each has consented to.
+// ROUTE: GET /api/v1/users/:userId/trusted-contacts
+func (tc *TrustedContactController) ListContacts(c *gin.Context) {
+	userID, _ := uuid.Parse(c.Param("userId"))
+
+	var contacts []models.TrustedContact
+	if err := tc.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&contacts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trusted contacts", "code": "db_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": contacts, "available_scopes": models.TrustedContactScopes})
+}
+
+// AddContact registers a trusted contact and emails them to confirm. The contact is
+// never alerted until they accept.
+// ROUTE: POST /api/v1/users/:userId/trusted-contacts
+func (tc *TrustedContactController) AddContact(c *gin.Context) {
+	userID, _ := uuid.Parse(c.Param("userId"))
+
+	var req TrustedContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error(), "code": "validation_failed"})
+		return
+	}
+
+	var user models.User
+	if err := tc.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found"})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == strings.ToLower(user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot add yourself as a trusted contact", "code": "invalid_contact"})
+		return
+	}
+
+	var existing int64
+	tc.DB.Model(&models.TrustedContact{}).Where("user_id = ?", userID).Count(&existing)
+	if existing >= maxTrustedContacts {
+		c.JSON(http.StatusConflict, gin.H{"error": "You can have at most 5 trusted contacts", "code": "contact_limit_reached", "max_contacts": maxTrustedContacts})
+		return
+	}
+	var duplicate int64
+	tc.DB.Model(&models.TrustedContact{}).Where("user_id = ? AND email = ?", userID, email).Count(&duplicate)
+	if duplicate > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This person is already one of your trusted contacts", "code": "contact_exists"})
+		return
+	}
+
+	contact := models.TrustedContact{
+		UserID: userID, Name: req.Name, Email: email, Phone: req.Phone, Relationship: req.Relationship,
+		Scopes: uniqueScopes(req.Scopes), ConsentedScopes: pq.StringArray{}, Status: models.TrustedContactPending,
+	}
+	if err := tc.DB.Create(&contact).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add trusted contact", "code": "db_insert_failed"})
+		return
+	}
+
+	tc.recordAudit(c, "trusted_contact_added", contact, nil)
+	go tc.sendVerification(contact, user)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Kami sudah mengirim email konfirmasi ke kontak tepercaya kamu.", "data": contact})
+}
+
+// UpdateContact changes a contact's details or scopes. Removing a scope takes effect
+// at once; adding one sends a new confirmation email, and the new scope is only used
+// once the contact accepts it.
+// ROUTE: PUT /api/v1/users/:userId/trusted-contacts/:contactId
+func (tc *TrustedContactController) UpdateContact(c *gin.Context) {
+	contact, user, ok := tc.findContact(c)
+	if !ok {
+		return
+	}
+	var req TrustedContactUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error(), "code": "validation_failed"})
+		return
+	}
+
+	old := contact.Scopes
+	if req.Name != nil {
+		contact.Name = *req.Name
+	}
+	if req.Phone != nil {
+		contact.Phone = req.Phone
+	}
+	if req.Relationship != nil {
+		contact.Relationship = *req.Relationship
+	}
+
+	needsConsent := false
+	if req.Scopes != nil {
+		contact.Scopes = uniqueScopes(req.Scopes)
+		consented := pq.StringArray{}
+		for _, scope := range contact.Scopes {
+			if contact.HasConsent(scope) {
+				consented = append(consented, scope)
+			} else {
+				needsConsent = true
+			}
+		}
+		contact.ConsentedScopes = consented
+	}
+
+	if err := tc.DB.Save(&contact).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update trusted contact", "code": "db_update_failed"})
+		return
+	}
+	tc.recordAudit(c, "trusted_contact_updated", contact, gin.H{"scopes": old})
+	if needsConsent && contact.Status != models.TrustedContactDeclined {
+		go tc.sendVerification(contact, user)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": contact, "confirmation_sent": needsConsent && contact.Status != models.TrustedContactDeclined})
+}
+
+// ResendVerification emails the contact a fresh confirmation link.
+// ROUTE: POST /api/v1/users/:userId/trusted-contacts/:contactId/resend
+func (tc *TrustedContactController) ResendVerification(c *gin.Context) {
+	contact, user, ok := tc.findContact(c)
+	if !ok {
+		return
+	}
+	if contact.VerificationSentAt != nil && time.Since(*contact.VerificationSentAt) < trustedContactResendCooldown {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before sending another confirmation email", "code": "resend_cooldown"})
+		return
+	}
+	if err := tc.Contacts.SendVerification(contact, user); err != nil {
+		log.Printf("ERROR: Failed to send trusted contact verification %s: %v", contact.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send confirmation email", "code": "email_send_failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email konfirmasi sudah dikirim ulang."})
+}
+
+// DeleteContact removes a trusted contact. Past escalation records keep their
+// delivery history without a link to the contact.
+// ROUTE: DELETE /api/v1/users/:userId/trusted-contacts/:contactId
+func (tc *TrustedContactController) DeleteContact(c *gin.Context) {
+	contact, _, ok := tc.findContact(c)
+	if !ok {
+		return
+	}
+	err := tc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.CrisisEscalationDelivery{}).Where("contact_id = ?", contact.ID).Update("contact_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&contact).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove trusted contact", "code": "db_delete_failed"})
+		return
+	}
+	tc.recordAudit(c, "trusted_contact_removed", contact, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// RespondToInvitation records a contact's decision from the emailed link. The signed
+// token is the credential because contacts do not need an account.
+// ROUTE: POST /api/v1/trusted-contacts/respond
+func (tc *TrustedContactController) RespondToInvitation(c *gin.Context) {
+	var req TrustedContactDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error(), "code": "validation_failed"})
+		return
+	}
+
+	contact, err := tc.Contacts.Respond(req.Token, req.Decision == "accept", c.ClientIP(), c.Request.UserAgent())
+	if errors.Is(err, services.ErrInvalidSignedToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirmation link is invalid or has expired", "code": "invalid_contact_link"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record your response", "code": "db_update_failed"})
+		return
+	}
+
+	message := "Terima kasih telah bersedia menjadi kontak tepercaya."
+	if contact.Status == models.TrustedContactDeclined {
+		message = "Terima kasih. Anda tidak akan dihubungi oleh Tenang.in."
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "status": contact.Status, "consented_scopes": contact.ConsentedScopes})
+}
+
+// --- Helpers ---
+
+func (tc *TrustedContactController) findContact(c *gin.Context) (models.TrustedContact, models.User, bool) {
+	userID, _ := uuid.Parse(c.Param("userId"))
+	contactID, err := uuid.Parse(c.Param("contactId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contact ID format", "code": "invalid_contact_id"})
+		return models.TrustedContact{}, models.User{}, false
+	}
+
+	var contact models.TrustedContact
+	if err := tc.DB.Where("id = ? AND user_id = ?", contactID, userID).First(&contact).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trusted contact not found", "code": "contact_not_found"})
+		return models.TrustedContact{}, models.User{}, false
+	}
+	var user models.User
+	if err := tc.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found"})
+		return models.TrustedContact{}, models.User{}, false
+	}
+	return contact, user, true
+}
+
+func (tc *TrustedContactController) sendVerification(contact models.TrustedContact, user models.User) {
+	if err := tc.Contacts.SendVerification(contact, user); err != nil {
+		log.Printf("ERROR: Failed to send trusted contact verification %s: %v", contact.ID, err)
+	}
+}
+
+func (tc *TrustedContactController) recordAudit(c *gin.Context, action string, contact models.TrustedContact, oldValues interface{}) {
+	actorID, _, _, _, _ := middleware.GetUserFromTenangContext(c)
+	services.RecordAudit(tc.DB, services.AuditEntry{
+		UserID: &actorID, Action: action, TableName: "trusted_contacts", RecordID: &contact.ID,
+		OldValues: oldValues, NewValues: gin.H{"user_id": contact.UserID, "scopes": contact.Scopes, "status": contact.Status},
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+}
+
+func uniqueScopes(scopes []string) pq.StringArray {
+	seen := map[string]bool{}
+	unique := pq.StringArray{}
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
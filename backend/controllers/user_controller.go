@@ -1,12 +1,17 @@
 package controllers
 
 import (
+	"errors"
+	"io"
+	"log"
 	"math"
 	"net/http"
 	"strconv"
 	"time"
 
+	"backend/middleware"
 	"backend/models"
+	"backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -15,12 +20,14 @@ import (
 
 // UserController handles all user-centric API requests
 type UserController struct {
-	DB *gorm.DB
+	DB      *gorm.DB
+	Privacy *services.PrivacyEnforcer
+	Avatars *services.AvatarService
 }
 
-// NewUserController creates a new instance of UserController with DB dependency
-func NewUserController(db *gorm.DB) *UserController {
-	return &UserController{DB: db}
+// NewUserController creates a new instance of UserController with its dependencies
+func NewUserController(db *gorm.DB, privacy *services.PrivacyEnforcer, avatars *services.AvatarService) *UserController {
+	return &UserController{DB: db, Privacy: privacy, Avatars: avatars}
 }
 
 
@@ -36,13 +43,17 @@ type UserProfileResponse struct {
 	PrivacyLevel string     `json:"privacy_level"`
 	CreatedAt    time.Time  `json:"created_at"`
 	LastActiveAt *time.Time `json:"last_active_at,omitempty"`
+	Avatar       services.AvatarURLs `json:"avatar"`
+
+	// Apa yang diizinkan oleh tingkat privasi di atas (retensi chat, audio, analitik, media sosial)
+	PrivacyPolicy *services.PrivacyPolicy `json:"privacy_policy,omitempty"`
 }
 
 type UserUpdateRequest struct {
 	Username     *string `json:"username" binding:"omitempty,min=3,max=50"`
 	FullName     *string `json:"full_name" binding:"omitempty,min=2,max=100"`
 	DateOfBirth  *string `json:"date_of_birth" binding:"omitempty,datetime=2006-01-02"` // Terima sebagai string untuk validasi
-	Timezone     *string `json:"timezone" binding:"omitempty,min=2,max=50"`
+	Timezone     *string `json:"timezone" binding:"omitempty,max=50"` // Nama zona IANA, mis. "Asia/Makassar"
 	PrivacyLevel *string `json:"privacy_level" binding:"omitempty,oneof=minimal standard full"`
 }
 
@@ -63,7 +74,7 @@ type UserPreferencesResponse struct {
 	UserID                      uuid.UUID `json:"user_id"`
 	NotificationChat            bool      `json:"notification_chat"`
 	NotificationCommunity       bool      `json:"notification_community"`
-	NotificationSchedule        string    `json:"notification_schedule"`
+	NotificationSchedule        models.NotificationSchedule `json:"notification_schedule"`
 	CommunityAnonymousDefault   bool      `json:"community_anonymous_default"`
 	SocialMediaMonitoring       bool      `json:"social_media_monitoring"`
 	UpdatedAt                   time.Time `json:"updated_at"`
@@ -72,7 +83,7 @@ type UserPreferencesResponse struct {
 type UserPreferencesUpdateRequest struct {
 	NotificationChat          *bool  `json:"notification_chat"`
 	NotificationCommunity     *bool  `json:"notification_community"`
-	NotificationSchedule      *string `json:"notification_schedule"`
+	NotificationSchedule      *models.NotificationSchedule `json:"notification_schedule"`
 	CommunityAnonymousDefault *bool  `json:"community_anonymous_default"`
 	SocialMediaMonitoring     *bool  `json:"social_media_monitoring"`
 }
@@ -102,10 +113,11 @@ func (uc *UserController) GetProfile(c *gin.Context) {
 		return
 	}
 
+	policy := services.PolicyForUser(user, uc.Privacy.Cfg)
 	c.JSON(http.StatusOK, UserProfileResponse{
 		ID: user.ID, Email: user.Email, Username: user.Username, FullName: user.FullName,
 		DateOfBirth: user.DateOfBirth, Timezone: user.Timezone, PrivacyLevel: user.PrivacyLevel,
-		CreatedAt: user.CreatedAt, LastActiveAt: user.LastActiveAt,
+		CreatedAt: user.CreatedAt, LastActiveAt: user.LastActiveAt, Avatar: uc.Avatars.URLs(user), PrivacyPolicy: &policy,
 	})
 }
 
@@ -136,7 +148,15 @@ func (uc *UserController) UpdateProfile(c *gin.Context) {
 	}
 
 	if req.FullName != nil { user.FullName = req.FullName }
-	if req.Timezone != nil { user.Timezone = *req.Timezone }
+	oldTimezone := user.Timezone
+	if req.Timezone != nil {
+		if err := services.ValidateTimezone(*req.Timezone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_timezone"})
+			return
+		}
+		user.Timezone = *req.Timezone
+	}
+	oldPrivacyLevel := user.PrivacyLevel
 	if req.PrivacyLevel != nil { user.PrivacyLevel = *req.PrivacyLevel }
 
 	if req.DateOfBirth != nil {
@@ -145,6 +165,17 @@ func (uc *UserController) UpdateProfile(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format, use YYYY-MM-DD", "code": "invalid_date_format"})
 			return
 		}
+		// Tanggal lahir hanya bisa diisi sekali agar mode aman anak tidak bisa dilewati;
+		// koreksi dilakukan oleh tim dukungan.
+		if user.DateOfBirth != nil && !user.DateOfBirth.Equal(dob) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Date of birth cannot be changed once set. Please contact support.", "code": "date_of_birth_locked"})
+			return
+		}
+		minimumAge := uc.Privacy.Cfg.Security.MinimumAge
+		if services.AgeOn(dob, time.Now(), services.UserLocation(user.Timezone)) < minimumAge {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You must be at least " + strconv.Itoa(minimumAge) + " years old to use Tenang.in", "code": "age_requirement_not_met", "minimum_age": minimumAge})
+			return
+		}
 		user.DateOfBirth = &dob
 	}
 
@@ -152,9 +183,145 @@ func (uc *UserController) UpdateProfile(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile", "code": "db_update_failed"})
 		return
 	}
+	// Jadwal check-in disimpan dalam UTC, jadi dihitung ulang untuk zona waktu yang baru
+	if user.Timezone != oldTimezone {
+		if err := services.RescheduleCheckins(uc.DB, user.ID, user.Timezone); err != nil {
+			log.Printf("ERROR: Failed to reschedule check-ins for user %s: %v", user.ID, err)
+		}
+	}
+	// Tingkat privasi baru berlaku juga untuk data lama (chat, audio, analitik, media sosial)
+	if user.PrivacyLevel != oldPrivacyLevel {
+		uc.Privacy.ApplyLevelChange(user.ID, oldPrivacyLevel, user.PrivacyLevel)
+	}
 	uc.GetProfile(c)
 }
 
+// UploadAvatar replaces the user's avatar. The image type is checked by content, not
+// by extension, and the stored variants are re-encoded so EXIF/GPS metadata is dropped.
+// ROUTE: PUT /api/v1/users/:userId/avatar
+func (uc *UserController) UploadAvatar(c *gin.Context) {
+	userID, _ := uuid.Parse(c.Param("userId"))
+	maxSize := uc.Avatars.Cfg.Storage.MaxAvatarSize
+
+	// Sisakan ruang untuk overhead multipart di luar isi file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+64*1024)
+	file, _, err := c.Request.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar file is too large", "code": "avatar_too_large", "max_bytes": maxSize})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An image file with key 'avatar' is required", "code": "avatar_required"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read avatar file", "code": "avatar_read_failed"})
+		return
+	}
+	if int64(len(data)) > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar file is too large", "code": "avatar_too_large", "max_bytes": maxSize})
+		return
+	}
+
+	var user models.User
+	if err := uc.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found"})
+		return
+	}
+
+	key, err := uc.Avatars.Store(user.ID, data)
+	switch {
+	case errors.Is(err, services.ErrUnsupportedImage):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Avatar must be a JPEG, PNG or GIF image", "code": "unsupported_image_type"})
+		return
+	case errors.Is(err, services.ErrImageDimensions):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar dimensions are too small or too large", "code": "invalid_image_dimensions"})
+		return
+	case err != nil:
+		log.Printf("ERROR: Failed to store avatar for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save avatar", "code": "avatar_store_failed"})
+		return
+	}
+
+	oldKey := user.AvatarKey
+	if err := uc.DB.Model(&user).Update("avatar_key", key).Error; err != nil {
+		uc.Avatars.Remove(key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save avatar", "code": "db_update_failed"})
+		return
+	}
+	if oldKey != nil {
+		uc.Avatars.Remove(*oldKey)
+	}
+	user.AvatarKey = &key
+
+	uc.recordAvatarAudit(c, user.ID, "avatar_updated")
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar updated", "avatar": uc.Avatars.URLs(user)})
+}
+
+// DeleteAvatar removes the uploaded avatar so the generated identicon is shown again.
+// ROUTE: DELETE /api/v1/users/:userId/avatar
+func (uc *UserController) DeleteAvatar(c *gin.Context) {
+	userID, _ := uuid.Parse(c.Param("userId"))
+
+	var user models.User
+	if err := uc.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found"})
+		return
+	}
+	if user.AvatarKey != nil {
+		if err := uc.DB.Model(&user).Update("avatar_key", nil).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove avatar", "code": "db_update_failed"})
+			return
+		}
+		uc.Avatars.Remove(*user.AvatarKey)
+		user.AvatarKey = nil
+		uc.recordAvatarAudit(c, user.ID, "avatar_removed")
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar removed", "avatar": uc.Avatars.URLs(user)})
+}
+
+// GetIdenticon serves the generated default avatar for a user. It is public so it can
+// be used directly in <img> tags, and reveals nothing but a pattern derived from the ID.
+// ROUTE: GET /api/v1/avatars/identicon/:userId?size=128
+func (uc *UserController) GetIdenticon(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "code": "invalid_user_id"})
+		return
+	}
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "128"))
+	valid := false
+	for _, s := range services.AvatarSizes {
+		if size == s {
+			valid = true
+		}
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported avatar size", "code": "invalid_avatar_size", "sizes": services.AvatarSizes})
+		return
+	}
+
+	png, err := services.Identicon(userID, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render avatar", "code": "identicon_failed"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=604800, immutable")
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+func (uc *UserController) recordAvatarAudit(c *gin.Context, userID uuid.UUID, action string) {
+	actorID, _, _, _, _ := middleware.GetUserFromTenangContext(c)
+	services.RecordAudit(uc.DB, services.AuditEntry{
+		UserID: &actorID, Action: action, TableName: "users", RecordID: &userID,
+		IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent(),
+	})
+}
+
 // GetPreferences retrieves user-specific application preferences.
 // ROUTE: GET /api/v1/users/:userId/preferences
 func (uc *UserController) GetPreferences(c *gin.Context) {
@@ -184,6 +351,25 @@ func (uc *UserController) UpdatePreferences(c *gin.Context) {
 		return
 	}
 
+	if req.NotificationSchedule != nil {
+		if err := services.ValidateNotificationSchedule(*req.NotificationSchedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification schedule", "details": err.Error(), "code": "invalid_notification_schedule"})
+			return
+		}
+	}
+
+	if req.SocialMediaMonitoring != nil && *req.SocialMediaMonitoring {
+		var user models.User
+		if err := uc.DB.Select("privacy_level", "date_of_birth", "timezone").Where("id = ?", userID).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found"})
+			return
+		}
+		if policy := services.PolicyForUser(user, uc.Privacy.Cfg); !policy.AllowSocialMonitoring {
+			respondMonitoringRestricted(c, policy)
+			return
+		}
+	}
+
 	var prefs models.UserPreferences
 	uc.DB.Where(models.UserPreferences{UserID: userID}).FirstOrCreate(&prefs)
 
@@ -232,37 +418,6 @@ func (uc *UserController) GetProgressMetrics(c *gin.Context) {
 	c.JSON(http.StatusOK, metrics)
 }
 
-// DeactivateAccount performs a soft delete on a user account.
-// ROUTE: DELETE /api/v1/users/:userId/deactivate
-func (uc *UserController) DeactivateAccount(c *gin.Context) {
-	userID, _ := uuid.Parse(c.Param("userId"))
-
-	var user models.User
-	if tx := uc.DB.Where("id = ?", userID).First(&user); tx.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "code": "user_not_found"})
-		return
-	}
-
-	err := uc.DB.Transaction(func(tx *gorm.DB) error {
-		user.IsActive = false
-		if err := tx.Save(&user).Error; err != nil {
-			return err
-		}
-		if err := tx.Delete(&user).Error; err != nil {
-			return err
-		}
-		return nil
-	})
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate account", "code": "db_transaction_failed"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "User account deactivated successfully", "code": "user_deactivated"})
-}
-
-
 // --- Admin-Only Handlers ---
 
 // GetAllUsers retrieves a paginated list of all users.
@@ -284,7 +439,7 @@ func (uc *UserController) GetAllUsers(c *gin.Context) {
 			UserProfileResponse: UserProfileResponse{
 				ID: user.ID, Email: user.Email, Username: user.Username, FullName: user.FullName,
 				DateOfBirth: user.DateOfBirth, Timezone: user.Timezone, PrivacyLevel: user.PrivacyLevel,
-				CreatedAt: user.CreatedAt, LastActiveAt: user.LastActiveAt,
+				CreatedAt: user.CreatedAt, LastActiveAt: user.LastActiveAt, Avatar: uc.Avatars.URLs(user),
 			},
 			IsActive:        user.IsActive,
 			EmailVerifiedAt: user.EmailVerifiedAt,
@@ -332,7 +487,19 @@ func (uc *UserController) UpdateUserStatus(c *gin.Context) {
 		user.DeletedAt = &now
 	}
 
-	if err := uc.DB.Save(&user).Error; err != nil {
+	err = uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if !user.IsActive {
+			return nil
+		}
+		// Mengaktifkan kembali akun juga membatalkan penghapusan akun yang masih dalam masa tenggang
+		return tx.Model(&models.AccountDeletionRequest{}).
+			Where("user_id = ? AND status = ?", user.ID, models.AccountDeletionPending).
+			Updates(map[string]interface{}{"status": models.AccountDeletionCancelled, "cancelled_at": time.Now()}).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user status", "code": "db_update_failed"})
 		return
 	}
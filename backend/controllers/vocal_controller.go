@@ -16,10 +16,10 @@ import (
 	"backend/config"
 	"backend/middleware"
 	"backend/models"
+	"backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
 )
 
@@ -27,13 +27,15 @@ type VocalController struct {
 	DB         *gorm.DB
 	Cfg        *config.Config
 	HTTPClient *http.Client
+	LLM        *services.LLMService
 }
 
 // NewVocalController membuat instance baru dari VocalController
-func NewVocalController(db *gorm.DB, cfg *config.Config) *VocalController {
+func NewVocalController(db *gorm.DB, cfg *config.Config, llm *services.LLMService) *VocalController {
 	return &VocalController{
 		DB:         db,
 		Cfg:        cfg,
+		LLM:        llm,
 		HTTPClient: &http.Client{Timeout: 90 * time.Second}, // Timeout lebih lama untuk proses AI
 	}
 }
@@ -67,14 +69,15 @@ func (vc *VocalController) CreateEntry(c *gin.Context) {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Gagal melakukan transkripsi suara", "details": err.Error()})
 		return
 	}
-	log.Printf("[VOCAL DEBUG] Hasil Transkripsi: %s", transcriptionText)
+	// Isi transkripsi tidak pernah dicatat di log; hanya panjangnya.
+	log.Printf("[VOCAL] Transcription received for user %s (%d chars)", authedUser.ID, len(transcriptionText))
 	if strings.TrimSpace(transcriptionText) == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Tidak ada suara yang terdeteksi dalam rekaman."})
 		return
 	}
 
-	// 2. Analisis Teks -> Skor, Kategori, Refleksi (Azure OpenAI)
-	analysis, err := vc.analyzeTextWithOpenAI(transcriptionText)
+	// 2. Analisis Teks -> Skor, Kategori, Refleksi (model bahasa)
+	analysis, err := vc.analyzeTextWithLLM(transcriptionText, services.IsMinor(*authedUser, vc.Cfg))
 	if err != nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Gagal menganalisis teks", "details": err.Error()})
 		return
@@ -83,15 +86,19 @@ func (vc *VocalController) CreateEntry(c *gin.Context) {
 	// 3. Simpan semua hasil ke database
 	tx := vc.DB.Begin()
 
-	uploadPath := vc.Cfg.Storage.AudioUploadPath
-	if err := os.MkdirAll(uploadPath, 0755); err != nil {
-		log.Printf("Gagal membuat direktori upload: %v", err)
-	}
-	uniqueFilename := fmt.Sprintf("%s_%s%s", authedUser.ID.String(), uuid.New().String(), filepath.Ext(header.Filename))
-	filePath := filepath.Join(uploadPath, uniqueFilename)
-	if err := os.WriteFile(filePath, audioBytes, 0644); err != nil {
-		log.Printf("Gagal menyimpan file audio ke disk: %v", err)
-		filePath = "cloud/storage_failed" // fallback path
+	// Tingkat privasi "minimal" tidak menyimpan rekaman; cukup transkripsi dan analisisnya.
+	filePath := ""
+	if services.PolicyForUser(*authedUser, vc.Cfg).KeepVocalAudio {
+		uploadPath := vc.Cfg.Storage.AudioUploadPath
+		if err := os.MkdirAll(uploadPath, 0755); err != nil {
+			log.Printf("Gagal membuat direktori upload: %v", err)
+		}
+		uniqueFilename := fmt.Sprintf("%s_%s%s", authedUser.ID.String(), uuid.New().String(), filepath.Ext(header.Filename))
+		filePath = filepath.Join(uploadPath, uniqueFilename)
+		if err := os.WriteFile(filePath, audioBytes, 0644); err != nil {
+			log.Printf("Gagal menyimpan file audio ke disk: %v", err)
+			filePath = "cloud/storage_failed" // fallback path
+		}
 	}
 
 	title := fmt.Sprintf("Jurnal Suara - %s", time.Now().Format("2 Jan 2006"))
@@ -117,7 +124,7 @@ func (vc *VocalController) CreateEntry(c *gin.Context) {
 		return
 	}
 
-	modelNameFromConfig := vc.Cfg.Azure.OpenAIDeploymentName
+	modelNameFromConfig := vc.LLM.ModelFor(services.LLMFeatureVocalAnalysis)
 	analysisResult := models.VocalSentimentAnalysis{
 		VocalEntryID:          vocalEntry.ID,
 		OverallWellbeingScore: &analysis.WellbeingScore,
@@ -168,45 +175,35 @@ func (vc *VocalController) transcribeAudioWithAzure(audioBytes []byte) (string,
 	return result.DisplayText, nil
 }
 
-// analyzeTextWithOpenAI: Menganalisis teks menggunakan GPT
-func (vc *VocalController) analyzeTextWithOpenAI(transcription string) (*OpenAIAnalysisResponse, error) {
-	config := openai.DefaultAzureConfig(vc.Cfg.Azure.OpenAIAPIKey, vc.Cfg.Azure.OpenAIEndpoint)
-	config.APIVersion = vc.Cfg.Azure.OpenAIAPIVersion
-	client := openai.NewClientWithConfig(config)
-
+// analyzeTextWithLLM: Menganalisis teks menggunakan model bahasa dalam mode JSON
+func (vc *VocalController) analyzeTextWithLLM(transcription string, minorSafe bool) (*OpenAIAnalysisResponse, error) {
 	systemPrompt := `Anda adalah API yang mengembalikan format JSON. Jangan menulis teks atau penjelasan apapun di luar blok JSON. Anda menerima transkrip dari jurnal suara pengguna. Analisis teksnya dan kembalikan objek JSON dengan struktur: {"wellbeing_score": float, "wellbeing_category": "string", "reflection": "string"}. 'wellbeing_score' adalah angka 1.0-10.0. 'wellbeing_category' adalah judul singkat 3-5 kata. 'reflection' adalah paragraf refleksi 2-4 kalimat dalam Bahasa Indonesia.`
+	if minorSafe {
+		systemPrompt += " Untuk 'reflection': " + minorSafePrompt
+	}
 
-	req := openai.ChatCompletionRequest{
-		Model:            vc.Cfg.Azure.OpenAIDeploymentName,
-		ResponseFormat:   &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
-		Messages: []openai.ChatCompletionMessage{
-			{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
-			{Role: openai.ChatMessageRoleUser, Content: transcription},
+	req := services.LLMRequest{
+		Feature: services.LLMFeatureVocalAnalysis,
+		Messages: []services.LLMMessage{
+			{Role: services.LLMRoleSystem, Content: systemPrompt},
+			{Role: services.LLMRoleUser, Content: transcription},
 		},
 		MaxTokens:   350,
 		Temperature: 0.6,
 	}
 
-	resp, err := client.CreateChatCompletion(context.Background(), req)
-	if err != nil {
-		return nil, fmt.Errorf("OpenAI completion error: %w", err)
-	}
-	if len(resp.Choices) == 0 {
-		return nil, fmt.Errorf("OpenAI tidak memberikan respons")
-	}
-
-	rawResponse := resp.Choices[0].Message.Content
-	log.Printf("[VOCAL DEBUG] Raw OpenAI Response: %s", rawResponse)
-
 	var analysisResp OpenAIAnalysisResponse
-	err = json.Unmarshal([]byte(rawResponse), &analysisResp)
+	resp, err := vc.LLM.CompleteJSON(context.Background(), req, &analysisResp)
+	if resp == nil {
+		return nil, fmt.Errorf("LLM completion error: %w", err)
+	}
 	if err != nil {
-		log.Printf("Gagal mem-parsing JSON dari OpenAI: %v. Raw content: %s", err, rawResponse)
+		log.Printf("Gagal mem-parsing JSON dari model (%d chars): %v", len(resp.Content), err)
 		return nil, fmt.Errorf("respons AI tidak dalam format JSON yang valid")
 	}
 
 	if analysisResp.WellbeingCategory == "" || analysisResp.Reflection == "" {
-		return nil, fmt.Errorf("AI mengembalikan objek JSON kosong atau tidak lengkap. Respons mentah: %s", rawResponse)
+		return nil, fmt.Errorf("AI mengembalikan objek JSON kosong atau tidak lengkap")
 	}
 
 	return &analysisResp, nil
@@ -1,20 +1,19 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"time"
-
-	"github.com/sashabaranov/go-openai"
+	_ "time/tzdata" // Basis data zona waktu IANA disematkan agar validasi timezone tidak bergantung pada OS
 
 	"backend/config"
 	"backend/controllers"
 	"backend/middleware"
 	"backend/models"
+	"backend/services"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -36,7 +35,52 @@ func main() {
 
 	config.CreateInitialData(db)
 
-	appControllers := initializeTenangControllers(db, cfg)
+	// Enkripsi per-field (envelope) untuk isi chat, transkripsi, dan refleksi jurnal suara
+	dataKeys := services.NewDataKeyring(db, cfg)
+	models.UseFieldCipher(dataKeys)
+
+	// Perintah pemeliharaan: `go run . <perintah>`
+	if len(os.Args) > 1 {
+		runMaintenanceCommand(os.Args[1], dataKeys)
+		return
+	}
+	dataKeys.StartBackfill()
+
+	signingKeys := services.NewSigningKeyManager(db, cfg)
+	if err := signingKeys.Init(); err != nil {
+		log.Fatal("❌ Failed to initialise JWT signing keys:", err)
+	}
+	signingKeys.StartRotation(10 * time.Minute)
+	middleware.UseSigningKeys(signingKeys)
+
+	dataExporter := services.NewDataExporter(db, cfg)
+	dataExporter.StartMaintenance(time.Hour)
+
+	// Avatar disimpan di ./uploads yang disajikan statis oleh setupStaticFileServing
+	avatars := services.NewAvatarService(services.NewLocalStorage("./uploads", cfg.Server.PublicURL+"/uploads"), cfg)
+
+	accountDeleter := services.NewAccountDeleter(db, cfg, avatars, dataKeys)
+	accountDeleter.StartPurgeScheduler(time.Hour)
+
+	privacyEnforcer := services.NewPrivacyEnforcer(db, cfg)
+	privacyEnforcer.StartRetentionSweeper(time.Hour)
+
+	// Notifikasi yang ditunda (jam tenang, batas harian, ringkasan) dikirim saat jatuh tempo
+	notifier := services.NewNotifier(db, cfg)
+	notifier.StartDelivery(time.Minute)
+
+	// Kanal real-time chat. MemoryPubSub cukup untuk satu instance; untuk beberapa
+	// instance ganti dengan broker bersama (mis. Redis) yang memenuhi services.PubSub.
+	chatHub := services.NewChatHub(services.NewMemoryPubSub())
+
+	// Penyedia model bahasa (Azure, endpoint kompatibel OpenAI, atau fake) dipilih lewat LLM_PROVIDER.
+	llm := services.NewLLMService(cfg)
+
+	// Sentimen dan emosi pesan chat dianalisis di latar belakang (SENTIMENT_ANALYZER)
+	sentiment := services.NewSentimentTagger(db, cfg, llm)
+	sentiment.Start(10 * time.Minute)
+
+	appControllers := initializeTenangControllers(db, cfg, signingKeys, dataExporter, accountDeleter, privacyEnforcer, avatars, notifier, chatHub, llm, sentiment)
 	router := setupTenangRouter(cfg, db)
 	setupTenangRoutes(router, appControllers)
 	setupStaticFileServing(router, cfg)
@@ -52,14 +96,53 @@ func main() {
 
 // migrateTenangModels mencakup semua model dalam aplikasi.
 func migrateTenangModels(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&models.User{}, &models.UserCredentials{}, &models.UserPreferences{}, &models.UserSession{},
-		&models.ChatSession{}, &models.ChatMessage{}, &models.ScheduledCheckin{},
-		&models.VocalJournalEntry{}, &models.VocalTranscription{}, &models.VocalSentimentAnalysis{},
-		&models.CommunityCategory{}, &models.CommunityPost{}, &models.CommunityPostReply{}, &models.CommunityReaction{},
-		&models.SocialMediaAccount{}, &models.SocialMediaPostMonitored{},
-		&models.Notification{}, &models.UserProgressMetric{}, &models.SystemAnalytics{}, &models.AuditLog{},
-	)
+	// AutoMigrate tidak memperbarui CHECK yang sudah ada; hapus agar dibuat ulang dengan nilai terbaru.
+	staleChecks := []struct {
+		model interface{}
+		name  string
+	}{
+		{&models.Notification{}, "chk_notifications_notification_type"},
+		{&models.UserProgressMetric{}, "chk_user_progress_metrics_metric_type"},
+	}
+	for _, check := range staleChecks {
+		if db.Migrator().HasConstraint(check.model, check.name) {
+			if err := db.Migrator().DropConstraint(check.model, check.name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := db.AutoMigrate(models.All()...); err != nil {
+		return err
+	}
+
+	// Email dibandingkan tanpa memedulikan huruf besar/kecil (services.EmailEquals);
+	// indeks ini mempercepat pencarian itu dan mencegah akun ganda beda kapitalisasi.
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))").Error; err != nil {
+		log.Printf("⚠️ Could not create idx_users_email_lower, resolve accounts whose emails differ only by case: %v", err)
+	}
+	return nil
+}
+
+// runMaintenanceCommand menjalankan satu perintah operasional lalu keluar.
+func runMaintenanceCommand(command string, dataKeys *services.DataKeyring) {
+	switch command {
+	case "encrypt-existing":
+		summary, err := dataKeys.EncryptExistingRows()
+		if err != nil {
+			log.Fatalf("❌ Encrypting existing rows failed after %v: %v", summary, err)
+		}
+		log.Printf("✅ Existing rows encrypted: %v", summary)
+	case "rotate-data-keys":
+		summary, err := dataKeys.RotateMasterKey()
+		if err != nil {
+			log.Fatalf("❌ Master key rotation failed after %v: %v", summary, err)
+		}
+		log.Printf("✅ Keys re-wrapped with the current ENCRYPTION_KEY: %v", summary)
+		log.Println("   ENCRYPTION_KEY_PREVIOUS can be removed once this reports zero for every entry.")
+	default:
+		log.Fatalf("❌ Unknown command %q (available: encrypt-existing, rotate-data-keys)", command)
+	}
 }
 
 // TenangControllers menampung semua instance controller.
@@ -69,22 +152,44 @@ type TenangControllers struct {
 	Community    *controllers.CommunityController
 	Notification *controllers.NotificationController
 	Chat         *controllers.ChatController
+	ChatSocket   *controllers.ChatSocketController
 	Vocal        *controllers.VocalController
 	Social       *controllers.SocialController
 	Analytics    *controllers.AnalyticsController
+	Role         *controllers.RoleController
+	Security     *controllers.SecurityController
+	Debug        *controllers.DebugController
+
+	Impersonation   *controllers.ImpersonationController
+	DataExport      *controllers.DataExportController
+	AccountDeletion *controllers.AccountDeletionController
+	GuardianConsent *controllers.GuardianConsentController
+	TrustedContact  *controllers.TrustedContactController
+	Crisis          *controllers.CrisisController
 }
 
 // initializeTenangControllers membuat semua instance controller dengan dependensinya.
-func initializeTenangControllers(db *gorm.DB, cfg *config.Config) *TenangControllers {
+func initializeTenangControllers(db *gorm.DB, cfg *config.Config, signingKeys *services.SigningKeyManager, dataExporter *services.DataExporter, accountDeleter *services.AccountDeleter, privacyEnforcer *services.PrivacyEnforcer, avatars *services.AvatarService, notifier *services.Notifier, chatHub *services.ChatHub, llm *services.LLMService, sentiment *services.SentimentTagger) *TenangControllers {
 	return &TenangControllers{
 		Auth:         controllers.NewAuthController(db, cfg),
-		User:         controllers.NewUserController(db),
-		Community:    controllers.NewCommunityController(db),
-		Notification: controllers.NewNotificationController(db, cfg),
-		Chat:         controllers.NewChatController(db, cfg),
-		Vocal:        controllers.NewVocalController(db, cfg),
+		User:         controllers.NewUserController(db, privacyEnforcer, avatars),
+		Community:    controllers.NewCommunityController(db, cfg, avatars),
+		Notification: controllers.NewNotificationController(db, cfg, notifier),
+		Chat:         controllers.NewChatController(db, cfg, chatHub, llm, sentiment),
+		ChatSocket:   controllers.NewChatSocketController(db, cfg, chatHub),
+		Vocal:        controllers.NewVocalController(db, cfg, llm),
 		Social:       controllers.NewSocialController(db, cfg),
 		Analytics:    controllers.NewAnalyticsController(db, cfg),
+		Role:         controllers.NewRoleController(db),
+		Security:     controllers.NewSecurityController(db, signingKeys),
+		Debug:        controllers.NewDebugController(cfg, llm),
+
+		Impersonation:   controllers.NewImpersonationController(db, cfg),
+		DataExport:      controllers.NewDataExportController(db, cfg, dataExporter),
+		AccountDeletion: controllers.NewAccountDeletionController(db, cfg, accountDeleter),
+		GuardianConsent: controllers.NewGuardianConsentController(db, cfg),
+		TrustedContact:  controllers.NewTrustedContactController(db, cfg),
+		Crisis:          controllers.NewCrisisController(db, cfg),
 	}
 }
 
@@ -95,7 +200,7 @@ func setupTenangRouter(cfg *config.Config, db *gorm.DB) *gin.Engine {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     cfg.Server.CORSOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Device-Name", "X-Device-Platform"},
 		AllowCredentials: true,
 	}))
 	router.Use(func(c *gin.Context) {
@@ -108,6 +213,7 @@ func setupTenangRouter(cfg *config.Config, db *gorm.DB) *gin.Engine {
 // setupTenangRoutes mengonfigurasi semua rute API.
 func setupTenangRoutes(router *gin.Engine, c *TenangControllers) {
 	router.GET("/health", func(ctx *gin.Context) { ctx.JSON(http.StatusOK, gin.H{"status": "healthy"}) })
+	router.GET("/.well-known/jwks.json", c.Security.JWKS)
 
 	setupDebugRoutes(router, c)
 
@@ -118,159 +224,58 @@ func setupTenangRoutes(router *gin.Engine, c *TenangControllers) {
 	protected.Use(middleware.TenangAuthMiddleware())
 	setupProtectedRoutes(protected, c)
 
+	// WebSocket: token boleh dikirim lewat subprotocol karena browser tidak bisa mengatur
+	// header Authorization, jadi WebSocketToken harus berjalan sebelum otentikasi.
+	realtime := v1.Group("/chat")
+	realtime.Use(middleware.WebSocketToken(), middleware.TenangAuthMiddleware(), middleware.DenyDuringImpersonation(), middleware.RequireGuardianConsent())
+	realtime.GET("/sessions/:sessionId/ws", c.ChatSocket.Connect)
+
 	admin := v1.Group("/admin")
-	admin.Use(middleware.TenangAuthMiddleware(), middleware.RequireAdmin())
+	admin.Use(middleware.TenangAuthMiddleware())
 	setupAdminRoutes(admin, c)
 }
 
 func setupDebugRoutes(router *gin.Engine, c *TenangControllers) {
 	debug := router.Group("/debug")
 	{
-		debug.GET("/env", func(ctx *gin.Context) {
-			cfg := config.AppConfig // Ambil dari global config
-			if cfg == nil {
-				ctx.JSON(500, gin.H{"error": "Config not loaded"})
-				return
-			}
-
-			apiKey := cfg.Azure.OpenAIAPIKey
-			masked := ""
-			if len(apiKey) > 8 {
-				masked = apiKey[:4] + "..." + apiKey[len(apiKey)-4:]
-			}
-
-			debugInfo := map[string]interface{}{
-				"azure_config": map[string]string{
-					"api_key_masked":  masked,
-					"endpoint":        cfg.Azure.OpenAIEndpoint,
-					"deployment_name": cfg.Azure.OpenAIDeploymentName,
-					"api_version":     cfg.Azure.OpenAIAPIVersion,
-				},
-				"config_status": map[string]bool{
-					"api_key_set":    len(cfg.Azure.OpenAIAPIKey) > 0,
-					"endpoint_set":   len(cfg.Azure.OpenAIEndpoint) > 0,
-					"deployment_set": len(cfg.Azure.OpenAIDeploymentName) > 0,
-					"version_set":    len(cfg.Azure.OpenAIAPIVersion) > 0,
-				},
-				"timestamp": time.Now(),
-			}
-
-			ctx.JSON(200, gin.H{"debug": debugInfo})
-		})
-
-		debug.GET("/test-openai", func(ctx *gin.Context) {
-			cfg := config.AppConfig
-			if cfg == nil {
-				ctx.JSON(500, gin.H{"error": "Config not loaded"})
-				return
-			}
-
-			// Test Azure OpenAI connection langsung
-			testAzureOpenAI(ctx, cfg)
-		})
-	}
-}
-
-// 🔧 FUNCTION YANG DIPERBAIKI - SEKARANG LENGKAP
-func testAzureOpenAI(c *gin.Context, cfg *config.Config) {
-	apiKey := cfg.Azure.OpenAIAPIKey
-	endpoint := cfg.Azure.OpenAIEndpoint
-	deploymentName := cfg.Azure.OpenAIDeploymentName
-	apiVersion := cfg.Azure.OpenAIAPIVersion
-
-	log.Printf("🔍 Testing Azure OpenAI Connection...")
-	log.Printf("   Endpoint: %s", endpoint)
-	log.Printf("   Deployment: %s", deploymentName)
-	log.Printf("   API Version: %s", apiVersion)
-	log.Printf("   API Key length: %d", len(apiKey))
-
-	if apiKey == "" || endpoint == "" || deploymentName == "" {
-		c.JSON(400, gin.H{
-			"error": "Missing Azure OpenAI configuration",
-			"missing": map[string]bool{
-				"api_key":    apiKey == "",
-				"endpoint":   endpoint == "",
-				"deployment": deploymentName == "",
-			},
-		})
-		return
-	}
-
-	// 🔧 IMPLEMENTASI AZURE OPENAI YANG LENGKAP
-	config := openai.DefaultAzureConfig(apiKey, endpoint)
-	config.APIVersion = apiVersion
-	client := openai.NewClientWithConfig(config)
-
-	req := openai.ChatCompletionRequest{
-		Model: deploymentName,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: "You are a helpful assistant.",
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: "Say 'Hello from Azure OpenAI test' in Indonesian.",
-			},
-		},
-		MaxTokens:   50,
-		Temperature: 0.7,
-	}
-
-	log.Printf("🚀 Sending request to Azure OpenAI...")
-	start := time.Now()
-	resp, err := client.CreateChatCompletion(context.Background(), req)
-	duration := time.Since(start)
-
-	if err != nil {
-		log.Printf("❌ Azure OpenAI Error: %v", err)
-		c.JSON(500, gin.H{
-			"error":    "Azure OpenAI connection failed",
-			"details":  err.Error(),
-			"duration": duration.String(),
-		})
-		return
-	}
-
-	if len(resp.Choices) == 0 {
-		log.Printf("❌ No response choices from Azure OpenAI")
-		c.JSON(500, gin.H{
-			"error":    "No response choices from Azure OpenAI",
-			"duration": duration.String(),
-		})
-		return
+		debug.GET("/env", c.Debug.DebugEnvironment)
+		debug.GET("/test-openai", c.Debug.TestLLM)
 	}
-
-	response := resp.Choices[0].Message.Content
-	log.Printf("✅ Azure OpenAI Response: %s", response)
-	log.Printf("✅ Request completed in: %s", duration)
-
-	c.JSON(200, gin.H{
-		"success":  true,
-		"response": response,
-		"duration": duration.String(),
-		"usage": map[string]interface{}{
-			"prompt_tokens":     resp.Usage.PromptTokens,
-			"completion_tokens": resp.Usage.CompletionTokens,
-			"total_tokens":      resp.Usage.TotalTokens,
-		},
-		"model": resp.Model,
-	})
 }
 
 // setupPublicRoutes untuk endpoint yang tidak memerlukan otentikasi.
 func setupPublicRoutes(v1 *gin.RouterGroup, c *TenangControllers) {
+	// Satu limiter dipakai bersama oleh semua endpoint login agar batasnya tidak bisa
+	// dilewati dengan berganti metode (password, magic link, kode MFA).
+	loginRateLimit := middleware.TenangRateLimitMiddleware()
+
 	auth := v1.Group("/auth")
 	{
 		auth.POST("/register", c.Auth.Register)
-		auth.POST("/login", c.Auth.Login)
+		auth.POST("/login", loginRateLimit, c.Auth.Login)
+		auth.POST("/magic-link", loginRateLimit, c.Auth.RequestMagicLink)
+		auth.POST("/magic-link/verify", loginRateLimit, c.Auth.VerifyMagicLink)
+		auth.POST("/mfa/verify", loginRateLimit, c.Auth.VerifyMFA)
 		auth.POST("/google", c.Auth.GoogleAuth)
+		auth.GET("/google/login", c.Auth.GoogleLogin)
+		auth.POST("/google/callback", middleware.OptionalAuth(), c.Auth.GoogleCallback) // Alur tautkan akun mensyaratkan token pemiliknya
 		auth.POST("/refresh", c.Auth.RefreshToken)
-		auth.POST("/forgot-password", c.Auth.ForgotPassword)
+		auth.POST("/forgot-password", loginRateLimit, c.Auth.ForgotPassword)
 		auth.POST("/reset-password", c.Auth.ResetPassword)
 		auth.GET("/verify-email", c.Auth.VerifyEmail)
 	}
 
+	// Tautan unduhan ekspor data sudah ditandatangani, sehingga tidak memerlukan header Authorization.
+	v1.GET("/exports/:exportId/download", c.DataExport.DownloadExport)
+	// Akun yang sedang menunggu penghapusan tidak bisa login; pemulihan memakai tautan dari email.
+	v1.POST("/account/restore", c.AccountDeletion.CancelDeletion)
+	// Orang tua/wali tidak memiliki akun; keputusan mereka memakai tautan bertanda tangan dari email.
+	v1.POST("/guardian-consent/respond", c.GuardianConsent.RespondToConsent)
+	// Kontak tepercaya juga tidak memiliki akun; persetujuan mereka memakai tautan bertanda tangan.
+	v1.POST("/trusted-contacts/respond", c.TrustedContact.RespondToInvitation)
+	// Avatar bawaan (identicon) dipakai langsung di tag <img>, tanpa header Authorization.
+	v1.GET("/avatars/identicon/:userId", c.User.GetIdenticon)
+
 	community := v1.Group("/community")
 	community.Use(middleware.OptionalAuth())
 	{
@@ -282,26 +287,49 @@ func setupPublicRoutes(v1 *gin.RouterGroup, c *TenangControllers) {
 
 // setupProtectedRoutes untuk endpoint yang memerlukan otentikasi JWT.
 func setupProtectedRoutes(protected *gin.RouterGroup, c *TenangControllers) {
+	// Percakapan, jurnal suara, ekspor & penghapusan data, dan pengaturan keamanan akun tertutup untuk sesi dukungan (impersonasi).
+	private := middleware.DenyDuringImpersonation()
+
 	users := protected.Group("/users")
 	users.Use(middleware.ValidateUserOwnership())
 	{
 		users.GET("/:userId/profile", c.User.GetProfile)
 		users.PUT("/:userId/profile", c.User.UpdateProfile)
+		users.PUT("/:userId/avatar", c.User.UploadAvatar)
+		users.DELETE("/:userId/avatar", c.User.DeleteAvatar)
 		users.GET("/:userId/preferences", c.User.GetPreferences)
 		users.PUT("/:userId/preferences", c.User.UpdatePreferences)
 		users.GET("/:userId/dashboard", c.User.GetDashboardStats)
 		users.GET("/:userId/progress", c.User.GetProgressMetrics)
-		users.DELETE("/:userId/deactivate", c.User.DeactivateAccount)
+		users.DELETE("/:userId/deactivate", private, c.AccountDeletion.RequestDeletion)
+		users.POST("/:userId/export", private, c.DataExport.RequestExport)
+		users.GET("/:userId/export", private, c.DataExport.ListExports)
+		users.GET("/:userId/guardian-consent", c.GuardianConsent.GetConsentStatus)
+		users.POST("/:userId/guardian-consent", c.GuardianConsent.RequestConsent)
+		users.GET("/:userId/trusted-contacts", private, c.TrustedContact.ListContacts)
+		users.POST("/:userId/trusted-contacts", private, c.TrustedContact.AddContact)
+		users.PUT("/:userId/trusted-contacts/:contactId", private, c.TrustedContact.UpdateContact)
+		users.DELETE("/:userId/trusted-contacts/:contactId", private, c.TrustedContact.DeleteContact)
+		users.POST("/:userId/trusted-contacts/:contactId/resend", private, c.TrustedContact.ResendVerification)
+		users.GET("/:userId/crisis-escalations", private, c.Crisis.ListEscalations)
 	}
 
+	// Tombol darurat sengaja tidak memerlukan email terverifikasi atau persetujuan wali.
+	protected.POST("/crisis/panic", private, c.Crisis.TriggerPanic)
+
+	// Posting dan fitur sosial dapat dibatasi sampai email terverifikasi (REQUIRE_VERIFIED_EMAIL).
+	verifiedEmail := middleware.RequireVerifiedEmail()
+	// Pengguna di bawah umur memerlukan persetujuan orang tua/wali untuk chat, jurnal suara, dan posting.
+	guardianConsent := middleware.RequireGuardianConsent()
+
 	community := protected.Group("/community")
 	{
 		community.GET("/posts", c.Community.GetUserPosts)
-		community.POST("/posts", c.Community.CreatePost)
-		community.PUT("/posts/:postId", c.Community.UpdatePost)
+		community.POST("/posts", verifiedEmail, guardianConsent, c.Community.CreatePost)
+		community.PUT("/posts/:postId", verifiedEmail, guardianConsent, c.Community.UpdatePost)
 		community.DELETE("/posts/:postId", c.Community.DeletePost)
-		community.POST("/replies", c.Community.CreateReply)
-		community.POST("/reactions", c.Community.AddReaction)
+		community.POST("/replies", verifiedEmail, guardianConsent, c.Community.CreateReply)
+		community.POST("/reactions", verifiedEmail, guardianConsent, c.Community.AddReaction)
 		community.POST("/posts/:postId/report", c.Community.ReportPost)
 	}
 
@@ -316,12 +344,14 @@ func setupProtectedRoutes(protected *gin.RouterGroup, c *TenangControllers) {
 	}
 
 	chat := protected.Group("/chat")
+	chat.Use(guardianConsent)
 	{
-		chat.POST("/sessions", c.Chat.CreateSession)
-		chat.GET("/sessions", c.Chat.GetSessions)
-		chat.GET("/sessions/:sessionId", c.Chat.GetSession)
-		chat.POST("/messages", c.Chat.SendMessage)
-		chat.PUT("/sessions/:sessionId/end", c.Chat.EndSession)
+		chat.POST("/sessions", private, c.Chat.CreateSession)
+		chat.GET("/sessions", private, c.Chat.GetSessions)
+		chat.GET("/sessions/:sessionId", private, c.Chat.GetSession)
+		chat.POST("/messages", private, c.Chat.SendMessage)
+		chat.POST("/messages/stream", private, c.Chat.StreamMessage)
+		chat.PUT("/sessions/:sessionId/end", private, c.Chat.EndSession)
 		chat.GET("/checkins", c.Chat.GetScheduledCheckins)
 		chat.POST("/checkins", c.Chat.CreateScheduledCheckin)
 		chat.PUT("/checkins/:checkinId", c.Chat.UpdateScheduledCheckin)
@@ -329,6 +359,7 @@ func setupProtectedRoutes(protected *gin.RouterGroup, c *TenangControllers) {
 	}
 
 	vocal := protected.Group("/vocal")
+	vocal.Use(private, guardianConsent)
 	{
 		vocal.POST("/entries", c.Vocal.CreateEntry)
 		// vocal.GET("/entries", c.Vocal.GetEntries)
@@ -339,6 +370,7 @@ func setupProtectedRoutes(protected *gin.RouterGroup, c *TenangControllers) {
 	}
 
 	social := protected.Group("/social")
+	social.Use(verifiedEmail)
 	{
 		social.POST("/connect", c.Social.ConnectAccount)
 		social.GET("/accounts", c.Social.GetConnectedAccounts)
@@ -360,23 +392,66 @@ func setupProtectedRoutes(protected *gin.RouterGroup, c *TenangControllers) {
 	authProtected := protected.Group("/auth")
 	{
 		authProtected.POST("/logout", c.Auth.Logout)
-		authProtected.POST("/change-password", c.Auth.ChangePassword)
+		authProtected.POST("/logout-all", private, c.Auth.LogoutAll)
+		authProtected.GET("/sessions", private, c.Auth.GetSessions)
+		authProtected.DELETE("/sessions/:sessionId", private, c.Auth.RevokeSession)
+
+		authProtected.GET("/mfa", private, c.Auth.GetMFAStatus)
+		authProtected.POST("/mfa/setup", private, c.Auth.SetupMFA)
+		authProtected.POST("/mfa/enable", private, c.Auth.EnableMFA)
+		authProtected.POST("/mfa/disable", private, c.Auth.DisableMFA)
+		authProtected.POST("/mfa/recovery-codes", private, c.Auth.RegenerateRecoveryCodes)
+		authProtected.GET("/identities", private, c.Auth.ListIdentities)
+		authProtected.POST("/identities/google", private, c.Auth.StartGoogleLink)
+		authProtected.DELETE("/identities/:provider", private, c.Auth.UnlinkIdentity)
+		authProtected.POST("/change-password", private, c.Auth.ChangePassword)
+		authProtected.POST("/resend-verification", c.Auth.ResendVerification)
 	}
 }
 
 // setupAdminRoutes mengonfigurasi rute khusus admin.
 func setupAdminRoutes(admin *gin.RouterGroup, c *TenangControllers) {
-	admin.GET("/users", c.User.GetAllUsers)
-	admin.PUT("/users/:userId/status", c.User.UpdateUserStatus)
-
-	admin.GET("/community/reported-posts", c.Community.GetReportedPosts)
-	admin.POST("/community/posts/:postId/moderate", c.Community.ModeratePost)
-
-	admin.POST("/notifications/broadcast", c.Notification.BroadcastNotification)
-	admin.POST("/notifications/process-scheduled", c.Notification.ProcessScheduledNotifications)
-
-	admin.GET("/analytics/system/metrics", c.Analytics.GetSystemMetrics)
-	admin.GET("/analytics/platform-health", c.Analytics.GetPlatformHealth)
+	// Setiap endpoint admin dijaga oleh permission, bukan sekadar flag admin
+	usersRead := middleware.RequirePermission(models.PermUsersRead)
+	usersManage := middleware.RequirePermission(models.PermUsersManage)
+	rolesManage := middleware.RequirePermission(models.PermRolesManage)
+	moderate := middleware.RequirePermission(models.PermCommunityModerate)
+	broadcast := middleware.RequirePermission(models.PermNotificationsBroadcast)
+	analyticsView := middleware.RequirePermission(models.PermAnalyticsView)
+	securityManage := middleware.RequirePermission(models.PermSecurityManage)
+	impersonate := middleware.RequirePermission(models.PermUsersImpersonate)
+	crisisRespond := middleware.RequirePermission(models.PermCrisisRespond)
+
+	admin.GET("/users", usersRead, c.User.GetAllUsers)
+	admin.PUT("/users/:userId/status", usersManage, c.User.UpdateUserStatus)
+	admin.POST("/users/:userId/unlock", usersManage, c.Auth.UnlockAccount)
+
+	admin.POST("/users/:userId/impersonate", impersonate, c.Impersonation.StartImpersonation)
+	admin.GET("/impersonations", impersonate, c.Impersonation.ListImpersonations)
+	admin.DELETE("/impersonations/:sessionId", impersonate, c.Impersonation.EndImpersonation)
+
+	admin.GET("/roles", rolesManage, c.Role.ListRoles)
+	admin.PUT("/roles/:roleName/mfa", rolesManage, c.Role.SetRoleMFARequirement)
+	admin.GET("/users/:userId/roles", usersRead, c.Role.GetUserRoles)
+	admin.POST("/users/:userId/roles", rolesManage, c.Role.GrantRole)
+	admin.DELETE("/users/:userId/roles/:roleName", rolesManage, c.Role.RevokeRole)
+
+	admin.GET("/users/:userId/crisis-escalations", crisisRespond, c.Crisis.ListEscalations)
+	admin.POST("/users/:userId/crisis-escalations", crisisRespond, c.Crisis.ConfirmCrisis)
+	admin.GET("/crisis-alerts", crisisRespond, c.Crisis.ListAlerts)
+	admin.POST("/crisis-alerts/:alertId/review", crisisRespond, c.Crisis.ReviewAlert)
+
+	admin.GET("/community/reported-posts", moderate, c.Community.GetReportedPosts)
+	admin.POST("/community/posts/:postId/moderate", moderate, c.Community.ModeratePost)
+
+	admin.POST("/notifications/broadcast", broadcast, c.Notification.BroadcastNotification)
+	admin.POST("/notifications/process-scheduled", broadcast, c.Notification.ProcessScheduledNotifications)
+
+	admin.GET("/analytics/system/metrics", analyticsView, c.Analytics.GetSystemMetrics)
+	admin.GET("/analytics/platform-health", analyticsView, c.Analytics.GetPlatformHealth)
+
+	admin.GET("/security/signing-keys", securityManage, c.Security.ListSigningKeys)
+	admin.POST("/security/signing-keys/rotate", securityManage, c.Security.RotateSigningKey)
 }
 
 // setupStaticFileServing configures static file serving for mental health content
@@ -398,8 +473,8 @@ func setupStaticFileServing(router *gin.Engine, cfg *config.Config) {
 	router.Static("/uploads", "./uploads")
 	router.Static("/audio", cfg.Storage.AudioUploadPath)
 
-	// Serve audio files with specific headers for privacy
-	router.GET("/api/v1/audio/:filename", middleware.TenangAuthMiddleware(), func(c *gin.Context) {
+	// Serve audio files with specific headers for privacy; jurnal suara tertutup untuk sesi impersonasi.
+	router.GET("/api/v1/audio/:filename", middleware.TenangAuthMiddleware(), middleware.DenyDuringImpersonation(), func(c *gin.Context) {
 		filename := c.Param("filename")
 		filepath := filepath.Join(cfg.Storage.AudioUploadPath, filename)
 
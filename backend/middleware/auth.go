@@ -9,6 +9,7 @@ import (
 
 	"backend/config"
 	"backend/models"
+	"backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -22,17 +23,32 @@ var (
 	ErrMismatchedTokenType   = errors.New("token type is mismatched")
 	ErrMismatchedIssuer      = errors.New("token issuer is mismatched")
 	ErrUserNotFoundOrInactive = errors.New("user account not found or inactive")
+	ErrSessionRevoked         = errors.New("session has been revoked or expired")
+	ErrRefreshTokenReused     = errors.New("refresh token has already been used")
 )
 
 
+// signingKeys holds the asymmetric JWT keys; nil means tokens are signed with the HS256 secrets.
+var signingKeys *services.SigningKeyManager
+
+// UseSigningKeys switches token signing and verification to the given key manager.
+func UseSigningKeys(manager *services.SigningKeyManager) {
+	signingKeys = manager
+}
+
 // TenangJWTClaims represents JWT token claims for Tenang.in platform
 type TenangJWTClaims struct {
 	UserID       uuid.UUID `json:"user_id"`
 	Email        string    `json:"email"`
-	IsAdmin      bool      `json:"is_admin"`
+	Roles        []string  `json:"roles,omitempty"`
 	PrivacyLevel string    `json:"privacy_level"`
 	TokenType    string    `json:"token_type"` // "access" or "refresh"
 	SessionID    string    `json:"session_id"`
+
+	// Only set on impersonation tokens minted for support staff
+	ImpersonatorID        *uuid.UUID `json:"impersonator_id,omitempty"`
+	ImpersonatorEmail     string     `json:"impersonator_email,omitempty"`
+	ImpersonationReadOnly bool       `json:"impersonation_read_only,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -72,27 +88,91 @@ func TenangAuthMiddleware() gin.HandlerFunc {
 
 		// Verify user still exists and is active (important for mental health platform security)
 		db := c.MustGet("db").(*gorm.DB)
-		var user models.User
-		if err := db.Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
+		if claims.ImpersonatorID != nil {
+			// Every request under impersonation is audited, including rejected ones
+			defer auditImpersonatedRequest(c, db, claims)
+		}
+		subject, err := resolveAccessToken(db, claims)
+		switch {
+		case errors.Is(err, ErrUserNotFoundOrInactive):
 			respondWithAuthError(c, "User account not found or inactive", "user_not_found")
 			return
+		case errors.Is(err, ErrSessionRevoked):
+			respondWithAuthError(c, "Session is no longer valid, please log in again", "session_revoked")
+			return
+		case err != nil:
+			respondWithAuthError(c, "Authentication failed", "auth_error")
+			return
 		}
 
+		// Support staff acting as the user: writes are limited and staff privileges dropped
+		if claims.ImpersonatorID != nil {
+			if !authorizeImpersonation(c, db, claims) {
+				return
+			}
+		}
+
+		setAuthContext(c, claims, subject)
+		c.Next()
+	}
+}
+
+// accessTokenSubject is the account behind an access token that passed the database checks.
+type accessTokenSubject struct {
+	User    models.User
+	Session *models.UserSession
+	Roles   []string
+}
+
+// resolveAccessToken checks a validly signed access token against the database: the
+// account must still be active, the token must be newer than the last password change
+// and its server-side session must not be logged out, revoked or expired. Roles are
+// read from the database so grants and revocations apply immediately.
+func resolveAccessToken(db *gorm.DB, claims *TenangJWTClaims) (*accessTokenSubject, error) {
+	var user models.User
+	if err := db.Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
+		return nil, ErrUserNotFoundOrInactive
+	}
+
+	// Reject tokens minted before the most recent password change or reset
+	if TokenIssuedBeforePasswordChange(db, claims) {
+		return nil, ErrSessionRevoked
+	}
+
+	session, err := LoadActiveSession(db, claims)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(session.LastActivityAt) > time.Minute {
+		db.Model(session).Update("last_activity_at", time.Now())
+	}
+
+	roles, err := LoadUserRoles(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ImpersonatorID == nil {
 		// Update last active timestamp for user engagement tracking
 		now := time.Now()
 		user.LastActiveAt = &now
 		db.Save(&user)
-
-		// Store user information in context for controllers
-		c.Set("user_id", claims.UserID)
-		c.Set("user_email", claims.Email)
-		c.Set("is_admin", claims.IsAdmin)
-		c.Set("privacy_level", user.PrivacyLevel)
-		c.Set("session_id", claims.SessionID)
-		c.Set("user", user) // Full user object for convenience
-
-		c.Next()
 	}
+	return &accessTokenSubject{User: user, Session: session, Roles: roles}, nil
+}
+
+// setAuthContext stores the authenticated user in the context for controllers.
+func setAuthContext(c *gin.Context, claims *TenangJWTClaims, subject *accessTokenSubject) {
+	c.Set("user_id", claims.UserID)
+	c.Set("user_email", claims.Email)
+	c.Set("is_admin", HasAdminRole(subject.Roles) && claims.ImpersonatorID == nil)
+	c.Set("roles", subject.Roles)
+	c.Set("privacy_level", subject.User.PrivacyLevel)
+	c.Set("session_id", claims.SessionID)
+	c.Set("mfa_verified", subject.Session.MFAVerified)
+	c.Set("user", subject.User) // Full user object for convenience
+	// Koneksi panjang (WebSocket) memakai claims ini untuk memeriksa ulang sesinya
+	c.Set("token_claims", claims)
 }
 
 // RequireAdmin middleware ensures only admin users can access certain endpoints
@@ -113,7 +193,38 @@ func RequireAdmin() gin.HandlerFunc {
 	}
 }
 
-// OptionalAuth middleware for endpoints that work with or without authentication
+// RequireVerifiedEmail blocks the request until the user's email is verified,
+// but only when REQUIRE_VERIFIED_EMAIL is enabled.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg := config.AppConfig; cfg == nil || !cfg.Security.RequireVerifiedEmail {
+			c.Next()
+			return
+		}
+
+		user, err := GetFullUserFromContext(c)
+		if err != nil {
+			respondWithAuthError(c, "Authentication required", "auth_required")
+			return
+		}
+
+		if user.EmailVerifiedAt == nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Email verification required",
+				"code":    "email_not_verified",
+				"message": "Please verify your email address to use this feature.",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// OptionalAuth middleware for endpoints that work with or without authentication.
+// A token is only trusted after the same database checks as TenangAuthMiddleware;
+// an invalid, logged-out or revoked token makes the request anonymous.
 func OptionalAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -125,23 +236,40 @@ func OptionalAuth() gin.HandlerFunc {
 
 		// Try to parse token
 		parts := strings.Split(authHeader, " ")
-		if len(parts) == 2 && parts[0] == "Bearer" {
-			claims, err := ValidateTenangJWT(parts[1], "access")
-			if err == nil {
-				// Valid token, set user context
-				c.Set("user_id", claims.UserID)
-				c.Set("user_email", claims.Email)
-				c.Set("is_admin", claims.IsAdmin)
-				c.Set("privacy_level", claims.PrivacyLevel)
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.Next()
+			return
+		}
+		claims, err := ValidateTenangJWT(parts[1], "access")
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		db := c.MustGet("db").(*gorm.DB)
+		subject, err := resolveAccessToken(db, claims)
+		if err != nil {
+			c.Next()
+			return
+		}
+		if claims.ImpersonatorID != nil {
+			if !impersonatorAllowed(db, claims) {
+				c.Next()
+				return
+			}
+			defer auditImpersonatedRequest(c, db, claims)
+			if !applyImpersonation(c, claims) {
+				return
 			}
 		}
 
+		setAuthContext(c, claims, subject)
 		c.Next()
 	}
 }
 
 // GenerateTenangJWT generates JWT tokens specifically for Tenang.in platform
-func GenerateTenangJWT(user models.User, tokenType string, sessionID string) (string, error) {
+func GenerateTenangJWT(user models.User, roles []string, tokenType string, sessionID string) (string, error) {
 	cfg := config.AppConfig
 
 	var secret string
@@ -157,14 +285,11 @@ func GenerateTenangJWT(user models.User, tokenType string, sessionID string) (st
 		return "", jwt.ErrInvalidKeyType
 	}
 
-	// Determine if user is admin (check by email pattern for Tenang.in)
-	isAdmin := strings.HasSuffix(user.Email, "@tenang.in") || user.Email == "admin@tenang.in"
-
 	// Create claims with mental health platform specific data
 	claims := TenangJWTClaims{
 		UserID:       user.ID,
 		Email:        user.Email,
-		IsAdmin:      isAdmin,
+		Roles:        roles,
 		PrivacyLevel: user.PrivacyLevel,
 		TokenType:    tokenType,
 		SessionID:    sessionID,
@@ -178,10 +303,27 @@ func GenerateTenangJWT(user models.User, tokenType string, sessionID string) (st
 		},
 	}
 
-	// Create token
+	return signTenangClaims(claims, secret)
+}
+
+// signTenangClaims signs claims with the active asymmetric key, or with the HS256
+// secret when no key manager is configured.
+func signTenangClaims(claims TenangJWTClaims, secret string) (string, error) {
+	// Sign with the active asymmetric key; the kid header tells verifiers which public key to use
+	if signingKeys != nil {
+		kid, method, key, err := signingKeys.SigningKey()
+		if err != nil {
+			return "", err
+		}
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		return token.SignedString(key)
+	}
+
+	// Fallback HS256 when no key manager is configured
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	// Sign token with secret
+	// Sign with secret
 	tokenString, err := token.SignedString([]byte(secret))
 	if err != nil {
 		return "", err
@@ -196,10 +338,25 @@ func ValidateTenangJWT(tokenString, expectedType string) (*TenangJWTClaims, erro
 
 	// Parse token
 	token, err := jwt.ParseWithClaims(tokenString, &TenangJWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
+		// Asymmetric tokens: look the public key up by kid, including recently retired keys
+		if kid, ok := token.Header["kid"].(string); ok && signingKeys != nil {
+			alg, publicKey, err := signingKeys.VerificationKey(kid)
+			if err != nil {
+				return nil, err
+			}
+			if token.Method.Alg() != alg {
+				return nil, jwt.ErrSignatureInvalid
+			}
+			return publicKey, nil
+		}
+
+		// Validate signing method (legacy HS256 tokens)
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, jwt.ErrSignatureInvalid
 		}
+		if signingKeys != nil && !cfg.JWT.AcceptLegacyHS256 {
+			return nil, jwt.ErrSignatureInvalid
+		}
 
 		// Get claims to determine which secret to use
 		claims, ok := token.Claims.(*TenangJWTClaims)
@@ -214,7 +371,7 @@ func ValidateTenangJWT(tokenString, expectedType string) (*TenangJWTClaims, erro
 		}
 
 		return nil, jwt.ErrInvalidKeyType
-	})
+	}, jwt.WithValidMethods([]string{"ES256", "RS256", "HS256"}))
 
 	// Handle parsing errors (e.g., expired, malformed)
 	if err != nil {
@@ -240,35 +397,128 @@ func ValidateTenangJWT(tokenString, expectedType string) (*TenangJWTClaims, erro
 	return claims, nil
 }
 
-// RefreshTenangTokens generates new access and refresh tokens for Tenang.in
-func RefreshTenangTokens(refreshToken string, db *gorm.DB) (string, string, error) {
+// TokenIssuedBeforePasswordChange reports whether a token predates the user's last
+// password change. Such tokens are treated as revoked. JWT timestamps only have
+// second precision, so the change time is truncated before comparing.
+func TokenIssuedBeforePasswordChange(db *gorm.DB, claims *TenangJWTClaims) bool {
+	if claims.IssuedAt == nil {
+		return true
+	}
+
+	var credentials models.UserCredentials
+	if err := db.Select("password_changed_at").Where("user_id = ?", claims.UserID).First(&credentials).Error; err != nil {
+		return false
+	}
+
+	return claims.IssuedAt.Time.Before(credentials.PasswordChangedAt.Truncate(time.Second))
+}
+
+// RefreshTenangTokens rotates a refresh token: the session it belongs to is retired
+// and a new session in the same family is issued. Refresh tokens are single use;
+// presenting a token that was already rotated revokes the whole family.
+func RefreshTenangTokens(refreshToken string, db *gorm.DB, client ClientInfo) (*TenangTokenPair, error) {
 	// Validate refresh token
 	claims, err := ValidateTenangJWT(refreshToken, "refresh")
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+
+	if TokenIssuedBeforePasswordChange(db, claims) {
+		return nil, ErrInvalidToken
+	}
+
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var session models.UserSession
+	if err := db.Where("id = ? AND user_id = ?", sessionID, claims.UserID).First(&session).Error; err != nil {
+		return nil, ErrSessionRevoked
+	}
+	if session.SessionToken != services.HashToken(refreshToken) {
+		return nil, ErrInvalidToken
+	}
+
+	if !session.IsActive {
+		if session.ReplacedByID != nil {
+			revokeReusedFamily(db, session, client)
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrSessionRevoked
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionRevoked
 	}
 
 	// Get user from database
 	var user models.User
 	if err := db.Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
-		return "", "", ErrUserNotFoundOrInactive
+		RevokeSessionFamily(db, session.FamilyID, "user_inactive")
+		return nil, ErrUserNotFoundOrInactive
 	}
 
-	// Generate new session ID for security
-	newSessionID := uuid.New().String()
+	familyID := session.FamilyID
+	if familyID == uuid.Nil {
+		familyID = session.ID // sesi lama sebelum ada family
+	}
 
-	// Generate new tokens
-	newAccessToken, err := GenerateTenangJWT(user, "access", newSessionID)
+	tokens, err := buildSession(db, user, client, uuid.New(), familyID, session.MFAVerified)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	newRefreshToken, err := GenerateTenangJWT(user, "refresh", newSessionID)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Conditional update: only one concurrent request can rotate this token.
+		result := tx.Model(&models.UserSession{}).Where("id = ? AND is_active = ?", session.ID, true).
+			Updates(map[string]interface{}{
+				"is_active":      false,
+				"revoked_at":     time.Now(),
+				"revoked_reason": "rotated",
+				"replaced_by_id": tokens.Session.ID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+		return tx.Create(&tokens.Session).Error
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		revokeReusedFamily(db, session, client)
+		return nil, err
+	}
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	return newAccessToken, newRefreshToken, nil
+	return tokens, nil
+}
+
+// revokeReusedFamily handles a replayed refresh token. Either the legitimate client or an
+// attacker holds a stolen copy, so every session in the family is revoked.
+func revokeReusedFamily(db *gorm.DB, session models.UserSession, client ClientInfo) {
+	familyID := session.FamilyID
+	if familyID == uuid.Nil {
+		familyID = session.ID
+	}
+
+	revoked, err := RevokeSessionFamily(db, familyID, "refresh_token_reuse")
+	if err != nil {
+		log.Printf("ERROR: Failed to revoke session family %s: %v", familyID, err)
+	}
+	log.Printf("SECURITY: Refresh token reuse detected for user %s (family %s)", session.UserID, familyID)
+
+	services.RecordAudit(db, services.AuditEntry{
+		UserID:    &session.UserID,
+		Action:    "refresh_token_reuse_detected",
+		TableName: "user_sessions",
+		RecordID:  &session.ID,
+		NewValues: gin.H{"family_id": familyID, "revoked_sessions": revoked},
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	})
 }
 
 // GetUserFromTenangContext extracts user information from Gin context
@@ -330,6 +580,21 @@ func GetFullUserFromContext(c *gin.Context) (*models.User, error) {
 	return &userObj, nil
 }
 
+// GetTokenClaimsFromContext returns the claims of the access token that authenticated the request
+func GetTokenClaimsFromContext(c *gin.Context) (*TenangJWTClaims, error) {
+	claimsVal, exists := c.Get("token_claims")
+	if !exists {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := claimsVal.(*TenangJWTClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
 // ValidateUserOwnership ensures user can only access their own data
 func ValidateUserOwnership() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -340,8 +605,8 @@ func ValidateUserOwnership() gin.HandlerFunc {
 			return
 		}
 
-		// Admins can access any user's data
-		if isAdminVal {
+		// Admins can access any user's data, once they meet their role's 2FA requirement
+		if isAdminVal && mfaSatisfied(c) {
 			c.Next()
 			return
 		}
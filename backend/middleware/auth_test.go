@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func optionalAuthRouter(db *gorm.DB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	cfg.JWT.AccessSecret = "test-access-secret-test-access-secret"
+	cfg.JWT.RefreshSecret = "test-refresh-secret-test-refresh-secret"
+	cfg.JWT.AccessExpiry = 15 * time.Minute
+	cfg.JWT.RefreshExpiry = time.Hour
+	config.AppConfig = cfg
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("db", db); c.Next() })
+	router.GET("/whoami", OptionalAuth(), func(c *gin.Context) {
+		userID, _, isAdmin, _, err := GetUserFromTenangContext(c)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"anonymous": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user_id": userID, "is_admin": isAdmin})
+	})
+	return router
+}
+
+func whoami(router *gin.Engine, token string) string {
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder.Body.String()
+}
+
+func TestOptionalAuthChecksSessionAndRolesInDatabase(t *testing.T) {
+	db := testutil.OpenDB(t)
+	router := optionalAuthRouter(db)
+
+	newUser := func(email string) (models.User, *TenangTokenPair) {
+		user := models.User{ID: uuid.New(), Email: email, IsActive: true}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		db.Create(&models.UserCredentials{UserID: user.ID, PasswordChangedAt: time.Now().Add(-time.Hour)})
+		tokens, err := IssueTenangSession(db, user, ClientInfo{IPAddress: "127.0.0.1"}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user, tokens
+	}
+
+	user, tokens := newUser("rani@example.com")
+	if got := whoami(router, tokens.AccessToken); got != `{"is_admin":false,"user_id":"`+user.ID.String()+`"}` {
+		t.Fatalf("valid token = %s", got)
+	}
+
+	// Role admin dibaca dari basis data, bukan dari klaim token.
+	role := models.Role{RoleName: models.RoleAdmin, DisplayName: "Admin"}
+	db.Create(&role)
+	db.Create(&models.UserRole{UserID: user.ID, RoleID: role.ID})
+	if got := whoami(router, tokens.AccessToken); got != `{"is_admin":true,"user_id":"`+user.ID.String()+`"}` {
+		t.Fatalf("token of a user granted admin after sign-in = %s", got)
+	}
+
+	if _, err := RevokeSession(db, user.ID, tokens.Session.ID, "logout"); err != nil {
+		t.Fatal(err)
+	}
+	if got := whoami(router, tokens.AccessToken); got != `{"anonymous":true}` {
+		t.Errorf("logged-out token = %s, want anonymous", got)
+	}
+
+	other, otherTokens := newUser("budi@example.com")
+	db.Model(&models.UserCredentials{}).Where("user_id = ?", other.ID).Update("password_changed_at", time.Now().Add(time.Minute))
+	if got := whoami(router, otherTokens.AccessToken); got != `{"anonymous":true}` {
+		t.Errorf("token from before a password change = %s, want anonymous", got)
+	}
+
+	if got := whoami(router, "not-a-jwt"); got != `{"anonymous":true}` {
+		t.Errorf("malformed token = %s, want anonymous", got)
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"backend/config"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RequireGuardianConsent blocks users in minor-safe mode from chat, vocal journals and
+// community posting until a parent or guardian has granted consent. Users whose age is
+// unknown must first add their date of birth, which also enforces MinimumAge.
+func RequireGuardianConsent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetFullUserFromContext(c)
+		if err != nil {
+			respondWithAuthError(c, "Authentication required", "auth_required")
+			return
+		}
+
+		if services.AgeUnknown(*user) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Date of birth required",
+				"code":    "date_of_birth_required",
+				"message": "Lengkapi tanggal lahir di profil kamu untuk menggunakan fitur ini.",
+			})
+			c.Abort()
+			return
+		}
+
+		consents := services.NewGuardianConsents(c.MustGet("db").(*gorm.DB), config.AppConfig)
+		if consents.Required(*user) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Parent or guardian consent required",
+				"code":    "guardian_consent_required",
+				"message": "Fitur ini bisa digunakan setelah orang tua atau wali kamu memberikan persetujuan.",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImpersonationHeader is set on every response served under an impersonation token
+// so client apps can show a clear "support session" banner.
+const ImpersonationHeader = "X-Tenang-Impersonation"
+
+// IssueImpersonationSession creates a short-lived session for target on behalf of
+// impersonator and returns an access token for it. No refresh token is issued.
+func IssueImpersonationSession(db *gorm.DB, target, impersonator models.User, client ClientInfo, readOnly bool, expiry time.Duration) (string, *models.UserSession, error) {
+	roles, err := LoadUserRoles(db, target.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	sessionID := uuid.New()
+	claims := TenangJWTClaims{
+		UserID:                target.ID,
+		Email:                 target.Email,
+		Roles:                 roles,
+		PrivacyLevel:          target.PrivacyLevel,
+		TokenType:             "access",
+		SessionID:             sessionID.String(),
+		ImpersonatorID:        &impersonator.ID,
+		ImpersonatorEmail:     impersonator.Email,
+		ImpersonationReadOnly: readOnly,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "tenang.in",
+			Subject:   target.ID.String(),
+			Audience:  []string{"tenang.in-users"},
+		},
+	}
+
+	accessToken, err := signTenangClaims(claims, config.AppConfig.JWT.AccessSecret)
+	if err != nil {
+		return "", nil, err
+	}
+
+	deviceInfo, _ := json.Marshal(client)
+	ipAddress := client.IPAddress
+	if ipAddress == "" {
+		ipAddress = "0.0.0.0"
+	}
+	session := models.UserSession{
+		ID:             sessionID,
+		UserID:         target.ID,
+		SessionToken:   services.HashToken(accessToken),
+		DeviceInfo:     string(deviceInfo),
+		IPAddress:      ipAddress,
+		LastActivityAt: now,
+		ExpiresAt:      now.Add(expiry),
+		IsActive:       true,
+		FamilyID:       sessionID,
+		ImpersonatorID: &impersonator.ID,
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return "", nil, err
+	}
+	return accessToken, &session, nil
+}
+
+// IsImpersonating reports whether the current request uses an impersonation token.
+func IsImpersonating(c *gin.Context) bool {
+	_, exists := c.Get("impersonator_id")
+	return exists
+}
+
+// DenyDuringImpersonation blocks routes that support staff must never reach while
+// acting as a user (chat messages, vocal journals, account security settings).
+func DenyDuringImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsImpersonating(c) {
+			respondImpersonationForbidden(c, "This area is private to the user and cannot be opened during a support session.")
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorizeImpersonation validates an impersonation token on every request: the
+// impersonator must still be active and allowed to impersonate, and read-only
+// sessions may only read. It aborts the request and returns false otherwise.
+func authorizeImpersonation(c *gin.Context, db *gorm.DB, claims *TenangJWTClaims) bool {
+	if !impersonatorAllowed(db, claims) {
+		respondWithAuthError(c, "Support session is no longer valid", "impersonation_revoked")
+		return false
+	}
+	return applyImpersonation(c, claims)
+}
+
+// impersonatorAllowed reports whether the staff member behind an impersonation token
+// is still active and still holds the impersonation permission.
+func impersonatorAllowed(db *gorm.DB, claims *TenangJWTClaims) bool {
+	var impersonator models.User
+	if err := db.Where("id = ? AND is_active = ?", *claims.ImpersonatorID, true).First(&impersonator).Error; err != nil {
+		return false
+	}
+	permissions, err := LoadUserPermissions(db, impersonator.ID)
+	return err == nil && permissions[models.PermUsersImpersonate]
+}
+
+// applyImpersonation marks the request as a support session and enforces read-only
+// mode. It aborts the request and returns false for writes in a read-only session.
+func applyImpersonation(c *gin.Context, claims *TenangJWTClaims) bool {
+	c.Set("impersonator_id", *claims.ImpersonatorID)
+	c.Set("impersonation_read_only", claims.ImpersonationReadOnly)
+	mode := "read-write"
+	if claims.ImpersonationReadOnly {
+		mode = "read-only"
+	}
+	c.Header(ImpersonationHeader, mode)
+
+	if claims.ImpersonationReadOnly && !isReadOnlyRequest(c) {
+		respondImpersonationForbidden(c, "This support session is read-only.")
+		return false
+	}
+	return true
+}
+
+// isReadOnlyRequest allows safe methods plus logout, so a read-only session can end itself.
+func isReadOnlyRequest(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return c.Request.Method == http.MethodPost && strings.HasSuffix(c.FullPath(), "/auth/logout")
+}
+
+// auditImpersonatedRequest writes one audit row per request made under impersonation,
+// including requests that were rejected.
+func auditImpersonatedRequest(c *gin.Context, db *gorm.DB, claims *TenangJWTClaims) {
+	var sessionID *uuid.UUID
+	if id, err := uuid.Parse(claims.SessionID); err == nil {
+		sessionID = &id
+	}
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	services.RecordAudit(db, services.AuditEntry{
+		UserID:    claims.ImpersonatorID,
+		Action:    "impersonation_request",
+		TableName: "user_sessions",
+		RecordID:  sessionID,
+		NewValues: gin.H{
+			"target_user_id": claims.UserID,
+			"method":         c.Request.Method,
+			"route":          route,
+			"path":           c.Request.URL.Path,
+			"status":         c.Writer.Status(),
+			"read_only":      claims.ImpersonationReadOnly,
+		},
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if c.Writer.Status() == http.StatusForbidden {
+		log.Printf("SECURITY: Impersonation by %s blocked on %s %s", *claims.ImpersonatorID, c.Request.Method, route)
+	}
+}
+
+func respondImpersonationForbidden(c *gin.Context, message string) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "Not allowed during a support session",
+		"code":    "impersonation_forbidden",
+		"message": message,
+	})
+	c.Abort()
+}
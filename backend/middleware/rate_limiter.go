@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -114,9 +115,9 @@ func TenangRateLimitMiddleware() gin.HandlerFunc {
 		}
 
 		// Add rate limit headers
-		c.Header("X-RateLimit-Limit", string(rune(limit)))
-		c.Header("X-RateLimit-Remaining", string(rune(remainingRequests)))
-		c.Header("X-RateLimit-Reset", string(rune(resetTime.Unix())))
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remainingRequests))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(resetTime.Unix(), 10))
 		c.Header("X-RateLimit-Window", window.String())
 
 		c.Next()
@@ -301,10 +302,10 @@ func respondWithRateLimitError(c *gin.Context, endpointType string, resetTime ti
 		supportMessage = "Ini membantu menjaga kinerja platform untuk semua pengguna."
 	}
 
-	c.Header("Retry-After", string(rune(retryAfter)))
-	c.Header("X-RateLimit-Limit", string(rune(limit)))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
 	c.Header("X-RateLimit-Remaining", "0")
-	c.Header("X-RateLimit-Reset", string(rune(resetTime.Unix())))
+	c.Header("X-RateLimit-Reset", strconv.FormatInt(resetTime.Unix(), 10))
 
 	c.JSON(http.StatusTooManyRequests, gin.H{
 		"error":         "Rate limit exceeded",
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"net/http"
+
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoadUserRoles returns the role names granted to a user. Every user implicitly
+// holds the "user" role.
+func LoadUserRoles(db *gorm.DB, userID uuid.UUID) ([]string, error) {
+	var roleNames []string
+	err := db.Model(&models.UserRole{}).
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.role_name").
+		Pluck("roles.role_name", &roleNames).Error
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{models.RoleUser}, roleNames...), nil
+}
+
+// LoadUserPermissions returns the union of permissions of all roles held by a user.
+func LoadUserPermissions(db *gorm.DB, userID uuid.UUID) (map[string]bool, error) {
+	var keys []string
+	err := db.Table("permissions").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.role_name = ? OR roles.id IN (?)", models.RoleUser,
+			db.Model(&models.UserRole{}).Select("role_id").Where("user_id = ?", userID)).
+		Distinct().
+		Pluck("permissions.permission_key", &keys).Error
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		permissions[key] = true
+	}
+	return permissions, nil
+}
+
+// UserRequiresMFA reports whether any role held by the user makes 2FA mandatory.
+func UserRequiresMFA(db *gorm.DB, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := db.Model(&models.UserRole{}).
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ? AND roles.require_mfa = ?", userID, true).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// HasAdminRole reports whether the roles include admin or super-admin.
+func HasAdminRole(roles []string) bool {
+	for _, role := range roles {
+		if role == models.RoleAdmin || role == models.RoleSuperAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission ensures the authenticated user holds every listed permission.
+// Must run after TenangAuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Staff privileges are never available through an impersonated session
+		if IsImpersonating(c) {
+			respondImpersonationForbidden(c, "Administrative actions are not available during a support session.")
+			return
+		}
+
+		granted, err := getPermissions(c)
+		if err != nil {
+			respondWithAuthError(c, "Authentication required", "auth_required")
+			return
+		}
+
+		for _, permission := range permissions {
+			if !granted[permission] {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":      "Insufficient permissions",
+					"code":       "permission_denied",
+					"message":    "You do not have permission to perform this action.",
+					"permission": permission,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		if !mfaSatisfied(c) {
+			respondMFARequired(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// HasPermission reports whether the authenticated user holds a permission.
+func HasPermission(c *gin.Context, permission string) bool {
+	if IsImpersonating(c) {
+		return false
+	}
+	granted, err := getPermissions(c)
+	return err == nil && granted[permission]
+}
+
+// mfaSatisfied reports whether the session meets the 2FA requirement of the user's roles.
+func mfaSatisfied(c *gin.Context) bool {
+	if verified, _ := c.Get("mfa_verified"); verified == true {
+		return true
+	}
+	userID, _, _, _, err := GetUserFromTenangContext(c)
+	if err != nil {
+		return false
+	}
+	required, err := UserRequiresMFA(c.MustGet("db").(*gorm.DB), userID)
+	return err == nil && !required
+}
+
+func respondMFARequired(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "Two-factor authentication required",
+		"code":    "mfa_required",
+		"message": "Your role requires signing in with two-factor authentication. Enable 2FA and log in again.",
+	})
+	c.Abort()
+}
+
+// getPermissions loads the user's permissions once per request and caches them in the context.
+func getPermissions(c *gin.Context) (map[string]bool, error) {
+	if cached, exists := c.Get("permissions"); exists {
+		if permissions, ok := cached.(map[string]bool); ok {
+			return permissions, nil
+		}
+	}
+
+	userID, _, _, _, err := GetUserFromTenangContext(c)
+	if err != nil {
+		return nil, err
+	}
+
+	db := c.MustGet("db").(*gorm.DB)
+	permissions, err := LoadUserPermissions(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	c.Set("permissions", permissions)
+	return permissions, nil
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"encoding/json"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ClientInfo describes the device a session was started from.
+type ClientInfo struct {
+	IPAddress  string `json:"-"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	DeviceName string `json:"device_name,omitempty"`
+	Platform   string `json:"platform,omitempty"`
+}
+
+// TenangTokenPair is the result of issuing a new server-side session.
+type TenangTokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	Session      models.UserSession
+	User         models.User
+}
+
+// ClientInfoFromRequest collects device details sent by the client apps.
+func ClientInfoFromRequest(c *gin.Context) ClientInfo {
+	return ClientInfo{
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		DeviceName: c.GetHeader("X-Device-Name"),
+		Platform:   c.GetHeader("X-Device-Platform"),
+	}
+}
+
+// IssueTenangSession persists a UserSession and mints an access/refresh pair bound to it.
+// Only the hash of the refresh token is stored. The session starts a new refresh family.
+// mfaVerified records whether the sign-in passed a second factor.
+func IssueTenangSession(db *gorm.DB, user models.User, client ClientInfo, mfaVerified bool) (*TenangTokenPair, error) {
+	sessionID := uuid.New()
+	tokens, err := buildSession(db, user, client, sessionID, sessionID, mfaVerified)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Create(&tokens.Session).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// buildSession mints the token pair and the (unsaved) UserSession row for it.
+func buildSession(db *gorm.DB, user models.User, client ClientInfo, sessionID, familyID uuid.UUID, mfaVerified bool) (*TenangTokenPair, error) {
+	roles, err := LoadUserRoles(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := GenerateTenangJWT(user, roles, "access", sessionID.String())
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := GenerateTenangJWT(user, roles, "refresh", sessionID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	deviceInfo, _ := json.Marshal(client)
+	ipAddress := client.IPAddress
+	if ipAddress == "" {
+		ipAddress = "0.0.0.0"
+	}
+
+	now := time.Now()
+	session := models.UserSession{
+		ID:             sessionID,
+		UserID:         user.ID,
+		SessionToken:   services.HashToken(refreshToken),
+		DeviceInfo:     string(deviceInfo),
+		IPAddress:      ipAddress,
+		LastActivityAt: now,
+		ExpiresAt:      now.Add(config.AppConfig.JWT.RefreshExpiry),
+		IsActive:       true,
+		MFAVerified:    mfaVerified,
+		FamilyID:       familyID,
+	}
+
+	return &TenangTokenPair{AccessToken: accessToken, RefreshToken: refreshToken, Session: session, User: user}, nil
+}
+
+// RevokeSession deactivates a single session of a user.
+func RevokeSession(db *gorm.DB, userID, sessionID uuid.UUID, reason string) (bool, error) {
+	result := db.Model(&models.UserSession{}).
+		Where("id = ? AND user_id = ? AND is_active = ?", sessionID, userID, true).
+		Updates(revokedColumns(reason))
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeUserSessions deactivates every active session of a user, optionally
+// keeping the one identified by exceptID.
+func RevokeUserSessions(db *gorm.DB, userID uuid.UUID, reason string, exceptID *uuid.UUID) (int64, error) {
+	query := db.Model(&models.UserSession{}).Where("user_id = ? AND is_active = ?", userID, true)
+	if exceptID != nil {
+		query = query.Where("id <> ?", *exceptID)
+	}
+	result := query.Updates(revokedColumns(reason))
+	return result.RowsAffected, result.Error
+}
+
+// RevokeSessionFamily deactivates every session descended from the same login.
+func RevokeSessionFamily(db *gorm.DB, familyID uuid.UUID, reason string) (int64, error) {
+	result := db.Model(&models.UserSession{}).Where("family_id = ? AND is_active = ?", familyID, true).
+		Updates(revokedColumns(reason))
+	return result.RowsAffected, result.Error
+}
+
+func revokedColumns(reason string) map[string]interface{} {
+	return map[string]interface{}{"is_active": false, "revoked_at": time.Now(), "revoked_reason": reason}
+}
+
+// CheckSessionStillValid repeats the checks TenangAuthMiddleware made when a long-lived
+// connection was opened: the access token has not expired, the account is active, no
+// password change happened since and the server-side session is still active.
+func CheckSessionStillValid(db *gorm.DB, claims *TenangJWTClaims) error {
+	if claims.ExpiresAt == nil || time.Now().After(claims.ExpiresAt.Time) {
+		return jwt.ErrTokenExpired
+	}
+
+	var count int64
+	if err := db.Model(&models.User{}).Where("id = ? AND is_active = ?", claims.UserID, true).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInvalidToken
+	}
+
+	if TokenIssuedBeforePasswordChange(db, claims) {
+		return ErrSessionRevoked
+	}
+	_, err := LoadActiveSession(db, claims)
+	return err
+}
+
+// LoadActiveSession returns the session referenced by a token if it is still active.
+func LoadActiveSession(db *gorm.DB, claims *TenangJWTClaims) (*models.UserSession, error) {
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, ErrSessionRevoked
+	}
+
+	var session models.UserSession
+	err = db.Where("id = ? AND user_id = ? AND is_active = ? AND expires_at > ?", sessionID, claims.UserID, true, time.Now()).
+		First(&session).Error
+	if err != nil {
+		return nil, ErrSessionRevoked
+	}
+	return &session, nil
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebSocketBearerPrefix marks the subprotocol that carries the access token.
+const WebSocketBearerPrefix = "bearer."
+
+// WebSocketToken lets browser clients, which cannot set headers on a WebSocket
+// handshake, send the access token as a "bearer.<token>" subprotocol. It must run
+// before TenangAuthMiddleware. Native clients keep using the Authorization header.
+func WebSocketToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			for _, protocol := range strings.Split(c.GetHeader("Sec-WebSocket-Protocol"), ",") {
+				protocol = strings.TrimSpace(protocol)
+				if strings.HasPrefix(protocol, WebSocketBearerPrefix) {
+					c.Request.Header.Set("Authorization", "Bearer "+strings.TrimPrefix(protocol, WebSocketBearerPrefix))
+					break
+				}
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PasswordResetToken menyimpan token reset password sekali pakai.
+// Hanya hash SHA-256 dari token yang disimpan; token asli hanya dikirim lewat email.
+type PasswordResetToken struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	TokenHash   string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt      *time.Time `json:"usedAt"`
+	RequestedIP *string    `gorm:"type:inet" json:"requestedIp"`
+	CreatedAt   time.Time  `json:"createdAt"`
+
+	// Relationships - Using pointer to break circular dependency
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+// MagicLinkToken adalah token login tanpa password yang dikirim lewat email.
+// Token hanya bisa ditukar dari perangkat yang memintanya (DeviceHash) dan hanya sekali.
+type MagicLinkToken struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	TokenHash   string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	DeviceHash  string     `gorm:"type:varchar(64);not null" json:"-"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt      *time.Time `json:"usedAt"`
+	RequestedIP *string    `gorm:"type:inet" json:"requestedIp"`
+	CreatedAt   time.Time  `json:"createdAt"`
+
+	// Relationships - Using pointer to break circular dependency
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+// UserMFA menyimpan secret TOTP (terenkripsi AES-GCM) milik pengguna.
+// Baris dibuat saat setup dan baru aktif setelah kode pertama diverifikasi.
+type UserMFA struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"userId"`
+	SecretEncrypted string     `gorm:"type:text;not null" json:"-"`
+	IsEnabled       bool       `gorm:"default:false" json:"isEnabled"`
+	EnabledAt       *time.Time `json:"enabledAt"`
+	LastUsedStep    int64      `gorm:"default:0" json:"-"` // Langkah TOTP terakhir yang diterima, mencegah replay
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+
+	// Relationships - Using pointer to break circular dependency
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+// MFARecoveryCode adalah kode cadangan sekali pakai; hanya hash-nya yang disimpan.
+type MFARecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	CodeHash  string     `gorm:"type:varchar(64);not null" json:"-"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+
+	// Relationships - Using pointer to break circular dependency
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+// UsedMFAChallenge mencatat token tantangan 2FA (berdasarkan jti) yang sudah dipakai,
+// sehingga setiap token hanya bisa ditukar sekali. Baris dihapus setelah token kedaluwarsa.
+type UsedMFAChallenge struct {
+	TokenID   string    `gorm:"type:varchar(64);primaryKey" json:"tokenId"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Relationships - Using pointer to break circular dependency
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+// SigningKey adalah pasangan kunci asimetris untuk menandatangani JWT.
+// Private key disimpan terenkripsi; public key dipublikasikan lewat JWKS
+// sampai ExpiresAt agar token lama tetap bisa diverifikasi.
+type SigningKey struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	KeyID               string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"kid"`
+	Algorithm           string     `gorm:"type:varchar(10);not null;check:algorithm IN ('ES256', 'RS256')" json:"algorithm"`
+	PrivateKeyEncrypted string     `gorm:"type:text;not null" json:"-"`
+	PublicKeyPEM        string     `gorm:"type:text;not null" json:"publicKeyPem"`
+	ActivatedAt         time.Time  `gorm:"not null" json:"activatedAt"`
+	RetiredAt           *time.Time `json:"retiredAt"` // Berhenti dipakai untuk menandatangani
+	ExpiresAt           *time.Time `json:"expiresAt"` // Berhenti dipakai untuk verifikasi
+	CreatedAt           time.Time  `json:"createdAt"`
+}
+
+// UserIdentity menautkan akun Tenang.in dengan identitas di penyedia login eksternal (mis. Google).
+type UserIdentity struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_user_provider" json:"userId"`
+	Provider        string     `gorm:"type:varchar(30);not null;uniqueIndex:idx_provider_subject;uniqueIndex:idx_user_provider" json:"provider"`
+	ProviderSubject string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_provider_subject" json:"-"`
+	Email           string     `gorm:"type:varchar(255)" json:"email"`
+	LastLoginAt     *time.Time `json:"lastLoginAt"`
+	CreatedAt       time.Time  `json:"createdAt"`
+
+	// Relationships - Using pointer to break circular dependency
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+// OAuthState menyimpan state, nonce dan PKCE verifier dari alur authorization-code
+// sampai callback diterima. Baris dihapus saat dipakai sehingga state sekali pakai.
+// BindingHash adalah hash cookie browser yang memulai alur; callback dari browser lain ditolak.
+type OAuthState struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	StateHash    string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	Provider     string     `gorm:"type:varchar(30);not null" json:"provider"`
+	Nonce        string     `gorm:"type:varchar(100);not null" json:"-"`
+	CodeVerifier string     `gorm:"type:varchar(128);not null" json:"-"`
+	BindingHash  string     `gorm:"type:varchar(64);not null;default:''" json:"-"`
+	LinkUserID   *uuid.UUID `gorm:"type:uuid" json:"linkUserId"` // Diisi bila alur untuk menautkan ke akun yang sedang login
+	ExpiresAt    time.Time  `gorm:"not null;index" json:"expiresAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
@@ -26,6 +26,21 @@ type ChatSession struct {
 	Messages []ChatMessage `gorm:"foreignKey:ChatSessionID;constraint:OnDelete:CASCADE" json:"messages,omitempty"`
 }
 
+// Emosi utama yang ditandai pada pesan pengguna (kolom emotion_detected).
+const (
+	EmotionJoy        = "joy"
+	EmotionGratitude  = "gratitude"
+	EmotionSadness    = "sadness"
+	EmotionLoneliness = "loneliness"
+	EmotionAnxiety    = "anxiety"
+	EmotionFear       = "fear"
+	EmotionAnger      = "anger"
+	EmotionNeutral    = "neutral"
+)
+
+// Emotions lists every value EmotionDetected can take.
+var Emotions = []string{EmotionJoy, EmotionGratitude, EmotionSadness, EmotionLoneliness, EmotionAnxiety, EmotionFear, EmotionAnger, EmotionNeutral}
+
 type ChatMessage struct {
 	ID              uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	ChatSessionID   uuid.UUID `gorm:"type:uuid;not null;index" json:"chatSessionId"`
@@ -35,11 +50,13 @@ type ChatMessage struct {
 	SentimentScore  *float64  `gorm:"type:decimal(3,2);check:sentiment_score BETWEEN -1 AND 1" json:"sentimentScore"`
 	EmotionDetected *string   `gorm:"type:varchar(20)" json:"emotionDetected"`
 	ResponseTimeMs  *int      `json:"responseTimeMs"`
-	IsEncrypted     bool      `gorm:"default:false" json:"isEncrypted"`
+	IsEncrypted     bool      `gorm:"default:false" json:"isEncrypted"` // Lihat models/encryption.go
 	CreatedAt       time.Time `json:"createdAt"`
 
 	// Relationships - Using pointer to break circular dependency
 	ChatSession *ChatSession `gorm:"foreignKey:ChatSessionID" json:"chatSession,omitempty"`
+
+	plaintext string `gorm:"-"`
 }
 
 type ScheduledCheckin struct {
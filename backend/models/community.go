@@ -15,6 +15,7 @@ type CommunityCategory struct {
 	DisplayOrder        int       `gorm:"default:0" json:"displayOrder"`
 	IsActive            bool      `gorm:"default:true" json:"isActive"`
 	ModeratorRequired   bool      `gorm:"default:false" json:"moderatorRequired"`
+	AdultsOnly          bool      `gorm:"default:false" json:"adultsOnly"` // Disembunyikan dari pengguna dalam mode aman anak
 	PostGuidelines      *string   `gorm:"type:text" json:"postGuidelines"`
 	IconName            *string   `gorm:"type:varchar(50)" json:"iconName"`
 	CreatedAt           time.Time `json:"createdAt"`
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Status kontak tepercaya. Kontak baru dihubungi setelah menyetujui lewat tautan email.
+const (
+	TrustedContactPending  = "pending"
+	TrustedContactVerified = "verified"
+	TrustedContactDeclined = "declined"
+)
+
+// Cakupan persetujuan kontak tepercaya: kapan mereka boleh dihubungi dan apa yang dibagikan.
+const (
+	ContactScopeCrisisAlerts  = "crisis_alerts"  // Dihubungi saat krisis dikonfirmasi
+	ContactScopePanicAlerts   = "panic_alerts"   // Dihubungi saat pengguna menekan tombol darurat
+	ContactScopeShareLocation = "share_location" // Menerima lokasi yang dibagikan pengguna saat darurat
+)
+
+// TrustedContactScopes lists every scope a contact can consent to.
+var TrustedContactScopes = []string{ContactScopeCrisisAlerts, ContactScopePanicAlerts, ContactScopeShareLocation}
+
+// TrustedContact adalah orang kepercayaan pengguna yang dapat dihubungi saat krisis.
+// Scopes adalah cakupan yang diminta pengguna; ConsentedScopes adalah yang benar-benar
+// disetujui kontak, dan hanya itu yang dipakai saat eskalasi.
+type TrustedContact struct {
+	ID                 uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID             uuid.UUID      `gorm:"type:uuid;not null;index" json:"userId"`
+	Name               string         `gorm:"type:varchar(100);not null" json:"name"`
+	Email              string         `gorm:"type:varchar(255);not null" json:"email"`
+	Phone              *string        `gorm:"type:varchar(20)" json:"phone"`
+	Relationship       string         `gorm:"type:varchar(50);not null" json:"relationship"`
+	Scopes             pq.StringArray `gorm:"type:text[];not null" json:"scopes"`
+	ConsentedScopes    pq.StringArray `gorm:"type:text[]" json:"consentedScopes"`
+	Status             string         `gorm:"type:varchar(20);not null;default:'pending';check:status IN ('pending', 'verified', 'declined')" json:"status"`
+	VerificationSentAt *time.Time     `json:"verificationSentAt"`
+	RespondedAt        *time.Time     `json:"respondedAt"`
+	CreatedAt          time.Time      `json:"createdAt"`
+	UpdatedAt          time.Time      `json:"updatedAt"`
+
+	// Relationships - Using pointer to break circular dependency
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+// HasConsent reports whether the contact has agreed to be contacted for scope.
+func (t TrustedContact) HasConsent(scope string) bool {
+	if t.Status != TrustedContactVerified {
+		return false
+	}
+	for _, s := range t.ConsentedScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Pemicu dan hasil eskalasi krisis.
+const (
+	EscalationTriggerPanic           = "panic_button"
+	EscalationTriggerCrisisConfirmed = "crisis_confirmed"
+
+	EscalationSent       = "sent"
+	EscalationNoContacts = "no_contacts"
+	EscalationSuppressed = "suppressed" // Ditahan karena masih dalam masa cooldown
+)
+
+// CrisisEscalation mencatat setiap permintaan eskalasi, termasuk yang ditahan oleh
+// cooldown, sebagai jejak audit lengkap.
+type CrisisEscalation struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	TriggerType      string     `gorm:"type:varchar(30);not null;check:trigger_type IN ('panic_button', 'crisis_confirmed')" json:"triggerType"`
+	TriggeredBy      *uuid.UUID `gorm:"type:uuid" json:"triggeredBy"` // Pengguna sendiri atau staf yang mengonfirmasi
+	Status           string     `gorm:"type:varchar(20);not null;check:status IN ('sent', 'no_contacts', 'suppressed')" json:"status"`
+	Note             *string    `gorm:"type:text" json:"note"`
+	Latitude         *float64   `json:"latitude,omitempty"`
+	Longitude        *float64   `json:"longitude,omitempty"`
+	ContactsTargeted int        `gorm:"default:0" json:"contactsTargeted"`
+	RequestedIP      *string    `gorm:"type:inet" json:"-"`
+	CreatedAt        time.Time  `json:"createdAt"`
+
+	// Relationships
+	User       *User                      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+	Deliveries []CrisisEscalationDelivery `gorm:"foreignKey:EscalationID;constraint:OnDelete:CASCADE" json:"deliveries,omitempty"`
+}
+
+// CrisisEscalationDelivery adalah satu upaya menghubungi satu kontak.
+type CrisisEscalationDelivery struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	EscalationID uuid.UUID  `gorm:"type:uuid;not null;index" json:"escalationId"`
+	ContactID    *uuid.UUID `gorm:"type:uuid;index" json:"contactId"` // NULL bila kontak sudah dihapus
+	Channel      string     `gorm:"type:varchar(20);not null;check:channel IN ('email', 'in_app')" json:"channel"`
+	Status       string     `gorm:"type:varchar(20);not null;check:status IN ('sent', 'failed')" json:"status"`
+	Error        *string    `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// Tingkat risiko hasil deteksi krisis pada pesan chat.
+const (
+	CrisisRiskNone   = "none"
+	CrisisRiskLow    = "low"
+	CrisisRiskMedium = "medium"
+	CrisisRiskHigh   = "high"
+)
+
+// Status tinjauan peringatan krisis oleh konselor.
+const (
+	CrisisAlertOpen         = "open"
+	CrisisAlertAcknowledged = "acknowledged" // Sudah ditangani staf tanpa menghubungi kontak
+	CrisisAlertEscalated    = "escalated"    // Dikonfirmasi dan diteruskan ke kontak tepercaya
+	CrisisAlertDismissed    = "dismissed"    // Bukan krisis (positif palsu)
+)
+
+// CrisisAlert dibuat saat pesan chat terdeteksi berisiko, dan masuk ke antrean tinjauan
+// konselor. Isi pesan tidak disalin ke sini; hanya sinyal yang cocok yang disimpan.
+type CrisisAlert struct {
+	ID             uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID         uuid.UUID      `gorm:"type:uuid;not null;index" json:"userId"`
+	ChatSessionID  uuid.UUID      `gorm:"type:uuid;not null;index" json:"chatSessionId"`
+	ChatMessageID  uuid.UUID      `gorm:"type:uuid;not null" json:"chatMessageId"`
+	RiskLevel      string         `gorm:"type:varchar(10);not null;check:risk_level IN ('low', 'medium', 'high')" json:"riskLevel"`
+	Score          float64        `gorm:"type:decimal(3,2)" json:"score"`
+	Signals        pq.StringArray `gorm:"type:text[]" json:"signals"`
+	Stage          string         `gorm:"type:varchar(10);not null" json:"stage"` // lexicon atau model
+	SafetyOverride bool           `gorm:"default:false" json:"safetyOverride"`    // Jawaban AI diganti pesan keselamatan
+	Status         string         `gorm:"type:varchar(20);not null;default:'open';index;check:status IN ('open', 'acknowledged', 'escalated', 'dismissed')" json:"status"`
+	ReviewedBy     *uuid.UUID     `gorm:"type:uuid" json:"reviewedBy"`
+	ReviewedAt     *time.Time     `json:"reviewedAt"`
+	ReviewNote     *string        `gorm:"type:text" json:"reviewNote"`
+	EscalationID   *uuid.UUID     `gorm:"type:uuid" json:"escalationId"`
+	CreatedAt      time.Time      `json:"createdAt"`
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SealedFieldPrefix marks a column value encrypted with the owner's data key. Plaintext
+// rows written before encryption was enabled have no prefix and are read as-is.
+const SealedFieldPrefix = "enc:v1:"
+
+// UserDataKey adalah kunci data (DEK) milik satu pengguna, dibungkus (wrapped) dengan
+// kunci master SecurityConfig.EncryptionKey. Menghapus baris ini membuat seluruh isi
+// chat dan transkripsi pengguna tidak dapat dibaca lagi.
+type UserDataKey struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"userId"`
+	WrappedKey  string    `gorm:"type:text;not null" json:"-"`
+	MasterKeyID string    `gorm:"type:varchar(16);not null;index" json:"masterKeyId"` // Sidik jari kunci master yang membungkus
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+
+	// Relationships - Using pointer to break circular dependency
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+// FieldCipher seals and opens sensitive columns with the owning user's data key.
+type FieldCipher interface {
+	Seal(userID uuid.UUID, plaintext string) (string, error)
+	Open(userID uuid.UUID, value string) (string, error)
+}
+
+var fieldCipher FieldCipher
+
+// UseFieldCipher enables transparent encryption of chat messages, transcriptions and
+// reflection prompts. Without a cipher the hooks below store plaintext.
+func UseFieldCipher(cipher FieldCipher) {
+	fieldCipher = cipher
+}
+
+// IsSealed reports whether a column value is already encrypted.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, SealedFieldPrefix)
+}
+
+// Pemilik sesi chat dan entri jurnal tidak pernah berubah, jadi aman di-cache.
+var (
+	chatSessionOwners sync.Map // chat session ID -> user ID
+	vocalEntryOwners  sync.Map // vocal entry ID -> user ID
+)
+
+func recordOwner(tx *gorm.DB, cache *sync.Map, model interface{}, id uuid.UUID) (uuid.UUID, error) {
+	if owner, ok := cache.Load(id); ok {
+		return owner.(uuid.UUID), nil
+	}
+	var owner uuid.UUID
+	err := tx.Session(&gorm.Session{NewDB: true}).Model(model).Select("user_id").Where("id = ?", id).Row().Scan(&owner)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	cache.Store(id, owner)
+	return owner, nil
+}
+
+func sealField(tx *gorm.DB, cache *sync.Map, model interface{}, parentID uuid.UUID, value *string) (bool, error) {
+	if fieldCipher == nil || value == nil || *value == "" || IsSealed(*value) {
+		return false, nil
+	}
+	owner, err := recordOwner(tx, cache, model, parentID)
+	if err != nil {
+		return false, err
+	}
+	sealed, err := fieldCipher.Seal(owner, *value)
+	if err != nil {
+		return false, err
+	}
+	*value = sealed
+	return true, nil
+}
+
+func openField(tx *gorm.DB, cache *sync.Map, model interface{}, parentID uuid.UUID, value *string) error {
+	if fieldCipher == nil || value == nil || !IsSealed(*value) {
+		return nil
+	}
+	owner, err := recordOwner(tx, cache, model, parentID)
+	if err != nil {
+		return err
+	}
+	plaintext, err := fieldCipher.Open(owner, *value)
+	if err != nil {
+		return err
+	}
+	*value = plaintext
+	return nil
+}
+
+// --- ChatMessage.MessageContent ---
+
+func (m *ChatMessage) BeforeSave(tx *gorm.DB) error {
+	m.plaintext = m.MessageContent
+	sealed, err := sealField(tx, &chatSessionOwners, &ChatSession{}, m.ChatSessionID, &m.MessageContent)
+	if sealed {
+		m.IsEncrypted = true
+	}
+	return err
+}
+
+// AfterSave mengembalikan teks asli agar pemanggil tidak menerima ciphertext.
+func (m *ChatMessage) AfterSave(tx *gorm.DB) error {
+	if m.plaintext != "" {
+		m.MessageContent = m.plaintext
+	}
+	return nil
+}
+
+func (m *ChatMessage) AfterFind(tx *gorm.DB) error {
+	return openField(tx, &chatSessionOwners, &ChatSession{}, m.ChatSessionID, &m.MessageContent)
+}
+
+// --- VocalTranscription.TranscriptionText ---
+
+func (t *VocalTranscription) BeforeSave(tx *gorm.DB) error {
+	t.plaintext = t.TranscriptionText
+	sealed, err := sealField(tx, &vocalEntryOwners, &VocalJournalEntry{}, t.VocalEntryID, &t.TranscriptionText)
+	if sealed {
+		t.IsEncrypted = true
+	}
+	return err
+}
+
+func (t *VocalTranscription) AfterSave(tx *gorm.DB) error {
+	if t.plaintext != "" {
+		t.TranscriptionText = t.plaintext
+	}
+	return nil
+}
+
+func (t *VocalTranscription) AfterFind(tx *gorm.DB) error {
+	return openField(tx, &vocalEntryOwners, &VocalJournalEntry{}, t.VocalEntryID, &t.TranscriptionText)
+}
+
+// --- VocalSentimentAnalysis.ReflectionPrompt ---
+
+func (a *VocalSentimentAnalysis) BeforeSave(tx *gorm.DB) error {
+	if a.ReflectionPrompt == nil {
+		return nil
+	}
+	a.plaintext = *a.ReflectionPrompt
+	sealed, err := sealField(tx, &vocalEntryOwners, &VocalJournalEntry{}, a.VocalEntryID, a.ReflectionPrompt)
+	if sealed {
+		a.IsEncrypted = true
+	}
+	return err
+}
+
+func (a *VocalSentimentAnalysis) AfterSave(tx *gorm.DB) error {
+	if a.ReflectionPrompt != nil && a.plaintext != "" {
+		plaintext := a.plaintext
+		a.ReflectionPrompt = &plaintext
+	}
+	return nil
+}
+
+func (a *VocalSentimentAnalysis) AfterFind(tx *gorm.DB) error {
+	return openField(tx, &vocalEntryOwners, &VocalJournalEntry{}, a.VocalEntryID, a.ReflectionPrompt)
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Status persetujuan orang tua/wali untuk pengguna di bawah umur.
+const (
+	GuardianConsentPending  = "pending"
+	GuardianConsentGranted  = "granted"
+	GuardianConsentDeclined = "declined"
+	GuardianConsentRevoked  = "revoked"
+)
+
+// GuardianConsent mencatat persetujuan orang tua/wali bagi pengguna di bawah
+// SecurityConfig.MinorSafeAge. Baris lama tidak dihapus saat ada permintaan baru,
+// sehingga riwayat persetujuan tetap dapat diaudit.
+type GuardianConsent struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	GuardianName  string     `gorm:"type:varchar(100);not null" json:"guardianName"`
+	GuardianEmail string     `gorm:"type:varchar(255);not null" json:"guardianEmail"`
+	Relationship  string     `gorm:"type:varchar(50);not null" json:"relationship"` // mis. ibu, ayah, wali
+	Status        string     `gorm:"type:varchar(20);not null;default:'pending';check:status IN ('pending', 'granted', 'declined', 'revoked')" json:"status"`
+	RespondedAt   *time.Time `json:"respondedAt"`
+	RespondedIP   *string    `gorm:"type:inet" json:"-"`
+	RespondedUA   *string    `gorm:"type:text" json:"-"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+
+	// Relationships - Using pointer to break circular dependency
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
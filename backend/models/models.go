@@ -0,0 +1,17 @@
+package models
+
+// All mengembalikan semua model yang dimigrasikan, dalam urutan yang aman untuk AutoMigrate.
+func All() []interface{} {
+	return []interface{}{
+		&User{}, &UserCredentials{}, &UserPreferences{}, &UserSession{},
+		&PasswordResetToken{}, &MagicLinkToken{}, &UserMFA{}, &MFARecoveryCode{}, &UsedMFAChallenge{}, &SigningKey{}, &UserDataKey{},
+		&UserIdentity{}, &OAuthState{}, &DataExport{}, &AccountDeletionRequest{}, &GuardianConsent{},
+		&TrustedContact{}, &CrisisEscalation{}, &CrisisEscalationDelivery{}, &CrisisAlert{},
+		&Role{}, &Permission{}, &UserRole{},
+		&ChatSession{}, &ChatMessage{}, &ScheduledCheckin{},
+		&VocalJournalEntry{}, &VocalTranscription{}, &VocalSentimentAnalysis{},
+		&CommunityCategory{}, &CommunityPost{}, &CommunityPostReply{}, &CommunityReaction{},
+		&SocialMediaAccount{}, &SocialMediaPostMonitored{},
+		&Notification{}, &UserProgressMetric{}, &SystemAnalytics{}, &AuditLog{},
+	}
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Jenis notifikasi yang dikenal (lihat CHECK pada Notification.NotificationType).
+const (
+	NotificationChatCheckin       = "chat_checkin"
+	NotificationCommunityReply    = "community_reply"
+	NotificationCommunityReaction = "community_reaction"
+	NotificationSocialMediaAlert  = "social_media_alert"
+	NotificationWellnessReminder  = "wellness_reminder"
+	NotificationAccountUpdate     = "account_update"
+	NotificationCrisisAlert       = "crisis_alert"
+)
+
+// NotificationTypes lists every notification type.
+var NotificationTypes = []string{
+	NotificationChatCheckin, NotificationCommunityReply, NotificationCommunityReaction, NotificationSocialMediaAlert,
+	NotificationWellnessReminder, NotificationAccountUpdate, NotificationCrisisAlert,
+}
+
+// Saluran pengiriman notifikasi (Notification.DeliveryMethod).
+const (
+	DeliveryPush  = "push"
+	DeliveryEmail = "email"
+	DeliveryInApp = "in_app"
+)
+
+// Frekuensi ringkasan (digest) untuk notifikasi berprioritas rendah dan normal.
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly" // Dikirim setiap Senin pada DigestTime
+)
+
+// QuietHours adalah rentang jam tenang harian dalam zona waktu pengguna, format "HH:MM".
+// Rentang boleh melewati tengah malam, mis. 22:00–07:00.
+type QuietHours struct {
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+// NotificationSchedule is the typed content of UserPreferences.NotificationSchedule.
+// Validation lives in services.ValidateNotificationSchedule.
+type NotificationSchedule struct {
+	QuietHours QuietHours `json:"quiet_hours"`
+	// Channels maps a notification type to the channels the user wants it on, in order
+	// of preference. Types not listed keep the channel chosen by the sender; an empty
+	// list turns the type off.
+	Channels        map[string][]string `json:"channels"`
+	MaxPerDay       int                 `json:"max_per_day"` // 0 = tanpa batas
+	DigestFrequency string              `json:"digest_frequency"`
+	DigestTime      string              `json:"digest_time"`
+}
+
+// DefaultNotificationSchedule is used for new preferences and for legacy free-form values.
+func DefaultNotificationSchedule() NotificationSchedule {
+	return NotificationSchedule{
+		QuietHours:      QuietHours{Enabled: false, Start: "22:00", End: "07:00"},
+		Channels:        map[string][]string{},
+		DigestFrequency: DigestOff,
+		DigestTime:      "19:00",
+	}
+}
+
+// Value implements driver.Valuer.
+func (s NotificationSchedule) Value() (driver.Value, error) {
+	s.fillDefaults()
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner. Missing fields take their defaults, and values that
+// predate the schema (the old '[]' default or arbitrary text) read as the default.
+func (s *NotificationSchedule) Scan(value interface{}) error {
+	*s = DefaultNotificationSchedule()
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported notification schedule value %T", value)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		*s = DefaultNotificationSchedule()
+	}
+	s.fillDefaults()
+	return nil
+}
+
+// fillDefaults replaces empty fields, e.g. from a zero-valued schedule saved by FirstOrCreate.
+func (s *NotificationSchedule) fillDefaults() {
+	defaults := DefaultNotificationSchedule()
+	if s.QuietHours.Start == "" || s.QuietHours.End == "" {
+		s.QuietHours.Start, s.QuietHours.End = defaults.QuietHours.Start, defaults.QuietHours.End
+	}
+	if s.Channels == nil {
+		s.Channels = defaults.Channels
+	}
+	if s.DigestFrequency == "" {
+		s.DigestFrequency = defaults.DigestFrequency
+	}
+	if s.DigestTime == "" {
+		s.DigestTime = defaults.DigestTime
+	}
+}
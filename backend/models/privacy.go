@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tingkat privasi pengguna (User.PrivacyLevel). Aturan tiap tingkat ada di services.PrivacyPolicyFor.
+const (
+	PrivacyMinimal  = "minimal"
+	PrivacyStandard = "standard"
+	PrivacyFull     = "full"
+)
+
+// Status pekerjaan ekspor data pribadi.
+const (
+	DataExportPending    = "pending"
+	DataExportProcessing = "processing"
+	DataExportReady      = "ready"
+	DataExportFailed     = "failed"
+	DataExportExpired    = "expired"
+)
+
+// DataExport adalah permintaan salinan seluruh data pengguna (hak akses UU PDP).
+// Arsip ZIP dibuat di latar belakang dan diunduh lewat tautan bertanda tangan.
+type DataExport struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	Status        string     `gorm:"type:varchar(20);not null;default:'pending';check:status IN ('pending', 'processing', 'ready', 'failed', 'expired')" json:"status"`
+	FilePath      *string    `gorm:"type:varchar(500)" json:"-"`
+	FileSizeBytes *int64     `json:"fileSizeBytes"`
+	ErrorMessage  *string    `gorm:"type:text" json:"errorMessage,omitempty"`
+	RequestedIP   *string    `gorm:"type:inet" json:"-"`
+	StartedAt     *time.Time `json:"startedAt"`
+	CompletedAt   *time.Time `json:"completedAt"`
+	ExpiresAt     *time.Time `json:"expiresAt"` // Arsip dihapus setelah waktu ini
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+
+	// Relationships - Using pointer to break circular dependency
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+// Status permintaan penghapusan akun.
+const (
+	AccountDeletionPending   = "pending"
+	AccountDeletionCancelled = "cancelled"
+	AccountDeletionCompleted = "completed"
+)
+
+// DeletedUserEmail adalah akun pengganti yang menjadi pemilik konten komunitas
+// dari akun yang sudah dihapus, sehingga utas diskusi tetap utuh.
+const DeletedUserEmail = "deleted-user@tenang.in"
+
+// DeletedUserDisplayName ditampilkan sebagai penulis konten dari akun yang sudah dihapus.
+const DeletedUserDisplayName = "Pengguna terhapus"
+
+// AccountDeletionRequest adalah permintaan penghapusan akun (hak hapus UU PDP).
+// Akun dinonaktifkan segera dan dihapus permanen setelah masa tenggang. Baris ini
+// sengaja tidak memiliki foreign key ke users agar tetap ada sebagai bukti penghapusan.
+type AccountDeletionRequest struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	RequestedBy  uuid.UUID  `gorm:"type:uuid;not null" json:"requestedBy"` // Pengguna sendiri atau admin
+	Status       string     `gorm:"type:varchar(20);not null;default:'pending';check:status IN ('pending', 'cancelled', 'completed')" json:"status"`
+	RequestedIP  *string    `gorm:"type:inet" json:"-"`
+	ScheduledFor time.Time  `gorm:"not null;index" json:"scheduledFor"` // Akhir masa tenggang
+	CancelledAt  *time.Time `json:"cancelledAt"`
+	CompletedAt  *time.Time `json:"completedAt"`
+	PurgeSummary *string    `gorm:"type:jsonb" json:"purgeSummary"` // Jumlah data yang dihapus/dianonimkan
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
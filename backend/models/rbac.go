@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Nama role bawaan. Setiap pengguna secara implisit memiliki RoleUser.
+const (
+	RoleUser       = "user"
+	RoleModerator  = "moderator"
+	RoleCounselor  = "counselor"
+	RoleAdmin      = "admin"
+	RoleSuperAdmin = "super_admin"
+)
+
+// Kunci permission yang diperiksa oleh middleware.RequirePermission.
+const (
+	PermUsersRead              = "users.read"
+	PermUsersManage            = "users.manage"
+	PermUsersImpersonate       = "users.impersonate"
+	PermRolesManage            = "roles.manage"
+	PermCommunityModerate      = "community.moderate"
+	PermNotificationsBroadcast = "notifications.broadcast"
+	PermAnalyticsView          = "analytics.view"
+	PermCrisisRespond          = "crisis.respond"
+	PermSecurityManage         = "security.manage"
+)
+
+type Role struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	RoleName    string    `gorm:"type:varchar(30);not null;uniqueIndex" json:"roleName"`
+	DisplayName string    `gorm:"type:varchar(50);not null" json:"displayName"`
+	Description *string   `gorm:"type:text" json:"description"`
+	RequireMFA  bool      `gorm:"default:false" json:"requireMfa"` // Pemegang role wajib login dengan 2FA
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions,omitempty"`
+}
+
+type Permission struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	PermissionKey string    `gorm:"type:varchar(50);not null;uniqueIndex" json:"permissionKey"`
+	Description   *string   `gorm:"type:text" json:"description"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// UserRole mencatat role tambahan yang diberikan kepada pengguna beserta pemberinya.
+type UserRole struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_user_role" json:"userId"`
+	RoleID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_user_role" json:"roleId"`
+	GrantedBy *uuid.UUID `gorm:"type:uuid" json:"grantedBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+
+	// Relationships - Using pointer to break circular dependency
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+	Role *Role `gorm:"foreignKey:RoleID;constraint:OnDelete:CASCADE" json:"role,omitempty"`
+}
@@ -9,7 +9,7 @@ import (
 type Notification struct {
 	ID               uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	UserID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
-	NotificationType string     `gorm:"type:varchar(30);not null;check:notification_type IN ('chat_checkin', 'community_reply', 'community_reaction', 'social_media_alert', 'wellness_reminder')" json:"notificationType"`
+	NotificationType string     `gorm:"type:varchar(30);not null;check:notification_type IN ('chat_checkin', 'community_reply', 'community_reaction', 'social_media_alert', 'wellness_reminder', 'account_update', 'crisis_alert')" json:"notificationType"`
 	Title            string     `gorm:"type:varchar(200);not null" json:"title"`
 	Message          string     `gorm:"type:text;not null" json:"message"`
 	ActionURL        *string    `gorm:"type:varchar(500)" json:"actionUrl"`
@@ -28,10 +28,14 @@ type Notification struct {
 	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
 
+// MetricChatMood adalah rata-rata harian sentimen pesan chat pengguna (-1..1), per
+// tanggal lokal pengguna; rincian emosi ada di CalculationData.
+const MetricChatMood = "chat_mood"
+
 type UserProgressMetric struct {
 	ID              uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	UserID          uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
-	MetricType      string    `gorm:"type:varchar(30);not null;check:metric_type IN ('wellbeing_trend_vocal', 'chat_engagement', 'community_participation', 'overall_wellness')" json:"metricType"`
+	MetricType      string    `gorm:"type:varchar(30);not null;check:metric_type IN ('wellbeing_trend_vocal', 'chat_engagement', 'chat_mood', 'community_participation', 'overall_wellness')" json:"metricType"`
 	MetricValue     float64   `gorm:"type:decimal(10,2);not null" json:"metricValue"`
 	MetricDate      time.Time `gorm:"type:date;not null" json:"metricDate"`
 	CalculationData string    `gorm:"type:jsonb;default:'{}'" json:"calculationData"`
@@ -42,13 +46,14 @@ type UserProgressMetric struct {
 }
 
 type SystemAnalytics struct {
-	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	EventType   string    `gorm:"type:varchar(50);not null" json:"eventType"`
-	EventData   string    `gorm:"type:jsonb;not null;default:'{}'" json:"eventData"`
-	UserSegment *string   `gorm:"type:varchar(30)" json:"userSegment"`
-	DeviceType  *string   `gorm:"type:varchar(20)" json:"deviceType"`
-	AppVersion  *string   `gorm:"type:varchar(20)" json:"appVersion"`
-	CreatedAt   time.Time `json:"createdAt"`
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID      *uuid.UUID `gorm:"type:uuid;index" json:"userId"` // Hanya diisi bila tingkat privasi pengguna mengizinkan
+	EventType   string     `gorm:"type:varchar(50);not null" json:"eventType"`
+	EventData   string     `gorm:"type:jsonb;not null;default:'{}'" json:"eventData"`
+	UserSegment *string    `gorm:"type:varchar(30)" json:"userSegment"`
+	DeviceType  *string    `gorm:"type:varchar(20)" json:"deviceType"`
+	AppVersion  *string    `gorm:"type:varchar(20)" json:"appVersion"`
+	CreatedAt   time.Time  `json:"createdAt"`
 }
 
 type AuditLog struct {
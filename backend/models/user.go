@@ -17,6 +17,7 @@ type User struct {
 	IsActive          bool       `gorm:"default:true" json:"isActive"`
 	EmailVerifiedAt   *time.Time `json:"emailVerifiedAt"`
 	LastActiveAt      *time.Time `json:"lastActiveAt"`
+	AvatarKey         *string    `gorm:"type:varchar(255)" json:"-"` // Prefiks penyimpanan varian avatar; nil berarti identicon bawaan
 	CreatedAt         time.Time  `json:"createdAt"`
 	UpdatedAt         time.Time  `json:"updatedAt"`
 	DeletedAt         *time.Time `gorm:"index" json:"deletedAt"`
@@ -43,6 +44,7 @@ type UserCredentials struct {
 	PasswordChangedAt     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"passwordChangedAt"`
 	FailedLoginAttempts   int       `gorm:"default:0" json:"failedLoginAttempts"`
 	LockedUntil           *time.Time `json:"lockedUntil"`
+	LockoutCount          int       `gorm:"default:0" json:"lockoutCount"` // Jumlah lockout beruntun, untuk backoff progresif
 	CreatedAt             time.Time `json:"createdAt"`
 	UpdatedAt             time.Time `json:"updatedAt"`
 
@@ -55,7 +57,7 @@ type UserPreferences struct {
 	UserID                      uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
 	NotificationChat            bool      `gorm:"default:true" json:"notificationChat"`
 	NotificationCommunity       bool      `gorm:"default:true" json:"notificationCommunity"`
-	NotificationSchedule        string    `gorm:"type:jsonb;default:'[]'" json:"notificationSchedule"`
+	NotificationSchedule        NotificationSchedule `gorm:"type:jsonb;default:'{}'" json:"notificationSchedule"`
 	CommunityAnonymousDefault   bool      `gorm:"default:false" json:"communityAnonymousDefault"`
 	SocialMediaMonitoring       bool      `gorm:"default:false" json:"socialMediaMonitoring"`
 	CreatedAt                   time.Time `json:"createdAt"`
@@ -68,13 +70,19 @@ type UserPreferences struct {
 type UserSession struct {
 	ID             uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	UserID         uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
-	SessionToken   string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"sessionToken"`
-	DeviceInfo     string    `gorm:"type:jsonb;default:'{}'" json:"deviceInfo"`
-	IPAddress      string    `gorm:"type:inet" json:"ipAddress"`
-	LastActivityAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"lastActivityAt"`
-	ExpiresAt      time.Time `gorm:"not null" json:"expiresAt"`
-	IsActive       bool      `gorm:"default:true" json:"isActive"`
-	CreatedAt      time.Time `json:"createdAt"`
+	SessionToken   string     `gorm:"type:varchar(255);not null;uniqueIndex" json:"-"` // SHA-256 dari refresh token
+	DeviceInfo     string     `gorm:"type:jsonb;default:'{}'" json:"deviceInfo"`
+	IPAddress      string     `gorm:"type:inet" json:"ipAddress"`
+	LastActivityAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"lastActivityAt"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expiresAt"`
+	IsActive       bool       `gorm:"default:true" json:"isActive"`
+	MFAVerified    bool       `gorm:"default:false" json:"mfaVerified"` // Login sesi ini sudah melewati 2FA
+	FamilyID       uuid.UUID  `gorm:"type:uuid;index" json:"familyId"` // sesi awal dari rantai refresh token
+	ReplacedByID   *uuid.UUID `gorm:"type:uuid" json:"replacedById"`   // sesi hasil rotasi refresh token
+	RevokedAt      *time.Time `json:"revokedAt"`
+	RevokedReason  *string    `gorm:"type:varchar(50)" json:"revokedReason"`
+	ImpersonatorID *uuid.UUID `gorm:"type:uuid;index" json:"impersonatorId"` // Admin yang bertindak sebagai pengguna (sesi dukungan)
+	CreatedAt      time.Time  `json:"createdAt"`
 
 	// Relationships - Using pointer to break circular dependency
 	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
@@ -38,11 +38,13 @@ type VocalTranscription struct {
 	WordCount            *int      `json:"WordCount"`
 	ProcessingService    string    `gorm:"type:varchar(50);default:'azure_speech'" json:"ProcessingService"`
 	ProcessingDurationMs *int      `json:"ProcessingDurationMs"`
-	IsEncrypted          bool      `gorm:"default:true" json:"IsEncrypted"`
+	IsEncrypted          bool      `gorm:"default:true" json:"IsEncrypted"` // Lihat models/encryption.go
 	CreatedAt            time.Time `json:"CreatedAt"`
 
 	// Relationships - Using pointer to break circular dependency
 	VocalEntry *VocalJournalEntry `gorm:"foreignKey:VocalEntryID" json:"vocalEntry,omitempty"`
+
+	plaintext string `gorm:"-"`
 }
 
 type VocalSentimentAnalysis struct {
@@ -61,9 +63,12 @@ type VocalSentimentAnalysis struct {
 	ConfidenceScore       *float64       `gorm:"type:decimal(3,2)" json:"ConfidenceScore,omitempty"`
 	ProcessingDurationMs  *int           `json:"ProcessingDurationMs,omitempty"`
 	ReflectionPrompt      *string        `gorm:"type:text" json:"ReflectionPrompt"`
+	IsEncrypted           bool           `gorm:"default:false" json:"IsEncrypted"` // ReflectionPrompt terenkripsi, lihat models/encryption.go
 	CreatedAt             time.Time      `json:"CreatedAt"`
 	UpdatedAt             time.Time      `json:"UpdatedAt"`
 
 	// Relationships - Using pointer to break circular dependency
 	VocalEntry *VocalJournalEntry `gorm:"foreignKey:VocalEntryID" json:"VocalEntry,omitempty"`
+
+	plaintext string `gorm:"-"`
 }
\ No newline at end of file
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AccountDeletionCancelPurpose is the purpose of signed "restore my account" links.
+const AccountDeletionCancelPurpose = "account_deletion_cancel"
+
+// AccountDeleter permanently removes accounts once their deletion grace period ends.
+type AccountDeleter struct {
+	DB      *gorm.DB
+	Cfg     *config.Config
+	Email   *EmailService
+	Avatars *AvatarService
+	Keys    *DataKeyring
+}
+
+// NewAccountDeleter creates a new AccountDeleter.
+func NewAccountDeleter(db *gorm.DB, cfg *config.Config, avatars *AvatarService, keys *DataKeyring) *AccountDeleter {
+	return &AccountDeleter{DB: db, Cfg: cfg, Email: NewEmailService(cfg.Email), Avatars: avatars, Keys: keys}
+}
+
+// StartPurgeScheduler periodically purges accounts whose grace period has ended.
+func (d *AccountDeleter) StartPurgeScheduler(every time.Duration) {
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for range ticker.C {
+			d.purgeDue()
+		}
+	}()
+}
+
+// CancelURL returns the frontend link that restores an account during its grace period.
+func (d *AccountDeleter) CancelURL(request models.AccountDeletionRequest, user models.User) (string, error) {
+	token, err := SignReferenceToken(d.Cfg.JWT.EncryptionKey, AccountDeletionCancelPurpose, user.ID, user.Email,
+		request.ID.String(), time.Until(request.ScheduledFor))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/account/restore?token=%s", d.Cfg.Server.FrontendURL, url.QueryEscape(token)), nil
+}
+
+// NotifyScheduled emails the user when their account will be deleted and how to stop it.
+func (d *AccountDeleter) NotifyScheduled(request models.AccountDeletionRequest, user models.User) {
+	link, err := d.CancelURL(request, user)
+	if err != nil {
+		log.Printf("ERROR: Failed to sign restore link for deletion request %s: %v", request.ID, err)
+		return
+	}
+
+	body := fmt.Sprintf("Halo,\n\n"+
+		"Kami menerima permintaan untuk menghapus akun Tenang.in kamu. Akun sudah dinonaktifkan dan "+
+		"seluruh data akan dihapus permanen pada %s.\n\n"+
+		"Jika kamu berubah pikiran atau tidak pernah meminta ini, pulihkan akun melalui tautan berikut "+
+		"sebelum tanggal tersebut:\n\n%s\n\n"+
+		"Setelah dihapus, percakapan, jurnal suara, dan data lain tidak dapat dikembalikan. Postingan dan "+
+		"balasan di komunitas akan tetap ada tanpa nama kamu agar diskusi orang lain tidak terputus.\n\n"+
+		"Salam hangat,\nTim Tenang.in 🌸",
+		request.ScheduledFor.Format("02 Jan 2006 15:04 MST"), link)
+	if err := d.Email.Send(EmailMessage{To: user.Email, Subject: "Akun Tenang.in kamu akan dihapus", TextBody: body}); err != nil {
+		log.Printf("ERROR: Failed to send deletion notice to user %s: %v", user.ID, err)
+	}
+}
+
+func (d *AccountDeleter) purgeDue() {
+	var due []uuid.UUID
+	if err := d.DB.Model(&models.AccountDeletionRequest{}).
+		Where("status = ? AND scheduled_for <= ?", models.AccountDeletionPending, time.Now()).
+		Pluck("id", &due).Error; err != nil {
+		log.Printf("ERROR: Failed to load due account deletions: %v", err)
+		return
+	}
+	for _, id := range due {
+		if err := d.Purge(id); err != nil {
+			log.Printf("ERROR: Account deletion %s failed, will retry: %v", id, err)
+		}
+	}
+}
+
+// Purge permanently deletes the account behind a pending deletion request. Community
+// posts and replies are handed to the deleted-user placeholder instead of being
+// removed, so other people's threads stay intact. It is safe to retry.
+func (d *AccountDeleter) Purge(requestID uuid.UUID) error {
+	var purged *uuid.UUID
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		var request models.AccountDeletionRequest
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ?", requestID, models.AccountDeletionPending).First(&request).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Sudah dibatalkan atau diproses worker lain
+		}
+		if err != nil {
+			return fmt.Errorf("lock deletion request: %w", err) // Mis. koneksi putus atau lock timeout; dicoba lagi oleh scheduler
+		}
+		if time.Now().Before(request.ScheduledFor) {
+			return nil
+		}
+		userID := request.UserID
+
+		placeholder, err := deletedUserPlaceholder(tx)
+		if err != nil {
+			return err
+		}
+
+		// File dikumpulkan lebih dulu; baris yang menunjuk ke file ikut dihapus di bawah.
+		var audioFiles, exportFiles []string
+		tx.Model(&models.VocalJournalEntry{}).Where("user_id = ?", userID).Pluck("audio_file_path", &audioFiles)
+		tx.Model(&models.DataExport{}).Where("user_id = ? AND file_path IS NOT NULL", userID).Pluck("file_path", &exportFiles)
+		var avatarKey *string
+		tx.Model(&models.User{}).Where("id = ?", userID).Pluck("avatar_key", &avatarKey)
+
+		summary := map[string]int64{}
+		anonymised := map[string]interface{}{
+			"user_id": placeholder.ID, "is_anonymous": true, "anonymous_display_name": models.DeletedUserDisplayName,
+		}
+		steps := []struct {
+			name string
+			run  func() *gorm.DB
+		}{
+			{"community_posts_anonymised", func() *gorm.DB {
+				return tx.Model(&models.CommunityPost{}).Where("user_id = ?", userID).Updates(anonymised)
+			}},
+			{"community_replies_anonymised", func() *gorm.DB {
+				return tx.Model(&models.CommunityPostReply{}).Where("user_id = ?", userID).Updates(anonymised)
+			}},
+			{"community_reactions", func() *gorm.DB {
+				return tx.Where("user_id = ?", userID).Delete(&models.CommunityReaction{})
+			}},
+			{"chat_messages", func() *gorm.DB {
+				return tx.Where("chat_session_id IN (?)", tx.Model(&models.ChatSession{}).Select("id").Where("user_id = ?", userID)).
+					Delete(&models.ChatMessage{})
+			}},
+			{"chat_sessions", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.ChatSession{}) }},
+			{"scheduled_checkins", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.ScheduledCheckin{}) }},
+			{"vocal_transcriptions", func() *gorm.DB {
+				return tx.Where("vocal_entry_id IN (?)", tx.Model(&models.VocalJournalEntry{}).Select("id").Where("user_id = ?", userID)).
+					Delete(&models.VocalTranscription{})
+			}},
+			{"vocal_sentiment_analyses", func() *gorm.DB {
+				return tx.Where("vocal_entry_id IN (?)", tx.Model(&models.VocalJournalEntry{}).Select("id").Where("user_id = ?", userID)).
+					Delete(&models.VocalSentimentAnalysis{})
+			}},
+			{"vocal_entries", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.VocalJournalEntry{}) }},
+			// Token akses media sosial ikut terhapus bersama barisnya.
+			{"social_monitored_posts", func() *gorm.DB {
+				return tx.Where("social_account_id IN (?)", tx.Model(&models.SocialMediaAccount{}).Select("id").Where("user_id = ?", userID)).
+					Delete(&models.SocialMediaPostMonitored{})
+			}},
+			{"social_accounts", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.SocialMediaAccount{}) }},
+			{"notifications", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.Notification{}) }},
+			{"progress_metrics", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.UserProgressMetric{}) }},
+			{"analytics_unlinked", func() *gorm.DB {
+				return tx.Model(&models.SystemAnalytics{}).Where("user_id = ?", userID).Update("user_id", nil)
+			}},
+			{"crisis_escalation_deliveries", func() *gorm.DB {
+				return tx.Where("escalation_id IN (?)", tx.Model(&models.CrisisEscalation{}).Select("id").Where("user_id = ?", userID)).
+					Delete(&models.CrisisEscalationDelivery{})
+			}},
+			{"crisis_escalations", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.CrisisEscalation{}) }},
+			{"crisis_alerts", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.CrisisAlert{}) }},
+			{"trusted_contacts", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.TrustedContact{}) }},
+			{"guardian_consents", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.GuardianConsent{}) }},
+			{"data_exports", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.DataExport{}) }},
+			{"identities", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.UserIdentity{}) }},
+			{"oauth_states", func() *gorm.DB { return tx.Where("link_user_id = ?", userID).Delete(&models.OAuthState{}) }},
+			{"mfa_recovery_codes", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}) }},
+			{"mfa_challenges", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.UsedMFAChallenge{}) }},
+			{"mfa", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.UserMFA{}) }},
+			{"magic_link_tokens", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.MagicLinkToken{}) }},
+			{"password_reset_tokens", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.PasswordResetToken{}) }},
+			{"sessions", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.UserSession{}) }},
+			{"roles", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.UserRole{}) }},
+			{"preferences", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.UserPreferences{}) }},
+			{"credentials", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.UserCredentials{}) }},
+			// Jejak audit lama tetap disimpan untuk keamanan, tetapi dilepas dari pengguna dan alamat IP-nya.
+			{"audit_logs_detached", func() *gorm.DB {
+				return tx.Model(&models.AuditLog{}).Where("user_id = ?", userID).
+					Updates(map[string]interface{}{"user_id": nil, "ip_address": nil, "user_agent": nil})
+			}},
+			// Kunci data dihapus terakhir: sisa salinan terenkripsi (mis. di backup) tidak bisa dibuka lagi.
+			{"data_keys", func() *gorm.DB { return tx.Where("user_id = ?", userID).Delete(&models.UserDataKey{}) }},
+			{"users", func() *gorm.DB { return tx.Where("id = ?", userID).Delete(&models.User{}) }},
+		}
+		for _, step := range steps {
+			result := step.run()
+			if result.Error != nil {
+				return fmt.Errorf("%s: %w", step.name, result.Error)
+			}
+			summary[step.name] = result.RowsAffected
+		}
+
+		// File dihapus setelah semua baris terhapus; bila commit gagal, percobaan berikutnya
+		// tetap aman karena file yang sudah tidak ada diabaikan.
+		summary["audio_files"], summary["audio_files_failed"] = removeFiles(audioFiles)
+		summary["export_archives"], summary["export_archives_failed"] = removeFiles(exportFiles)
+		if avatarKey != nil {
+			d.Avatars.Remove(*avatarKey)
+			summary["avatar_removed"] = 1
+		}
+
+		completedAt := time.Now()
+		rawSummary, _ := json.Marshal(summary)
+		if err := tx.Model(&request).Updates(map[string]interface{}{
+			"status":        models.AccountDeletionCompleted,
+			"completed_at":  completedAt,
+			"purge_summary": string(rawSummary),
+			"requested_ip":  nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Bukti penghapusan: tidak terikat ke pengguna (barisnya sudah tidak ada), hanya ke permintaan.
+		RecordAudit(tx, AuditEntry{
+			Action: "account_purged", TableName: "account_deletion_requests", RecordID: &request.ID,
+			NewValues: map[string]interface{}{
+				"user_id":       userID,
+				"requested_at":  request.CreatedAt,
+				"scheduled_for": request.ScheduledFor,
+				"purged_at":     completedAt,
+				"summary":       summary,
+			},
+		})
+		log.Printf("INFO: Account %s purged (deletion request %s)", userID, request.ID)
+		purged = &userID
+		return nil
+	})
+	// Kunci data yang masih tersimpan di memori dibuang setelah barisnya benar-benar terhapus.
+	if err == nil && purged != nil && d.Keys != nil {
+		d.Keys.Forget(*purged)
+	}
+	return err
+}
+
+// deletedUserPlaceholder returns the inactive account that owns anonymised community content.
+func deletedUserPlaceholder(tx *gorm.DB) (*models.User, error) {
+	var placeholder models.User
+	displayName := models.DeletedUserDisplayName
+	if err := tx.Where("email = ?", models.DeletedUserEmail).
+		Attrs(models.User{FullName: &displayName, PrivacyLevel: "minimal"}).
+		FirstOrCreate(&placeholder).Error; err != nil {
+		return nil, err
+	}
+	// is_active memiliki default true, jadi nilai false harus ditulis terpisah.
+	if placeholder.IsActive {
+		if err := tx.Model(&placeholder).Update("is_active", false).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &placeholder, nil
+}
+
+func removeFiles(paths []string) (removed, failed int64) {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("WARNING: Failed to delete file %s: %v", path, err)
+			failed++
+			continue
+		}
+		removed++
+	}
+	return removed, failed
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"time"
+
+	"backend/config"
+	"backend/models"
+)
+
+// DefaultTimezone dipakai bila zona waktu pengguna kosong atau tidak dikenal.
+const DefaultTimezone = "Asia/Jakarta"
+
+// UserLocation returns the user's time zone, falling back to Asia/Jakarta.
+func UserLocation(timezone string) *time.Location {
+	if loc, err := time.LoadLocation(timezone); err == nil && timezone != "" {
+		return loc
+	}
+	if loc, err := time.LoadLocation(DefaultTimezone); err == nil {
+		return loc
+	}
+	return time.FixedZone("WIB", 7*60*60)
+}
+
+// AgeOn returns the age in whole years of someone born on dob, as of the calendar
+// date of now in loc. Birthdays on 29 February count from 1 March in other years.
+func AgeOn(dob, now time.Time, loc *time.Location) int {
+	today := now.In(loc)
+	age := today.Year() - dob.Year()
+	if today.Month() < dob.Month() || (today.Month() == dob.Month() && today.Day() < dob.Day()) {
+		age--
+	}
+	return age
+}
+
+// UserAge returns the user's current age in their own time zone. ok is false when
+// no date of birth is on record.
+func UserAge(user models.User) (age int, ok bool) {
+	if user.DateOfBirth == nil {
+		return 0, false
+	}
+	return AgeOn(*user.DateOfBirth, time.Now(), UserLocation(user.Timezone)), true
+}
+
+// IsMinor reports whether minor-safe mode applies to the user. Users without a date
+// of birth on record (e.g. accounts created through Google sign-in) are treated as
+// minors until they provide one; RequireGuardianConsent asks them to.
+func IsMinor(user models.User, cfg *config.Config) bool {
+	age, ok := UserAge(user)
+	return !ok || age < cfg.Security.MinorSafeAge
+}
+
+// AgeUnknown reports whether the user still has to provide a date of birth.
+func AgeUnknown(user models.User) bool {
+	_, ok := UserAge(user)
+	return !ok
+}
+
+// MinorBirthCutoff is the earliest date of birth that is still a minor today. It uses
+// the default time zone, so queries built on it may be a day off for users elsewhere;
+// per-request checks use IsMinor instead.
+func MinorBirthCutoff(cfg *config.Config) time.Time {
+	today := time.Now().In(UserLocation(DefaultTimezone))
+	return time.Date(today.Year()-cfg.Security.MinorSafeAge, today.Month(), today.Day()+1, 0, 0, 0, 0, time.UTC)
+}
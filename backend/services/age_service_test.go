@@ -0,0 +1,39 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/models"
+)
+
+func TestIsMinorTreatsUnknownAgeAsMinor(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Security.MinorSafeAge = 18
+	birth := func(yearsAgo int) *time.Time {
+		d := time.Now().AddDate(-yearsAgo, 0, -1)
+		return &d
+	}
+
+	tests := []struct {
+		name string
+		dob  *time.Time
+		want bool
+	}{
+		{name: "no date of birth (Google sign-up)", dob: nil, want: true},
+		{name: "sixteen", dob: birth(16), want: true},
+		{name: "adult", dob: birth(30), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := models.User{DateOfBirth: tt.dob, Timezone: DefaultTimezone}
+			if got := IsMinor(user, cfg); got != tt.want {
+				t.Errorf("IsMinor = %v, want %v", got, tt.want)
+			}
+			if got := AgeUnknown(user); got != (tt.dob == nil) {
+				t.Errorf("AgeUnknown = %v, want %v", got, tt.dob == nil)
+			}
+		})
+	}
+}
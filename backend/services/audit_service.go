@@ -0,0 +1,66 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditEntry describes a security-relevant event to be written to audit_logs.
+type AuditEntry struct {
+	UserID    *uuid.UUID
+	Action    string
+	TableName string
+	RecordID  *uuid.UUID
+	OldValues interface{}
+	NewValues interface{}
+	IPAddress string
+	UserAgent string
+}
+
+// RecordAudit persists an AuditEntry. Failures are logged rather than returned so
+// that auditing never breaks the request that triggered it.
+func RecordAudit(db *gorm.DB, entry AuditEntry) {
+	if err := WriteAudit(db, entry); err != nil {
+		log.Printf("WARNING: Failed to write audit log '%s': %v", entry.Action, err)
+	}
+}
+
+// WriteAudit writes an audit log entry and returns the error, for callers that
+// rely on the row, e.g. as a throttle inside a transaction.
+func WriteAudit(db *gorm.DB, entry AuditEntry) error {
+	auditLog := models.AuditLog{
+		UserID:    entry.UserID,
+		Action:    entry.Action,
+		RecordID:  entry.RecordID,
+		OldValues: marshalAuditValues(entry.OldValues),
+		NewValues: marshalAuditValues(entry.NewValues),
+	}
+	if entry.TableName != "" {
+		auditLog.TableName = &entry.TableName
+	}
+	if entry.IPAddress != "" {
+		auditLog.IPAddress = &entry.IPAddress
+	}
+	if entry.UserAgent != "" {
+		auditLog.UserAgent = &entry.UserAgent
+	}
+
+	return db.Create(&auditLog).Error
+}
+
+func marshalAuditValues(values interface{}) *string {
+	if values == nil {
+		return nil
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return nil
+	}
+	s := string(raw)
+	return &s
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // Registrasi decoder GIF (hanya frame pertama yang dipakai)
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+)
+
+// AvatarSizes are the square variants generated for every avatar, in pixels.
+var AvatarSizes = []int{64, 128, 256, 512}
+
+// Batas dimensi dan jumlah piksel dicek dari header sebelum decode penuh, untuk menolak
+// "decompression bomb": 16 MP ≈ 64 MB RGBA, dan itu terjadi di dalam request handler.
+const (
+	avatarMinDimension = 32
+	avatarMaxDimension = 4096
+	avatarMaxPixels    = 16_000_000
+)
+
+var (
+	// ErrUnsupportedImage is returned when the upload is not a JPEG, PNG or GIF image.
+	ErrUnsupportedImage = errors.New("unsupported image type")
+	// ErrImageDimensions is returned when the image is too small or too large.
+	ErrImageDimensions = errors.New("image dimensions out of range")
+)
+
+// AvatarService processes avatar uploads and resolves avatar URLs.
+type AvatarService struct {
+	Storage FileStorage
+	Cfg     *config.Config
+}
+
+// NewAvatarService creates a new AvatarService.
+func NewAvatarService(storage FileStorage, cfg *config.Config) *AvatarService {
+	return &AvatarService{Storage: storage, Cfg: cfg}
+}
+
+// AvatarURLs maps a variant size ("64", "128", ...) to its URL.
+type AvatarURLs struct {
+	URLs      map[string]string `json:"urls"`
+	IsDefault bool              `json:"is_default"` // true bila memakai identicon bawaan
+}
+
+// URLs returns the user's avatar variants, or their generated identicon if they
+// have not uploaded one.
+func (s *AvatarService) URLs(user models.User) AvatarURLs {
+	urls := make(map[string]string, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		if user.AvatarKey != nil {
+			urls[strconv.Itoa(size)] = s.Storage.URL(avatarVariantKey(*user.AvatarKey, size))
+		} else {
+			urls[strconv.Itoa(size)] = fmt.Sprintf("%s/api/v1/avatars/identicon/%s?size=%d", s.Cfg.Server.PublicURL, user.ID, size)
+		}
+	}
+	return AvatarURLs{URLs: urls, IsDefault: user.AvatarKey == nil}
+}
+
+// Store validates and processes an uploaded image and stores every variant. It
+// returns the new avatar key to save on the user.
+func (s *AvatarService) Store(userID uuid.UUID, data []byte) (string, error) {
+	variants, err := ProcessAvatar(data)
+	if err != nil {
+		return "", err
+	}
+	// Nama acak: URL lama tidak lagi valid di cache dan avatar tidak bisa ditebak.
+	token, _, err := GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("images/avatars/%s/%s", userID, token[:16])
+	for size, variant := range variants {
+		if err := s.Storage.Put(avatarVariantKey(key, size), variant, "image/jpeg"); err != nil {
+			s.Remove(key)
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+// Remove deletes every variant of an avatar.
+func (s *AvatarService) Remove(key string) {
+	for _, size := range AvatarSizes {
+		s.Storage.Delete(avatarVariantKey(key, size))
+	}
+}
+
+func avatarVariantKey(key string, size int) string {
+	return fmt.Sprintf("%s_%d.jpg", key, size)
+}
+
+// --- processing ---
+
+// ProcessAvatar checks the image type by its magic bytes, crops to a centred square,
+// applies the EXIF orientation and encodes every size as JPEG. Because
+// the pixels are re-encoded, EXIF (including GPS), XMP and other metadata are dropped.
+func ProcessAvatar(data []byte) (map[int][]byte, error) {
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, ErrUnsupportedImage
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if cfg.Width < avatarMinDimension || cfg.Height < avatarMinDimension ||
+		cfg.Width > avatarMaxDimension || cfg.Height > avatarMaxDimension ||
+		cfg.Width*cfg.Height > avatarMaxPixels {
+		return nil, ErrImageDimensions
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	// Potongan persegi di tengah tidak berubah oleh rotasi/cermin, jadi potong dulu:
+	// orientasi cukup diterapkan pada persegi, bukan pada salinan gambar penuh.
+	square := cropSquare(src)
+	if format == "jpeg" {
+		square = applyOrientation(square, jpegOrientation(data))
+	}
+
+	variants := make(map[int][]byte, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resizeBox(square, size), &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		variants[size] = buf.Bytes()
+	}
+	return variants, nil
+}
+
+// cropSquare returns the centred square of src flattened onto white, since JPEG has no alpha.
+func cropSquare(src image.Image) *image.NRGBA {
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	offset := image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, offset, draw.Over)
+	return dst
+}
+
+// resizeBox scales a square image to size×size by averaging the source pixels that
+// fall under each destination pixel (box filter). Good enough for downscaling photos
+// without pulling in an imaging dependency.
+func resizeBox(src *image.NRGBA, size int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	srcSize := src.Bounds().Dx()
+	for y := 0; y < size; y++ {
+		y0, y1 := y*srcSize/size, (y+1)*srcSize/size
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < size; x++ {
+			x0, x1 := x*srcSize/size, (x+1)*srcSize/size
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(row[sx*4])
+					g += uint32(row[sx*4+1])
+					b += uint32(row[sx*4+2])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), 0xff
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag (1-8) from a JPEG, defaulting to 1.
+func jpegOrientation(data []byte) int {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) { // Start of scan: tidak ada metadata lagi
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 14 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation rotates/flips src so it displays upright for EXIF orientation o.
+func applyOrientation(src *image.NRGBA, o int) *image.NRGBA {
+	if o <= 1 || o > 8 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(b.Min.X+x, b.Min.Y+y):][:4])
+		}
+	}
+	return dst
+}
+
+// --- identicon ---
+
+// Identicon renders the default avatar for a user: a symmetric 5×5 pattern whose
+// shape and colour are derived from the user ID, encoded as PNG.
+func Identicon(userID uuid.UUID, size int) ([]byte, error) {
+	sum := sha256.Sum256(userID[:])
+	fg := color.NRGBA{R: 80 + sum[0]%140, G: 80 + sum[1]%140, B: 80 + sum[2]%140, A: 0xff}
+	bg := color.NRGBA{R: 0xf2, G: 0xf2, B: 0xf2, A: 0xff}
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: bg}, image.Point{}, draw.Src)
+
+	const grid = 5
+	padding := size / 10
+	cell := (size - 2*padding) / grid
+	offset := (size - cell*grid) / 2
+	for row := 0; row < grid; row++ {
+		for col := 0; col < (grid+1)/2; col++ {
+			if sum[3+row*3+col]%2 != 0 {
+				continue
+			}
+			for _, c := range []int{col, grid - 1 - col} { // Cermin kiri-kanan
+				rect := image.Rect(offset+c*cell, offset+row*cell, offset+(c+1)*cell, offset+(row+1)*cell)
+				draw.Draw(img, rect, &image.Uniform{C: fg}, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
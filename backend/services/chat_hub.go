@@ -0,0 +1,229 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Jenis event pada kanal real-time sesi chat.
+const (
+	ChatEventMessage      = "message"
+	ChatEventTyping       = "typing"
+	ChatEventSessionEnded = "session_ended"
+)
+
+// ChatEvent is pushed to every device connected to a chat session.
+type ChatEvent struct {
+	Type      string          `json:"type"`
+	SessionID uuid.UUID       `json:"session_id"`
+	MessageID *uuid.UUID      `json:"message_id,omitempty"` // Hanya untuk event "message"
+	Data      json.RawMessage `json:"data,omitempty"`
+	// Source is the connection that caused the event; it is not echoed back to it.
+	Source string `json:"source,omitempty"`
+}
+
+// NewChatEvent builds an event with data encoded as JSON.
+func NewChatEvent(eventType string, sessionID uuid.UUID, data interface{}) (ChatEvent, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return ChatEvent{}, err
+	}
+	return ChatEvent{Type: eventType, SessionID: sessionID, Data: raw}, nil
+}
+
+// PubSub carries chat events between server instances. MemoryPubSub is enough for a
+// single instance and for tests; running several instances needs a shared broker
+// (e.g. Redis pub/sub) behind this interface.
+type PubSub interface {
+	Publish(topic string, payload []byte) error
+	Subscribe(topic string) (Subscription, error)
+}
+
+// Subscription receives the payloads published to one topic until it is closed.
+type Subscription interface {
+	Messages() <-chan []byte
+	Close() error
+}
+
+// MemoryPubSub is an in-process PubSub. Payloads for a subscriber that is not keeping
+// up are dropped rather than blocking the publisher.
+type MemoryPubSub struct {
+	mu   sync.RWMutex
+	subs map[string]map[*memorySubscription]struct{}
+}
+
+// NewMemoryPubSub creates an empty MemoryPubSub.
+func NewMemoryPubSub() *MemoryPubSub {
+	return &MemoryPubSub{subs: map[string]map[*memorySubscription]struct{}{}}
+}
+
+// Publish delivers payload to every current subscriber of topic.
+func (p *MemoryPubSub) Publish(topic string, payload []byte) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for sub := range p.subs[topic] {
+		select {
+		case sub.ch <- payload:
+		default:
+			log.Printf("WARNING: Dropping pub/sub message on %s: subscriber is full", topic)
+		}
+	}
+	return nil
+}
+
+// Subscribe starts receiving payloads published to topic.
+func (p *MemoryPubSub) Subscribe(topic string) (Subscription, error) {
+	sub := &memorySubscription{ps: p, topic: topic, ch: make(chan []byte, 256)}
+	p.mu.Lock()
+	if p.subs[topic] == nil {
+		p.subs[topic] = map[*memorySubscription]struct{}{}
+	}
+	p.subs[topic][sub] = struct{}{}
+	p.mu.Unlock()
+	return sub, nil
+}
+
+type memorySubscription struct {
+	ps    *MemoryPubSub
+	topic string
+	ch    chan []byte
+	once  sync.Once
+}
+
+func (s *memorySubscription) Messages() <-chan []byte { return s.ch }
+
+func (s *memorySubscription) Close() error {
+	s.once.Do(func() {
+		s.ps.mu.Lock()
+		delete(s.ps.subs[s.topic], s)
+		if len(s.ps.subs[s.topic]) == 0 {
+			delete(s.ps.subs, s.topic)
+		}
+		close(s.ch)
+		s.ps.mu.Unlock()
+	})
+	return nil
+}
+
+// ChatHub fans chat events out to the WebSocket connections on this instance. Each
+// session with local connections holds one PubSub subscription, so events published
+// on any instance reach every device.
+type ChatHub struct {
+	PubSub PubSub
+
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*hubSession
+}
+
+type hubSession struct {
+	sub     Subscription
+	clients map[*ChatClient]struct{}
+}
+
+// ChatClient is one connection's view of a session's events.
+type ChatClient struct {
+	ID        string
+	SessionID uuid.UUID
+
+	events   chan ChatEvent
+	lagged   chan struct{}
+	lagOnce  sync.Once
+	released bool
+}
+
+// Events delivers the session's events. It is closed when the client leaves.
+func (c *ChatClient) Events() <-chan ChatEvent { return c.events }
+
+// Lagged is closed when the client fell behind and missed events. The connection
+// should be closed so the device reconnects and replays from its last message.
+func (c *ChatClient) Lagged() <-chan struct{} { return c.lagged }
+
+// NewChatHub creates a hub on top of ps.
+func NewChatHub(ps PubSub) *ChatHub {
+	return &ChatHub{PubSub: ps, sessions: map[uuid.UUID]*hubSession{}}
+}
+
+func chatTopic(sessionID uuid.UUID) string {
+	return "chat:session:" + sessionID.String()
+}
+
+// Publish sends event to every device connected to its session, on any instance.
+func (h *ChatHub) Publish(event ChatEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return h.PubSub.Publish(chatTopic(event.SessionID), payload)
+}
+
+// Join registers a new connection to sessionID.
+func (h *ChatHub) Join(sessionID uuid.UUID) (*ChatClient, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	session, ok := h.sessions[sessionID]
+	if !ok {
+		sub, err := h.PubSub.Subscribe(chatTopic(sessionID))
+		if err != nil {
+			return nil, err
+		}
+		session = &hubSession{sub: sub, clients: map[*ChatClient]struct{}{}}
+		h.sessions[sessionID] = session
+		go h.fanOut(session)
+	}
+
+	client := &ChatClient{
+		ID: uuid.NewString(), SessionID: sessionID,
+		events: make(chan ChatEvent, 64), lagged: make(chan struct{}),
+	}
+	session.clients[client] = struct{}{}
+	return client, nil
+}
+
+// Leave unregisters client. The session's subscription is closed with its last client.
+func (h *ChatHub) Leave(client *ChatClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if client.released {
+		return
+	}
+	client.released = true
+	close(client.events)
+
+	session, ok := h.sessions[client.SessionID]
+	if !ok {
+		return
+	}
+	delete(session.clients, client)
+	if len(session.clients) == 0 {
+		delete(h.sessions, client.SessionID)
+		session.sub.Close()
+	}
+}
+
+func (h *ChatHub) fanOut(session *hubSession) {
+	for payload := range session.sub.Messages() {
+		var event ChatEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			log.Printf("WARNING: Ignoring malformed chat event: %v", err)
+			continue
+		}
+
+		h.mu.Lock()
+		for client := range session.clients {
+			if event.Source != "" && event.Source == client.ID {
+				continue
+			}
+			select {
+			case client.events <- event:
+			default:
+				client.lagOnce.Do(func() { close(client.lagged) })
+			}
+		}
+		h.mu.Unlock()
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func receiveEvent(t *testing.T, client *ChatClient) ChatEvent {
+	t.Helper()
+	select {
+	case event, ok := <-client.Events():
+		if !ok {
+			t.Fatal("events channel closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return ChatEvent{}
+}
+
+func expectNoEvent(t *testing.T, client *ChatClient) {
+	t.Helper()
+	select {
+	case event := <-client.Events():
+		t.Fatalf("unexpected event %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestChatHubFansOutToEveryClientOfTheSession(t *testing.T) {
+	hub := NewChatHub(NewMemoryPubSub())
+	sessionID := uuid.New()
+	phone, _ := hub.Join(sessionID)
+	laptop, _ := hub.Join(sessionID)
+	other, _ := hub.Join(uuid.New())
+	defer hub.Leave(phone)
+	defer hub.Leave(laptop)
+	defer hub.Leave(other)
+
+	event, _ := NewChatEvent(ChatEventMessage, sessionID, map[string]string{"content": "halo"})
+	if err := hub.Publish(event); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, client := range []*ChatClient{phone, laptop} {
+		if got := receiveEvent(t, client); got.Type != ChatEventMessage || got.SessionID != sessionID {
+			t.Errorf("client %s got %+v", client.ID, got)
+		}
+	}
+	expectNoEvent(t, other)
+}
+
+func TestChatHubDoesNotEchoToSource(t *testing.T) {
+	hub := NewChatHub(NewMemoryPubSub())
+	sessionID := uuid.New()
+	typist, _ := hub.Join(sessionID)
+	viewer, _ := hub.Join(sessionID)
+	defer hub.Leave(typist)
+	defer hub.Leave(viewer)
+
+	event, _ := NewChatEvent(ChatEventTyping, sessionID, map[string]bool{"is_typing": true})
+	event.Source = typist.ID
+	if err := hub.Publish(event); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := receiveEvent(t, viewer); got.Type != ChatEventTyping {
+		t.Errorf("viewer got %+v", got)
+	}
+	expectNoEvent(t, typist)
+}
+
+func TestChatHubMarksSlowClientLagged(t *testing.T) {
+	hub := NewChatHub(NewMemoryPubSub())
+	sessionID := uuid.New()
+	slow, _ := hub.Join(sessionID)
+	defer hub.Leave(slow)
+
+	event, _ := NewChatEvent(ChatEventTyping, sessionID, nil)
+	for i := 0; i < cap(slow.events)+10; i++ {
+		hub.Publish(event)
+	}
+
+	select {
+	case <-slow.Lagged():
+	case <-time.After(time.Second):
+		t.Fatal("client that stopped reading was not marked lagged")
+	}
+}
+
+func TestChatHubLeaveClosesSubscriptionWithLastClient(t *testing.T) {
+	ps := NewMemoryPubSub()
+	hub := NewChatHub(ps)
+	sessionID := uuid.New()
+	first, _ := hub.Join(sessionID)
+	second, _ := hub.Join(sessionID)
+
+	subscribers := func() int {
+		ps.mu.RLock()
+		defer ps.mu.RUnlock()
+		return len(ps.subs[chatTopic(sessionID)])
+	}
+	if n := subscribers(); n != 1 {
+		t.Fatalf("subscriptions = %d, want one shared by both clients", n)
+	}
+
+	hub.Leave(first)
+	if _, ok := <-first.Events(); ok {
+		t.Error("events channel of a client that left is still open")
+	}
+	if n := subscribers(); n != 1 {
+		t.Fatalf("subscriptions = %d after first Leave, want 1", n)
+	}
+
+	hub.Leave(second)
+	hub.Leave(second) // Leave berulang tidak boleh panik
+	if n := subscribers(); n != 0 {
+		t.Errorf("subscriptions = %d after last Leave, want 0", n)
+	}
+	if len(hub.sessions) != 0 {
+		t.Errorf("hub still tracks %d sessions", len(hub.sessions))
+	}
+}
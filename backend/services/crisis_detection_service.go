@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CrisisAssessment is the result of classifying one chat message.
+type CrisisAssessment struct {
+	Risk     string   `json:"risk_level"` // models.CrisisRisk*
+	Score    float64  `json:"score"`
+	Signals  []string `json:"signals"`
+	Stage    string   `json:"stage"`    // lexicon atau model: tahap yang menentukan tingkat risiko
+	Language string   `json:"language"` // id atau en, untuk memilih bahasa pesan keselamatan
+}
+
+// CrisisClassifier scores a message for suicide and self-harm risk.
+type CrisisClassifier interface {
+	Classify(ctx context.Context, text string) (CrisisAssessment, error)
+}
+
+// crisisRule is one entry of the lexicon. Patterns run on normalized text (lowercase,
+// apostrophes removed, punctuation turned into spaces, letters repeated 3+ times
+// collapsed), so "Pengen matiii..." matches "pengen mati" and "don't" matches "dont".
+type crisisRule struct {
+	Signal   string
+	Weight   float64
+	Language string
+	Pattern  *regexp.Regexp
+}
+
+// crisisLexicon adalah daftar frasa yang dipelihara bersama tim klinis. Saat menambah
+// entri: bobot 1.0 untuk niat atau rencana bunuh diri, 0.8 untuk melukai diri, 0.5–0.6
+// untuk keputusasaan dan pesan perpisahan (dua sinyal sedang bersama-sama menjadi tinggi).
+var crisisLexicon = []crisisRule{
+	{"suicidal_ideation", 1.0, "id", regexp.MustCompile(`\b(bunuh diri|bundir|akhiri hidup(ku)?|mengakhiri hidup(ku)?|(ingin|pengen|pingin|pengin|pgn|mau) mati|lebih baik (aku |gue |gw )?mati|(tidak|nggak|gak|ga|enggak) (mau|ingin|pengen) hidup lagi|(tidak|nggak|gak|ga) (mau|ingin) bangun lagi)\b`)},
+	{"suicidal_ideation", 1.0, "en", regexp.MustCompile(`\b(kill myself|kms|end my life|(want to|wanna|going to) die|suicidal|take my (own )?life|better off dead|dont want to (live|be alive|wake up)|unalive myself)\b`)},
+	{"suicide_plan", 1.0, "id", regexp.MustCompile(`\b(gantung diri|(loncat|lompat) dari (gedung|jembatan|atap|lantai)|minum (racun|obat serangga|baygon)|overdosis|over dosis|(sudah|udah) (beli|siapkan|menyiapkan|nyiapin) (tali|obat|racun)|surat (wasiat|perpisahan))\b`)},
+	{"suicide_plan", 1.0, "en", regexp.MustCompile(`\b(hang myself|overdose|jump off (a|the) (bridge|building|roof)|(bought|got|have) (a rope|the pills)|suicide note|goodbye letter)\b`)},
+	{"self_harm", 0.8, "id", regexp.MustCompile(`\b(menyakiti diri|melukai diri|nyakitin diri|ngelukain diri|(sayat|nyayat|menyayat|iris|ngiris) (tangan|nadi|lengan|paha)|potong nadi|silet (tangan|diri))\b`)},
+	{"self_harm", 0.8, "en", regexp.MustCompile(`\b(hurt myself|harm myself|cut myself|cutting myself|self harm|selfharm|burn myself)\b`)},
+	{"hopelessness", 0.5, "id", regexp.MustCompile(`\b((tidak|nggak|gak|ga) ada harapan|putus asa|capek hidup|lelah hidup|cape hidup|hidupku (tidak|nggak|gak) (ada )?(berarti|gunanya)|(tidak|nggak|gak) ada gunanya (aku )?hidup|semua orang lebih baik tanpa (aku|gue|gw)|aku (cuma|hanya) jadi beban)\b`)},
+	{"hopelessness", 0.5, "en", regexp.MustCompile(`\b(no reason to live|hopeless|everyone (would be|is) better off without me|im (just )?a burden|no point (in )?living|cant go on)\b`)},
+	{"farewell", 0.6, "id", regexp.MustCompile(`\b(selamat tinggal (semuanya|semua)|ini pesan terakhir(ku)?|maaf(kan)? aku untuk terakhir kali(nya)?|titip (kucingku|anakku|keluargaku))\b`)},
+	{"farewell", 0.6, "en", regexp.MustCompile(`\b(goodbye forever|this is my last message|wont be here tomorrow|take care of my (cat|dog|family) for me)\b`)},
+}
+
+// crisisNegations membatalkan frasa yang langsung didahuluinya ("tidak mau bunuh diri",
+// "im not suicidal"). Hanya kata tepat sebelumnya yang diperiksa, atau dua kata bila
+// kata sebelumnya kata kerja bantu, agar "gak kuat lagi pengen mati" tetap terdeteksi.
+var (
+	crisisNegations  = map[string]bool{"tidak": true, "tak": true, "nggak": true, "gak": true, "ga": true, "enggak": true, "bukan": true, "jangan": true, "not": true, "never": true, "dont": true, "wont": true, "no": true}
+	crisisAuxiliary  = map[string]bool{"mau": true, "ingin": true, "pengen": true, "akan": true, "bakal": true, "want": true, "going": true, "gonna": true, "to": true, "be": true}
+	crisisNonLetters = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// LexiconClassifier is the fast first stage, run on every message.
+type LexiconClassifier struct{}
+
+// Classify never fails; the error is there to satisfy CrisisClassifier.
+func (LexiconClassifier) Classify(_ context.Context, text string) (CrisisAssessment, error) {
+	normalized := normalizeCrisisText(text)
+	assessment := CrisisAssessment{Risk: models.CrisisRiskNone, Stage: "lexicon", Language: "id"}
+
+	seen := map[string]bool{}
+	strongest := 0.0
+	for _, rule := range crisisLexicon {
+		if seen[rule.Signal] {
+			continue
+		}
+		for _, loc := range rule.Pattern.FindAllStringIndex(normalized, -1) {
+			if negatedCrisisPhrase(normalized[:loc[0]]) {
+				continue
+			}
+			seen[rule.Signal] = true
+			assessment.Signals = append(assessment.Signals, rule.Signal)
+			assessment.Score += rule.Weight
+			if rule.Weight > strongest {
+				strongest, assessment.Language = rule.Weight, rule.Language
+			}
+			break
+		}
+	}
+
+	if assessment.Score > 1 {
+		assessment.Score = 1
+	}
+	assessment.Risk = crisisRiskForScore(assessment.Score)
+	return assessment, nil
+}
+
+func normalizeCrisisText(text string) string {
+	text = strings.ToLower(text)
+	text = strings.NewReplacer("'", "", "’", "", "`", "").Replace(text)
+	text = collapseRepeats(text)
+	return " " + strings.TrimSpace(crisisNonLetters.ReplaceAllString(text, " ")) + " "
+}
+
+// collapseRepeats turns runs of three or more identical characters into one.
+func collapseRepeats(text string) string {
+	runes := []rune(text)
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+		count := j - i
+		if count >= 3 {
+			count = 1
+		}
+		b.WriteString(strings.Repeat(string(runes[i]), count))
+		i = j
+	}
+	return b.String()
+}
+
+func negatedCrisisPhrase(before string) bool {
+	words := strings.Fields(before)
+	for i := len(words) - 1; i >= 0 && i >= len(words)-2; i-- {
+		if crisisNegations[words[i]] {
+			return true
+		}
+		if !crisisAuxiliary[words[i]] {
+			return false
+		}
+	}
+	return false
+}
+
+func crisisRiskForScore(score float64) string {
+	switch {
+	case score >= 0.8:
+		return models.CrisisRiskHigh
+	case score >= 0.5:
+		return models.CrisisRiskMedium
+	case score > 0:
+		return models.CrisisRiskLow
+	default:
+		return models.CrisisRiskNone
+	}
+}
+
+var crisisRiskRank = map[string]int{models.CrisisRiskNone: 0, models.CrisisRiskLow: 1, models.CrisisRiskMedium: 2, models.CrisisRiskHigh: 3}
+
+// ModelCrisisClassifier is the optional second stage: a language model judges context
+// the lexicon cannot, such as indirect phrasing.
+type ModelCrisisClassifier struct {
+	LLM *LLMService
+}
+
+const crisisClassifierPrompt = `You are a clinical safety classifier for a mental health support app in Indonesia. Assess the user's message (Indonesian or English, possibly slang) for risk of suicide or self-harm to the writer. Reply with a JSON object only: {"risk": "none|low|medium|high", "signals": ["suicidal_ideation"|"suicide_plan"|"self_harm"|"hopelessness"|"farewell"], "language": "id|en"}. Use "high" for any current intent, plan, or self-harm; "medium" for hopelessness without intent; "low" for general distress. Messages about someone else, news, or clearly denied intent are "none" or "low".`
+
+// Classify asks the model for a risk level.
+func (m ModelCrisisClassifier) Classify(ctx context.Context, text string) (CrisisAssessment, error) {
+	var result struct {
+		Risk     string   `json:"risk"`
+		Signals  []string `json:"signals"`
+		Language string   `json:"language"`
+	}
+	_, err := m.LLM.CompleteJSON(ctx, LLMRequest{
+		Feature: LLMFeatureCrisisClassifier,
+		Messages: []LLMMessage{
+			{Role: LLMRoleSystem, Content: crisisClassifierPrompt},
+			{Role: LLMRoleUser, Content: text},
+		},
+		MaxTokens: 80,
+	}, &result)
+	if err != nil {
+		return CrisisAssessment{}, err
+	}
+	if _, ok := crisisRiskRank[result.Risk]; !ok {
+		return CrisisAssessment{}, fmt.Errorf("crisis classifier returned unknown risk %q", result.Risk)
+	}
+	if result.Language != "en" {
+		result.Language = "id"
+	}
+	score := map[string]float64{models.CrisisRiskLow: 0.3, models.CrisisRiskMedium: 0.6, models.CrisisRiskHigh: 1}[result.Risk]
+	return CrisisAssessment{Risk: result.Risk, Score: score, Signals: result.Signals, Stage: "model", Language: result.Language}, nil
+}
+
+// crisisModelTimeout membatasi tahap model agar chat tidak tertahan terlalu lama.
+const crisisModelTimeout = 5 * time.Second
+
+// CrisisDetector runs the classifiers on chat messages and raises detected crises to
+// the counselor review queue.
+type CrisisDetector struct {
+	DB       *gorm.DB
+	Cfg      *config.Config
+	Lexicon  CrisisClassifier
+	Model    CrisisClassifier // nil bila tahap model dimatikan
+	Notifier *Notifier
+}
+
+// NewCrisisDetector creates a detector; the model stage is enabled by CRISIS_MODEL_STAGE.
+func NewCrisisDetector(db *gorm.DB, cfg *config.Config, llm *LLMService) *CrisisDetector {
+	d := &CrisisDetector{DB: db, Cfg: cfg, Lexicon: LexiconClassifier{}, Notifier: NewNotifier(db, cfg)}
+	if cfg.Security.CrisisModelStage && llm.Configured(LLMFeatureCrisisClassifier) {
+		d.Model = ModelCrisisClassifier{LLM: llm}
+	}
+	return d
+}
+
+// Assess classifies text. The model stage can only raise the lexicon's risk level,
+// never lower it, so a model failure or a lenient answer cannot hide a clear signal.
+func (d *CrisisDetector) Assess(ctx context.Context, text string) CrisisAssessment {
+	assessment, _ := d.Lexicon.Classify(ctx, text)
+	if d.Model == nil || assessment.Risk == models.CrisisRiskHigh {
+		return assessment
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, crisisModelTimeout)
+	defer cancel()
+	modelAssessment, err := d.Model.Classify(ctx, text)
+	if err != nil {
+		log.Printf("WARNING: Crisis model stage failed, using lexicon result: %v", err)
+		return assessment
+	}
+	if crisisRiskRank[modelAssessment.Risk] > crisisRiskRank[assessment.Risk] {
+		return modelAssessment
+	}
+	return assessment
+}
+
+// ShouldAlert reports whether the assessment goes to counselors for review.
+func (a CrisisAssessment) ShouldAlert() bool {
+	return crisisRiskRank[a.Risk] >= crisisRiskRank[models.CrisisRiskMedium]
+}
+
+// CrisisSafetyMessage is the vetted reply that replaces the AI answer on high risk.
+func CrisisSafetyMessage(language string, minor bool) string {
+	if language == "en" {
+		message := "I'm really glad you told me, and I'm worried about your safety right now. You don't have to go through this alone.\n\n" +
+			"Please reach out for help now:\n" +
+			"• Mental health hotline 119 ext. 8 (24 hours)\n" +
+			"• WhatsApp crisis line 081-111-500-711\n" +
+			"• Emergency services 112 if you are in immediate danger\n" +
+			"• More services: https://sehatmental.kemkes.go.id\n\n"
+		if minor {
+			message += "Please also tell a parent, guardian, teacher or another adult you trust right away.\n\n"
+		}
+		return message + "Are you safe right now? I'm here and will keep talking with you."
+	}
+
+	message := "Terima kasih sudah mau bercerita. Aku khawatir dengan keselamatanmu sekarang, dan kamu tidak harus menghadapi ini sendirian.\n\n" +
+		"Tolong hubungi bantuan sekarang:\n" +
+		"• Hotline kesehatan jiwa 119 ext. 8 (24 jam)\n" +
+		"• WhatsApp krisis 081-111-500-711\n" +
+		"• Layanan darurat 112 jika kamu dalam bahaya\n" +
+		"• Layanan lain: https://sehatmental.kemkes.go.id\n\n"
+	if minor {
+		message += "Ceritakan juga sekarang pada orang tua, wali, guru, atau orang dewasa lain yang kamu percaya.\n\n"
+	}
+	return message + "Apakah kamu aman sekarang? Aku di sini dan akan tetap menemanimu."
+}
+
+// Raise records a CrisisAlert for counselors. On high risk the session is flagged as
+// crisis_intervention, with the alert as its trigger source. Trusted contacts are only
+// alerted once a counselor confirms the crisis, as they consented to.
+func (d *CrisisDetector) Raise(user models.User, message models.ChatMessage, assessment CrisisAssessment, safetyOverride bool) (*models.CrisisAlert, error) {
+	alert := models.CrisisAlert{
+		UserID: user.ID, ChatSessionID: message.ChatSessionID, ChatMessageID: message.ID,
+		RiskLevel: assessment.Risk, Score: assessment.Score, Signals: assessment.Signals, Stage: assessment.Stage,
+		SafetyOverride: safetyOverride, Status: models.CrisisAlertOpen,
+	}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&alert).Error; err != nil {
+			return err
+		}
+		if assessment.Risk != models.CrisisRiskHigh {
+			return nil
+		}
+		return tx.Model(&models.ChatSession{}).Where("id = ?", message.ChatSessionID).
+			Updates(map[string]interface{}{"trigger_type": "crisis_intervention", "trigger_source_id": alert.ID}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	RecordAudit(d.DB, AuditEntry{
+		UserID: &user.ID, Action: "crisis_alert_raised", TableName: "crisis_alerts", RecordID: &alert.ID,
+		NewValues: map[string]interface{}{"risk_level": alert.RiskLevel, "signals": alert.Signals, "stage": alert.Stage, "session_id": alert.ChatSessionID},
+	})
+	go d.notifyCounselors(alert)
+	return &alert, nil
+}
+
+// notifyCounselors alerts every staff member holding crisis.respond.
+func (d *CrisisDetector) notifyCounselors(alert models.CrisisAlert) {
+	var staffIDs []uuid.UUID
+	err := d.DB.Model(&models.UserRole{}).
+		Joins("JOIN role_permissions ON role_permissions.role_id = user_roles.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Joins("JOIN users ON users.id = user_roles.user_id").
+		Where("permissions.permission_key = ? AND users.is_active = ?", models.PermCrisisRespond, true).
+		Distinct().Pluck("user_roles.user_id", &staffIDs).Error
+	if err != nil {
+		log.Printf("ERROR: Failed to find counselors for crisis alert %s: %v", alert.ID, err)
+		return
+	}
+
+	priority := "high"
+	if alert.RiskLevel == models.CrisisRiskHigh {
+		priority = "urgent"
+	}
+	for _, staffID := range staffIDs {
+		notification := models.Notification{
+			UserID: staffID, NotificationType: models.NotificationCrisisAlert,
+			Title:      fmt.Sprintf("Peringatan krisis (risiko %s) perlu ditinjau", alert.RiskLevel),
+			Message:    "Pesan chat seorang pengguna terdeteksi berisiko. Tinjau peringatan ini di antrean krisis.",
+			ActionData: fmt.Sprintf(`{"crisis_alert_id":"%s","user_id":"%s"}`, alert.ID, alert.UserID),
+			Priority:   priority, DeliveryMethod: "push",
+		}
+		if err := d.Notifier.Create(&notification); err != nil {
+			log.Printf("WARNING: Failed to notify counselor %s of crisis alert %s: %v", staffID, alert.ID, err)
+		}
+	}
+}
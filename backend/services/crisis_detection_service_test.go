@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"backend/models"
+)
+
+func TestLexiconClassifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		risk     string
+		signals  []string
+		language string
+	}{
+		// Positif nyata
+		{name: "stretched letters", text: "pengen matiii...", risk: models.CrisisRiskHigh, signals: []string{"suicidal_ideation"}, language: "id"},
+		{name: "negation earlier in the sentence", text: "gak kuat lagi pengen mati", risk: models.CrisisRiskHigh, signals: []string{"suicidal_ideation"}, language: "id"},
+		{name: "english without apostrophe", text: "i dont want to live", risk: models.CrisisRiskHigh, signals: []string{"suicidal_ideation"}, language: "en"},
+		{name: "english with apostrophe", text: "I don't want to live anymore", risk: models.CrisisRiskHigh, signals: []string{"suicidal_ideation"}, language: "en"},
+		{name: "negation is part of the phrase", text: "aku ga mau hidup lagi", risk: models.CrisisRiskHigh, signals: []string{"suicidal_ideation"}, language: "id"},
+		{name: "plan", text: "aku udah beli tali", risk: models.CrisisRiskHigh, signals: []string{"suicide_plan"}, language: "id"},
+		{name: "self harm", text: "Tadi aku nyayat tangan lagi", risk: models.CrisisRiskHigh, signals: []string{"self_harm"}, language: "id"},
+
+		// Penyangkalan
+		{name: "indonesian denial", text: "aku tidak mau bunuh diri", risk: models.CrisisRiskNone},
+		{name: "english denial", text: "im not suicidal", risk: models.CrisisRiskNone},
+		{name: "english denial with apostrophe", text: "I'm not suicidal, just tired", risk: models.CrisisRiskNone},
+		{name: "telling someone not to", text: "jangan bunuh diri ya", risk: models.CrisisRiskNone},
+
+		// Tentang orang lain: leksikon sengaja tetap menandai (lebih baik konselor meninjau
+		// daripada terlewat); konteks seperti ini dinilai tahap model, yang tidak bisa menurunkan risiko.
+		{name: "about someone else", text: "temanku bilang dia pengen mati", risk: models.CrisisRiskHigh, signals: []string{"suicidal_ideation"}, language: "id"},
+
+		// Ambang skor
+		{name: "one medium signal", text: "aku capek hidup", risk: models.CrisisRiskMedium, signals: []string{"hopelessness"}, language: "id"},
+		{name: "two medium signals become high", text: "aku capek hidup. ini pesan terakhirku", risk: models.CrisisRiskHigh, signals: []string{"hopelessness", "farewell"}, language: "id"},
+		{name: "repeated signal counts once", text: "putus asa, putus asa, putus asa", risk: models.CrisisRiskMedium, signals: []string{"hopelessness"}, language: "id"},
+
+		// Kasus tepi
+		{name: "empty", text: "", risk: models.CrisisRiskNone},
+		{name: "everyday sadness", text: "hari ini aku sedih banget", risk: models.CrisisRiskNone},
+		{name: "phrase inside another word", text: "aku suka kopi bundirian", risk: models.CrisisRiskNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LexiconClassifier{}.Classify(context.Background(), tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Risk != tt.risk || !reflect.DeepEqual(got.Signals, tt.signals) {
+				t.Errorf("Classify(%q) = %s %v, want %s %v", tt.text, got.Risk, got.Signals, tt.risk, tt.signals)
+			}
+			if tt.language != "" && got.Language != tt.language {
+				t.Errorf("language = %q, want %q", got.Language, tt.language)
+			}
+			if got.Score < 0 || got.Score > 1 {
+				t.Errorf("score = %v, want 0..1", got.Score)
+			}
+		})
+	}
+}
+
+func TestNormalizeCrisisText(t *testing.T) {
+	tests := map[string]string{
+		"Pengen MATIII!!!": " pengen mati ",
+		"don’t   want":     " dont want ",
+		"self-harm":        " self harm ",
+		"":                 "  ",
+	}
+	for in, want := range tests {
+		if got := normalizeCrisisText(in); got != want {
+			t.Errorf("normalizeCrisisText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCrisisDetectorAssessOnlyRaisesRisk(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		reply      FakeReply
+		wantRisk   string
+		wantStage  string
+		modelAsked bool
+	}{
+		{name: "model raises an indirect message", text: "aku mau pergi jauh dan nggak kembali", reply: FakeReply{Content: `{"risk":"high","signals":["farewell"],"language":"id"}`}, wantRisk: models.CrisisRiskHigh, wantStage: "model", modelAsked: true},
+		{name: "lenient model cannot lower the lexicon", text: "aku capek hidup", reply: FakeReply{Content: `{"risk":"none","signals":[]}`}, wantRisk: models.CrisisRiskMedium, wantStage: "lexicon", modelAsked: true},
+		{name: "model failure keeps the lexicon", text: "aku capek hidup", reply: FakeReply{Err: errors.New("timeout")}, wantRisk: models.CrisisRiskMedium, wantStage: "lexicon", modelAsked: true},
+		{name: "unknown risk from the model is ignored", text: "biasa aja", reply: FakeReply{Content: "```json\n{\"risk\":\"extreme\"}\n```"}, wantRisk: models.CrisisRiskNone, wantStage: "lexicon", modelAsked: true},
+		{name: "high lexicon risk skips the model", text: "aku mau bunuh diri", reply: FakeReply{Content: `{"risk":"none"}`}, wantRisk: models.CrisisRiskHigh, wantStage: "lexicon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeLLM()
+			fake.Script(tt.reply)
+			detector := &CrisisDetector{Lexicon: LexiconClassifier{}, Model: ModelCrisisClassifier{LLM: &LLMService{Provider: fake, DefaultModel: "fake"}}}
+
+			got := detector.Assess(context.Background(), tt.text)
+			if got.Risk != tt.wantRisk || got.Stage != tt.wantStage {
+				t.Errorf("Assess(%q) = %s from %s, want %s from %s", tt.text, got.Risk, got.Stage, tt.wantRisk, tt.wantStage)
+			}
+			if asked := len(fake.Requests()) > 0; asked != tt.modelAsked {
+				t.Errorf("model asked = %v, want %v", asked, tt.modelAsked)
+			}
+		})
+	}
+}
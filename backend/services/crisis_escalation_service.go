@@ -0,0 +1,200 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrEscalationCooldown is returned when contacts were already alerted within the cooldown.
+var ErrEscalationCooldown = errors.New("crisis escalation is in cooldown")
+
+// CrisisResource is a crisis service shown to users who may be in danger.
+type CrisisResource struct {
+	Name    string `json:"name"`
+	Contact string `json:"contact"`
+}
+
+// CrisisResources are always returned alongside escalations, including suppressed ones.
+var CrisisResources = []CrisisResource{
+	{Name: "Layanan darurat", Contact: "112"},
+	{Name: "Hotline kesehatan jiwa Kemenkes", Contact: "119 ext. 8"},
+	{Name: "WhatsApp krisis", Contact: "081-111-500-711"},
+	{Name: "Direktori layanan kesehatan jiwa", Contact: "https://sehatmental.kemkes.go.id"},
+}
+
+// EscalationRequest describes why and by whom a user's trusted contacts are alerted.
+type EscalationRequest struct {
+	UserID      uuid.UUID
+	Trigger     string     // models.EscalationTriggerPanic atau models.EscalationTriggerCrisisConfirmed
+	TriggeredBy *uuid.UUID // Pengguna sendiri untuk tombol darurat, staf untuk krisis terkonfirmasi
+	Note        string
+	Latitude    *float64
+	Longitude   *float64
+	IPAddress   string
+	UserAgent   string
+}
+
+// CrisisEscalator alerts a user's trusted contacts, within the scopes they consented to.
+type CrisisEscalator struct {
+	DB       *gorm.DB
+	Cfg      *config.Config
+	Email    *EmailService
+	Notifier *Notifier
+}
+
+// NewCrisisEscalator creates a new CrisisEscalator.
+func NewCrisisEscalator(db *gorm.DB, cfg *config.Config) *CrisisEscalator {
+	return &CrisisEscalator{DB: db, Cfg: cfg, Email: NewEmailService(cfg.Email), Notifier: NewNotifier(db, cfg)}
+}
+
+// Escalate records an escalation and alerts consenting contacts in the background.
+// The cooldown applies per trigger, because each trigger reaches the contacts of a
+// different consent scope: a recent panic alert must not hold back a confirmed crisis.
+// Within the cooldown the attempt is still recorded, as suppressed, and
+// ErrEscalationCooldown is returned together with the record.
+func (e *CrisisEscalator) Escalate(req EscalationRequest) (*models.CrisisEscalation, []models.TrustedContact, error) {
+	scope := models.ContactScopeCrisisAlerts
+	if req.Trigger == models.EscalationTriggerPanic {
+		scope = models.ContactScopePanicAlerts
+	}
+
+	escalation := models.CrisisEscalation{UserID: req.UserID, TriggerType: req.Trigger, TriggeredBy: req.TriggeredBy, Latitude: req.Latitude, Longitude: req.Longitude}
+	if req.Note != "" {
+		escalation.Note = &req.Note
+	}
+	if req.IPAddress != "" {
+		escalation.RequestedIP = &req.IPAddress
+	}
+
+	var user models.User
+	var contacts []models.TrustedContact
+	err := e.DB.Transaction(func(tx *gorm.DB) error {
+		// Kunci baris pengguna agar dua permintaan bersamaan tidak sama-sama lolos cooldown.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", req.UserID).Error; err != nil {
+			return err
+		}
+
+		var recent int64
+		tx.Model(&models.CrisisEscalation{}).
+			Where("user_id = ? AND trigger_type = ? AND status = ? AND created_at > ?", req.UserID, req.Trigger, models.EscalationSent, time.Now().Add(-e.Cfg.Security.CrisisEscalationCooldown)).
+			Count(&recent)
+		if recent > 0 {
+			escalation.Status = models.EscalationSuppressed
+			return tx.Create(&escalation).Error
+		}
+
+		var candidates []models.TrustedContact
+		if err := tx.Where("user_id = ? AND status = ?", req.UserID, models.TrustedContactVerified).Find(&candidates).Error; err != nil {
+			return err
+		}
+		for _, contact := range candidates {
+			if contact.HasConsent(scope) {
+				contacts = append(contacts, contact)
+			}
+		}
+
+		escalation.Status = models.EscalationSent
+		if len(contacts) == 0 {
+			escalation.Status = models.EscalationNoContacts
+		}
+		escalation.ContactsTargeted = len(contacts)
+		return tx.Create(&escalation).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	RecordAudit(e.DB, AuditEntry{
+		UserID: req.TriggeredBy, Action: "crisis_escalation_" + escalation.Status, TableName: "crisis_escalations", RecordID: &escalation.ID,
+		NewValues: map[string]interface{}{"user_id": req.UserID, "trigger": req.Trigger, "contacts_targeted": escalation.ContactsTargeted},
+		IPAddress: req.IPAddress, UserAgent: req.UserAgent,
+	})
+
+	if escalation.Status == models.EscalationSuppressed {
+		return &escalation, nil, ErrEscalationCooldown
+	}
+	e.notifyUser(escalation, user)
+	if len(contacts) > 0 {
+		go e.deliver(escalation, user, contacts)
+	}
+	return &escalation, contacts, nil
+}
+
+// notifyUser tells the user in-app that help has been requested on their behalf.
+func (e *CrisisEscalator) notifyUser(escalation models.CrisisEscalation, user models.User) {
+	message := "Kami sudah menghubungi kontak tepercaya kamu. Jika kamu dalam bahaya, hubungi 112 atau hotline 119 ext. 8 sekarang."
+	if escalation.Status == models.EscalationNoContacts {
+		message = "Kamu belum memiliki kontak tepercaya yang bisa dihubungi. Jika kamu dalam bahaya, hubungi 112 atau hotline 119 ext. 8 sekarang."
+	}
+	notification := models.Notification{
+		UserID: user.ID, NotificationType: "crisis_alert", Title: "Kamu tidak sendirian 💙", Message: message,
+		ActionData: fmt.Sprintf(`{"escalation_id":"%s"}`, escalation.ID), Priority: "urgent", DeliveryMethod: "in_app",
+	}
+	if err := e.Notifier.Create(&notification); err != nil {
+		log.Printf("WARNING: Failed to create crisis notification for user %s: %v", user.ID, err)
+	}
+}
+
+// deliver alerts each contact by email, and in-app as well when the contact is also a
+// Tenang.in member. Every attempt is recorded as a CrisisEscalationDelivery.
+func (e *CrisisEscalator) deliver(escalation models.CrisisEscalation, user models.User, contacts []models.TrustedContact) {
+	name := DisplayName(user)
+	for _, contact := range contacts {
+		contactID := contact.ID
+		body := fmt.Sprintf("Halo %s,\n\n"+
+			"%s membutuhkan dukungan Anda sekarang. %s\n\n"+
+			"Mohon segera hubungi %s. Jika Anda yakin ia dalam bahaya langsung, hubungi layanan darurat 112 "+
+			"atau hotline kesehatan jiwa 119 ext. 8.%s\n\n"+
+			"Anda menerima pesan ini karena telah setuju menjadi kontak tepercaya %s di Tenang.in.\n\n"+
+			"Tim Tenang.in",
+			contact.Name, name, escalationReason(escalation), name, e.locationLine(escalation, contact), name)
+		err := e.Email.Send(EmailMessage{To: contact.Email, Subject: "Penting: " + name + " membutuhkan dukungan Anda", TextBody: body})
+		e.recordDelivery(escalation.ID, &contactID, "email", err)
+
+		var member models.User
+		if e.DB.Scopes(EmailEquals(contact.Email)).Where("is_active = ?", true).First(&member).Error == nil {
+			notification := models.Notification{
+				UserID: member.ID, NotificationType: "crisis_alert", Title: name + " membutuhkan dukungan Anda",
+				Message:  "Mohon segera hubungi " + name + ". Jika ia dalam bahaya langsung, hubungi 112.",
+				Priority: "urgent", DeliveryMethod: "push",
+			}
+			e.recordDelivery(escalation.ID, &contactID, "in_app", e.Notifier.Create(&notification))
+		}
+	}
+}
+
+func (e *CrisisEscalator) recordDelivery(escalationID uuid.UUID, contactID *uuid.UUID, channel string, sendErr error) {
+	delivery := models.CrisisEscalationDelivery{EscalationID: escalationID, ContactID: contactID, Channel: channel, Status: "sent"}
+	if sendErr != nil {
+		delivery.Status = "failed"
+		message := sendErr.Error()
+		delivery.Error = &message
+		log.Printf("ERROR: Crisis escalation %s: %s delivery to contact %s failed: %v", escalationID, channel, contactID, sendErr)
+	}
+	if err := e.DB.Create(&delivery).Error; err != nil {
+		log.Printf("ERROR: Failed to record crisis escalation delivery for %s: %v", escalationID, err)
+	}
+}
+
+func (e *CrisisEscalator) locationLine(escalation models.CrisisEscalation, contact models.TrustedContact) string {
+	if escalation.Latitude == nil || escalation.Longitude == nil || !contact.HasConsent(models.ContactScopeShareLocation) {
+		return ""
+	}
+	return fmt.Sprintf("\n\nLokasi yang ia bagikan: https://maps.google.com/?q=%.6f,%.6f", *escalation.Latitude, *escalation.Longitude)
+}
+
+func escalationReason(escalation models.CrisisEscalation) string {
+	if escalation.TriggerType == models.EscalationTriggerPanic {
+		return "Ia baru saja menekan tombol darurat di aplikasi Tenang.in."
+	}
+	return "Tim kami menilai ia sedang mengalami krisis dan memerlukan pendampingan orang terdekat."
+}
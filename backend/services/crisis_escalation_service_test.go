@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/testutil"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestEscalateCooldownIsPerTrigger(t *testing.T) {
+	db := testutil.OpenDB(t)
+	cfg := &config.Config{}
+	cfg.Security.CrisisEscalationCooldown = time.Hour
+	escalator := NewCrisisEscalator(db, cfg)
+
+	user := models.User{ID: uuid.New(), Email: "rani@example.com", IsActive: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, contact := range []models.TrustedContact{
+		{UserID: user.ID, Name: "Ibu", Email: "ibu@example.com", Relationship: "parent", Scopes: pq.StringArray{models.ContactScopePanicAlerts}, ConsentedScopes: pq.StringArray{models.ContactScopePanicAlerts}, Status: models.TrustedContactVerified},
+		{UserID: user.ID, Name: "Kakak", Email: "kakak@example.com", Relationship: "sibling", Scopes: pq.StringArray{models.ContactScopeCrisisAlerts}, ConsentedScopes: pq.StringArray{models.ContactScopeCrisisAlerts}, Status: models.TrustedContactVerified},
+	} {
+		if err := db.Create(&contact).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	staffID := uuid.New()
+
+	escalation, contacts, err := escalator.Escalate(EscalationRequest{UserID: user.ID, Trigger: models.EscalationTriggerPanic, TriggeredBy: &user.ID})
+	if err != nil || escalation.Status != models.EscalationSent || len(contacts) != 1 || contacts[0].Name != "Ibu" {
+		t.Fatalf("panic = %v %v, want sent to Ibu only", escalation, err)
+	}
+
+	// Krisis terkonfirmasi di dalam cooldown tombol darurat tetap menjangkau kontak crisis_alerts.
+	escalation, contacts, err = escalator.Escalate(EscalationRequest{UserID: user.ID, Trigger: models.EscalationTriggerCrisisConfirmed, TriggeredBy: &staffID})
+	if err != nil || escalation.Status != models.EscalationSent || len(contacts) != 1 || contacts[0].Name != "Kakak" {
+		t.Fatalf("confirmed crisis after a panic = %v %v, want sent to Kakak", escalation, err)
+	}
+
+	for _, trigger := range []string{models.EscalationTriggerPanic, models.EscalationTriggerCrisisConfirmed} {
+		escalation, _, err = escalator.Escalate(EscalationRequest{UserID: user.ID, Trigger: trigger, TriggeredBy: &user.ID})
+		if !errors.Is(err, ErrEscalationCooldown) || escalation.Status != models.EscalationSuppressed {
+			t.Errorf("second %s within the cooldown = %v %v, want suppressed", trigger, escalation, err)
+		}
+	}
+}
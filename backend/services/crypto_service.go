@@ -0,0 +1,78 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+
+	"backend/config"
+)
+
+// ErrInvalidCiphertext is returned when encrypted data cannot be decrypted.
+var ErrInvalidCiphertext = errors.New("ciphertext is invalid or was encrypted with another key")
+
+// EncryptString seals plaintext with AES-256-GCM. The random nonce is prepended
+// to the ciphertext and the result is base64url encoded.
+func EncryptString(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptString reverses EncryptString.
+func DecryptString(key []byte, encrypted string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encrypted)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	return string(plaintext), nil
+}
+
+// DecryptWithMasterKeys opens data sealed with SecurityConfig.EncryptionKey, falling back
+// to the previous master keys that are kept while a key rotation is in progress.
+func DecryptWithMasterKeys(security config.SecurityConfig, encrypted string) (string, error) {
+	plaintext, err := DecryptString(security.EncryptionKey, encrypted)
+	if err == nil {
+		return plaintext, nil
+	}
+	for _, key := range security.PreviousEncryptionKeys {
+		if plaintext, err := DecryptString(key, encrypted); err == nil {
+			return plaintext, nil
+		}
+	}
+	return "", err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DataExportPurpose is the purpose of signed export download links.
+const DataExportPurpose = "data_export"
+
+// Export yang macet (mis. server restart di tengah proses) dijalankan ulang setelah jeda ini.
+const dataExportStaleAfter = 30 * time.Minute
+
+// DataExporter builds personal data export archives in the background.
+type DataExporter struct {
+	DB       *gorm.DB
+	Cfg      *config.Config
+	Email    *EmailService
+	Notifier *Notifier
+}
+
+// NewDataExporter creates a new DataExporter.
+func NewDataExporter(db *gorm.DB, cfg *config.Config) *DataExporter {
+	return &DataExporter{DB: db, Cfg: cfg, Email: NewEmailService(cfg.Email), Notifier: NewNotifier(db, cfg)}
+}
+
+// Enqueue starts building an export in the background.
+func (e *DataExporter) Enqueue(exportID uuid.UUID) {
+	go e.Run(exportID)
+}
+
+// StartMaintenance periodically deletes expired archives and restarts exports
+// that were interrupted before they finished.
+func (e *DataExporter) StartMaintenance(every time.Duration) {
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for range ticker.C {
+			e.expireArchives()
+			e.resumeStale()
+		}
+	}()
+}
+
+// DownloadURL returns a signed, expiring link to a ready export.
+func (e *DataExporter) DownloadURL(export models.DataExport, user models.User) (string, time.Time, error) {
+	expiresAt := time.Now().Add(e.Cfg.Security.DataExportLinkExpiry)
+	if export.ExpiresAt != nil && export.ExpiresAt.Before(expiresAt) {
+		expiresAt = *export.ExpiresAt
+	}
+	token, err := SignReferenceToken(e.Cfg.JWT.EncryptionKey, DataExportPurpose, user.ID, user.Email, export.ID.String(), time.Until(expiresAt))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	link := fmt.Sprintf("%s/api/v1/exports/%s/download?token=%s", e.Cfg.Server.PublicURL, export.ID, url.QueryEscape(token))
+	return link, expiresAt, nil
+}
+
+// Run builds one export. Only one worker can claim a pending export.
+func (e *DataExporter) Run(exportID uuid.UUID) {
+	now := time.Now()
+	claim := e.DB.Model(&models.DataExport{}).
+		Where("id = ? AND status = ?", exportID, models.DataExportPending).
+		Updates(map[string]interface{}{"status": models.DataExportProcessing, "started_at": now})
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return
+	}
+
+	var export models.DataExport
+	if err := e.DB.First(&export, "id = ?", exportID).Error; err != nil {
+		log.Printf("ERROR: Data export %s disappeared: %v", exportID, err)
+		return
+	}
+	var user models.User
+	if err := e.DB.First(&user, "id = ?", export.UserID).Error; err != nil {
+		e.fail(export, err)
+		return
+	}
+
+	path, size, err := e.buildArchive(export, user)
+	if err != nil {
+		e.fail(export, err)
+		return
+	}
+
+	completedAt := time.Now()
+	expiresAt := completedAt.Add(e.Cfg.Security.DataExportRetention)
+	if err := e.DB.Model(&export).Updates(map[string]interface{}{
+		"status":          models.DataExportReady,
+		"file_path":       path,
+		"file_size_bytes": size,
+		"completed_at":    completedAt,
+		"expires_at":      expiresAt,
+	}).Error; err != nil {
+		os.Remove(path)
+		e.fail(export, err)
+		return
+	}
+	export.ExpiresAt = &expiresAt
+
+	RecordAudit(e.DB, AuditEntry{
+		UserID: &user.ID, Action: "data_export_ready", TableName: "data_exports", RecordID: &export.ID,
+		NewValues: map[string]interface{}{"file_size_bytes": size},
+	})
+	e.notifyReady(export, user)
+}
+
+// --- archive ---
+
+// exportSection is one JSON file in the archive.
+type exportSection struct {
+	name  string
+	query func() (interface{}, error)
+}
+
+func (e *DataExporter) buildArchive(export models.DataExport, user models.User) (string, int64, error) {
+	if err := os.MkdirAll(e.Cfg.Storage.ExportPath, 0700); err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(e.Cfg.Storage.ExportPath, export.ID.String()+".zip")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = e.writeArchive(zip.NewWriter(file), user)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+	return path, info.Size(), nil
+}
+
+func (e *DataExporter) writeArchive(archive *zip.Writer, user models.User) error {
+	db := e.DB
+	userID := user.ID
+	find := func(dest interface{}, query *gorm.DB) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			err := query.Find(dest).Error
+			return dest, err
+		}
+	}
+
+	var vocalEntries []models.VocalJournalEntry
+	sections := []exportSection{
+		{"profile.json", func() (interface{}, error) { return user, nil }},
+		{"preferences.json", find(&[]models.UserPreferences{}, db.Where("user_id = ?", userID))},
+		{"chat_sessions.json", find(&[]models.ChatSession{}, db.Preload("Messages", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("created_at")
+		}).Where("user_id = ?", userID).Order("started_at"))},
+		{"scheduled_checkins.json", find(&[]models.ScheduledCheckin{}, db.Where("user_id = ?", userID))},
+		{"vocal_entries.json", find(&vocalEntries, db.Preload("Transcription").Preload("SentimentAnalysis").
+			Where("user_id = ?", userID).Order("created_at"))},
+		{"community_posts.json", find(&[]models.CommunityPost{}, db.Where("user_id = ?", userID).Order("created_at"))},
+		{"community_replies.json", find(&[]models.CommunityPostReply{}, db.Where("user_id = ?", userID).Order("created_at"))},
+		{"community_reactions.json", find(&[]models.CommunityReaction{}, db.Where("user_id = ?", userID).Order("created_at"))},
+		{"social_accounts.json", find(&[]models.SocialMediaAccount{}, db.Where("user_id = ?", userID))},
+		{"notifications.json", find(&[]models.Notification{}, db.Where("user_id = ?", userID).Order("created_at"))},
+		{"trusted_contacts.json", find(&[]models.TrustedContact{}, db.Where("user_id = ?", userID).Order("created_at"))},
+		{"crisis_escalations.json", find(&[]models.CrisisEscalation{}, db.Preload("Deliveries").Where("user_id = ?", userID).Order("created_at"))},
+		{"crisis_alerts.json", find(&[]models.CrisisAlert{}, db.Where("user_id = ?", userID).Order("created_at"))},
+		{"progress_metrics.json", find(&[]models.UserProgressMetric{}, db.Where("user_id = ?", userID).Order("metric_date"))},
+	}
+
+	files := make([]string, 0, len(sections)+1)
+	for _, section := range sections {
+		data, err := section.query()
+		if err != nil {
+			return fmt.Errorf("%s: %w", section.name, err)
+		}
+		if err := writeJSONEntry(archive, section.name, data); err != nil {
+			return err
+		}
+		files = append(files, section.name)
+	}
+
+	// Rekaman audio asli disertakan apa adanya; file yang sudah tidak ada dicatat di manifest.
+	var missingAudio []uuid.UUID
+	for _, entry := range vocalEntries {
+		name := fmt.Sprintf("audio/%s%s", entry.ID, filepath.Ext(entry.AudioFilePath))
+		if err := copyFileEntry(archive, name, entry.AudioFilePath); err != nil {
+			missingAudio = append(missingAudio, entry.ID)
+			continue
+		}
+		files = append(files, name)
+	}
+
+	manifest := map[string]interface{}{
+		"user_id":       userID,
+		"email":         user.Email,
+		"generated_at":  time.Now().UTC(),
+		"files":         files,
+		"missing_audio": missingAudio,
+		"note":          "Ekspor ini berisi seluruh data pribadi kamu di Tenang.in sesuai UU No. 27 Tahun 2022 tentang Pelindungan Data Pribadi.",
+	}
+	if err := writeJSONEntry(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func writeJSONEntry(archive *zip.Writer, name string, data interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+func copyFileEntry(archive *zip.Writer, name, path string) error {
+	if path == "" {
+		return errors.New("no file path")
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store}) // audio sudah terkompresi
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// --- lifecycle ---
+
+func (e *DataExporter) fail(export models.DataExport, cause error) {
+	log.Printf("ERROR: Data export %s failed: %v", export.ID, cause)
+	message := "Export could not be completed, please request a new one."
+	e.DB.Model(&models.DataExport{}).Where("id = ?", export.ID).
+		Updates(map[string]interface{}{"status": models.DataExportFailed, "error_message": message})
+}
+
+func (e *DataExporter) notifyReady(export models.DataExport, user models.User) {
+	link, linkExpiresAt, err := e.DownloadURL(export, user)
+	if err != nil {
+		log.Printf("ERROR: Failed to sign download link for export %s: %v", export.ID, err)
+		return
+	}
+
+	actionURL := e.Cfg.Server.FrontendURL + "/settings/privacy"
+	notification := models.Notification{
+		UserID:           user.ID,
+		NotificationType: "account_update",
+		Title:            "Salinan data kamu sudah siap",
+		Message:          "Ekspor data pribadi kamu sudah selesai dan bisa diunduh dari pengaturan privasi.",
+		ActionURL:        &actionURL,
+		Priority:         "normal",
+		DeliveryMethod:   "in_app",
+	}
+	if err := e.Notifier.Create(&notification); err != nil {
+		log.Printf("WARNING: Failed to create export notification for user %s: %v", user.ID, err)
+	}
+
+	body := fmt.Sprintf("Halo,\n\n"+
+		"Salinan seluruh data kamu di Tenang.in sudah siap. Unduh arsipnya melalui tautan berikut:\n\n%s\n\n"+
+		"Tautan ini berlaku sampai %s. Setelah itu kamu bisa membuat tautan baru dari pengaturan privasi "+
+		"selama arsip masih tersimpan (sampai %s).\n\n"+
+		"Arsip berisi data yang sangat pribadi, termasuk percakapan dan rekaman suara. Simpan di tempat yang aman.\n\n"+
+		"Salam hangat,\nTim Tenang.in 🌸",
+		link, linkExpiresAt.Format("02 Jan 2006 15:04 MST"), export.ExpiresAt.Format("02 Jan 2006"))
+	if err := e.Email.Send(EmailMessage{To: user.Email, Subject: "Ekspor data Tenang.in sudah siap", TextBody: body}); err != nil {
+		log.Printf("ERROR: Failed to send export email to user %s: %v", user.ID, err)
+	}
+}
+
+func (e *DataExporter) expireArchives() {
+	var expired []models.DataExport
+	if err := e.DB.Where("status = ? AND expires_at < ?", models.DataExportReady, time.Now()).Find(&expired).Error; err != nil {
+		log.Printf("ERROR: Failed to load expired data exports: %v", err)
+		return
+	}
+	for _, export := range expired {
+		if export.FilePath != nil {
+			if err := os.Remove(*export.FilePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("WARNING: Failed to delete export archive %s: %v", *export.FilePath, err)
+				continue
+			}
+		}
+		e.DB.Model(&export).Updates(map[string]interface{}{"status": models.DataExportExpired, "file_path": nil})
+	}
+}
+
+func (e *DataExporter) resumeStale() {
+	var stale []uuid.UUID
+	e.DB.Model(&models.DataExport{}).
+		Where("(status = ? AND created_at < ?) OR (status = ? AND started_at < ?)",
+			models.DataExportPending, time.Now().Add(-time.Minute),
+			models.DataExportProcessing, time.Now().Add(-dataExportStaleAfter)).
+		Pluck("id", &stale)
+	for _, id := range stale {
+		e.DB.Model(&models.DataExport{}).Where("id = ?", id).Update("status", models.DataExportPending)
+		e.Run(id)
+	}
+}
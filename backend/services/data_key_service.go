@@ -0,0 +1,301 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ukuran batch untuk migrasi enkripsi dan rotasi kunci.
+const dataKeyBatchSize = 500
+
+// DataKeyring implements envelope encryption: every user has a random data key, and
+// only that key is encrypted ("wrapped") with the master SecurityConfig.EncryptionKey.
+// It is installed as the models.FieldCipher so GORM hooks encrypt on write and
+// decrypt on read.
+type DataKeyring struct {
+	DB  *gorm.DB
+	Cfg *config.Config
+
+	mu   sync.RWMutex
+	keys map[uuid.UUID][]byte // Kunci data yang sudah dibuka, per pengguna
+}
+
+// NewDataKeyring creates a new DataKeyring.
+func NewDataKeyring(db *gorm.DB, cfg *config.Config) *DataKeyring {
+	return &DataKeyring{DB: db, Cfg: cfg, keys: make(map[uuid.UUID][]byte)}
+}
+
+// MasterKeyID is a short, non-secret fingerprint identifying a master key.
+func MasterKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Seal encrypts plaintext with the user's data key, creating the key on first use.
+func (k *DataKeyring) Seal(userID uuid.UUID, plaintext string) (string, error) {
+	key, err := k.dataKey(userID, true)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := EncryptString(key, plaintext)
+	if err != nil {
+		return "", err
+	}
+	return models.SealedFieldPrefix + sealed, nil
+}
+
+// Open decrypts a value produced by Seal. Values without the sealed prefix are
+// returned unchanged so rows written before encryption stay readable.
+func (k *DataKeyring) Open(userID uuid.UUID, value string) (string, error) {
+	if !models.IsSealed(value) {
+		return value, nil
+	}
+	key, err := k.dataKey(userID, false)
+	if err != nil {
+		return "", err
+	}
+	return DecryptString(key, strings.TrimPrefix(value, models.SealedFieldPrefix))
+}
+
+func (k *DataKeyring) dataKey(userID uuid.UUID, create bool) ([]byte, error) {
+	k.mu.RLock()
+	key, ok := k.keys[userID]
+	k.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	var record models.UserDataKey
+	err := k.DB.Where("user_id = ?", userID).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && create {
+		record, err = k.createDataKey(userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("data key for user %s: %w", userID, err)
+	}
+
+	key, err = k.unwrap(record)
+	if err != nil {
+		return nil, err
+	}
+	k.mu.Lock()
+	k.keys[userID] = key
+	k.mu.Unlock()
+	return key, nil
+}
+
+// Forget drops the user's cached data key, e.g. once the key has been deleted, so
+// the plaintext key does not outlive its row in memory.
+func (k *DataKeyring) Forget(userID uuid.UUID) {
+	k.mu.Lock()
+	delete(k.keys, userID)
+	k.mu.Unlock()
+}
+
+// createDataKey menyimpan kunci baru di luar transaksi pemanggil, sehingga kunci yang
+// sudah dipakai untuk mengenkripsi tidak ikut hilang bila transaksi itu di-rollback.
+func (k *DataKeyring) createDataKey(userID uuid.UUID) (models.UserDataKey, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return models.UserDataKey{}, err
+	}
+	wrapped, err := EncryptString(k.Cfg.Security.EncryptionKey, string(raw))
+	if err != nil {
+		return models.UserDataKey{}, err
+	}
+
+	record := models.UserDataKey{UserID: userID, WrappedKey: wrapped, MasterKeyID: MasterKeyID(k.Cfg.Security.EncryptionKey)}
+	// Dua permintaan bersamaan bisa sama-sama membuat kunci; yang kalah memakai milik pemenang.
+	if err := k.DB.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "user_id"}}, DoNothing: true}).Create(&record).Error; err != nil {
+		return models.UserDataKey{}, err
+	}
+	var stored models.UserDataKey
+	err = k.DB.Where("user_id = ?", userID).First(&stored).Error
+	return stored, err
+}
+
+func (k *DataKeyring) unwrap(record models.UserDataKey) ([]byte, error) {
+	master, ok := k.masterKeys()[record.MasterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("data key for user %s is wrapped by unknown master key %s", record.UserID, record.MasterKeyID)
+	}
+	raw, err := DecryptString(master, record.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(raw), nil
+}
+
+func (k *DataKeyring) masterKeys() map[string][]byte {
+	keys := map[string][]byte{MasterKeyID(k.Cfg.Security.EncryptionKey): k.Cfg.Security.EncryptionKey}
+	for _, key := range k.Cfg.Security.PreviousEncryptionKeys {
+		keys[MasterKeyID(key)] = key
+	}
+	return keys
+}
+
+// --- rotation ---
+
+// RotateMasterKey re-wraps every data key, TOTP secret and JWT signing key that is
+// still sealed with a previous master key so that it uses the current one. Data
+// itself is not re-encrypted; only the keys protecting it change.
+func (k *DataKeyring) RotateMasterKey() (map[string]int64, error) {
+	current := k.Cfg.Security.EncryptionKey
+	currentID := MasterKeyID(current)
+	summary := map[string]int64{}
+
+	var records []models.UserDataKey
+	err := k.DB.Where("master_key_id <> ?", currentID).FindInBatches(&records, dataKeyBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, record := range records {
+			raw, err := k.unwrap(record)
+			if err != nil {
+				return err
+			}
+			wrapped, err := EncryptString(current, string(raw))
+			if err != nil {
+				return err
+			}
+			if err := k.DB.Model(&models.UserDataKey{}).Where("id = ? AND master_key_id = ?", record.ID, record.MasterKeyID).
+				Updates(map[string]interface{}{"wrapped_key": wrapped, "master_key_id": currentID}).Error; err != nil {
+				return err
+			}
+			summary["data_keys"]++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return summary, fmt.Errorf("user_data_keys: %w", err)
+	}
+
+	// Rahasia lain yang disegel langsung dengan kunci master dienkripsi ulang.
+	resealed, err := k.resealColumn(&models.UserMFA{}, "secret_encrypted")
+	summary["mfa_secrets"] = resealed
+	if err != nil {
+		return summary, fmt.Errorf("user_mfa: %w", err)
+	}
+	resealed, err = k.resealColumn(&models.SigningKey{}, "private_key_encrypted")
+	summary["signing_keys"] = resealed
+	if err != nil {
+		return summary, fmt.Errorf("signing_keys: %w", err)
+	}
+	return summary, nil
+}
+
+func (k *DataKeyring) resealColumn(model interface{}, column string) (int64, error) {
+	var rows []struct {
+		ID    uuid.UUID
+		Value string
+	}
+	if err := k.DB.Model(model).Select("id", column+" AS value").Scan(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	var resealed int64
+	for _, row := range rows {
+		if _, err := DecryptString(k.Cfg.Security.EncryptionKey, row.Value); err == nil {
+			continue // Sudah memakai kunci master saat ini
+		}
+		plaintext, err := DecryptWithMasterKeys(k.Cfg.Security, row.Value)
+		if err != nil {
+			return resealed, fmt.Errorf("row %s cannot be opened with any configured master key", row.ID)
+		}
+		sealed, err := EncryptString(k.Cfg.Security.EncryptionKey, plaintext)
+		if err != nil {
+			return resealed, err
+		}
+		if err := k.DB.Model(model).Where("id = ?", row.ID).Update(column, sealed).Error; err != nil {
+			return resealed, err
+		}
+		resealed++
+	}
+	return resealed, nil
+}
+
+// --- migration of existing rows ---
+
+// sealedColumn describes an encrypted column and how to find the user who owns each row.
+type sealedColumn struct {
+	table, column, ownerJoin string
+}
+
+var sealedColumns = []sealedColumn{
+	{"chat_messages", "message_content", "JOIN chat_sessions owner ON owner.id = chat_messages.chat_session_id"},
+	{"vocal_transcriptions", "transcription_text", "JOIN vocal_journal_entries owner ON owner.id = vocal_transcriptions.vocal_entry_id"},
+	{"vocal_sentiment_analyses", "reflection_prompt", "JOIN vocal_journal_entries owner ON owner.id = vocal_sentiment_analyses.vocal_entry_id"},
+}
+
+// StartBackfill encrypts rows written before field encryption was enabled, in the background.
+func (k *DataKeyring) StartBackfill() {
+	go func() {
+		summary, err := k.EncryptExistingRows()
+		if err != nil {
+			log.Printf("ERROR: Field encryption backfill stopped: %v", err)
+			return
+		}
+		for _, n := range summary {
+			if n > 0 {
+				log.Printf("INFO: Field encryption backfill finished: %v", summary)
+				break
+			}
+		}
+	}()
+}
+
+// EncryptExistingRows encrypts every plaintext value in the sealed columns. It is
+// idempotent and safe to run while the application is serving requests.
+func (k *DataKeyring) EncryptExistingRows() (map[string]int64, error) {
+	summary := map[string]int64{}
+	for _, col := range sealedColumns {
+		for {
+			var rows []struct {
+				ID     uuid.UUID
+				UserID uuid.UUID
+				Value  string
+			}
+			err := k.DB.Table(col.table).
+				Select(fmt.Sprintf("%s.id, owner.user_id, %s.%s AS value", col.table, col.table, col.column)).
+				Joins(col.ownerJoin).
+				Where(fmt.Sprintf("%s.%s <> '' AND %s.%s NOT LIKE ?", col.table, col.column, col.table, col.column), models.SealedFieldPrefix+"%").
+				Limit(dataKeyBatchSize).Scan(&rows).Error
+			if err != nil {
+				return summary, fmt.Errorf("%s: %w", col.table, err)
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			var progressed int64
+			for _, row := range rows {
+				sealed, err := k.Seal(row.UserID, row.Value)
+				if err != nil {
+					return summary, fmt.Errorf("%s %s: %w", col.table, row.ID, err)
+				}
+				// Bersyarat pada nilai lama agar tulisan baru dari aplikasi tidak tertimpa.
+				result := k.DB.Table(col.table).Where("id = ? AND "+col.column+" = ?", row.ID, row.Value).
+					Updates(map[string]interface{}{col.column: sealed, "is_encrypted": true})
+				if result.Error != nil {
+					return summary, fmt.Errorf("%s %s: %w", col.table, row.ID, result.Error)
+				}
+				progressed += result.RowsAffected
+			}
+			summary[col.table] += progressed
+			if progressed == 0 {
+				break
+			}
+		}
+	}
+	return summary, nil
+}
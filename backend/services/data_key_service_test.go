@@ -0,0 +1,24 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDataKeyringForget(t *testing.T) {
+	keyring := NewDataKeyring(nil, nil)
+	purged, other := uuid.New(), uuid.New()
+	keyring.keys[purged] = []byte("purged-key")
+	keyring.keys[other] = []byte("other-key")
+
+	keyring.Forget(purged)
+	keyring.Forget(uuid.New()) // Pengguna tanpa kunci di cache tidak berpengaruh
+
+	if _, ok := keyring.keys[purged]; ok {
+		t.Error("forgotten data key is still cached")
+	}
+	if _, ok := keyring.keys[other]; !ok {
+		t.Error("Forget dropped another user's data key")
+	}
+}
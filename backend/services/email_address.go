@@ -0,0 +1,21 @@
+package services
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// NormalizeEmail returns the form in which email addresses are stored and compared:
+// trimmed and lowercased.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// EmailEquals is a GORM scope that matches users by email regardless of case, so
+// accounts stored before addresses were normalized are still found.
+func EmailEquals(email string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("LOWER(email) = ?", NormalizeEmail(email))
+	}
+}
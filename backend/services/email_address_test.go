@@ -0,0 +1,16 @@
+package services
+
+import "testing"
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := map[string]string{
+		"Alice@Example.com":     "alice@example.com",
+		"  bob@example.com\t":   "bob@example.com",
+		"already@normalized.id": "already@normalized.id",
+	}
+	for in, want := range tests {
+		if got := NormalizeEmail(in); got != want {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"backend/config"
+
+	"github.com/google/uuid"
+)
+
+// EmailMessage is a plain-text transactional email.
+type EmailMessage struct {
+	To       string
+	Subject  string
+	TextBody string
+}
+
+// EmailService sends transactional emails through the SMTP server in EmailConfig.
+type EmailService struct {
+	Cfg config.EmailConfig
+}
+
+// NewEmailService creates a new EmailService for the given SMTP settings.
+func NewEmailService(cfg config.EmailConfig) *EmailService {
+	return &EmailService{Cfg: cfg}
+}
+
+// Send delivers a single email. SMTP AUTH is skipped when no username is configured,
+// so a local capture server such as MailHog can be used during development.
+func (e *EmailService) Send(msg EmailMessage) error {
+	body, err := e.buildMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if e.Cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", e.Cfg.SMTPUsername, e.Cfg.SMTPPassword, e.Cfg.SMTPHost)
+	}
+
+	addr := net.JoinHostPort(e.Cfg.SMTPHost, strconv.Itoa(e.Cfg.SMTPPort))
+	if e.Cfg.SMTPPort == 465 {
+		return e.sendImplicitTLS(addr, auth, msg.To, body)
+	}
+	// smtp.SendMail upgrades with STARTTLS whenever the server advertises it.
+	return smtp.SendMail(addr, auth, e.Cfg.FromEmail, []string{msg.To}, body)
+}
+
+// sendImplicitTLS handles SMTPS (port 465), which net/smtp.SendMail does not support.
+func (e *EmailService) sendImplicitTLS(addr string, auth smtp.Auth, to string, body []byte) error {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: e.Cfg.SMTPHost})
+	if err != nil {
+		return fmt.Errorf("smtp tls dial: %w", err)
+	}
+	client, err := smtp.NewClient(conn, e.Cfg.SMTPHost)
+	if err != nil {
+		return fmt.Errorf("smtp client: %w", err)
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := client.Mail(e.Cfg.FromEmail); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage renders RFC 5322 headers and a quoted-printable UTF-8 body.
+func (e *EmailService) buildMessage(msg EmailMessage) ([]byte, error) {
+	from := e.Cfg.FromEmail
+	if e.Cfg.FromName != "" {
+		from = fmt.Sprintf("%s <%s>", mime.QEncoding.Encode("utf-8", e.Cfg.FromName), e.Cfg.FromEmail)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", uuid.New().String(), e.Cfg.SMTPHost)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(msg.TextBody)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
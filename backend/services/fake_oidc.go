@@ -0,0 +1,185 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// FakeOIDCIdentity is the account a FakeOIDCIssuer signs in as.
+type FakeOIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type fakeOIDCGrant struct {
+	identity      FakeOIDCIdentity
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// FakeOIDCIssuer is a minimal OpenID Connect issuer for tests and offline development.
+// Serve it (e.g. with httptest.NewServer) and point GOOGLE_OIDC_ISSUER at its URL. It
+// publishes discovery and JWKS documents, enforces S256 PKCE at the token endpoint and
+// signs RS256 ID tokens carrying the nonce from the authorization request.
+type FakeOIDCIssuer struct {
+	// Identity is used when the browser-facing /authorize endpoint is visited directly.
+	Identity FakeOIDCIdentity
+
+	key   *rsa.PrivateKey
+	keyID string
+
+	mu     sync.Mutex
+	grants map[string]fakeOIDCGrant // authorization code -> grant
+}
+
+// NewFakeOIDCIssuer creates an issuer with a fresh signing key.
+func NewFakeOIDCIssuer(identity FakeOIDCIdentity) (*FakeOIDCIssuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &FakeOIDCIssuer{Identity: identity, key: key, keyID: "fake-oidc-1", grants: map[string]fakeOIDCGrant{}}, nil
+}
+
+// Authorize simulates the user approving the consent page at authURL as identity. It
+// returns the authorization code and the state the provider would redirect back with.
+func (f *FakeOIDCIssuer) Authorize(authURL string, identity FakeOIDCIdentity) (code, state string, err error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		return "", "", errors.New("fake oidc: authorization request must use the code flow with S256 PKCE")
+	}
+
+	code, _, err = GenerateSecureToken()
+	if err != nil {
+		return "", "", err
+	}
+	f.mu.Lock()
+	f.grants[code] = fakeOIDCGrant{
+		identity:      identity,
+		clientID:      query.Get("client_id"),
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	f.mu.Unlock()
+	return code, query.Get("state"), nil
+}
+
+// ServeHTTP serves discovery, JWKS, authorize (auto-approves as f.Identity) and token.
+func (f *FakeOIDCIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	issuer := "http://" + r.Host
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		writeFakeOIDCJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/authorize",
+			"token_endpoint":         issuer + "/token",
+			"jwks_uri":               issuer + "/jwks",
+		})
+	case "/jwks":
+		writeFakeOIDCJSON(w, http.StatusOK, JSONWebKeySet{Keys: []JSONWebKey{{
+			KeyType:   "RSA",
+			KeyID:     f.keyID,
+			Use:       "sig",
+			Algorithm: "RS256",
+			N:         base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+		}}})
+	case "/authorize":
+		authURL := issuer + r.URL.RequestURI()
+		code, state, err := f.Authorize(authURL, f.Identity)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		redirect, err := url.Parse(r.URL.Query().Get("redirect_uri"))
+		if err != nil {
+			http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+			return
+		}
+		query := redirect.Query()
+		query.Set("code", code)
+		query.Set("state", state)
+		redirect.RawQuery = query.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	case "/token":
+		f.token(w, r, issuer)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// token redeems a code once, checking client, redirect URI and the PKCE verifier.
+func (f *FakeOIDCIssuer) token(w http.ResponseWriter, r *http.Request, issuer string) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeFakeOIDCJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	f.mu.Lock()
+	grant, ok := f.grants[code]
+	delete(f.grants, code) // Kode hanya bisa ditukar sekali
+	f.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || grant.clientID != r.PostForm.Get("client_id") || grant.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != grant.codeChallenge {
+		writeFakeOIDCJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, oidcIDTokenClaims{
+		Email:         grant.identity.Email,
+		EmailVerified: grant.identity.EmailVerified,
+		Name:          grant.identity.Name,
+		Nonce:         grant.nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   grant.identity.Subject,
+			Audience:  jwt.ClaimStrings{grant.clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	})
+	token.Header["kid"] = f.keyID
+	idToken, err := token.SignedString(f.key)
+	if err != nil {
+		writeFakeOIDCJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken, _, _ := GenerateSecureToken()
+	writeFakeOIDCJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeFakeOIDCJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
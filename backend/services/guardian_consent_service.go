@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GuardianConsentPurpose is the purpose of signed links sent to a parent or guardian.
+const GuardianConsentPurpose = "guardian_consent"
+
+// ErrConsentNotPending is returned when a guardian responds to a consent request that
+// was already answered or replaced by a newer one.
+var ErrConsentNotPending = errors.New("guardian consent is no longer pending")
+
+// GuardianConsents manages parent/guardian consent for users in minor-safe mode.
+type GuardianConsents struct {
+	DB    *gorm.DB
+	Cfg   *config.Config
+	Email *EmailService
+}
+
+// NewGuardianConsents creates a new GuardianConsents.
+func NewGuardianConsents(db *gorm.DB, cfg *config.Config) *GuardianConsents {
+	return &GuardianConsents{DB: db, Cfg: cfg, Email: NewEmailService(cfg.Email)}
+}
+
+// Required reports whether the user is a minor without granted guardian consent.
+func (g *GuardianConsents) Required(user models.User) bool {
+	if !IsMinor(user, g.Cfg) {
+		return false
+	}
+	var granted int64
+	g.DB.Model(&models.GuardianConsent{}).Where("user_id = ? AND status = ?", user.ID, models.GuardianConsentGranted).Count(&granted)
+	return granted == 0
+}
+
+// Latest returns the user's most recent consent record, or nil if there is none.
+func (g *GuardianConsents) Latest(userID uuid.UUID) *models.GuardianConsent {
+	var consent models.GuardianConsent
+	if err := g.DB.Where("user_id = ?", userID).Order("created_at DESC").First(&consent).Error; err != nil {
+		return nil
+	}
+	return &consent
+}
+
+// Create records a new pending consent request inside tx. Older pending requests are
+// revoked so only the newest emailed link can be used.
+func (g *GuardianConsents) Create(tx *gorm.DB, userID uuid.UUID, guardianName, guardianEmail, relationship string) (*models.GuardianConsent, error) {
+	if err := tx.Model(&models.GuardianConsent{}).Where("user_id = ? AND status = ?", userID, models.GuardianConsentPending).
+		Update("status", models.GuardianConsentRevoked).Error; err != nil {
+		return nil, err
+	}
+	consent := models.GuardianConsent{
+		UserID: userID, GuardianName: guardianName, GuardianEmail: guardianEmail, Relationship: relationship,
+		Status: models.GuardianConsentPending,
+	}
+	if err := tx.Create(&consent).Error; err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// Notify emails the guardian a signed link to grant or decline consent.
+func (g *GuardianConsents) Notify(consent models.GuardianConsent, user models.User) {
+	token, err := SignReferenceToken(g.Cfg.JWT.EncryptionKey, GuardianConsentPurpose, user.ID, consent.GuardianEmail,
+		consent.ID.String(), g.Cfg.Security.GuardianConsentLinkExpiry)
+	if err != nil {
+		log.Printf("ERROR: Failed to sign guardian consent link %s: %v", consent.ID, err)
+		return
+	}
+	link := fmt.Sprintf("%s/guardian-consent?token=%s", g.Cfg.Server.FrontendURL, url.QueryEscape(token))
+
+	name := user.Email
+	if user.FullName != nil {
+		name = *user.FullName
+	}
+	body := fmt.Sprintf("Halo %s,\n\n"+
+		"%s mendaftar di Tenang.in, aplikasi pendamping kesehatan mental, dan mencantumkan Anda sebagai %s. "+
+		"Karena usianya di bawah %d tahun, kami memerlukan persetujuan orang tua atau wali sebelum ia dapat "+
+		"menggunakan fitur percakapan, jurnal suara, dan komunitas.\n\n"+
+		"Selama di bawah umur, akun ini berjalan dalam mode aman: pemantauan media sosial dimatikan, sebagian "+
+		"kategori komunitas disembunyikan, dan asisten AI memakai panduan yang lebih ketat.\n\n"+
+		"Tinjau dan berikan (atau tolak) persetujuan melalui tautan berikut:\n\n%s\n\n"+
+		"Tautan berlaku sampai %s. Jika Anda tidak mengenal pendaftaran ini, abaikan email ini.\n\n"+
+		"Salam hangat,\nTim Tenang.in 🌸",
+		consent.GuardianName, name, consent.Relationship, g.Cfg.Security.MinorSafeAge, link,
+		time.Now().Add(g.Cfg.Security.GuardianConsentLinkExpiry).Format("02 Jan 2006 15:04 MST"))
+	if err := g.Email.Send(EmailMessage{To: consent.GuardianEmail, Subject: "Permintaan persetujuan orang tua/wali - Tenang.in", TextBody: body}); err != nil {
+		log.Printf("ERROR: Failed to send guardian consent request %s: %v", consent.ID, err)
+	}
+}
+
+// Respond records the guardian's decision for the consent request named in a signed link.
+func (g *GuardianConsents) Respond(token string, grant bool, ip, userAgent string) (*models.GuardianConsent, error) {
+	claims, err := ParsePurposeToken(g.Cfg.JWT.EncryptionKey, token, GuardianConsentPurpose)
+	if err != nil {
+		return nil, err
+	}
+	consentID, err := uuid.Parse(claims.Reference)
+	if err != nil {
+		return nil, ErrInvalidSignedToken
+	}
+
+	status := models.GuardianConsentDeclined
+	if grant {
+		status = models.GuardianConsentGranted
+	}
+	now := time.Now()
+	// Bersyarat pada status pending agar tautan yang sama tidak bisa dipakai dua kali.
+	result := g.DB.Model(&models.GuardianConsent{}).
+		Where("id = ? AND user_id = ? AND status = ?", consentID, claims.UserID, models.GuardianConsentPending).
+		Updates(map[string]interface{}{"status": status, "responded_at": now, "responded_ip": ip, "responded_ua": userAgent})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrConsentNotPending
+	}
+
+	var consent models.GuardianConsent
+	if err := g.DB.First(&consent, "id = ?", consentID).Error; err != nil {
+		return nil, err
+	}
+	RecordAudit(g.DB, AuditEntry{
+		Action: "guardian_consent_" + status, TableName: "guardian_consents", RecordID: &consent.ID,
+		NewValues: map[string]interface{}{"user_id": consent.UserID, "guardian_email": consent.GuardianEmail},
+		IPAddress: ip, UserAgent: userAgent,
+	})
+	return &consent, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func newFakeGoogle(t *testing.T) (*FakeOIDCIssuer, *OIDCProvider) {
+	t.Helper()
+	issuer, err := NewFakeOIDCIssuer(FakeOIDCIdentity{Subject: "google-123", Email: "Rani@Example.com", EmailVerified: true, Name: "Rani"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(issuer)
+	t.Cleanup(server.Close)
+	return issuer, NewOIDCProvider("google", server.URL, "tenang-client", "secret", "http://localhost:3000/auth/google/callback")
+}
+
+func TestOIDCProviderAuthCodeURLCarriesStateNonceAndPKCE(t *testing.T) {
+	_, provider := newFakeGoogle(t)
+
+	authURL, err := provider.AuthCodeURL("state-1", "nonce-1", "verifier-verifier-verifier-verifier-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	for param, want := range map[string]string{"state": "state-1", "nonce": "nonce-1", "code_challenge_method": "S256", "client_id": "tenang-client"} {
+		if got := query.Get(param); got != want {
+			t.Errorf("%s = %q, want %q", param, got, want)
+		}
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge") == "verifier-verifier-verifier-verifier-verifier" {
+		t.Errorf("code_challenge = %q, want the S256 hash of the verifier", query.Get("code_challenge"))
+	}
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	const verifier = "verifier-verifier-verifier-verifier-verifier"
+	identity := FakeOIDCIdentity{Subject: "google-123", Email: "Rani@Example.com", EmailVerified: true, Name: "Rani"}
+
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+		wantErr  bool
+	}{
+		{name: "valid code, verifier and nonce", verifier: verifier, nonce: "nonce-1"},
+		{name: "wrong PKCE verifier", verifier: "another-verifier-another-verifier-another", nonce: "nonce-1", wantErr: true},
+		{name: "nonce from another flow", verifier: verifier, nonce: "nonce-2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer, provider := newFakeGoogle(t)
+			authURL, err := provider.AuthCodeURL("state-1", "nonce-1", verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, state, err := issuer.Authorize(authURL, identity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != "state-1" {
+				t.Errorf("state = %q, want state-1", state)
+			}
+
+			got, err := provider.Exchange(context.Background(), code, tt.verifier, tt.nonce)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Exchange succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if got.Subject != "google-123" || got.Email != "rani@example.com" || !got.EmailVerified || got.Provider != "google" {
+				t.Errorf("identity = %+v", got)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderExchangeRejectsReusedCode(t *testing.T) {
+	const verifier = "verifier-verifier-verifier-verifier-verifier"
+	issuer, provider := newFakeGoogle(t)
+	authURL, _ := provider.AuthCodeURL("state-1", "nonce-1", verifier)
+	code, _, err := issuer.Authorize(authURL, issuer.Identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.Exchange(context.Background(), code, verifier, "nonce-1"); err != nil {
+		t.Fatalf("first Exchange: %v", err)
+	}
+	if _, err := provider.Exchange(context.Background(), code, verifier, "nonce-1"); err == nil {
+		t.Fatal("second Exchange with the same code succeeded, want invalid_grant")
+	}
+}
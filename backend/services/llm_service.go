@@ -0,0 +1,386 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"backend/config"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrLLMNotConfigured is returned when no language model provider is available.
+var ErrLLMNotConfigured = errors.New("language model provider is not configured")
+
+// Fitur yang memakai model bahasa; masing-masing bisa diberi model sendiri lewat LLM_MODEL_<FITUR>.
+const (
+	LLMFeatureChat             = "chat"
+	LLMFeatureVocalAnalysis    = "vocal_analysis"
+	LLMFeatureCrisisClassifier = "crisis_classifier"
+	LLMFeatureSentiment        = "sentiment"
+)
+
+// Peran pesan dalam percakapan dengan model.
+const (
+	LLMRoleSystem    = "system"
+	LLMRoleUser      = "user"
+	LLMRoleAssistant = "assistant"
+)
+
+// LLMMessage is one turn of the conversation sent to the model.
+type LLMMessage struct {
+	Role    string
+	Content string
+}
+
+// LLMRequest is a provider-neutral completion request. Model is normally left empty
+// and resolved from Feature by LLMService.
+type LLMRequest struct {
+	Feature     string
+	Model       string
+	Messages    []LLMMessage
+	MaxTokens   int
+	Temperature float32
+	JSON        bool // Minta model membalas dengan satu objek JSON
+}
+
+// LLMUsage reports the tokens used by a completion.
+type LLMUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// LLMResponse is a finished completion.
+type LLMResponse struct {
+	Content      string
+	Model        string
+	FinishReason string
+	Usage        LLMUsage
+}
+
+// LLMStreamChunk is one piece of a streamed completion. FinishReason is set on the
+// chunk that ends the reply.
+type LLMStreamChunk struct {
+	Content      string
+	FinishReason string
+}
+
+// LLMStream yields chunks until Recv returns io.EOF. Close must always be called.
+type LLMStream interface {
+	Recv() (LLMStreamChunk, error)
+	Close() error
+}
+
+// LLMProvider is implemented by every language model backend.
+type LLMProvider interface {
+	Name() string
+	Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error)
+	Stream(ctx context.Context, req LLMRequest) (LLMStream, error)
+}
+
+// LLMService is what the rest of the application talks to: it picks the model for
+// each feature and hands the request to the configured provider.
+type LLMService struct {
+	Provider      LLMProvider // nil jika penyedia belum dikonfigurasi
+	DefaultModel  string
+	FeatureModels map[string]string
+}
+
+// NewLLMService builds the provider selected by LLM_PROVIDER.
+func NewLLMService(cfg *config.Config) *LLMService {
+	s := &LLMService{DefaultModel: cfg.LLM.DefaultModel, FeatureModels: cfg.LLM.FeatureModels}
+
+	switch cfg.LLM.Provider {
+	case "fake":
+		s.Provider = NewFakeLLM()
+		if s.DefaultModel == "" {
+			s.DefaultModel = "fake"
+		}
+	case "openai":
+		s.Provider = NewOpenAICompatibleLLM(cfg.LLM.BaseURL, cfg.LLM.APIKey)
+	default:
+		if cfg.Azure.OpenAIAPIKey == "" || cfg.Azure.OpenAIEndpoint == "" {
+			log.Println("WARNING: Azure OpenAI is not configured; AI features are disabled.")
+			return s
+		}
+		s.Provider = NewAzureLLM(cfg.Azure.OpenAIAPIKey, cfg.Azure.OpenAIEndpoint, cfg.Azure.OpenAIAPIVersion)
+	}
+	return s
+}
+
+// ProviderName returns the active provider, or "none".
+func (s *LLMService) ProviderName() string {
+	if s.Provider == nil {
+		return "none"
+	}
+	return s.Provider.Name()
+}
+
+// ModelFor returns the model (the deployment name on Azure) used for feature.
+func (s *LLMService) ModelFor(feature string) string {
+	if model := s.FeatureModels[feature]; model != "" {
+		return model
+	}
+	return s.DefaultModel
+}
+
+// Configured reports whether requests for feature can be sent.
+func (s *LLMService) Configured(feature string) bool {
+	return s.Provider != nil && s.ModelFor(feature) != ""
+}
+
+func (s *LLMService) prepare(req LLMRequest) (LLMRequest, error) {
+	if req.Model == "" {
+		req.Model = s.ModelFor(req.Feature)
+	}
+	if s.Provider == nil || req.Model == "" {
+		return req, ErrLLMNotConfigured
+	}
+	return req, nil
+}
+
+// Complete sends req and waits for the whole reply.
+func (s *LLMService) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	req, err := s.prepare(req)
+	if err != nil {
+		return nil, err
+	}
+	return s.Provider.Complete(ctx, req)
+}
+
+// Stream sends req and returns the reply as it is generated.
+func (s *LLMService) Stream(ctx context.Context, req LLMRequest) (LLMStream, error) {
+	req, err := s.prepare(req)
+	if err != nil {
+		return nil, err
+	}
+	return s.Provider.Stream(ctx, req)
+}
+
+// CompleteJSON asks for a JSON object and decodes it into v.
+func (s *LLMService) CompleteJSON(ctx context.Context, req LLMRequest, v interface{}) (*LLMResponse, error) {
+	req.JSON = true
+	resp, err := s.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// Beberapa server lokal mengabaikan mode JSON dan membungkus jawabannya dengan ```json.
+	raw := strings.TrimSpace(resp.Content)
+	raw = strings.TrimPrefix(raw, "```json")
+	raw = strings.TrimSuffix(strings.TrimPrefix(raw, "```"), "```")
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), v); err != nil {
+		return resp, fmt.Errorf("model did not return valid JSON: %w", err)
+	}
+	return resp, nil
+}
+
+// --- OpenAI-compatible providers (Azure OpenAI, OpenAI, llama.cpp, Ollama) ---
+
+// OpenAILLM talks to any endpoint that implements the OpenAI chat completions API.
+type OpenAILLM struct {
+	name   string
+	client *openai.Client
+}
+
+// NewAzureLLM creates a provider for Azure OpenAI; models are deployment names.
+func NewAzureLLM(apiKey, endpoint, apiVersion string) *OpenAILLM {
+	config := openai.DefaultAzureConfig(apiKey, endpoint)
+	config.APIVersion = apiVersion
+	return &OpenAILLM{name: "azure", client: openai.NewClientWithConfig(config)}
+}
+
+// NewOpenAICompatibleLLM creates a provider for a plain OpenAI-compatible endpoint,
+// e.g. https://api.openai.com/v1 or a local http://localhost:11434/v1 (Ollama).
+func NewOpenAICompatibleLLM(baseURL, apiKey string) *OpenAILLM {
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = strings.TrimSuffix(baseURL, "/")
+	return &OpenAILLM{name: "openai", client: openai.NewClientWithConfig(config)}
+}
+
+func (p *OpenAILLM) Name() string { return p.name }
+
+func (p *OpenAILLM) request(req LLMRequest) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, len(req.Messages))
+	for i, m := range req.Messages {
+		messages[i] = openai.ChatCompletionMessage{Role: m.Role, Content: m.Content}
+	}
+	chatReq := openai.ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	}
+	if req.JSON {
+		chatReq.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+	return chatReq
+}
+
+func (p *OpenAILLM) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, p.request(req))
+	if err != nil {
+		return nil, fmt.Errorf("%s completion error: %w", p.name, err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("%s returned no response choices", p.name)
+	}
+	return &LLMResponse{
+		Content:      resp.Choices[0].Message.Content,
+		Model:        resp.Model,
+		FinishReason: string(resp.Choices[0].FinishReason),
+		Usage: LLMUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+func (p *OpenAILLM) Stream(ctx context.Context, req LLMRequest) (LLMStream, error) {
+	chatReq := p.request(req)
+	chatReq.Stream = true
+	stream, err := p.client.CreateChatCompletionStream(ctx, chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s stream error: %w", p.name, err)
+	}
+	return &openAIStream{stream: stream}, nil
+}
+
+type openAIStream struct {
+	stream *openai.ChatCompletionStream
+}
+
+func (s *openAIStream) Recv() (LLMStreamChunk, error) {
+	for {
+		resp, err := s.stream.Recv()
+		if err != nil {
+			return LLMStreamChunk{}, err
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		return LLMStreamChunk{Content: resp.Choices[0].Delta.Content, FinishReason: string(resp.Choices[0].FinishReason)}, nil
+	}
+}
+
+func (s *openAIStream) Close() error { return s.stream.Close() }
+
+// --- Scripted fake ---
+
+// FakeReply is one scripted answer. When Err is set, Complete fails with it and
+// Stream fails after sending Content, which simulates a broken stream.
+type FakeReply struct {
+	Content string
+	Err     error
+}
+
+// FakeLLM is a deterministic provider for tests and offline development. Scripted
+// replies are used in order; once they run out it answers "{}" in JSON mode and
+// otherwise echoes the last user message.
+type FakeLLM struct {
+	mu       sync.Mutex
+	replies  []FakeReply
+	requests []LLMRequest
+}
+
+// NewFakeLLM creates a FakeLLM scripted with replies.
+func NewFakeLLM(replies ...string) *FakeLLM {
+	f := &FakeLLM{}
+	for _, reply := range replies {
+		f.Script(FakeReply{Content: reply})
+	}
+	return f
+}
+
+// Script queues more replies.
+func (f *FakeLLM) Script(replies ...FakeReply) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies = append(f.replies, replies...)
+}
+
+// Requests returns every request received so far.
+func (f *FakeLLM) Requests() []LLMRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]LLMRequest(nil), f.requests...)
+}
+
+func (f *FakeLLM) Name() string { return "fake" }
+
+func (f *FakeLLM) next(req LLMRequest) FakeReply {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	if len(f.replies) > 0 {
+		reply := f.replies[0]
+		f.replies = f.replies[1:]
+		return reply
+	}
+	if req.JSON {
+		return FakeReply{Content: "{}"}
+	}
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == LLMRoleUser {
+			return FakeReply{Content: "Fake reply to: " + req.Messages[i].Content}
+		}
+	}
+	return FakeReply{Content: "Fake reply"}
+}
+
+func (f *FakeLLM) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	reply := f.next(req)
+	if reply.Err != nil {
+		return nil, reply.Err
+	}
+	prompt := 0
+	for _, m := range req.Messages {
+		prompt += len(strings.Fields(m.Content))
+	}
+	completion := len(strings.Fields(reply.Content))
+	return &LLMResponse{
+		Content: reply.Content, Model: req.Model, FinishReason: "stop",
+		Usage: LLMUsage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion},
+	}, nil
+}
+
+func (f *FakeLLM) Stream(ctx context.Context, req LLMRequest) (LLMStream, error) {
+	reply := f.next(req)
+	if reply.Err != nil && reply.Content == "" {
+		return nil, reply.Err
+	}
+	return &fakeStream{ctx: ctx, chunks: strings.SplitAfter(reply.Content, " "), err: reply.Err}, nil
+}
+
+type fakeStream struct {
+	ctx    context.Context
+	chunks []string
+	err    error
+}
+
+func (s *fakeStream) Recv() (LLMStreamChunk, error) {
+	if err := s.ctx.Err(); err != nil {
+		return LLMStreamChunk{}, err
+	}
+	if len(s.chunks) == 0 {
+		if s.err != nil {
+			return LLMStreamChunk{}, s.err
+		}
+		return LLMStreamChunk{}, io.EOF
+	}
+	chunk := LLMStreamChunk{Content: s.chunks[0]}
+	s.chunks = s.chunks[1:]
+	if len(s.chunks) == 0 && s.err == nil {
+		chunk.FinishReason = "stop"
+	}
+	return chunk, nil
+}
+
+func (s *fakeStream) Close() error { return nil }
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func newFakeLLMService(fake *FakeLLM) *LLMService {
+	return &LLMService{Provider: fake, DefaultModel: "fake-default", FeatureModels: map[string]string{LLMFeatureSentiment: "fake-sentiment"}}
+}
+
+func TestLLMServiceCompleteJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain object", reply: `{"emotion":"sedih"}`, want: "sedih"},
+		{name: "fenced with json tag", reply: "```json\n{\"emotion\":\"cemas\"}\n```", want: "cemas"},
+		{name: "fenced without tag", reply: "```\n{\"emotion\":\"lega\"}\n```", want: "lega"},
+		{name: "prose instead of JSON", reply: "Maaf, aku tidak bisa.", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeLLM(tt.reply)
+			var out struct {
+				Emotion string `json:"emotion"`
+			}
+			_, err := newFakeLLMService(fake).CompleteJSON(context.Background(), LLMRequest{Feature: LLMFeatureSentiment}, &out)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("CompleteJSON succeeded with %+v, want error", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompleteJSON: %v", err)
+			}
+			if out.Emotion != tt.want {
+				t.Errorf("emotion = %q, want %q", out.Emotion, tt.want)
+			}
+
+			requests := fake.Requests()
+			if len(requests) != 1 || !requests[0].JSON || requests[0].Model != "fake-sentiment" {
+				t.Errorf("requests = %+v, want one JSON request to the sentiment model", requests)
+			}
+		})
+	}
+}
+
+func TestLLMServiceCompleteReturnsScriptedError(t *testing.T) {
+	errUpstream := errors.New("upstream timeout")
+	fake := NewFakeLLM()
+	fake.Script(FakeReply{Err: errUpstream}, FakeReply{Content: "Aku di sini untukmu."})
+	service := newFakeLLMService(fake)
+
+	if _, err := service.Complete(context.Background(), LLMRequest{Feature: LLMFeatureChat}); !errors.Is(err, errUpstream) {
+		t.Fatalf("first Complete error = %v, want %v", err, errUpstream)
+	}
+	resp, err := service.Complete(context.Background(), LLMRequest{Feature: LLMFeatureChat})
+	if err != nil {
+		t.Fatalf("second Complete: %v", err)
+	}
+	if resp.Content != "Aku di sini untukmu." || resp.Model != "fake-default" || resp.FinishReason != "stop" {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestLLMServiceStream(t *testing.T) {
+	errBroken := errors.New("connection reset")
+	tests := []struct {
+		name    string
+		reply   FakeReply
+		want    string
+		wantErr error
+	}{
+		{name: "complete reply", reply: FakeReply{Content: "Tarik napas pelan-pelan ya."}, want: "Tarik napas pelan-pelan ya.", wantErr: io.EOF},
+		{name: "broken after partial content", reply: FakeReply{Content: "Tarik napas", Err: errBroken}, want: "Tarik napas", wantErr: errBroken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeLLM()
+			fake.Script(tt.reply)
+			stream, err := newFakeLLMService(fake).Stream(context.Background(), LLMRequest{Feature: LLMFeatureChat})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stream.Close()
+
+			var got strings.Builder
+			for {
+				chunk, err := stream.Recv()
+				if err != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Errorf("stream ended with %v, want %v", err, tt.wantErr)
+					}
+					break
+				}
+				got.WriteString(chunk.Content)
+			}
+			if got.String() != tt.want {
+				t.Errorf("streamed %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLLMServiceNotConfigured(t *testing.T) {
+	service := &LLMService{}
+	if _, err := service.Complete(context.Background(), LLMRequest{Feature: LLMFeatureChat}); !errors.Is(err, ErrLLMNotConfigured) {
+		t.Errorf("Complete error = %v, want ErrLLMNotConfigured", err)
+	}
+	if service.Configured(LLMFeatureChat) {
+		t.Error("Configured = true without a provider")
+	}
+}
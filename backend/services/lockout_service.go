@@ -0,0 +1,131 @@
+package services
+
+import (
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoginLockout tracks failed sign-in attempts on UserCredentials and locks the
+// account once MaxLoginAttempts is reached. Every consecutive lockout doubles
+// the lock duration, up to MaxLockoutDuration.
+type LoginLockout struct {
+	DB  *gorm.DB
+	Cfg config.SecurityConfig
+}
+
+// NewLoginLockout creates a LoginLockout using the security settings.
+func NewLoginLockout(db *gorm.DB, cfg config.SecurityConfig) *LoginLockout {
+	return &LoginLockout{DB: db, Cfg: cfg}
+}
+
+// LockedUntil returns the end of an active lockout, or nil when sign-in is allowed.
+func (l *LoginLockout) LockedUntil(credentials models.UserCredentials) *time.Time {
+	if credentials.LockedUntil != nil && credentials.LockedUntil.After(time.Now()) {
+		return credentials.LockedUntil
+	}
+	return nil
+}
+
+// RegisterFailure counts a failed attempt and returns the lockout end when this
+// attempt triggered a lockout.
+func (l *LoginLockout) RegisterFailure(credentials models.UserCredentials, clientIP, userAgent string) (*time.Time, error) {
+	var updated models.UserCredentials
+	locked := false
+	err := l.DB.Transaction(func(tx *gorm.DB) error {
+		// Increment atomically so parallel attempts cannot slip past the threshold.
+		if err := tx.Model(&models.UserCredentials{}).Where("id = ?", credentials.ID).
+			Update("failed_login_attempts", gorm.Expr("failed_login_attempts + 1")).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", credentials.ID).First(&updated).Error; err != nil {
+			return err
+		}
+		if l.Cfg.MaxLoginAttempts <= 0 || updated.FailedLoginAttempts < l.Cfg.MaxLoginAttempts {
+			return nil
+		}
+
+		lockedUntil := time.Now().Add(l.lockoutDuration(updated.LockoutCount + 1))
+		updated.LockoutCount++
+		updated.LockedUntil = &lockedUntil
+		locked = true
+		return tx.Model(&models.UserCredentials{}).Where("id = ?", credentials.ID).Updates(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"lockout_count":         updated.LockoutCount,
+			"locked_until":          lockedUntil,
+		}).Error
+	})
+	if err != nil || !locked {
+		return nil, err
+	}
+
+	RecordAudit(l.DB, AuditEntry{
+		UserID:    &credentials.UserID,
+		Action:    "account_locked",
+		TableName: "user_credentials",
+		RecordID:  &credentials.ID,
+		NewValues: map[string]interface{}{"locked_until": updated.LockedUntil, "lockout_count": updated.LockoutCount},
+		IPAddress: clientIP,
+		UserAgent: userAgent,
+	})
+	return updated.LockedUntil, nil
+}
+
+// RegisterSuccess clears the failure counters after a successful sign-in.
+func (l *LoginLockout) RegisterSuccess(credentials models.UserCredentials) {
+	if credentials.FailedLoginAttempts == 0 && credentials.LockoutCount == 0 && credentials.LockedUntil == nil {
+		return
+	}
+	l.DB.Model(&models.UserCredentials{}).Where("id = ?", credentials.ID).Updates(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"lockout_count":         0,
+		"locked_until":          nil,
+	})
+}
+
+// Unlock lifts a lockout on behalf of an administrator.
+func (l *LoginLockout) Unlock(userID, adminID uuid.UUID, clientIP, userAgent string) error {
+	var credentials models.UserCredentials
+	if err := l.DB.Where("user_id = ?", userID).First(&credentials).Error; err != nil {
+		return err
+	}
+
+	if err := l.DB.Model(&credentials).Updates(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"lockout_count":         0,
+		"locked_until":          nil,
+	}).Error; err != nil {
+		return err
+	}
+
+	RecordAudit(l.DB, AuditEntry{
+		UserID:    &adminID,
+		Action:    "account_unlocked",
+		TableName: "user_credentials",
+		RecordID:  &credentials.ID,
+		OldValues: map[string]interface{}{"locked_until": credentials.LockedUntil, "lockout_count": credentials.LockoutCount},
+		NewValues: map[string]interface{}{"user_id": userID},
+		IPAddress: clientIP,
+		UserAgent: userAgent,
+	})
+	return nil
+}
+
+// lockoutDuration returns LockoutDuration * 2^(n-1), capped at MaxLockoutDuration.
+func (l *LoginLockout) lockoutDuration(lockoutNumber int) time.Duration {
+	duration := l.Cfg.LockoutDuration
+	for i := 1; i < lockoutNumber; i++ {
+		duration *= 2
+		if l.Cfg.MaxLockoutDuration > 0 && duration >= l.Cfg.MaxLockoutDuration {
+			return l.Cfg.MaxLockoutDuration
+		}
+	}
+	if l.Cfg.MaxLockoutDuration > 0 && duration > l.Cfg.MaxLockoutDuration {
+		return l.Cfg.MaxLockoutDuration
+	}
+	return duration
+}
@@ -0,0 +1,390 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrNotificationSuppressed is returned by Notifier.Create when the recipient has
+// turned the notification type off.
+var ErrNotificationSuppressed = errors.New("notification type disabled by user")
+
+// Peringatan krisis dan pemberitahuan akun tidak bisa dimatikan, hanya dipindah salurannya.
+var mandatoryNotificationTypes = map[string]bool{
+	models.NotificationCrisisAlert:   true,
+	models.NotificationAccountUpdate: true,
+}
+
+const maxNotificationsPerDay = 50
+
+// ValidateNotificationSchedule checks a schedule submitted by the user.
+func ValidateNotificationSchedule(s models.NotificationSchedule) error {
+	if s.QuietHours.Enabled {
+		start, err := parseClock(s.QuietHours.Start)
+		if err != nil {
+			return errors.New("quiet_hours.start must be in HH:MM format")
+		}
+		end, err := parseClock(s.QuietHours.End)
+		if err != nil {
+			return errors.New("quiet_hours.end must be in HH:MM format")
+		}
+		if start == end {
+			return errors.New("quiet_hours.start and quiet_hours.end must differ")
+		}
+	}
+
+	for notificationType, channels := range s.Channels {
+		if !isNotificationType(notificationType) {
+			return fmt.Errorf("channels: unknown notification type %q", notificationType)
+		}
+		if len(channels) == 0 && mandatoryNotificationTypes[notificationType] {
+			return fmt.Errorf("channels: %s notifications cannot be turned off", notificationType)
+		}
+		seen := map[string]bool{}
+		for _, channel := range channels {
+			switch channel {
+			case models.DeliveryPush, models.DeliveryEmail, models.DeliveryInApp:
+			default:
+				return fmt.Errorf("channels.%s: unknown channel %q", notificationType, channel)
+			}
+			if seen[channel] {
+				return fmt.Errorf("channels.%s: duplicate channel %q", notificationType, channel)
+			}
+			seen[channel] = true
+		}
+	}
+
+	if s.MaxPerDay < 0 || s.MaxPerDay > maxNotificationsPerDay {
+		return fmt.Errorf("max_per_day must be between 0 (unlimited) and %d", maxNotificationsPerDay)
+	}
+	switch s.DigestFrequency {
+	case models.DigestOff, models.DigestDaily, models.DigestWeekly:
+	default:
+		return errors.New("digest_frequency must be one of off, daily, weekly")
+	}
+	if _, err := parseClock(s.DigestTime); err != nil {
+		return errors.New("digest_time must be in HH:MM format")
+	}
+	return nil
+}
+
+// Notifier creates notifications according to the recipient's preferences and
+// delivers them once they are due.
+type Notifier struct {
+	DB    *gorm.DB
+	Cfg   *config.Config
+	Email *EmailService
+}
+
+// NewNotifier creates a new Notifier.
+func NewNotifier(db *gorm.DB, cfg *config.Config) *Notifier {
+	return &Notifier{DB: db, Cfg: cfg, Email: NewEmailService(cfg.Email)}
+}
+
+// StartDelivery periodically delivers notifications whose scheduled time has passed.
+func (nt *Notifier) StartDelivery(every time.Duration) {
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := nt.DeliverDue(time.Now()); err != nil {
+				log.Printf("ERROR: Notification delivery failed: %v", err)
+			}
+		}
+	}()
+}
+
+// Create applies the recipient's preferences to n and stores it. Disabled types are
+// not stored (ErrNotificationSuppressed) and the channel follows the user's choice
+// for the type. Non-urgent notifications are deferred, never dropped: out of quiet
+// hours, to the next digest, or to the next day once the daily limit is reached.
+// All times are evaluated in the user's own time zone.
+func (nt *Notifier) Create(n *models.Notification) error {
+	var user models.User
+	if err := nt.DB.Select("id", "email", "timezone", "is_active").Where("id = ?", n.UserID).First(&user).Error; err != nil {
+		return err
+	}
+	prefs := nt.preferences(n.UserID)
+	if !notificationEnabled(n.NotificationType, prefs) {
+		return ErrNotificationSuppressed
+	}
+
+	schedule := prefs.NotificationSchedule
+	n.DeliveryMethod = preferredChannel(n.NotificationType, n.DeliveryMethod, schedule)
+	if n.Priority == "" {
+		n.Priority = "normal"
+	}
+
+	now := time.Now()
+	due := now
+	if n.ScheduledFor != nil && n.ScheduledFor.After(now) {
+		due = *n.ScheduledFor
+	}
+	if n.Priority != "urgent" {
+		due = nt.deferUntil(n.UserID, due, n.Priority, schedule, UserLocation(user.Timezone))
+	}
+	n.ScheduledFor = &due
+
+	if err := nt.DB.Create(n).Error; err != nil {
+		return err
+	}
+	if !due.After(now) {
+		go nt.deliverBatch(user, schedule, []models.Notification{*n})
+	}
+	return nil
+}
+
+// DeliverDue delivers every unsent notification scheduled at or before now and
+// returns how many were delivered.
+func (nt *Notifier) DeliverDue(now time.Time) (int, error) {
+	var due []models.Notification
+	if err := nt.DB.Where("is_sent = ? AND scheduled_for <= ?", false, now).
+		Order("scheduled_for ASC").Limit(1000).Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	byUser := map[uuid.UUID][]models.Notification{}
+	for _, n := range due {
+		byUser[n.UserID] = append(byUser[n.UserID], n)
+	}
+
+	delivered := 0
+	for userID, batch := range byUser {
+		var user models.User
+		if err := nt.DB.Select("id", "email", "timezone", "is_active").Where("id = ?", userID).First(&user).Error; err != nil {
+			continue
+		}
+		delivered += nt.deliverBatch(user, nt.preferences(userID).NotificationSchedule, batch)
+	}
+	return delivered, nil
+}
+
+// deliverBatch sends one user's due notifications. Several email notifications are
+// combined into a single message, which is how digests reach the user.
+func (nt *Notifier) deliverBatch(user models.User, schedule models.NotificationSchedule, batch []models.Notification) int {
+	now := time.Now()
+	// Jam tenang bisa saja diubah setelah notifikasi dijadwalkan, jadi dicek ulang.
+	quietUntil := quietHoursEnd(now, schedule.QuietHours, UserLocation(user.Timezone))
+
+	var emails []models.Notification
+	delivered := 0
+	for _, n := range batch {
+		if n.Priority != "urgent" && quietUntil.After(now) {
+			nt.DB.Model(&models.Notification{}).Where("id = ? AND is_sent = ?", n.ID, false).Update("scheduled_for", quietUntil)
+			continue
+		}
+		if !nt.claim(n.ID, now) {
+			continue // Sudah dikirim oleh pekerja lain
+		}
+		delivered++
+		if !user.IsActive {
+			continue
+		}
+		switch n.DeliveryMethod {
+		case models.DeliveryEmail:
+			emails = append(emails, n)
+		case models.DeliveryPush:
+			// Belum ada penyedia push; klien mengambil notifikasi lewat API.
+		}
+	}
+
+	if len(emails) > 0 {
+		message := notificationEmail(emails)
+		message.To = user.Email
+		if err := nt.Email.Send(message); err != nil {
+			log.Printf("ERROR: Failed to email %d notification(s) to user %s: %v", len(emails), user.ID, err)
+		}
+	}
+	return delivered
+}
+
+func (nt *Notifier) claim(id uuid.UUID, now time.Time) bool {
+	result := nt.DB.Model(&models.Notification{}).Where("id = ? AND is_sent = ?", id, false).
+		Updates(map[string]interface{}{"is_sent": true, "sent_at": now})
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func (nt *Notifier) preferences(userID uuid.UUID) models.UserPreferences {
+	var prefs models.UserPreferences
+	if err := nt.DB.Where("user_id = ?", userID).First(&prefs).Error; err != nil {
+		return models.UserPreferences{
+			UserID: userID, NotificationChat: true, NotificationCommunity: true,
+			NotificationSchedule: models.DefaultNotificationSchedule(),
+		}
+	}
+	return prefs
+}
+
+// deferUntil moves at forward until it is outside quiet hours, at the next digest
+// (for low and normal priority when digests are on) and within the daily limit.
+func (nt *Notifier) deferUntil(userID uuid.UUID, at time.Time, priority string, s models.NotificationSchedule, loc *time.Location) time.Time {
+	digest := s.DigestFrequency != models.DigestOff && (priority == "low" || priority == "normal")
+	// Dibatasi seminggu ke depan agar batas harian tidak membuat perulangan tanpa akhir.
+	for i := 0; i < 7; i++ {
+		if digest {
+			at = nextDigest(at, s, loc)
+		}
+		at = quietHoursEnd(at, s.QuietHours, loc)
+		if digest || s.MaxPerDay == 0 || nt.countOnDay(userID, at, s, loc) < int64(s.MaxPerDay) {
+			return at
+		}
+		local := at.In(loc)
+		at = time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+	}
+	return at
+}
+
+// countOnDay counts the user's non-urgent notifications delivered or scheduled on
+// the local calendar day of at. Digested notifications do not count: while digests
+// are on, low and normal priority arrive in the digest, so only high counts.
+func (nt *Notifier) countOnDay(userID uuid.UUID, at time.Time, s models.NotificationSchedule, loc *time.Location) int64 {
+	local := at.In(loc)
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	dayEnd := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+
+	counted := []string{"low", "normal", "high"}
+	if s.DigestFrequency != models.DigestOff {
+		counted = []string{"high"}
+	}
+
+	var count int64
+	nt.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND priority IN ?", userID, counted).
+		Where("COALESCE(scheduled_for, created_at) >= ? AND COALESCE(scheduled_for, created_at) < ?", dayStart, dayEnd).
+		Count(&count)
+	return count
+}
+
+// --- helpers ---
+
+func notificationEnabled(notificationType string, prefs models.UserPreferences) bool {
+	if mandatoryNotificationTypes[notificationType] {
+		return true
+	}
+	switch notificationType {
+	case models.NotificationChatCheckin:
+		if !prefs.NotificationChat {
+			return false
+		}
+	case models.NotificationCommunityReply, models.NotificationCommunityReaction:
+		if !prefs.NotificationCommunity {
+			return false
+		}
+	}
+	channels, ok := prefs.NotificationSchedule.Channels[notificationType]
+	return !ok || len(channels) > 0
+}
+
+// preferredChannel keeps the sender's channel when the user accepts it for the type,
+// otherwise uses the user's first choice.
+func preferredChannel(notificationType, requested string, s models.NotificationSchedule) string {
+	if requested == "" {
+		requested = models.DeliveryPush
+	}
+	channels := s.Channels[notificationType]
+	if len(channels) == 0 {
+		return requested
+	}
+	for _, channel := range channels {
+		if channel == requested {
+			return channel
+		}
+	}
+	return channels[0]
+}
+
+// quietHoursEnd returns at unchanged when it is outside quiet hours, otherwise the
+// moment quiet hours end. A quiet period spanning a DST change still ends at the
+// configured local time.
+func quietHoursEnd(at time.Time, q models.QuietHours, loc *time.Location) time.Time {
+	if !q.Enabled {
+		return at
+	}
+	start, errStart := parseClock(q.Start)
+	end, errEnd := parseClock(q.End)
+	if errStart != nil || errEnd != nil || start == end {
+		return at
+	}
+
+	local := at.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	endDay := local.Day()
+	if start < end {
+		if minute < start || minute >= end {
+			return at
+		}
+	} else { // Melewati tengah malam, mis. 22:00–07:00
+		if minute < start && minute >= end {
+			return at
+		}
+		if minute >= start {
+			endDay++
+		}
+	}
+	return wallClock(local.Year(), local.Month(), endDay, end/60, end%60, loc)
+}
+
+// nextDigest returns the first digest slot at or after at.
+func nextDigest(at time.Time, s models.NotificationSchedule, loc *time.Location) time.Time {
+	clock, err := parseClock(s.DigestTime)
+	if err != nil {
+		return at
+	}
+	local := at.In(loc)
+	slot := wallClock(local.Year(), local.Month(), local.Day(), clock/60, clock%60, loc)
+	if slot.Before(at) {
+		slot = wallClock(local.Year(), local.Month(), local.Day()+1, clock/60, clock%60, loc)
+	}
+	if s.DigestFrequency == models.DigestWeekly {
+		for slot.Weekday() != time.Monday {
+			slot = wallClock(slot.Year(), slot.Month(), slot.Day()+1, clock/60, clock%60, loc)
+		}
+	}
+	return slot
+}
+
+// parseClock parses "HH:MM" into minutes since midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func isNotificationType(value string) bool {
+	for _, t := range models.NotificationTypes {
+		if t == value {
+			return true
+		}
+	}
+	return false
+}
+
+func notificationEmail(notifications []models.Notification) EmailMessage {
+	if len(notifications) == 1 {
+		n := notifications[0]
+		body := "Halo,\n\n" + n.Message
+		if n.ActionURL != nil && *n.ActionURL != "" {
+			body += "\n\n" + *n.ActionURL
+		}
+		return EmailMessage{Subject: n.Title, TextBody: body + "\n\nSalam hangat,\nTim Tenang.in 🌸"}
+	}
+
+	var body strings.Builder
+	body.WriteString("Halo,\n\nBerikut ringkasan notifikasi kamu di Tenang.in:\n")
+	for _, n := range notifications {
+		fmt.Fprintf(&body, "\n• %s\n  %s\n", n.Title, n.Message)
+	}
+	body.WriteString("\nSalam hangat,\nTim Tenang.in 🌸")
+	return EmailMessage{Subject: fmt.Sprintf("Ringkasan notifikasi Tenang.in (%d)", len(notifications)), TextBody: body.String()}
+}
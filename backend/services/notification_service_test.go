@@ -0,0 +1,146 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"backend/models"
+	"backend/testutil"
+
+	"github.com/google/uuid"
+)
+
+func TestQuietHoursEnd(t *testing.T) {
+	jakarta := mustLoadLocation(t, "Asia/Jakarta")
+	newYork := mustLoadLocation(t, "America/New_York")
+	overnight := models.QuietHours{Enabled: true, Start: "22:00", End: "07:00"}
+	afternoon := models.QuietHours{Enabled: true, Start: "13:00", End: "15:00"}
+
+	tests := []struct {
+		name  string
+		at    time.Time
+		quiet models.QuietHours
+		loc   *time.Location
+		want  time.Time
+	}{
+		{"before overnight quiet hours", time.Date(2026, 3, 10, 21, 59, 0, 0, jakarta), overnight, jakarta, time.Date(2026, 3, 10, 21, 59, 0, 0, jakarta)},
+		{"evening ends next morning", time.Date(2026, 3, 10, 23, 0, 0, 0, jakarta), overnight, jakarta, time.Date(2026, 3, 11, 7, 0, 0, 0, jakarta)},
+		{"starts exactly at start", time.Date(2026, 3, 10, 22, 0, 0, 0, jakarta), overnight, jakarta, time.Date(2026, 3, 11, 7, 0, 0, 0, jakarta)},
+		{"after midnight ends same morning", time.Date(2026, 3, 11, 3, 0, 0, 0, jakarta), overnight, jakarta, time.Date(2026, 3, 11, 7, 0, 0, 0, jakarta)},
+		{"end is outside quiet hours", time.Date(2026, 3, 11, 7, 0, 0, 0, jakarta), overnight, jakarta, time.Date(2026, 3, 11, 7, 0, 0, 0, jakarta)},
+		{"month boundary", time.Date(2026, 3, 31, 23, 30, 0, 0, jakarta), overnight, jakarta, time.Date(2026, 4, 1, 7, 0, 0, 0, jakarta)},
+		{"daytime range", time.Date(2026, 3, 10, 14, 0, 0, 0, jakarta), afternoon, jakarta, time.Date(2026, 3, 10, 15, 0, 0, 0, jakarta)},
+		{"outside daytime range", time.Date(2026, 3, 10, 23, 0, 0, 0, jakarta), afternoon, jakarta, time.Date(2026, 3, 10, 23, 0, 0, 0, jakarta)},
+		{"disabled", time.Date(2026, 3, 10, 23, 0, 0, 0, jakarta), models.QuietHours{Start: "22:00", End: "07:00"}, jakarta, time.Date(2026, 3, 10, 23, 0, 0, 0, jakarta)},
+		{"evaluated in the user's zone", time.Date(2026, 3, 10, 16, 0, 0, 0, time.UTC), overnight, jakarta, time.Date(2026, 3, 11, 7, 0, 0, 0, jakarta)}, // 23:00 WIB
+		{"night spanning spring-forward", time.Date(2026, 3, 7, 23, 0, 0, 0, newYork), overnight, newYork, time.Date(2026, 3, 8, 11, 0, 0, 0, time.UTC)}, // 07:00 EDT
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quietHoursEnd(tt.at, tt.quiet, tt.loc); !got.Equal(tt.want) {
+				t.Errorf("quietHoursEnd = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextDigest(t *testing.T) {
+	jakarta := mustLoadLocation(t, "Asia/Jakarta")
+	daily := models.NotificationSchedule{DigestFrequency: models.DigestDaily, DigestTime: "19:00"}
+	weekly := models.NotificationSchedule{DigestFrequency: models.DigestWeekly, DigestTime: "19:00"}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		schedule models.NotificationSchedule
+		want     time.Time
+	}{
+		{"daily later today", time.Date(2026, 3, 10, 9, 0, 0, 0, jakarta), daily, time.Date(2026, 3, 10, 19, 0, 0, 0, jakarta)},
+		{"daily at the slot", time.Date(2026, 3, 10, 19, 0, 0, 0, jakarta), daily, time.Date(2026, 3, 10, 19, 0, 0, 0, jakarta)},
+		{"daily after the slot", time.Date(2026, 3, 10, 19, 1, 0, 0, jakarta), daily, time.Date(2026, 3, 11, 19, 0, 0, 0, jakarta)},
+		{"weekly waits for Monday", time.Date(2026, 3, 10, 9, 0, 0, 0, jakarta), weekly, time.Date(2026, 3, 16, 19, 0, 0, 0, jakarta)},
+		{"weekly on Monday", time.Date(2026, 3, 16, 9, 0, 0, 0, jakarta), weekly, time.Date(2026, 3, 16, 19, 0, 0, 0, jakarta)},
+		{"weekly after Monday's slot", time.Date(2026, 3, 16, 20, 0, 0, 0, jakarta), weekly, time.Date(2026, 3, 23, 19, 0, 0, 0, jakarta)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextDigest(tt.at, tt.schedule, jakarta); !got.Equal(tt.want) {
+				t.Errorf("nextDigest = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeferUntilDigestAndQuietHours(t *testing.T) {
+	jakarta := mustLoadLocation(t, "Asia/Jakarta")
+	// Tanpa batas harian dan dengan ringkasan aktif, deferUntil tidak menyentuh basis data.
+	nt := &Notifier{}
+	at := time.Date(2026, 3, 10, 9, 0, 0, 0, jakarta)
+
+	digest := models.NotificationSchedule{
+		QuietHours:      models.QuietHours{Enabled: true, Start: "18:00", End: "20:00"},
+		MaxPerDay:       1,
+		DigestFrequency: models.DigestDaily,
+		DigestTime:      "19:00",
+	}
+	if got, want := nt.deferUntil(uuid.New(), at, "normal", digest, jakarta), time.Date(2026, 3, 10, 20, 0, 0, 0, jakarta); !got.Equal(want) {
+		t.Errorf("digest slot inside quiet hours = %v, want %v", got, want)
+	}
+	if got, want := nt.deferUntil(uuid.New(), at, "low", digest, jakarta), time.Date(2026, 3, 10, 20, 0, 0, 0, jakarta); !got.Equal(want) {
+		t.Errorf("low priority = %v, want digest at %v", got, want)
+	}
+
+	quietOnly := models.NotificationSchedule{QuietHours: models.QuietHours{Enabled: true, Start: "22:00", End: "07:00"}, DigestFrequency: models.DigestOff, DigestTime: "19:00"}
+	night := time.Date(2026, 3, 10, 23, 0, 0, 0, jakarta)
+	if got, want := nt.deferUntil(uuid.New(), night, "normal", quietOnly, jakarta), time.Date(2026, 3, 11, 7, 0, 0, 0, jakarta); !got.Equal(want) {
+		t.Errorf("quiet hours = %v, want %v", got, want)
+	}
+	if got := nt.deferUntil(uuid.New(), at, "normal", quietOnly, jakarta); !got.Equal(at) {
+		t.Errorf("outside quiet hours = %v, want unchanged %v", got, at)
+	}
+}
+
+func TestDeferUntilDailyCap(t *testing.T) {
+	db := testutil.OpenDB(t)
+	jakarta := mustLoadLocation(t, "Asia/Jakarta")
+	nt := &Notifier{DB: db}
+
+	user := models.User{ID: uuid.New(), Email: "rani@example.com", IsActive: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	schedule := func(digest string) models.NotificationSchedule {
+		return models.NotificationSchedule{MaxPerDay: 2, DigestFrequency: digest, DigestTime: "19:00"}
+	}
+	add := func(priority string, hour int) {
+		at := time.Date(2026, 3, 10, hour, 0, 0, 0, jakarta)
+		n := models.Notification{UserID: user.ID, NotificationType: models.NotificationWellnessReminder, Title: "t", Message: "m", Priority: priority, ScheduledFor: &at}
+		if err := db.Create(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	at := time.Date(2026, 3, 10, 10, 0, 0, 0, jakarta)
+	nextDay := time.Date(2026, 3, 11, 0, 0, 0, 0, jakarta)
+
+	add("urgent", 8)
+	add("urgent", 9)
+	add("normal", 9)
+	if got := nt.deferUntil(user.ID, at, "high", schedule(models.DigestOff), jakarta); !got.Equal(at) {
+		t.Errorf("one counted notification = %v, want unchanged; urgent must not count", got)
+	}
+
+	add("normal", 12)
+	if got := nt.deferUntil(user.ID, at, "high", schedule(models.DigestOff), jakarta); !got.Equal(nextDay) {
+		t.Errorf("cap reached = %v, want next day %v", got, nextDay)
+	}
+	// Dengan ringkasan aktif, notifikasi normal masuk ringkasan dan tidak menghabiskan batas.
+	if got := nt.deferUntil(user.ID, at, "high", schedule(models.DigestDaily), jakarta); !got.Equal(at) {
+		t.Errorf("digested notifications counted: %v, want unchanged", got)
+	}
+
+	add("high", 8)
+	add("high", 15)
+	if got := nt.deferUntil(user.ID, at, "high", schedule(models.DigestDaily), jakarta); !got.Equal(nextDay) {
+		t.Errorf("cap reached with digests = %v, want next day %v", got, nextDay)
+	}
+}
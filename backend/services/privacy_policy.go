@@ -0,0 +1,189 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PrivacyPolicy is what a privacy level allows the platform to keep or do with a user's data.
+type PrivacyPolicy struct {
+	Level                 string        `json:"level"`
+	ChatRetention         time.Duration `json:"-"`                   // 0 berarti percakapan disimpan sampai dihapus pengguna
+	ChatRetentionDays     int           `json:"chat_retention_days"` // Untuk klien; 0 berarti tanpa batas
+	KeepVocalAudio        bool          `json:"keep_vocal_audio"`    // false: rekaman dihapus setelah ditranskripsi
+	LinkAnalytics         bool          `json:"link_analytics"`      // Event analitik boleh dikaitkan ke pengguna
+	AllowSocialMonitoring bool          `json:"allow_social_monitoring"`
+	MinorSafe             bool          `json:"minor_safe"` // Mode aman anak: berlaku di atas tingkat privasi apa pun
+}
+
+// PrivacyPolicyFor returns the policy for a privacy level. Unknown levels get the
+// most restrictive policy rather than the most permissive one.
+func PrivacyPolicyFor(level string, cfg *config.Config) PrivacyPolicy {
+	switch level {
+	case models.PrivacyFull:
+		return PrivacyPolicy{Level: level, KeepVocalAudio: true, LinkAnalytics: true, AllowSocialMonitoring: true}
+	case models.PrivacyStandard:
+		return PrivacyPolicy{Level: level, KeepVocalAudio: true, AllowSocialMonitoring: true}
+	default:
+		retention := cfg.Security.MinimalChatRetention
+		return PrivacyPolicy{
+			Level:             models.PrivacyMinimal,
+			ChatRetention:     retention,
+			ChatRetentionDays: int(retention.Hours() / 24),
+		}
+	}
+}
+
+// PolicyForUser returns the policy for the user's privacy level, tightened by
+// minor-safe mode when the user is under SecurityConfig.MinorSafeAge.
+func PolicyForUser(user models.User, cfg *config.Config) PrivacyPolicy {
+	policy := PrivacyPolicyFor(user.PrivacyLevel, cfg)
+	if IsMinor(user, cfg) {
+		policy.MinorSafe = true
+		policy.AllowSocialMonitoring = false
+	}
+	return policy
+}
+
+// PrivacyEnforcer applies privacy policies to data that already exists: once when a
+// user changes level, and periodically so chat history expires on schedule.
+type PrivacyEnforcer struct {
+	DB  *gorm.DB
+	Cfg *config.Config
+}
+
+// NewPrivacyEnforcer creates a new PrivacyEnforcer.
+func NewPrivacyEnforcer(db *gorm.DB, cfg *config.Config) *PrivacyEnforcer {
+	return &PrivacyEnforcer{DB: db, Cfg: cfg}
+}
+
+// StartRetentionSweeper periodically enforces every level's policy across all users.
+func (p *PrivacyEnforcer) StartRetentionSweeper(every time.Duration) {
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for range ticker.C {
+			p.sweep()
+		}
+	}()
+}
+
+// ApplyLevelChange retroactively applies the user's new privacy level to their
+// existing data and records the outcome in the audit log. Runs in the background.
+func (p *PrivacyEnforcer) ApplyLevelChange(userID uuid.UUID, oldLevel, newLevel string) {
+	go func() {
+		var user models.User
+		if err := p.DB.First(&user, "id = ?", userID).Error; err != nil {
+			log.Printf("ERROR: Failed to load user %s to apply privacy level: %v", userID, err)
+			return
+		}
+		summary, err := p.apply(PolicyForUser(user, p.Cfg), p.DB.Model(&models.User{}).Select("id").Where("id = ?", userID))
+		if err != nil {
+			log.Printf("ERROR: Failed to apply privacy level %s to user %s: %v", newLevel, userID, err)
+		}
+		RecordAudit(p.DB, AuditEntry{
+			UserID: &userID, Action: "privacy_level_applied", TableName: "users", RecordID: &userID,
+			OldValues: map[string]interface{}{"privacy_level": oldLevel},
+			NewValues: map[string]interface{}{"privacy_level": newLevel, "summary": summary, "completed": err == nil},
+		})
+	}()
+}
+
+func (p *PrivacyEnforcer) sweep() {
+	for _, level := range []string{models.PrivacyMinimal, models.PrivacyStandard, models.PrivacyFull} {
+		users := p.DB.Model(&models.User{}).Select("id").Where("privacy_level = ?", level)
+		summary, err := p.apply(PrivacyPolicyFor(level, p.Cfg), users)
+		if err != nil {
+			log.Printf("ERROR: Privacy sweep for level %s failed: %v", level, err)
+			continue
+		}
+		for _, n := range summary {
+			if n > 0 {
+				log.Printf("INFO: Privacy sweep for level %s: %v", level, summary)
+				break
+			}
+		}
+	}
+
+	// Pengguna di bawah umur tidak boleh dipantau media sosialnya, apa pun tingkat privasinya.
+	minors := p.DB.Model(&models.User{}).Select("id").Where("date_of_birth >= ? OR date_of_birth IS NULL", MinorBirthCutoff(p.Cfg))
+	summary, err := p.apply(PrivacyPolicy{Level: "minor_safe", KeepVocalAudio: true, LinkAnalytics: true}, minors)
+	if err != nil {
+		log.Printf("ERROR: Privacy sweep for minor-safe mode failed: %v", err)
+	} else if summary["social_monitoring_disabled"] > 0 {
+		log.Printf("INFO: Privacy sweep for minor-safe mode: %v", summary)
+	}
+}
+
+// apply enforces policy for the users selected by the users subquery. Every step is
+// idempotent, so a sweep can safely repeat work a level change already did.
+func (p *PrivacyEnforcer) apply(policy PrivacyPolicy, users *gorm.DB) (map[string]int64, error) {
+	summary := map[string]int64{}
+
+	if policy.ChatRetention > 0 {
+		cutoff := time.Now().Add(-policy.ChatRetention)
+		sessions := p.DB.Model(&models.ChatSession{}).Select("id").Where("user_id IN (?)", users)
+		result := p.DB.Where("chat_session_id IN (?) AND created_at < ?", sessions, cutoff).Delete(&models.ChatMessage{})
+		if result.Error != nil {
+			return summary, fmt.Errorf("chat_messages: %w", result.Error)
+		}
+		summary["chat_messages_expired"] = result.RowsAffected
+
+		// Sesi lama yang sudah kosong ikut dihapus; sesi yang masih aktif dipertahankan.
+		result = p.DB.Where("user_id IN (?) AND started_at < ?", users, cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM chat_messages WHERE chat_messages.chat_session_id = chat_sessions.id)").
+			Delete(&models.ChatSession{})
+		if result.Error != nil {
+			return summary, fmt.Errorf("chat_sessions: %w", result.Error)
+		}
+		summary["chat_sessions_expired"] = result.RowsAffected
+	}
+
+	if !policy.KeepVocalAudio {
+		var entries []models.VocalJournalEntry
+		err := p.DB.Select("id", "audio_file_path").
+			Where("user_id IN (?) AND audio_file_path <> ''", users).
+			Where("EXISTS (SELECT 1 FROM vocal_transcriptions WHERE vocal_transcriptions.vocal_entry_id = vocal_journal_entries.id)").
+			Find(&entries).Error
+		if err != nil {
+			return summary, fmt.Errorf("vocal_entries: %w", err)
+		}
+		for _, entry := range entries {
+			if err := os.Remove(entry.AudioFilePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("WARNING: Failed to delete audio file %s: %v", entry.AudioFilePath, err)
+				continue
+			}
+			p.DB.Model(&models.VocalJournalEntry{}).Where("id = ?", entry.ID).Update("audio_file_path", "")
+			summary["vocal_audio_deleted"]++
+		}
+	}
+
+	if !policy.LinkAnalytics {
+		result := p.DB.Model(&models.SystemAnalytics{}).Where("user_id IN (?)", users).Update("user_id", nil)
+		if result.Error != nil {
+			return summary, fmt.Errorf("system_analytics: %w", result.Error)
+		}
+		summary["analytics_unlinked"] = result.RowsAffected
+	}
+
+	if !policy.AllowSocialMonitoring {
+		result := p.DB.Model(&models.SocialMediaAccount{}).Where("user_id IN (?) AND monitoring_enabled = ?", users, true).
+			Update("monitoring_enabled", false)
+		if result.Error != nil {
+			return summary, fmt.Errorf("social_media_accounts: %w", result.Error)
+		}
+		summary["social_monitoring_disabled"] = result.RowsAffected
+		p.DB.Model(&models.UserPreferences{}).Where("user_id IN (?) AND social_media_monitoring = ?", users, true).
+			Update("social_media_monitoring", false)
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,484 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SentimentResult is the analysis of one message: Score runs from -1 (very negative)
+// to 1 (very positive) and Emotion is one of models.Emotions.
+type SentimentResult struct {
+	Score   float64
+	Emotion string
+}
+
+// SentimentAnalyzer scores the sentiment and primary emotion of a message.
+type SentimentAnalyzer interface {
+	Name() string
+	Analyze(ctx context.Context, text string) (SentimentResult, error)
+}
+
+// --- Lexicon (default) ---
+
+// sentimentWords memberi bobot -1..1 pada kata bahasa Indonesia dan Inggris. Kata dicari
+// apa adanya, lalu tanpa akhiran -nya/-ku/-mu/-lah/-kah ("sedihnya" → "sedih").
+var sentimentWords = map[string]float64{
+	// Indonesia, positif
+	"senang": 0.7, "bahagia": 0.8, "gembira": 0.8, "lega": 0.6, "tenang": 0.5, "syukur": 0.7, "bersyukur": 0.7,
+	"bangga": 0.6, "semangat": 0.6, "baik": 0.4, "membaik": 0.5, "nyaman": 0.5, "suka": 0.4, "seru": 0.5,
+	"puas": 0.5, "damai": 0.6, "berhasil": 0.6, "makasih": 0.5, "terima": 0.1, "kasih": 0.3, "asik": 0.5, "mantap": 0.5,
+	"harapan": 0.4, "optimis": 0.6, "sayang": 0.5, "cinta": 0.5, "hangat": 0.4,
+	// Indonesia, negatif
+	"sedih": -0.7, "kecewa": -0.6, "marah": -0.7, "kesal": -0.6, "benci": -0.8, "takut": -0.6, "cemas": -0.6,
+	"khawatir": -0.5, "gelisah": -0.5, "panik": -0.7, "stres": -0.6, "stress": -0.6, "depresi": -0.8,
+	"kesepian": -0.7, "sendirian": -0.5, "hampa": -0.6, "kosong": -0.4, "lelah": -0.5, "capek": -0.5, "cape": -0.5,
+	"putus": -0.3, "asa": -0.3, "hancur": -0.8, "sakit": -0.5, "nangis": -0.6, "menangis": -0.6, "galau": -0.5,
+	"buruk": -0.6, "jelek": -0.4, "gagal": -0.6, "malu": -0.4, "bersalah": -0.5, "terpuruk": -0.8, "frustasi": -0.7,
+	"bingung": -0.3, "tertekan": -0.7, "overthinking": -0.5, "insecure": -0.5, "muak": -0.7, "jengkel": -0.6,
+	// English, positive
+	"happy": 0.7, "glad": 0.6, "joy": 0.8, "great": 0.6, "good": 0.4, "better": 0.4, "calm": 0.5, "relieved": 0.6,
+	"grateful": 0.7, "thankful": 0.7, "thanks": 0.5, "proud": 0.6, "excited": 0.7, "love": 0.5, "hopeful": 0.6,
+	"peaceful": 0.6, "okay": 0.2, "fine": 0.2, "nice": 0.4, "awesome": 0.7,
+	// English, negative
+	"sad": -0.7, "unhappy": -0.6, "angry": -0.7, "mad": -0.6, "hate": -0.8, "afraid": -0.6, "scared": -0.6,
+	"anxious": -0.6, "worried": -0.5, "nervous": -0.5, "panic": -0.7, "stressed": -0.6, "depressed": -0.8,
+	"lonely": -0.7, "alone": -0.4, "empty": -0.5, "tired": -0.4, "exhausted": -0.6, "hopeless": -0.8,
+	"hurt": -0.5, "crying": -0.6, "cry": -0.5, "bad": -0.5, "awful": -0.7, "terrible": -0.7, "failed": -0.6,
+	"ashamed": -0.6, "guilty": -0.5, "overwhelmed": -0.6, "frustrated": -0.6, "upset": -0.6, "miserable": -0.8,
+}
+
+// emotionWords memetakan kata ke emosi utamanya.
+var emotionWords = map[string]string{
+	"senang": models.EmotionJoy, "bahagia": models.EmotionJoy, "gembira": models.EmotionJoy, "seru": models.EmotionJoy,
+	"semangat": models.EmotionJoy, "bangga": models.EmotionJoy, "happy": models.EmotionJoy, "glad": models.EmotionJoy,
+	"excited": models.EmotionJoy, "proud": models.EmotionJoy, "joy": models.EmotionJoy,
+	"syukur": models.EmotionGratitude, "bersyukur": models.EmotionGratitude, "makasih": models.EmotionGratitude,
+	"grateful": models.EmotionGratitude, "thankful": models.EmotionGratitude, "thanks": models.EmotionGratitude,
+	"sedih": models.EmotionSadness, "kecewa": models.EmotionSadness, "nangis": models.EmotionSadness, "menangis": models.EmotionSadness,
+	"hancur": models.EmotionSadness, "galau": models.EmotionSadness, "terpuruk": models.EmotionSadness, "depresi": models.EmotionSadness,
+	"sad": models.EmotionSadness, "unhappy": models.EmotionSadness, "crying": models.EmotionSadness, "cry": models.EmotionSadness,
+	"depressed": models.EmotionSadness, "miserable": models.EmotionSadness, "hopeless": models.EmotionSadness,
+	"kesepian": models.EmotionLoneliness, "sendirian": models.EmotionLoneliness, "hampa": models.EmotionLoneliness,
+	"lonely": models.EmotionLoneliness, "alone": models.EmotionLoneliness, "empty": models.EmotionLoneliness,
+	"cemas": models.EmotionAnxiety, "khawatir": models.EmotionAnxiety, "gelisah": models.EmotionAnxiety, "stres": models.EmotionAnxiety,
+	"stress": models.EmotionAnxiety, "overthinking": models.EmotionAnxiety, "tertekan": models.EmotionAnxiety, "insecure": models.EmotionAnxiety,
+	"anxious": models.EmotionAnxiety, "worried": models.EmotionAnxiety, "nervous": models.EmotionAnxiety, "stressed": models.EmotionAnxiety,
+	"overwhelmed": models.EmotionAnxiety, "takut": models.EmotionFear, "panik": models.EmotionFear, "afraid": models.EmotionFear, "scared": models.EmotionFear, "panic": models.EmotionFear,
+	"marah": models.EmotionAnger, "kesal": models.EmotionAnger, "benci": models.EmotionAnger, "muak": models.EmotionAnger,
+	"jengkel": models.EmotionAnger, "frustasi": models.EmotionAnger, "angry": models.EmotionAnger, "mad": models.EmotionAnger,
+	"hate": models.EmotionAnger, "frustrated": models.EmotionAnger, "upset": models.EmotionAnger,
+}
+
+var (
+	sentimentNegators     = map[string]bool{"tidak": true, "tak": true, "nggak": true, "gak": true, "ga": true, "enggak": true, "bukan": true, "belum": true, "kurang": true, "not": true, "never": true, "dont": true, "didnt": true, "isnt": true, "wasnt": true, "no": true}
+	sentimentIntensifiers = map[string]bool{"sangat": true, "banget": true, "bgt": true, "sekali": true, "amat": true, "terlalu": true, "very": true, "so": true, "really": true, "extremely": true, "too": true}
+	sentimentSuffixes     = []string{"nya", "ku", "mu", "lah", "kah"}
+)
+
+// LexiconSentimentAnalyzer is the default analyser: local, deterministic, and never
+// sends message content anywhere.
+type LexiconSentimentAnalyzer struct{}
+
+func (LexiconSentimentAnalyzer) Name() string { return "lexicon" }
+
+// Analyze never fails.
+func (LexiconSentimentAnalyzer) Analyze(_ context.Context, text string) (SentimentResult, error) {
+	words := strings.Fields(normalizeCrisisText(text))
+	total := 0.0
+	emotions := map[string]float64{}
+	for i, word := range words {
+		word = sentimentLookup(word)
+		weight, ok := sentimentWords[word]
+		if !ok {
+			continue
+		}
+		// "tidak senang" membalik arah; "sedih banget" / "very sad" memperkuat.
+		if i > 0 && sentimentNegators[words[i-1]] {
+			weight = -weight * 0.7
+		} else if (i > 0 && sentimentIntensifiers[words[i-1]]) || (i+1 < len(words) && sentimentIntensifiers[words[i+1]]) {
+			weight *= 1.5
+		}
+		total += weight
+		if emotion, ok := emotionWords[word]; ok && weight*sentimentWords[word] > 0 {
+			emotions[emotion] += math.Abs(weight)
+		}
+	}
+
+	// Normalisasi ala VADER agar skor tetap di -1..1 berapa pun panjang pesannya.
+	score := total / math.Sqrt(total*total+4)
+	return SentimentResult{Score: roundSentiment(score), Emotion: primaryEmotion(emotions, score)}, nil
+}
+
+func sentimentLookup(word string) string {
+	if _, ok := sentimentWords[word]; ok {
+		return word
+	}
+	for _, suffix := range sentimentSuffixes {
+		if stem := strings.TrimSuffix(word, suffix); stem != word {
+			if _, ok := sentimentWords[stem]; ok {
+				return stem
+			}
+		}
+	}
+	return word
+}
+
+func primaryEmotion(emotions map[string]float64, score float64) string {
+	best, bestWeight := "", 0.0
+	for _, emotion := range models.Emotions { // Urutan tetap agar hasil seri selalu sama
+		if emotions[emotion] > bestWeight {
+			best, bestWeight = emotion, emotions[emotion]
+		}
+	}
+	switch {
+	case best != "":
+		return best
+	case score >= 0.3:
+		return models.EmotionJoy
+	case score <= -0.3:
+		return models.EmotionSadness
+	default:
+		return models.EmotionNeutral
+	}
+}
+
+// roundSentiment clamps to -1..1 and rounds to the two decimals of sentiment_score.
+func roundSentiment(score float64) float64 {
+	return math.Round(math.Max(-1, math.Min(1, score))*100) / 100
+}
+
+func validEmotion(emotion string) bool {
+	for _, e := range models.Emotions {
+		if e == emotion {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Language model ---
+
+// LLMSentimentAnalyzer asks the configured language model (LLM_MODEL_SENTIMENT).
+type LLMSentimentAnalyzer struct {
+	LLM *LLMService
+}
+
+func (LLMSentimentAnalyzer) Name() string { return "llm" }
+
+// Analyze returns an error for out-of-range answers so the lexicon is used instead.
+func (a LLMSentimentAnalyzer) Analyze(ctx context.Context, text string) (SentimentResult, error) {
+	var result struct {
+		Score   float64 `json:"score"`
+		Emotion string  `json:"emotion"`
+	}
+	prompt := `Analyse the sentiment and primary emotion of the user's message (Indonesian or English, possibly slang). Reply with a JSON object only: {"score": number from -1 (very negative) to 1 (very positive), "emotion": one of "` +
+		strings.Join(models.Emotions, `", "`) + `"}.`
+	_, err := a.LLM.CompleteJSON(ctx, LLMRequest{
+		Feature: LLMFeatureSentiment,
+		Messages: []LLMMessage{
+			{Role: LLMRoleSystem, Content: prompt},
+			{Role: LLMRoleUser, Content: text},
+		},
+		MaxTokens: 40,
+	}, &result)
+	if err != nil {
+		return SentimentResult{}, err
+	}
+	if result.Score < -1 || result.Score > 1 || !validEmotion(result.Emotion) {
+		return SentimentResult{}, fmt.Errorf("sentiment model returned score %v, emotion %q", result.Score, result.Emotion)
+	}
+	return SentimentResult{Score: roundSentiment(result.Score), Emotion: result.Emotion}, nil
+}
+
+// --- Azure Text Analytics ---
+
+// AzureSentimentAnalyzer uses Azure Text Analytics for the score. Azure does not detect
+// emotions, so the emotion still comes from the lexicon.
+type AzureSentimentAnalyzer struct {
+	Endpoint   string
+	Key        string
+	HTTPClient *http.Client
+}
+
+func (AzureSentimentAnalyzer) Name() string { return "azure" }
+
+// Kata fungsi yang sering muncul, untuk menebak bahasa pesan. Azure v3.1 menganggap
+// dokumen tanpa "language" sebagai bahasa Inggris, jadi bahasanya harus dikirim.
+var (
+	indonesianFunctionWords = map[string]bool{"aku": true, "saya": true, "gue": true, "gw": true, "kamu": true, "yang": true, "dan": true, "di": true, "ke": true, "dari": true, "ini": true, "itu": true, "tidak": true, "nggak": true, "gak": true, "ga": true, "udah": true, "sudah": true, "lagi": true, "aja": true, "banget": true, "mau": true, "sama": true, "karena": true, "tapi": true, "jadi": true}
+	englishFunctionWords    = map[string]bool{"i": true, "im": true, "me": true, "my": true, "you": true, "the": true, "and": true, "is": true, "am": true, "are": true, "was": true, "to": true, "of": true, "it": true, "this": true, "that": true, "not": true, "dont": true, "feel": true, "have": true, "but": true, "because": true, "so": true, "with": true}
+)
+
+// sentimentLanguage guesses whether text is English or Indonesian ("en" or "id").
+// Mixed or unclear messages count as Indonesian, the platform's main language.
+func sentimentLanguage(text string) string {
+	indonesian, english := 0, 0
+	for _, word := range strings.Fields(normalizeCrisisText(text)) {
+		if indonesianFunctionWords[word] {
+			indonesian++
+		}
+		if englishFunctionWords[word] {
+			english++
+		}
+	}
+	if english > indonesian {
+		return "en"
+	}
+	return "id"
+}
+
+func (a AzureSentimentAnalyzer) Analyze(ctx context.Context, text string) (SentimentResult, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"documents": []map[string]string{{"id": "1", "language": sentimentLanguage(text), "text": text}},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(a.Endpoint, "/")+"/text/analytics/v3.1/sentiment", bytes.NewReader(body))
+	if err != nil {
+		return SentimentResult{}, err
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", a.Key)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return SentimentResult{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return SentimentResult{}, fmt.Errorf("Azure Text Analytics error: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Documents []struct {
+			ConfidenceScores struct {
+				Positive float64 `json:"positive"`
+				Negative float64 `json:"negative"`
+			} `json:"confidenceScores"`
+		} `json:"documents"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return SentimentResult{}, err
+	}
+	if len(result.Documents) == 0 {
+		return SentimentResult{}, fmt.Errorf("Azure Text Analytics returned no documents")
+	}
+
+	lexicon, _ := LexiconSentimentAnalyzer{}.Analyze(ctx, text)
+	scores := result.Documents[0].ConfidenceScores
+	return SentimentResult{Score: roundSentiment(scores.Positive - scores.Negative), Emotion: lexicon.Emotion}, nil
+}
+
+// --- Background tagging ---
+
+// sentimentTimeout membatasi satu analisis oleh layanan eksternal.
+const sentimentTimeout = 10 * time.Second
+
+type sentimentJob struct {
+	MessageID uuid.UUID
+	UserID    uuid.UUID
+	Timezone  string
+	Text      string
+	CreatedAt time.Time
+}
+
+// SentimentTagger analyses user chat messages in the background, stores the result on
+// the message and keeps the user's daily chat_mood progress metric up to date.
+type SentimentTagger struct {
+	DB       *gorm.DB
+	Cfg      *config.Config
+	Analyzer SentimentAnalyzer
+	Fallback SentimentAnalyzer // Dipakai bila Analyzer gagal, agar setiap pesan tetap ditandai
+
+	jobs chan sentimentJob
+
+	mu     sync.Mutex
+	queued map[uuid.UUID]struct{} // Pesan yang sedang antre atau diproses; sweep tidak mengantrekannya lagi
+}
+
+// NewSentimentTagger creates a tagger with the analyser selected by SENTIMENT_ANALYZER.
+func NewSentimentTagger(db *gorm.DB, cfg *config.Config, llm *LLMService) *SentimentTagger {
+	t := &SentimentTagger{DB: db, Cfg: cfg, Analyzer: LexiconSentimentAnalyzer{}, Fallback: LexiconSentimentAnalyzer{}, jobs: make(chan sentimentJob, 1000), queued: make(map[uuid.UUID]struct{})}
+	switch cfg.Sentiment.Analyzer {
+	case "llm":
+		if llm.Configured(LLMFeatureSentiment) {
+			t.Analyzer = LLMSentimentAnalyzer{LLM: llm}
+		} else {
+			log.Println("WARNING: SENTIMENT_ANALYZER=llm but no model is configured; using the lexicon.")
+		}
+	case "azure":
+		t.Analyzer = AzureSentimentAnalyzer{Endpoint: cfg.Azure.TextAnalyticsEndpoint, Key: cfg.Azure.TextAnalyticsKey, HTTPClient: &http.Client{Timeout: sentimentTimeout}}
+	}
+	return t
+}
+
+// Start runs SENTIMENT_WORKERS workers, plus a periodic sweep that tags messages missed
+// because the queue was full or the server restarted.
+func (t *SentimentTagger) Start(sweepEvery time.Duration) {
+	for i := 0; i < t.Cfg.Sentiment.Workers; i++ {
+		go func() {
+			for job := range t.jobs {
+				t.process(job)
+				t.release(job.MessageID)
+			}
+		}()
+	}
+	go func() {
+		ticker := time.NewTicker(sweepEvery)
+		defer ticker.Stop()
+		for range ticker.C {
+			t.sweep()
+		}
+	}()
+}
+
+// Enqueue schedules a saved user message for analysis without blocking the request.
+// A message that is already queued or being analysed is skipped, so the sweep does
+// not pay for a second analysis of it.
+func (t *SentimentTagger) Enqueue(message models.ChatMessage, user models.User) {
+	if message.SenderType != "user" || !t.reserve(message.ID) {
+		return
+	}
+	job := sentimentJob{MessageID: message.ID, UserID: user.ID, Timezone: user.Timezone, Text: message.MessageContent, CreatedAt: message.CreatedAt}
+	select {
+	case t.jobs <- job:
+	default:
+		t.release(message.ID)
+		log.Printf("WARNING: Sentiment queue is full; message %s will be tagged by the next sweep", message.ID)
+	}
+}
+
+// reserve marks a message as queued and reports whether it was not queued already.
+func (t *SentimentTagger) reserve(messageID uuid.UUID) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.queued[messageID]; ok {
+		return false
+	}
+	if t.queued == nil {
+		t.queued = make(map[uuid.UUID]struct{})
+	}
+	t.queued[messageID] = struct{}{}
+	return true
+}
+
+func (t *SentimentTagger) release(messageID uuid.UUID) {
+	t.mu.Lock()
+	delete(t.queued, messageID)
+	t.mu.Unlock()
+}
+
+// sweep enqueues recent user messages that still have no sentiment. Messages still
+// in the queue are skipped by Enqueue.
+func (t *SentimentTagger) sweep() {
+	var pending []models.ChatMessage
+	err := t.DB.Preload("ChatSession.User").
+		Where("sender_type = ? AND sentiment_score IS NULL AND created_at > ?", "user", time.Now().Add(-24*time.Hour)).
+		Order("created_at").Limit(200).Find(&pending).Error
+	if err != nil {
+		log.Printf("ERROR: Sentiment sweep failed: %v", err)
+		return
+	}
+	for _, message := range pending {
+		if message.ChatSession != nil && message.ChatSession.User != nil {
+			t.Enqueue(message, *message.ChatSession.User)
+		}
+	}
+}
+
+func (t *SentimentTagger) process(job sentimentJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), sentimentTimeout)
+	defer cancel()
+	result, err := t.Analyzer.Analyze(ctx, job.Text)
+	if err != nil {
+		log.Printf("WARNING: %s sentiment analysis failed for message %s, using %s: %v", t.Analyzer.Name(), job.MessageID, t.Fallback.Name(), err)
+		result, _ = t.Fallback.Analyze(ctx, job.Text)
+	}
+
+	// UpdateColumns melewati hook enkripsi ChatMessage; isi pesan tidak disentuh.
+	update := t.DB.Model(&models.ChatMessage{}).Where("id = ? AND sentiment_score IS NULL", job.MessageID).
+		UpdateColumns(map[string]interface{}{"sentiment_score": result.Score, "emotion_detected": result.Emotion})
+	if update.Error != nil {
+		log.Printf("ERROR: Failed to store sentiment for message %s: %v", job.MessageID, update.Error)
+		return
+	}
+	if update.RowsAffected == 0 {
+		return // Sudah ditandai (mis. oleh sweep) atau pesannya sudah dihapus
+	}
+	if err := t.updateMoodMetric(job.UserID, job.Timezone, job.CreatedAt); err != nil {
+		log.Printf("ERROR: Failed to update chat mood metric for user %s: %v", job.UserID, err)
+	}
+}
+
+// moodDayStart returns the start of the day containing at in the user's time zone.
+func moodDayStart(at time.Time, timezone string) time.Time {
+	loc := UserLocation(timezone)
+	local := at.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
+
+// updateMoodMetric recomputes the user's chat_mood metric for the local day of at.
+func (t *SentimentTagger) updateMoodMetric(userID uuid.UUID, timezone string, at time.Time) error {
+	dayStart := moodDayStart(at, timezone)
+	loc := dayStart.Location()
+	day := dayStart.Format("2006-01-02")
+
+	return t.DB.Transaction(func(tx *gorm.DB) error {
+		// Kunci baris pengguna agar dua worker tidak sama-sama membuat metrik hari yang sama.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		var rows []struct {
+			SentimentScore  float64
+			EmotionDetected *string
+		}
+		err := tx.Model(&models.ChatMessage{}).
+			Select("chat_messages.sentiment_score, chat_messages.emotion_detected").
+			Joins("JOIN chat_sessions ON chat_sessions.id = chat_messages.chat_session_id").
+			Where("chat_sessions.user_id = ? AND chat_messages.sender_type = ? AND chat_messages.sentiment_score IS NOT NULL", userID, "user").
+			Where("chat_messages.created_at >= ? AND chat_messages.created_at < ?", dayStart, dayStart.AddDate(0, 0, 1)).
+			Scan(&rows).Error
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+
+		sum, low, high := 0.0, 1.0, -1.0
+		emotions := map[string]int{}
+		for _, row := range rows {
+			sum += row.SentimentScore
+			low, high = math.Min(low, row.SentimentScore), math.Max(high, row.SentimentScore)
+			if row.EmotionDetected != nil {
+				emotions[*row.EmotionDetected]++
+			}
+		}
+		calculation, _ := json.Marshal(map[string]interface{}{
+			"messages": len(rows), "min": low, "max": high, "emotions": emotions, "timezone": loc.String(),
+		})
+
+		var metric models.UserProgressMetric
+		err = tx.Where("user_id = ? AND metric_type = ? AND metric_date = ?", userID, models.MetricChatMood, day).First(&metric).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		metric.UserID, metric.MetricType = userID, models.MetricChatMood
+		metric.MetricDate = time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day(), 0, 0, 0, 0, time.UTC)
+		metric.MetricValue = roundSentiment(sum / float64(len(rows)))
+		metric.CalculationData = string(calculation)
+		return tx.Save(&metric).Error
+	})
+}
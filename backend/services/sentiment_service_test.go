@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/models"
+	"backend/testutil"
+
+	"github.com/google/uuid"
+)
+
+func lexiconScore(t *testing.T, text string) SentimentResult {
+	t.Helper()
+	result, err := LexiconSentimentAnalyzer{}.Analyze(context.Background(), text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestLexiconSentimentNegation(t *testing.T) {
+	tests := []struct {
+		positive, negated string
+	}{
+		{"aku senang hari ini", "aku tidak senang hari ini"},
+		{"I am happy", "I am not happy"},
+	}
+	for _, tt := range tests {
+		plain, negated := lexiconScore(t, tt.positive), lexiconScore(t, tt.negated)
+		if plain.Score <= 0 || negated.Score >= 0 {
+			t.Errorf("%q = %v, %q = %v; want negation to flip the sign", tt.positive, plain.Score, tt.negated, negated.Score)
+		}
+		if negated.Emotion == models.EmotionJoy {
+			t.Errorf("%q tagged as %s", tt.negated, negated.Emotion)
+		}
+	}
+
+	if got := lexiconScore(t, "aku nggak sedih kok"); got.Score <= 0 || got.Emotion == models.EmotionSadness {
+		t.Errorf("negated sadness = %+v, want a positive score without sadness", got)
+	}
+}
+
+func TestLexiconSentimentIntensifiers(t *testing.T) {
+	tests := []struct {
+		plain, intensified string
+	}{
+		{"sedih", "sedih banget"},
+		{"aku sedih", "aku sangat sedih"},
+		{"sad", "very sad"},
+	}
+	for _, tt := range tests {
+		plain, intensified := lexiconScore(t, tt.plain), lexiconScore(t, tt.intensified)
+		if intensified.Score >= plain.Score {
+			t.Errorf("%q = %v, %q = %v; want the intensifier to make it more negative", tt.plain, plain.Score, tt.intensified, intensified.Score)
+		}
+		if intensified.Emotion != models.EmotionSadness {
+			t.Errorf("%q emotion = %s, want sadness", tt.intensified, intensified.Emotion)
+		}
+	}
+
+	if got := lexiconScore(t, "sedihnya sedih sedih sedih sedih sedih sedih banget"); got.Score < -1 {
+		t.Errorf("score = %v, want it clamped to -1..1", got.Score)
+	}
+	if got := lexiconScore(t, "besok aku ke kampus"); got.Score != 0 || got.Emotion != models.EmotionNeutral {
+		t.Errorf("neutral sentence = %+v", got)
+	}
+}
+
+func TestSentimentLanguage(t *testing.T) {
+	tests := map[string]string{
+		"aku capek banget sama semua ini": "id",
+		"I feel so tired of everything":   "en",
+		"gue capek banget, so tired":      "id",
+		"😢":                               "id",
+	}
+	for text, want := range tests {
+		if got := sentimentLanguage(text); got != want {
+			t.Errorf("sentimentLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestAzureSentimentSendsDetectedLanguage(t *testing.T) {
+	var gotLanguage string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Documents []struct {
+				Language string `json:"language"`
+			} `json:"documents"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if len(body.Documents) == 1 {
+			gotLanguage = body.Documents[0].Language
+		}
+		w.Write([]byte(`{"documents":[{"confidenceScores":{"positive":0.1,"negative":0.8}}]}`))
+	}))
+	defer server.Close()
+
+	analyzer := AzureSentimentAnalyzer{Endpoint: server.URL, Key: "key", HTTPClient: server.Client()}
+	for text, want := range map[string]string{"I feel really lonely tonight": "en", "aku kesepian banget malam ini": "id"} {
+		result, err := analyzer.Analyze(context.Background(), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotLanguage != want {
+			t.Errorf("%q sent with language %q, want %q", text, gotLanguage, want)
+		}
+		if result.Score != -0.7 || result.Emotion != models.EmotionLoneliness {
+			t.Errorf("%q = %+v", text, result)
+		}
+	}
+}
+
+func TestMoodDayStartUsesUserTimezone(t *testing.T) {
+	at := time.Date(2026, 3, 1, 20, 30, 0, 0, time.UTC)
+	tests := []struct {
+		timezone string
+		want     string
+	}{
+		{"Asia/Jakarta", "2026-03-02"},        // 03:30 WIB keesokan harinya
+		{"Asia/Makassar", "2026-03-02"},       // 04:30 WITA
+		{"America/Los_Angeles", "2026-03-01"}, // 12:30 PST
+		{"", "2026-03-02"},                    // Zona kosong memakai DefaultTimezone
+		{"Not/AZone", "2026-03-02"},
+	}
+	for _, tt := range tests {
+		start := moodDayStart(at, tt.timezone)
+		if got := start.Format("2006-01-02"); got != tt.want {
+			t.Errorf("moodDayStart(%q) day = %s, want %s", tt.timezone, got, tt.want)
+		}
+		if start.After(at) || !start.AddDate(0, 0, 1).After(at) {
+			t.Errorf("moodDayStart(%q) = %v does not contain %v", tt.timezone, start, at)
+		}
+	}
+}
+
+func TestUpdateMoodMetricBucketsByLocalDay(t *testing.T) {
+	db := testutil.OpenDB(t)
+	user := models.User{Email: "mood@example.com", Timezone: "Asia/Jakarta"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	session := models.ChatSession{UserID: user.ID, TriggerType: "user_initiated"}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 16:30 UTC dan 18:00 UTC jatuh pada dua tanggal berbeda di WIB (23:30 dan 01:00).
+	lateEvening := time.Date(2026, 3, 1, 16, 30, 0, 0, time.UTC)
+	afterMidnight := time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC)
+	for _, m := range []struct {
+		at    time.Time
+		score float64
+	}{{lateEvening, -0.6}, {afterMidnight, 0.4}, {afterMidnight.Add(time.Minute), 0.2}} {
+		score, emotion := m.score, models.EmotionNeutral
+		message := models.ChatMessage{ChatSessionID: session.ID, SenderType: "user", MessageContent: "isi", SentimentScore: &score, EmotionDetected: &emotion, CreatedAt: m.at}
+		if err := db.Create(&message).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tagger := &SentimentTagger{DB: db}
+	for _, at := range []time.Time{lateEvening, afterMidnight} {
+		if err := tagger.updateMoodMetric(user.ID, user.Timezone, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var metrics []models.UserProgressMetric
+	db.Where("user_id = ? AND metric_type = ?", user.ID, models.MetricChatMood).Order("metric_date").Find(&metrics)
+	if len(metrics) != 2 {
+		t.Fatalf("got %d chat_mood metrics, want one per local day", len(metrics))
+	}
+	want := []struct {
+		day   string
+		value float64
+	}{{"2026-03-01", -0.6}, {"2026-03-02", 0.3}}
+	for i, metric := range metrics {
+		if day := metric.MetricDate.Format("2006-01-02"); day != want[i].day || metric.MetricValue != want[i].value {
+			t.Errorf("metric %d = %s %v, want %s %v", i, day, metric.MetricValue, want[i].day, want[i].value)
+		}
+	}
+}
+
+func TestEnqueueSkipsMessagesAlreadyQueued(t *testing.T) {
+	tagger := &SentimentTagger{jobs: make(chan sentimentJob, 2)}
+	user := models.User{ID: uuid.New(), Timezone: "Asia/Jakarta"}
+	first := models.ChatMessage{ID: uuid.New(), SenderType: "user", MessageContent: "capek banget"}
+	second := models.ChatMessage{ID: uuid.New(), SenderType: "user", MessageContent: "lumayan"}
+
+	tagger.Enqueue(first, user)
+	tagger.Enqueue(first, user) // Sweep menemukan pesan yang masih antre
+	tagger.Enqueue(models.ChatMessage{ID: uuid.New(), SenderType: "ai"}, user)
+	if len(tagger.jobs) != 1 {
+		t.Fatalf("queue holds %d jobs, want the first message once", len(tagger.jobs))
+	}
+
+	tagger.Enqueue(second, user)
+	tagger.Enqueue(models.ChatMessage{ID: uuid.New(), SenderType: "user"}, user) // Antrean penuh
+	if len(tagger.jobs) != 2 || len(tagger.queued) != 2 {
+		t.Fatalf("queue = %d jobs, %d reserved; a dropped message must not stay reserved", len(tagger.jobs), len(tagger.queued))
+	}
+
+	// Setelah diproses, pesan yang belum tertandai boleh diantrekan lagi oleh sweep.
+	job := <-tagger.jobs
+	tagger.release(job.MessageID)
+	tagger.Enqueue(first, user)
+	if len(tagger.jobs) != 2 {
+		t.Errorf("released message was not queued again: %d jobs", len(tagger.jobs))
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ErrInvalidSignedToken is returned when a purpose token is malformed, expired,
+// tampered with or issued for a different purpose.
+var ErrInvalidSignedToken = errors.New("signed token is invalid")
+
+// PurposeClaims are carried by short-lived, single-purpose links such as email
+// verification. Binding the email means a token dies if the address changes.
+type PurposeClaims struct {
+	Purpose   string    `json:"purpose"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	Reference string    `json:"ref,omitempty"` // Record the token grants access to, e.g. an export ID
+	jwt.RegisteredClaims
+}
+
+// SignPurposeToken creates an HMAC-signed token for one purpose and user.
+func SignPurposeToken(key []byte, purpose string, userID uuid.UUID, email string, ttl time.Duration) (string, error) {
+	return SignReferenceToken(key, purpose, userID, email, "", ttl)
+}
+
+// SignReferenceToken is SignPurposeToken bound to one specific record.
+func SignReferenceToken(key []byte, purpose string, userID uuid.UUID, email, reference string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := PurposeClaims{
+		Purpose:   purpose,
+		UserID:    userID,
+		Email:     email,
+		Reference: reference,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    "tenang.in",
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// ParsePurposeToken verifies the signature, expiry and purpose of a token.
+func ParsePurposeToken(key []byte, tokenString, purpose string) (*PurposeClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &PurposeClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return key, nil
+	}, jwt.WithIssuer("tenang.in"))
+	if err != nil {
+		return nil, ErrInvalidSignedToken
+	}
+
+	claims, ok := token.Claims.(*PurposeClaims)
+	if !ok || !token.Valid || claims.Purpose != purpose {
+		return nil, ErrInvalidSignedToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// ErrUnknownSigningKey is returned when a token references a kid that is not (or no longer) trusted.
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// Advisory lock id so only one instance rotates keys at a time.
+const signingKeyRotationLock = 727001
+
+// Berapa sering cache kunci dimuat ulang saat token memakai kid yang belum dikenal.
+const signingKeyReloadThrottle = 10 * time.Second
+
+// JSONWebKey is a public key in RFC 7517 format.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JSONWebKeySet is served at /.well-known/jwks.json.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type loadedSigningKey struct {
+	record     models.SigningKey
+	privateKey crypto.PrivateKey
+	publicKey  crypto.PublicKey
+}
+
+// SigningKeyManager keeps the JWT signing keys stored in the database and caches
+// them in memory. Exactly one key signs new tokens; retired keys keep verifying
+// until the longest-lived token they could have signed has expired.
+type SigningKeyManager struct {
+	DB  *gorm.DB
+	Cfg *config.Config
+
+	mu         sync.RWMutex
+	active     *loadedSigningKey
+	verifiers  map[string]*loadedSigningKey
+	lastReload time.Time
+}
+
+// NewSigningKeyManager creates a SigningKeyManager. Call Init before use.
+func NewSigningKeyManager(db *gorm.DB, cfg *config.Config) *SigningKeyManager {
+	return &SigningKeyManager{DB: db, Cfg: cfg, verifiers: map[string]*loadedSigningKey{}}
+}
+
+// Init creates the first key if needed, rotates an overdue key and loads the key set.
+func (m *SigningKeyManager) Init() error {
+	if err := m.rotateIfDue(); err != nil {
+		return err
+	}
+	return m.Reload()
+}
+
+// StartRotation periodically rotates the active key when it is older than
+// KeyRotationInterval, drops expired keys and refreshes the in-memory cache.
+func (m *SigningKeyManager) StartRotation(checkEvery time.Duration) {
+	go func() {
+		ticker := time.NewTicker(checkEvery)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := m.rotateIfDue(); err != nil {
+				log.Printf("ERROR: Signing key rotation failed: %v", err)
+			}
+			if err := m.DB.Where("expires_at < ?", time.Now()).Delete(&models.SigningKey{}).Error; err != nil {
+				log.Printf("ERROR: Failed to delete expired signing keys: %v", err)
+			}
+			if err := m.Reload(); err != nil {
+				log.Printf("ERROR: Failed to reload signing keys: %v", err)
+			}
+		}
+	}()
+}
+
+// Rotate immediately replaces the active key with a new one.
+func (m *SigningKeyManager) Rotate() (*models.SigningKey, error) {
+	var created *models.SigningKey
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyRotationLock).Error; err != nil {
+			return err
+		}
+		var err error
+		created, err = m.rotateLocked(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, m.Reload()
+}
+
+// Reload refreshes the cached keys from the database.
+func (m *SigningKeyManager) Reload() error {
+	var records []models.SigningKey
+	if err := m.DB.Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("activated_at DESC").Find(&records).Error; err != nil {
+		return err
+	}
+
+	verifiers := make(map[string]*loadedSigningKey, len(records))
+	var active *loadedSigningKey
+	for _, record := range records {
+		key, err := m.decode(record)
+		if err != nil {
+			log.Printf("ERROR: Skipping signing key %s: %v", record.KeyID, err)
+			continue
+		}
+		verifiers[record.KeyID] = key
+		if active == nil && record.RetiredAt == nil {
+			active = key
+		}
+	}
+	if active == nil {
+		return errors.New("no active signing key available")
+	}
+
+	m.mu.Lock()
+	m.active = active
+	m.verifiers = verifiers
+	m.lastReload = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+// SigningKey returns the kid, method and private key used to sign new tokens.
+func (m *SigningKeyManager) SigningKey() (string, jwt.SigningMethod, crypto.PrivateKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.active == nil {
+		return "", nil, nil, errors.New("signing keys not initialised")
+	}
+	return m.active.record.KeyID, jwt.GetSigningMethod(m.active.record.Algorithm), m.active.privateKey, nil
+}
+
+// VerificationKey returns the algorithm and public key for a kid. Unknown kids
+// trigger a throttled reload so keys rotated by another instance are picked up.
+func (m *SigningKeyManager) VerificationKey(kid string) (string, crypto.PublicKey, error) {
+	m.mu.RLock()
+	key, ok := m.verifiers[kid]
+	stale := time.Since(m.lastReload) > signingKeyReloadThrottle
+	m.mu.RUnlock()
+
+	if !ok && stale {
+		if err := m.Reload(); err == nil {
+			m.mu.RLock()
+			key, ok = m.verifiers[kid]
+			m.mu.RUnlock()
+		}
+	}
+	if !ok || (key.record.ExpiresAt != nil && time.Now().After(*key.record.ExpiresAt)) {
+		return "", nil, ErrUnknownSigningKey
+	}
+	return key.record.Algorithm, key.publicKey, nil
+}
+
+// JWKS returns every public key that may still verify tokens.
+func (m *SigningKeyManager) JWKS() JSONWebKeySet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(m.verifiers))}
+	for kid, key := range m.verifiers {
+		jwk := JSONWebKey{KeyID: kid, Use: "sig", Algorithm: key.record.Algorithm}
+		switch pub := key.publicKey.(type) {
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.KeyType = "EC"
+			jwk.Curve = pub.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// ListKeys returns metadata of all stored keys, newest first.
+func (m *SigningKeyManager) ListKeys() ([]models.SigningKey, error) {
+	var records []models.SigningKey
+	err := m.DB.Order("activated_at DESC").Find(&records).Error
+	return records, err
+}
+
+// --- internal ---
+
+func (m *SigningKeyManager) rotateIfDue() error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyRotationLock).Error; err != nil {
+			return err
+		}
+
+		var current models.SigningKey
+		err := tx.Where("retired_at IS NULL").Order("activated_at DESC").First(&current).Error
+		if err == nil && time.Since(current.ActivatedAt) < m.Cfg.JWT.KeyRotationInterval &&
+			current.Algorithm == m.Cfg.JWT.SigningAlgorithm {
+			return nil
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		created, err := m.rotateLocked(tx)
+		if err == nil {
+			log.Printf("🔑 New JWT signing key activated (kid=%s, alg=%s)", created.KeyID, created.Algorithm)
+		}
+		return err
+	})
+}
+
+// rotateLocked retires the current key and stores a new one. Caller holds the advisory lock.
+func (m *SigningKeyManager) rotateLocked(tx *gorm.DB) (*models.SigningKey, error) {
+	now := time.Now()
+	// A retired key may have signed a refresh token just before retirement, and other
+	// instances keep signing with it until their next reload; the extra hour covers that.
+	verifyUntil := now.Add(m.Cfg.JWT.RefreshExpiry + m.Cfg.JWT.AccessExpiry + time.Hour)
+	if err := tx.Model(&models.SigningKey{}).Where("retired_at IS NULL").
+		Updates(map[string]interface{}{"retired_at": now, "expires_at": verifyUntil}).Error; err != nil {
+		return nil, err
+	}
+
+	record, err := m.generate(m.Cfg.JWT.SigningAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	record.ActivatedAt = now
+	if err := tx.Create(record).Error; err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (m *SigningKeyManager) generate(algorithm string) (*models.SigningKey, error) {
+	var privateKey crypto.Signer
+	var err error
+	switch algorithm {
+	case "ES256":
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "RS256":
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := EncryptString(m.Cfg.Security.EncryptionKey, string(privateDER))
+	if err != nil {
+		return nil, err
+	}
+
+	kid, _, err := GenerateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		KeyID:               kid[:16],
+		Algorithm:           algorithm,
+		PrivateKeyEncrypted: encrypted,
+		PublicKeyPEM:        string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+func (m *SigningKeyManager) decode(record models.SigningKey) (*loadedSigningKey, error) {
+	privateDER, err := DecryptWithMasterKeys(m.Cfg.Security, record.PrivateKeyEncrypted)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey([]byte(privateDER))
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("stored key is not a signing key")
+	}
+	return &loadedSigningKey{record: record, privateKey: privateKey, publicKey: signer.Public()}, nil
+}
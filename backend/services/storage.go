@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidStorageKey is returned for keys that would escape the storage root.
+var ErrInvalidStorageKey = errors.New("invalid storage key")
+
+// FileStorage stores publicly served files such as avatars. Keys are slash-separated
+// paths; URL returns where clients can fetch the file.
+type FileStorage interface {
+	Put(key string, data []byte, contentType string) error
+	Delete(key string) error
+	URL(key string) string
+}
+
+// LocalStorage keeps files on disk under Root, which must be served at BaseURL.
+type LocalStorage struct {
+	Root    string
+	BaseURL string
+}
+
+// NewLocalStorage creates a LocalStorage.
+func NewLocalStorage(root, baseURL string) *LocalStorage {
+	return &LocalStorage{Root: root, BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Put writes data to key, replacing any existing file.
+func (s *LocalStorage) Put(key string, data []byte, contentType string) error {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	// Tulis ke file sementara lalu rename, agar klien tidak pernah membaca file setengah jadi.
+	tmp := fullPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fullPath)
+}
+
+// Delete removes key. Missing files are not an error.
+func (s *LocalStorage) Delete(key string) error {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// URL returns the public URL of key.
+func (s *LocalStorage) URL(key string) string {
+	return s.BaseURL + "/" + strings.TrimLeft(path.Clean("/"+key), "/")
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "..") {
+		return "", ErrInvalidStorageKey
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(cleaned)), nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidTimezone is returned for names that are not in the IANA tz database.
+var ErrInvalidTimezone = errors.New("timezone must be an IANA time zone name, e.g. Asia/Jakarta")
+
+// ValidateTimezone checks name against the tz database embedded in the binary
+// (time/tzdata), so the result does not depend on the host's zoneinfo files.
+func ValidateTimezone(name string) error {
+	// "Local" adalah zona waktu server, bukan zona waktu pengguna.
+	if name == "" || name == "Local" {
+		return ErrInvalidTimezone
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return ErrInvalidTimezone
+	}
+	return nil
+}
+
+// NextCheckinTrigger returns the first occurrence after now of timeOfDay (wall clock
+// in loc) on one of daysOfWeek (0 = Sunday), in UTC. Days are stepped with time.Date
+// so the wall-clock time is kept across DST changes; a time that does not exist on a
+// spring-forward day is moved forward by the length of the gap.
+func NextCheckinTrigger(timeOfDay time.Time, daysOfWeek []int64, loc *time.Location, now time.Time) (time.Time, bool) {
+	local := now.In(loc)
+	for i := 0; i <= 7; i++ {
+		candidate := wallClock(local.Year(), local.Month(), local.Day()+i, timeOfDay.Hour(), timeOfDay.Minute(), loc)
+		if !candidate.After(now) {
+			continue
+		}
+		for _, day := range daysOfWeek {
+			if day == int64(candidate.Weekday()) {
+				return candidate.UTC(), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// wallClock is time.Date, except that a wall-clock time skipped by a DST change is
+// resolved with the offset in force before the change, i.e. moved forward by the gap.
+// time.Date leaves the choice of offset unspecified in that case.
+func wallClock(year int, month time.Month, day, hour, minute int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, minute, 0, 0, loc)
+	if t.Hour() == hour && t.Minute() == minute {
+		return t
+	}
+	_, offsetBefore := t.Add(-12 * time.Hour).Zone()
+	return time.Date(year, month, day, hour, minute, 0, 0, time.FixedZone("", offsetBefore)).In(loc)
+}
+
+// RescheduleCheckins recomputes NextTriggerAt for every active check-in of the user,
+// e.g. after they change time zone.
+func RescheduleCheckins(db *gorm.DB, userID uuid.UUID, timezone string) error {
+	var checkins []models.ScheduledCheckin
+	if err := db.Where("user_id = ? AND is_active = ?", userID, true).Find(&checkins).Error; err != nil {
+		return err
+	}
+	loc := UserLocation(timezone)
+	now := time.Now()
+	for _, checkin := range checkins {
+		var next *time.Time
+		if at, ok := NextCheckinTrigger(checkin.TimeOfDay, checkin.DaysOfWeek, loc, now); ok {
+			next = &at
+		}
+		if err := db.Model(&models.ScheduledCheckin{}).Where("id = ?", checkin.ID).Update("next_trigger_at", next).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"backend/models"
+	"backend/testutil"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func clock(hour, minute int) time.Time {
+	return time.Date(0, 1, 1, hour, minute, 0, 0, time.UTC)
+}
+
+func TestNextCheckinTrigger(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	jakarta := mustLoadLocation(t, "Asia/Jakarta")
+
+	tests := []struct {
+		name      string
+		timeOfDay time.Time
+		days      []int64
+		loc       *time.Location
+		now       time.Time
+		want      time.Time
+	}{
+		{
+			// 8 Maret 2026 pukul 02:00 EST melompat ke 03:00 EDT; 02:30 tidak ada hari itu.
+			name: "spring-forward gap moves forward by the gap", timeOfDay: clock(2, 30), days: []int64{0}, loc: newYork,
+			now:  time.Date(2026, 3, 7, 12, 0, 0, 0, newYork),
+			want: time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC), // 03:30 EDT
+		},
+		{
+			name: "wall clock kept after spring-forward", timeOfDay: clock(9, 0), days: []int64{1}, loc: newYork,
+			now:  time.Date(2026, 3, 7, 12, 0, 0, 0, newYork),
+			want: time.Date(2026, 3, 9, 13, 0, 0, 0, time.UTC), // 09:00 EDT
+		},
+		{
+			// 1 November 2026 pukul 01:00–02:00 terjadi dua kali; check-in hanya sekali, pada yang pertama.
+			name: "fall-back repeat fires on the first occurrence", timeOfDay: clock(1, 30), days: []int64{0}, loc: newYork,
+			now:  time.Date(2026, 10, 31, 12, 0, 0, 0, newYork),
+			want: time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+		},
+		{
+			name: "fall-back repeat does not fire again", timeOfDay: clock(1, 30), days: []int64{0}, loc: newYork,
+			now:  time.Date(2026, 11, 1, 5, 31, 0, 0, time.UTC), // 01:31 EDT, sebelum jam mundur
+			want: time.Date(2026, 11, 8, 6, 30, 0, 0, time.UTC), // 01:30 EST minggu depannya
+		},
+		{
+			name: "day-of-week wraps past Saturday", timeOfDay: clock(8, 0), days: []int64{1}, loc: jakarta,
+			now:  time.Date(2026, 3, 7, 22, 0, 0, 0, jakarta), // Sabtu
+			want: time.Date(2026, 3, 9, 1, 0, 0, 0, time.UTC), // Senin 08:00 WIB
+		},
+		{
+			name: "same weekday already passed wraps a full week", timeOfDay: clock(8, 0), days: []int64{0}, loc: jakarta,
+			now:  time.Date(2026, 3, 8, 9, 0, 0, 0, jakarta), // Minggu, setelah 08:00
+			want: time.Date(2026, 3, 15, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "later today", timeOfDay: clock(20, 0), days: []int64{0, 1, 2, 3, 4, 5, 6}, loc: jakarta,
+			now:  time.Date(2026, 3, 8, 9, 0, 0, 0, jakarta),
+			want: time.Date(2026, 3, 8, 13, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NextCheckinTrigger(tt.timeOfDay, tt.days, tt.loc, tt.now)
+			if !ok || !got.Equal(tt.want) {
+				t.Errorf("NextCheckinTrigger = %v (%v), want %v", got, ok, tt.want)
+			}
+			if got.Location() != time.UTC {
+				t.Errorf("location = %v, want UTC", got.Location())
+			}
+		})
+	}
+
+	if _, ok := NextCheckinTrigger(clock(8, 0), nil, jakarta, time.Now()); ok {
+		t.Error("check-in without days returned a trigger")
+	}
+}
+
+func TestValidateTimezone(t *testing.T) {
+	for _, name := range []string{"", "Local", "Mars/Olympus", "GMT+7"} {
+		if err := ValidateTimezone(name); !errors.Is(err, ErrInvalidTimezone) {
+			t.Errorf("ValidateTimezone(%q) = %v, want ErrInvalidTimezone", name, err)
+		}
+	}
+	for _, name := range []string{"Asia/Jakarta", "America/New_York", "UTC"} {
+		if err := ValidateTimezone(name); err != nil {
+			t.Errorf("ValidateTimezone(%q) = %v", name, err)
+		}
+	}
+}
+
+func TestRescheduleCheckinsUsesNewTimezone(t *testing.T) {
+	db := testutil.OpenDB(t)
+	user := models.User{ID: uuid.New(), Email: "rani@example.com", IsActive: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	everyDay := pq.Int64Array{0, 1, 2, 3, 4, 5, 6}
+	active := models.ScheduledCheckin{UserID: user.ID, TimeOfDay: clock(8, 0), DaysOfWeek: everyDay, IsActive: true}
+	paused := models.ScheduledCheckin{UserID: user.ID, TimeOfDay: clock(8, 0), DaysOfWeek: everyDay, IsActive: true}
+	db.Create(&active)
+	db.Create(&paused)
+	db.Model(&paused).Update("is_active", false)
+
+	if err := RescheduleCheckins(db, user.ID, "America/New_York"); err != nil {
+		t.Fatal(err)
+	}
+
+	db.First(&active, "id = ?", active.ID)
+	db.First(&paused, "id = ?", paused.ID)
+	if active.NextTriggerAt == nil {
+		t.Fatal("active check-in was not rescheduled")
+	}
+	if local := active.NextTriggerAt.In(mustLoadLocation(t, "America/New_York")); local.Hour() != 8 || local.Minute() != 0 {
+		t.Errorf("next trigger = %v in New York, want 08:00", local)
+	}
+	if paused.NextTriggerAt != nil {
+		t.Errorf("paused check-in got next trigger %v", paused.NextTriggerAt)
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// TrustedContactPurpose is the purpose of signed links sent to a new trusted contact.
+const TrustedContactPurpose = "trusted_contact_verify"
+
+// TrustedContacts sends and records trusted contacts' consent to be reached in a crisis.
+type TrustedContacts struct {
+	DB    *gorm.DB
+	Cfg   *config.Config
+	Email *EmailService
+}
+
+// NewTrustedContacts creates a new TrustedContacts.
+func NewTrustedContacts(db *gorm.DB, cfg *config.Config) *TrustedContacts {
+	return &TrustedContacts{DB: db, Cfg: cfg, Email: NewEmailService(cfg.Email)}
+}
+
+// SendVerification emails the contact a signed link to accept or decline exactly the
+// scopes currently requested. The scopes are part of the signed reference, so a later
+// change of scopes needs a new link.
+func (t *TrustedContacts) SendVerification(contact models.TrustedContact, user models.User) error {
+	scopes := append([]string(nil), contact.Scopes...)
+	sort.Strings(scopes)
+	reference := contact.ID.String() + ":" + strings.Join(scopes, ",")
+	token, err := SignReferenceToken(t.Cfg.JWT.EncryptionKey, TrustedContactPurpose, user.ID, contact.Email, reference, t.Cfg.Security.TrustedContactLinkExpiry)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/trusted-contact?token=%s", t.Cfg.Server.FrontendURL, url.QueryEscape(token))
+
+	body := fmt.Sprintf("Halo %s,\n\n"+
+		"%s menambahkan Anda sebagai kontak tepercaya di Tenang.in, aplikasi pendamping kesehatan mental. "+
+		"Jika Anda setuju, kami dapat menghubungi Anda saat ia membutuhkan dukungan:\n\n%s\n"+
+		"Kami tidak pernah membagikan isi percakapan atau jurnal. Anda dapat menerima atau menolak melalui tautan berikut:\n\n%s\n\n"+
+		"Tautan berlaku sampai %s. Jika Anda tidak mengenal permintaan ini, abaikan email ini.\n\n"+
+		"Salam hangat,\nTim Tenang.in 🌸",
+		contact.Name, DisplayName(user), describeScopes(contact.Scopes), link,
+		time.Now().Add(t.Cfg.Security.TrustedContactLinkExpiry).Format("02 Jan 2006 15:04 MST"))
+	if err := t.Email.Send(EmailMessage{To: contact.Email, Subject: DisplayName(user) + " menambahkan Anda sebagai kontak tepercaya", TextBody: body}); err != nil {
+		return err
+	}
+	now := time.Now()
+	return t.DB.Model(&models.TrustedContact{}).Where("id = ?", contact.ID).Update("verification_sent_at", now).Error
+}
+
+// Respond records the contact's decision from a signed verification link. Only scopes
+// that were in the link and are still requested are consented to.
+func (t *TrustedContacts) Respond(token string, accept bool, ip, userAgent string) (*models.TrustedContact, error) {
+	claims, err := ParsePurposeToken(t.Cfg.JWT.EncryptionKey, token, TrustedContactPurpose)
+	if err != nil {
+		return nil, err
+	}
+	idPart, scopePart, _ := strings.Cut(claims.Reference, ":")
+	contactID, err := uuid.Parse(idPart)
+	if err != nil {
+		return nil, ErrInvalidSignedToken
+	}
+
+	var contact models.TrustedContact
+	if err := t.DB.Where("id = ? AND user_id = ? AND email = ?", contactID, claims.UserID, claims.Email).First(&contact).Error; err != nil {
+		return nil, ErrInvalidSignedToken // Kontak sudah dihapus oleh pengguna
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"responded_at": now}
+	if accept {
+		linkScopes := map[string]bool{}
+		for _, s := range strings.Split(scopePart, ",") {
+			linkScopes[s] = true
+		}
+		consented := pq.StringArray{}
+		for _, s := range contact.Scopes {
+			if linkScopes[s] {
+				consented = append(consented, s)
+			}
+		}
+		updates["status"] = models.TrustedContactVerified
+		updates["consented_scopes"] = consented
+	} else {
+		updates["status"] = models.TrustedContactDeclined
+		updates["consented_scopes"] = pq.StringArray{}
+	}
+	if err := t.DB.Model(&models.TrustedContact{}).Where("id = ?", contact.ID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	contact.Status = updates["status"].(string)
+	contact.ConsentedScopes = updates["consented_scopes"].(pq.StringArray)
+	contact.RespondedAt = &now
+
+	RecordAudit(t.DB, AuditEntry{
+		Action: "trusted_contact_" + contact.Status, TableName: "trusted_contacts", RecordID: &contact.ID,
+		NewValues: map[string]interface{}{"user_id": contact.UserID, "consented_scopes": contact.ConsentedScopes},
+		IPAddress: ip, UserAgent: userAgent,
+	})
+	return &contact, nil
+}
+
+// DisplayName is how a user is named in messages sent to other people.
+func DisplayName(user models.User) string {
+	switch {
+	case user.FullName != nil && *user.FullName != "":
+		return *user.FullName
+	case user.Username != nil && *user.Username != "":
+		return *user.Username
+	default:
+		return user.Email
+	}
+}
+
+func describeScopes(scopes []string) string {
+	descriptions := map[string]string{
+		models.ContactScopeCrisisAlerts:  "- Dihubungi bila tim atau sistem kami mengonfirmasi ia sedang dalam krisis",
+		models.ContactScopePanicAlerts:   "- Dihubungi bila ia menekan tombol darurat di aplikasi",
+		models.ContactScopeShareLocation: "- Menerima lokasi yang ia bagikan saat keadaan darurat",
+	}
+	var lines []string
+	for _, s := range scopes {
+		if d, ok := descriptions[s]; ok {
+			lines = append(lines, d)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}